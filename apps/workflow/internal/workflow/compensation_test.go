@@ -0,0 +1,115 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/domain"
+)
+
+// newCompensatedTask logs message and is undone by a log task logging undo,
+// itemTaskExecutor fails messages starting with fail
+func newCompensatedTask(t *testing.T, name, message, undo string, next ...*domain.Task) *domain.Task {
+	t.Helper()
+	compensation, err := domain.NewTask("undo "+name, domain.TaskTypeLog, 0, 0, "", domain.Join{}, "",
+		&domain.LogPayload{Message: undo}, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create compensation task: %v", err)
+	}
+	task, err := domain.NewTask(name, domain.TaskTypeLog, 0, 0, "", domain.Join{}, "",
+		&domain.LogPayload{Message: message}, next, nil, compensation)
+	if err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+	return task
+}
+
+func assertCompensated(t *testing.T, e *domain.Execution, task *domain.Task, want domain.TaskStatus) {
+	t.Helper()
+	c := e.Compensations[task.ID]
+	if c == nil {
+		t.Fatalf("task %s was not compensated", task.Name)
+	}
+	if c.Status != want || c.TaskID != task.Compensation.ID || c.Compensates != task.ID {
+		t.Errorf("got compensation of task %s %s by %s, want %s by %s", task.Name, c.Status, c.TaskID, want, task.Compensation.ID)
+	}
+}
+
+func TestFailedRunCompensatesCompletedTasks(t *testing.T) {
+	never := newCompensatedTask(t, "never", "never", "undone")
+	failing := newFailingTask(t, "fail boom", "", nil, never)
+	second := newCompensatedTask(t, "second", "second", "undone", failing)
+	first := newCompensatedTask(t, "first", "first", "undone", second)
+
+	e, events, err := newTestExecutor(&itemTaskExecutor{}).run(context.Background(), newTestWorkflow(t, first), nil)
+	if err == nil || e.Status != domain.WorkflowStatusFailed {
+		t.Fatalf("got status %s with error %v, want %s", e.Status, err, domain.WorkflowStatusFailed)
+	}
+	assertTaskStatus(t, e, never, domain.TaskStatusCancelled)
+	if _, ok := e.Compensations[never.ID]; ok {
+		t.Errorf("task %s was compensated without completing", never.Name)
+	}
+	assertCompensated(t, e, first, domain.TaskStatusCompleted)
+	assertCompensated(t, e, second, domain.TaskStatusCompleted)
+
+	// the last completed task is undone first
+	var order []string
+	for _, ev := range events {
+		if ev.Compensates != "" && ev.TaskStatus == domain.TaskStatusRunning {
+			order = append(order, ev.Compensates)
+		}
+	}
+	if len(order) != 2 || order[0] != second.ID || order[1] != first.ID {
+		t.Errorf("got compensations of %v, want %s then %s", order, second.ID, first.ID)
+	}
+}
+
+func TestCancelledRunCompensatesCompletedTasks(t *testing.T) {
+	slow := newCompensatedTask(t, "slow", "100", "undone")
+	first := newCompensatedTask(t, "first", "first", "undone", slow)
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	time.AfterFunc(200*time.Millisecond, func() { cancel(&domain.CancelError{Reason: "test"}) })
+	e, _, err := newTestExecutor(&itemTaskExecutor{}).run(ctx, newTestWorkflow(t, first), nil)
+	if !errors.Is(err, domain.ErrExecutionCancelled) || e.Status != domain.WorkflowStatusCancelled {
+		t.Fatalf("got status %s with error %v, want %s", e.Status, err, domain.WorkflowStatusCancelled)
+	}
+	assertTaskStatus(t, e, slow, domain.TaskStatusCancelled)
+	assertCompensated(t, e, first, domain.TaskStatusCompleted)
+	if _, ok := e.Compensations[slow.ID]; ok {
+		t.Errorf("task %s was compensated without completing", slow.Name)
+	}
+}
+
+func TestFailedCompensationIsAddedToTheError(t *testing.T) {
+	failing := newFailingTask(t, "fail boom", "", nil)
+	second := newCompensatedTask(t, "second", "second", "undone", failing)
+	first := newCompensatedTask(t, "first", "first", "fail undo", second)
+
+	e, _, err := newTestExecutor(&itemTaskExecutor{}).run(context.Background(), newTestWorkflow(t, first), nil)
+	if err == nil || !strings.Contains(err.Error(), "fail boom") || !strings.HasSuffix(err.Error(), "1 compensation(s) failed") {
+		t.Fatalf("got error %v, want the task error and the failed compensation", err)
+	}
+	// a failed compensation does not stop the others
+	assertCompensated(t, e, first, domain.TaskStatusFailed)
+	assertCompensated(t, e, second, domain.TaskStatusCompleted)
+	if e.Error != err.Error() {
+		t.Errorf("got execution error %q, want %q", e.Error, err)
+	}
+}
+
+func TestCompletedRunIsNotCompensated(t *testing.T) {
+	first := newCompensatedTask(t, "first", "first", "undone")
+
+	e, _, err := newTestExecutor(&itemTaskExecutor{}).run(context.Background(), newTestWorkflow(t, first), nil)
+	if err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if len(e.Compensations) != 0 {
+		t.Errorf("got compensations %v for a completed run", e.Compensations)
+	}
+}
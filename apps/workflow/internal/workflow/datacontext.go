@@ -0,0 +1,121 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/domain"
+	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/expression"
+)
+
+// dataContext holds the data produced during a single workflow run, task
+// conditions and payload placeholders are evaluated against it
+type dataContext struct {
+	mu     sync.RWMutex
+	inputs map[string]interface{}
+	tasks  map[string]interface{}
+}
+
+func newDataContext(inputs map[string]interface{}) *dataContext {
+	if inputs == nil {
+		inputs = map[string]interface{}{}
+	}
+	return &dataContext{
+		inputs: inputs,
+		tasks:  map[string]interface{}{},
+	}
+}
+
+// setTaskResult records a finished task, it can be looked up by id or by name
+func (dc *dataContext) setTaskResult(t *domain.Task, status domain.TaskStatus, output interface{}) error {
+	value, err := toPlainValue(output)
+	if err != nil {
+		return fmt.Errorf("failed to store output of task %s: %w", t.ID, err)
+	}
+	dc.set(t, map[string]interface{}{
+		"id":     t.ID,
+		"name":   t.Name,
+		"status": string(status),
+		"output": value,
+		"error":  "",
+	})
+	return nil
+}
+
+// setTaskFailure records a task that failed without failing the run, the
+// error is what its on failure task handles
+func (dc *dataContext) setTaskFailure(t *domain.Task, err string) {
+	dc.set(t, map[string]interface{}{
+		"id":     t.ID,
+		"name":   t.Name,
+		"status": string(domain.TaskStatusFailed),
+		"output": nil,
+		"error":  err,
+	})
+}
+
+func (dc *dataContext) set(t *domain.Task, entry map[string]interface{}) {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	dc.tasks[t.ID] = entry
+	dc.tasks[t.Name] = entry
+}
+
+// vars returns a snapshot of the context to evaluate expressions with,
+// predecessors are the tasks exposed as upstream
+func (dc *dataContext) vars(predecessors []*domain.Task) map[string]interface{} {
+	dc.mu.RLock()
+	defer dc.mu.RUnlock()
+	tasks := make(map[string]interface{}, len(dc.tasks))
+	for k, v := range dc.tasks {
+		tasks[k] = v
+	}
+	upstream := make(map[string]interface{}, len(predecessors)*2)
+	for _, p := range predecessors {
+		if entry, ok := dc.tasks[p.ID]; ok {
+			upstream[p.ID] = entry
+			upstream[p.Name] = entry
+		}
+	}
+	return map[string]interface{}{
+		expression.VarInputs:   dc.inputs,
+		expression.VarTasks:    tasks,
+		expression.VarUpstream: upstream,
+	}
+}
+
+// evalCondition reports whether the task should run
+func evalCondition(ctx context.Context, t *domain.Task, vars map[string]interface{}) (bool, error) {
+	if t.Condition == "" {
+		return true, nil
+	}
+	expr, err := expression.CompileBool(t.Condition)
+	if err != nil {
+		return false, fmt.Errorf("invalid condition for task %s (name: %s): %w", t.ID, t.Name, err)
+	}
+	ok, err := expr.EvalBool(ctx, vars)
+	if err != nil {
+		return false, fmt.Errorf("failed to evaluate condition for task %s (name: %s): %w", t.ID, t.Name, err)
+	}
+	return ok, nil
+}
+
+// toPlainValue converts a task output into plain JSON values (maps, slices,
+// strings, float64, bool and nil) so expressions can navigate it
+func toPlainValue(v interface{}) (interface{}, error) {
+	switch v.(type) {
+	case nil, string, bool, float64:
+		return v, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var out interface{}
+	if err := json.Unmarshal(b, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
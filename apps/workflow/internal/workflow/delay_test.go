@@ -0,0 +1,122 @@
+package workflow
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/domain"
+)
+
+func newDelayTask(t *testing.T, name string, d time.Duration, next ...*domain.Task) *domain.Task {
+	t.Helper()
+	p, err := domain.NewDelayPayload(d, "", "", "")
+	if err != nil {
+		t.Fatalf("failed to create delay payload: %v", err)
+	}
+	task, err := domain.NewTask(name, domain.TaskTypeDelay, 0, 0, "", domain.Join{}, "", p, next, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create task %s: %v", name, err)
+	}
+	return task
+}
+
+// resume continues an execution the way the server does after a restart
+// and returns the events it streamed
+func (te *testExecutor) resume(ctx context.Context, w *domain.Workflow, e *domain.Execution) ([]*domain.ExecutionEvent, error) {
+	if err := te.repo.CreateExecution(e); err != nil {
+		return nil, err
+	}
+	eventCh := make(chan *domain.ExecutionEvent)
+	var events []*domain.ExecutionEvent
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for ev := range eventCh {
+			events = append(events, ev)
+		}
+	}()
+	err := te.Resume(ctx, w, e, eventCh)
+	close(eventCh)
+	<-done
+	return events, err
+}
+
+func TestResumeWaitsForDelayUntilItWasDue(t *testing.T) {
+	after := newLogTask(t, "after", 0, 0)
+	wait := newDelayTask(t, "wait", time.Hour, after)
+	first := newLogTask(t, "first", 0, 0, wait)
+	w := newTestWorkflow(t, first)
+
+	// the server stopped while the delay was waiting
+	wakeAt := time.Now().Add(100 * time.Millisecond).UTC()
+	e := domain.NewExecution(w, nil)
+	e.Status = domain.WorkflowStatusRunning
+	*e.Tasks[first.ID] = domain.TaskExecution{TaskID: first.ID, TaskName: first.Name,
+		Status: domain.TaskStatusCompleted, Attempts: 1, Output: "first"}
+	*e.Tasks[wait.ID] = domain.TaskExecution{TaskID: wait.ID, TaskName: wait.Name,
+		Status: domain.TaskStatusRunning, Attempts: 1, WakeAt: wakeAt}
+
+	fe := &flakyTaskExecutor{}
+	start := time.Now()
+	if _, err := newTestExecutor(fe).resume(context.Background(), w, e); err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+	// the delay keeps its wake time instead of waiting an hour again
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond || elapsed > 5*time.Second {
+		t.Errorf("resume took %v, want the delay to end at its wake time", elapsed)
+	}
+	if e.Status != domain.WorkflowStatusCompleted {
+		t.Fatalf("got status %s, want %s", e.Status, domain.WorkflowStatusCompleted)
+	}
+	if out, ok := e.Tasks[wait.ID].Output.(*domain.DelayResult); !ok || !out.WakeAt.Equal(wakeAt) {
+		t.Errorf("got delay output %v, want wake time %v", e.Tasks[wait.ID].Output, wakeAt)
+	}
+	// finished tasks are not run again
+	if len(fe.attempts["first"]) != 0 || len(fe.attempts["after"]) != 1 {
+		t.Errorf("got attempts %v, want only after to run", fe.attempts)
+	}
+	assertTaskStatus(t, e, after, domain.TaskStatusCompleted)
+}
+
+func TestResumeFailsInterruptedTasks(t *testing.T) {
+	first := newLogTask(t, "first", 0, 0)
+	w := newTestWorkflow(t, first)
+
+	// a task cut off mid attempt may have had side effects, it is not rerun
+	e := domain.NewExecution(w, nil)
+	e.Status = domain.WorkflowStatusRunning
+	e.Tasks[first.ID].Status = domain.TaskStatusRunning
+	fe := &flakyTaskExecutor{}
+	_, err := newTestExecutor(fe).resume(context.Background(), w, e)
+	if err == nil || !strings.Contains(err.Error(), "interrupted") {
+		t.Fatalf("got error %v, want the interrupted task to fail the execution", err)
+	}
+	if e.Status != domain.WorkflowStatusFailed || len(fe.attempts["first"]) != 0 {
+		t.Errorf("got status %s and attempts %v", e.Status, fe.attempts)
+	}
+}
+
+func TestRunTimeoutOnlyPausesWhileEveryTaskWaits(t *testing.T) {
+	expired := make(chan struct{})
+	rt := newRunTimeout(50*time.Millisecond, func(error) { close(expired) })
+	defer rt.stop()
+
+	// a lone delay stops the clock
+	rt.begin()
+	rt.pause()
+	select {
+	case <-expired:
+		t.Fatalf("the run timed out while its only task waited")
+	case <-time.After(150 * time.Millisecond):
+	}
+
+	// another task running in a parallel branch starts it again
+	rt.begin()
+	select {
+	case <-expired:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("the run did not time out while a task was running")
+	}
+}
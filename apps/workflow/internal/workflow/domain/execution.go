@@ -0,0 +1,284 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ExecutionDefaultPageSize = 20
+	ExecutionMaxPageSize     = 100
+	ExecutionMaxReasonLength = 500
+	// SubworkflowMaxDepth bounds how deep subworkflow tasks can nest
+	// executions, recursive workflows included
+	SubworkflowMaxDepth = 5
+)
+
+// ErrExecutionCancelled is the cause of executions stopped on request
+var ErrExecutionCancelled = errors.New("execution cancelled")
+
+// CancelError is the error executions cancelled on request finish with
+type CancelError struct {
+	Reason string
+}
+
+// NewCancelError validates the reason given to cancel an execution
+func NewCancelError(reason string) (*CancelError, error) {
+	if len([]rune(reason)) > ExecutionMaxReasonLength {
+		return nil, fmt.Errorf("reason cannot be longer than %d characters", ExecutionMaxReasonLength)
+	}
+	return &CancelError{Reason: reason}, nil
+}
+
+func (e *CancelError) Error() string {
+	if e.Reason == "" {
+		return ErrExecutionCancelled.Error()
+	}
+	return fmt.Sprintf("%s: %s", ErrExecutionCancelled, e.Reason)
+}
+
+func (e *CancelError) Unwrap() error {
+	return ErrExecutionCancelled
+}
+
+// ParsePageToken returns the offset encoded in a page token
+func ParsePageToken(token string) (int, error) {
+	if token == "" {
+		return 0, nil
+	}
+	offset, err := strconv.Atoi(token)
+	if err != nil || offset < 0 {
+		return 0, fmt.Errorf("invalid page token")
+	}
+	return offset, nil
+}
+
+// NextPageToken returns the token of the page after the one starting at
+// offset, or an empty string when there are no more results
+func NextPageToken(offset, pageSize, returned int, more bool) string {
+	if !more || returned < pageSize {
+		return ""
+	}
+	return strconv.Itoa(offset + returned)
+}
+
+// Execution is a single run of a workflow, it holds all the state produced
+// by the run so the workflow definition itself is never modified
+type Execution struct {
+	ID         string
+	WorkflowID string
+	Status     WorklowStatus
+	Inputs     map[string]interface{}
+	Tasks      map[string]*TaskExecution // by task id
+	StartedAt  time.Time
+	EndedAt    time.Time // zero while the execution is running
+	Error      string
+	// TriggeredBy is the execution whose completion started this one
+	TriggeredBy string
+	// TriggerChain holds the workflows of the executions that led to this
+	// one through completion triggers, oldest first
+	TriggerChain []string
+	// ParentExecutionID and ParentTaskID are the execution and subworkflow
+	// task that started this one, Depth is how many parents it has
+	ParentExecutionID string
+	ParentTaskID      string
+	Depth             int
+	// Compensations holds the compensations run after the execution failed
+	// or was cancelled, by id of the task they undo
+	Compensations map[string]*TaskExecution
+}
+
+// TaskExecution is the state of a task within an execution
+type TaskExecution struct {
+	TaskID    string
+	TaskName  string
+	Status    TaskStatus
+	Attempts  int
+	Output    interface{}
+	Error     string
+	StartedAt time.Time // zero until the first attempt starts
+	EndedAt   time.Time // zero until the task finishes
+	// WakeAt is when a running DELAY task is due, it is kept so that the
+	// wait survives a server restart
+	WakeAt time.Time
+	// Compensates is the task a compensation undoes, empty for the tasks of
+	// the workflow
+	Compensates string
+}
+
+// ExecutionFilter selects executions when listing them, zero fields match everything
+type ExecutionFilter struct {
+	WorkflowID    string
+	Status        WorklowStatus
+	StartedAfter  time.Time
+	StartedBefore time.Time
+	PageSize      int
+	PageToken     string // returned by the previous page, empty for the first one
+}
+
+// ExecutionRepository persists the history of workflow executions
+type ExecutionRepository interface {
+	CreateExecution(e *Execution) error
+	UpdateExecution(e *Execution) error
+	UpdateTaskExecution(executionID string, t *TaskExecution) error
+	GetExecution(id string) (*Execution, error)
+	// ListExecutions returns the executions matching the filter, most recent
+	// first, and the token of the next page or an empty string on the last one
+	ListExecutions(f ExecutionFilter) ([]*Execution, string, error)
+	AppendExecutionEvent(ev *ExecutionEvent) error
+	// ListExecutionEvents returns the events of an execution with a sequence
+	// number greater or equal to fromSeq, in order
+	ListExecutionEvents(executionID string, fromSeq int64) ([]*ExecutionEvent, error)
+}
+
+// NewExecutionFilter validates the filter and applies the default page size
+func NewExecutionFilter(workflowID string, status WorklowStatus, startedAfter, startedBefore time.Time,
+	pageSize int, pageToken string) (ExecutionFilter, error) {
+	if pageSize < 0 || pageSize > ExecutionMaxPageSize {
+		return ExecutionFilter{}, fmt.Errorf("page size must be between 0 and %d", ExecutionMaxPageSize)
+	}
+	if pageSize == 0 {
+		pageSize = ExecutionDefaultPageSize
+	}
+	if !startedAfter.IsZero() && !startedBefore.IsZero() && startedBefore.Before(startedAfter) {
+		return ExecutionFilter{}, fmt.Errorf("started before cannot be earlier than started after")
+	}
+	return ExecutionFilter{
+		WorkflowID:    workflowID,
+		Status:        status,
+		StartedAfter:  startedAfter,
+		StartedBefore: startedBefore,
+		PageSize:      pageSize,
+		PageToken:     pageToken,
+	}, nil
+}
+
+// NewExecution creates an idle execution with a pending entry for every task of the workflow
+func NewExecution(w *Workflow, inputs map[string]interface{}) *Execution {
+	e := &Execution{
+		ID:         uuid.NewString(),
+		WorkflowID: w.ID,
+		Status:     WorkflowStatusIDLE,
+		Inputs:     inputs,
+		Tasks:      make(map[string]*TaskExecution),
+		StartedAt:  time.Now().UTC(),
+
+		Compensations: make(map[string]*TaskExecution),
+	}
+	var visit func(tasks []*Task)
+	visit = func(tasks []*Task) {
+		for _, t := range tasks {
+			if _, ok := e.Tasks[t.ID]; ok {
+				continue
+			}
+			e.Tasks[t.ID] = &TaskExecution{
+				TaskID:   t.ID,
+				TaskName: t.Name,
+				Status:   TaskStatusPending,
+			}
+			visit(t.Successors())
+		}
+	}
+	visit(w.Tasks)
+	return e
+}
+
+// Clone returns a deep copy of the execution state, outputs are shared
+// since they are never modified once set
+func (e *Execution) Clone() *Execution {
+	out := *e
+	out.Tasks = make(map[string]*TaskExecution, len(e.Tasks))
+	for id, t := range e.Tasks {
+		tc := *t
+		out.Tasks[id] = &tc
+	}
+	out.Compensations = make(map[string]*TaskExecution, len(e.Compensations))
+	for id, t := range e.Compensations {
+		tc := *t
+		out.Compensations[id] = &tc
+	}
+	return &out
+}
+
+// SetParent links the execution to the subworkflow task of the parent
+// execution that starts it
+func (e *Execution) SetParent(parent *Execution, taskID string) error {
+	if parent.Depth+1 > SubworkflowMaxDepth {
+		return fmt.Errorf("subworkflows cannot be nested more than %d levels deep", SubworkflowMaxDepth)
+	}
+	e.ParentExecutionID = parent.ID
+	e.ParentTaskID = taskID
+	e.Depth = parent.Depth + 1
+	return nil
+}
+
+// Outputs returns the outputs of the completed tasks by task name
+func (e *Execution) Outputs() map[string]interface{} {
+	outputs := make(map[string]interface{})
+	for _, te := range e.Tasks {
+		if te.Status == TaskStatusCompleted {
+			outputs[te.TaskName] = te.Output
+		}
+	}
+	return outputs
+}
+
+// NextTriggerChain returns the trigger chain of the executions this one triggers
+func (e *Execution) NextTriggerChain() []string {
+	chain := make([]string, 0, len(e.TriggerChain)+1)
+	chain = append(chain, e.TriggerChain...)
+	return append(chain, e.WorkflowID)
+}
+
+// CanTrigger checks that this execution may start the given workflow
+// through a completion trigger without looping or chaining too deep
+func (e *Execution) CanTrigger(workflowID string) error {
+	chain := e.NextTriggerChain()
+	if len(chain) >= TriggerMaxChainDepth {
+		return fmt.Errorf("trigger chain cannot be longer than %d executions", TriggerMaxChainDepth)
+	}
+	for _, id := range chain {
+		if id == workflowID {
+			return fmt.Errorf("trigger loop detected: workflow %s already ran in this chain", workflowID)
+		}
+	}
+	return nil
+}
+
+func (e *Execution) String() string {
+	return fmt.Sprintf("Id %s, Workflow %s, Status %s", e.ID, e.WorkflowID, e.Status)
+}
+
+// ExecutionEvent is a progress update streamed while an execution runs,
+// task fields are empty for workflow level events
+type ExecutionEvent struct {
+	Seq            int64 // position of the event within the execution, starting at 1
+	ExecutionID    string
+	WorkflowID     string
+	WorkflowStatus WorklowStatus
+	TaskID         string
+	TaskStatus     TaskStatus
+	Output         interface{}
+	Error          string
+	Attempt        int
+	MaxAttempts    int
+	TotalTasks     int
+	ExecutedTasks  int
+	// Join is how the task waits for its predecessors, nil for workflow
+	// level events
+	Join *Join
+	// ItemIndex is the position of the map item the event is about, nil for
+	// events about whole tasks
+	ItemIndex *int
+	// Iteration is the loop iteration the event is about, starting at 1, nil
+	// for events about whole tasks
+	Iteration *int
+	// Compensates is the task undone by the compensation the event is
+	// about, TaskID is then the compensation task
+	Compensates string
+	Time        time.Time
+}
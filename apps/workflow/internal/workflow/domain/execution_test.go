@@ -0,0 +1,60 @@
+package domain
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewExecutionFilter(t *testing.T) {
+	now := time.Now()
+	if f, err := NewExecutionFilter("", "", time.Time{}, time.Time{}, 0, ""); err != nil || f.PageSize != ExecutionDefaultPageSize {
+		t.Errorf("got %+v, %v, want the default page size", f, err)
+	}
+	if _, err := NewExecutionFilter("", "", time.Time{}, time.Time{}, ExecutionMaxPageSize+1, ""); err == nil {
+		t.Errorf("expected a page size over the maximum to be rejected")
+	}
+	if _, err := NewExecutionFilter("", "", now, now.Add(-time.Hour), 0, ""); err == nil {
+		t.Errorf("expected an inverted time range to be rejected")
+	}
+}
+
+func TestPageTokens(t *testing.T) {
+	if _, err := ParsePageToken("-1"); err == nil {
+		t.Errorf("expected a negative offset to be rejected")
+	}
+	if offset, err := ParsePageToken(NextPageToken(20, 10, 10, true)); err != nil || offset != 30 {
+		t.Errorf("got offset %d, %v, want 30", offset, err)
+	}
+	if token := NextPageToken(20, 10, 4, true); token != "" {
+		t.Errorf("got token %q for a short page, want none", token)
+	}
+}
+
+func TestNewCancelError(t *testing.T) {
+	cause, err := NewCancelError("stop")
+	if err != nil {
+		t.Fatalf("new cancel error: %v", err)
+	}
+	if !errors.Is(cause, ErrExecutionCancelled) || cause.Error() != "execution cancelled: stop" {
+		t.Errorf("got %q, want a cancellation with its reason", cause)
+	}
+	if _, err := NewCancelError(strings.Repeat("x", ExecutionMaxReasonLength+1)); err == nil {
+		t.Errorf("expected a reason over the maximum length to be rejected")
+	}
+}
+
+func TestExecutionSetParent(t *testing.T) {
+	parent := &Execution{ID: "p", Depth: SubworkflowMaxDepth - 1}
+	e := &Execution{ID: "c"}
+	if err := e.SetParent(parent, "sub"); err != nil {
+		t.Fatalf("set parent: %v", err)
+	}
+	if e.ParentExecutionID != "p" || e.ParentTaskID != "sub" || e.Depth != SubworkflowMaxDepth {
+		t.Errorf("got parent %s, task %s and depth %d", e.ParentExecutionID, e.ParentTaskID, e.Depth)
+	}
+	if err := (&Execution{ID: "g"}).SetParent(e, "sub"); err == nil {
+		t.Errorf("expected nesting past depth %d to be rejected", SubworkflowMaxDepth)
+	}
+}
@@ -0,0 +1,132 @@
+package domain
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	FileWatchPatternMaxLength = 100
+	FileWatchDefaultDebounce  = time.Second
+	FileWatchMaxDebounce      = time.Minute
+	FileWatchMaxPerWorkflow   = 10
+)
+
+// inputs a file event fills, only the ones the workflow declares are passed
+const (
+	FileWatchInputPath    = "path"
+	FileWatchInputSize    = "size"
+	FileWatchInputModTime = "modTime" // RFC 3339
+)
+
+// FileWatch starts a run of a workflow for every file created or modified
+// in a local directory whose name matches a glob pattern
+type FileWatch struct {
+	ID         string
+	WorkflowID string
+	Dir        string // absolute path, subdirectories are not watched
+	Pattern    string // matched against the file name, such as *.csv
+	// Debounce is how long a file must go without changes before it fires,
+	// so that a file still being written starts a single run
+	Debounce time.Duration
+	// ArchiveDir is where files are moved to before their run starts, the
+	// run then receives the archived path, files are left in place when empty
+	ArchiveDir string
+	CreatedAt  time.Time
+}
+
+type FileWatchRepository interface {
+	CreateFileWatch(fw *FileWatch) error
+	// ListFileWatches returns the file watches of a workflow, or every file
+	// watch when workflowID is empty, oldest first
+	ListFileWatches(workflowID string) ([]*FileWatch, error)
+	DeleteFileWatch(id string) error
+}
+
+func NewFileWatch(workflowID, dir, pattern string, debounce time.Duration, archiveDir string) (*FileWatch, error) {
+	if workflowID == "" {
+		return nil, fmt.Errorf("workflow id cannot be empty")
+	}
+	if !filepath.IsAbs(dir) {
+		return nil, fmt.Errorf("directory must be an absolute path")
+	}
+	dir = filepath.Clean(dir)
+	if pattern == "" {
+		pattern = "*"
+	}
+	if len(pattern) > FileWatchPatternMaxLength {
+		return nil, fmt.Errorf("pattern cannot be longer than %d characters", FileWatchPatternMaxLength)
+	}
+	if strings.ContainsRune(pattern, filepath.Separator) {
+		return nil, fmt.Errorf("pattern is matched against file names and cannot contain %c", filepath.Separator)
+	}
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid pattern: %w", err)
+	}
+	if debounce == 0 {
+		debounce = FileWatchDefaultDebounce
+	}
+	if debounce < 0 || debounce > FileWatchMaxDebounce {
+		return nil, fmt.Errorf("debounce must be between 0 and %v", FileWatchMaxDebounce)
+	}
+	if archiveDir != "" {
+		if !filepath.IsAbs(archiveDir) {
+			return nil, fmt.Errorf("archive directory must be an absolute path")
+		}
+		archiveDir = filepath.Clean(archiveDir)
+		if archiveDir == dir {
+			return nil, fmt.Errorf("archive directory must differ from the watched directory")
+		}
+	}
+	return &FileWatch{
+		ID:         uuid.NewString(),
+		WorkflowID: workflowID,
+		Dir:        dir,
+		Pattern:    pattern,
+		Debounce:   debounce,
+		ArchiveDir: archiveDir,
+		CreatedAt:  time.Now().UTC(),
+	}, nil
+}
+
+// Match reports whether a file name matches the pattern of the watch
+func (fw *FileWatch) Match(name string) bool {
+	ok, _ := filepath.Match(fw.Pattern, name)
+	return ok
+}
+
+func (fw *FileWatch) Clone() *FileWatch {
+	out := *fw
+	return &out
+}
+
+func (fw *FileWatch) String() string {
+	return fmt.Sprintf("Id %s, Workflow %s, Dir %s, Pattern %s", fw.ID, fw.WorkflowID, fw.Dir, fw.Pattern)
+}
+
+// FileEvent is a file picked up by a file watch
+type FileEvent struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+}
+
+// Inputs returns the run inputs of the event for the inputs the workflow declares
+func (e FileEvent) Inputs(w *Workflow) map[string]interface{} {
+	values := map[string]interface{}{
+		FileWatchInputPath:    e.Path,
+		FileWatchInputSize:    float64(e.Size),
+		FileWatchInputModTime: e.ModTime.UTC().Format(time.RFC3339Nano),
+	}
+	inputs := make(map[string]interface{})
+	for _, in := range w.Inputs {
+		if v, ok := values[in.Name]; ok {
+			inputs[in.Name] = v
+		}
+	}
+	return inputs
+}
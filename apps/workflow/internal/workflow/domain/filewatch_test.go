@@ -0,0 +1,63 @@
+package domain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewFileWatch(t *testing.T) {
+	fw, err := NewFileWatch("w", "/data/in/", "", 0, "/data/done")
+	if err != nil {
+		t.Fatalf("new file watch: %v", err)
+	}
+	if fw.Dir != "/data/in" || fw.Pattern != "*" || fw.Debounce != FileWatchDefaultDebounce {
+		t.Errorf("got %+v, want the defaults applied", fw)
+	}
+	tests := []struct {
+		name, dir, pattern string
+		debounce           time.Duration
+		archiveDir         string
+	}{
+		{"relative dir", "data/in", "*", 0, ""},
+		{"pattern with a separator", "/data/in", "sub/*.csv", 0, ""},
+		{"invalid pattern", "/data/in", "[", 0, ""},
+		{"negative debounce", "/data/in", "*", -time.Second, ""},
+		{"debounce over the maximum", "/data/in", "*", FileWatchMaxDebounce + time.Second, ""},
+		{"relative archive dir", "/data/in", "*", 0, "done"},
+		{"archive in the watched dir", "/data/in", "*", 0, "/data/in/"},
+	}
+	for _, tt := range tests {
+		if _, err := NewFileWatch("w", tt.dir, tt.pattern, tt.debounce, tt.archiveDir); err == nil {
+			t.Errorf("%s: expected the file watch to be rejected", tt.name)
+		}
+	}
+}
+
+func TestFileWatchMatch(t *testing.T) {
+	fw, err := NewFileWatch("w", "/data", "*.csv", 0, "")
+	if err != nil {
+		t.Fatalf("new file watch: %v", err)
+	}
+	for name, want := range map[string]bool{"a.csv": true, ".csv": true, "a.csv.tmp": false, "a.txt": false} {
+		if got := fw.Match(name); got != want {
+			t.Errorf("%s: got match %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestFileEventInputs(t *testing.T) {
+	var inputs []*Input
+	for _, name := range []string{FileWatchInputPath, FileWatchInputModTime} {
+		in, err := NewInput(name, InputTypeString, false, nil, "")
+		if err != nil {
+			t.Fatalf("new input: %v", err)
+		}
+		inputs = append(inputs, in)
+	}
+	ev := FileEvent{Path: "/data/a.csv", Size: 3, ModTime: time.Date(2026, 1, 1, 1, 0, 0, 0, time.FixedZone("X", 3600))}
+	got := ev.Inputs(&Workflow{Inputs: inputs})
+	// only the declared inputs, the size is left out
+	if len(got) != 2 || got[FileWatchInputPath] != "/data/a.csv" || got[FileWatchInputModTime] != "2026-01-01T00:00:00Z" {
+		t.Errorf("got inputs %v", got)
+	}
+}
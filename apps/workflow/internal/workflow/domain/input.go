@@ -0,0 +1,150 @@
+package domain
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+)
+
+type InputType string
+
+const (
+	InputTypeUnspecified InputType = "UNSPECIFIED"
+	InputTypeString      InputType = "STRING"
+	InputTypeNumber      InputType = "NUMBER"
+	InputTypeBool        InputType = "BOOL"
+	InputTypeObject      InputType = "OBJECT"
+	InputTypeList        InputType = "LIST"
+)
+
+const (
+	InputNameMaxLength        = 30
+	InputDescriptionMaxLength = 100
+)
+
+// input names must be valid identifiers so expressions can use inputs.<name>
+var inputNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Input declares a parameter a workflow run accepts
+type Input struct {
+	Name        string
+	Type        InputType
+	Required    bool
+	Default     interface{} // used when the value is not provided, nil means no default
+	Description string
+}
+
+func NewInput(name string, inputType InputType, required bool, defaultValue interface{}, description string) (*Input, error) {
+	if name == "" {
+		return nil, fmt.Errorf("input name cannot be empty")
+	}
+	if len([]rune(name)) > InputNameMaxLength {
+		return nil, fmt.Errorf("input name cannot be longer than %d characters", InputNameMaxLength)
+	}
+	if !inputNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("input name %s must start with a letter or underscore and only contain letters, digits and underscores", name)
+	}
+	if len([]rune(description)) > InputDescriptionMaxLength {
+		return nil, fmt.Errorf("input description cannot be longer than %d characters", InputDescriptionMaxLength)
+	}
+	switch inputType {
+	case InputTypeString, InputTypeNumber, InputTypeBool, InputTypeObject, InputTypeList:
+	default:
+		return nil, fmt.Errorf("invalid type for input %s", name)
+	}
+	in := &Input{
+		Name:        name,
+		Type:        inputType,
+		Required:    required,
+		Description: description,
+	}
+	if defaultValue != nil {
+		v, err := in.validate(defaultValue)
+		if err != nil {
+			return nil, fmt.Errorf("invalid default for input %s: %w", name, err)
+		}
+		in.Default = v
+	}
+	return in, nil
+}
+
+// validate checks that v matches the input type. Whole numbers are normalized
+// to int64 and fractional ones to float64, so expressions can do integer
+// arithmetic such as inputs.n + 1 and need a double for inputs.x + 0.5
+func (in *Input) validate(v interface{}) (interface{}, error) {
+	switch in.Type {
+	case InputTypeString:
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+	case InputTypeNumber:
+		switch n := v.(type) {
+		case float64:
+			return normalizeNumber(n), nil
+		case float32:
+			return normalizeNumber(float64(n)), nil
+		case int:
+			return int64(n), nil
+		case int32:
+			return int64(n), nil
+		case int64:
+			return n, nil
+		}
+	case InputTypeBool:
+		if b, ok := v.(bool); ok {
+			return b, nil
+		}
+	case InputTypeObject:
+		if m, ok := v.(map[string]interface{}); ok {
+			return m, nil
+		}
+	case InputTypeList:
+		if l, ok := v.([]interface{}); ok {
+			return l, nil
+		}
+	}
+	return nil, fmt.Errorf("expected a value of type %s, got %T", in.Type, v)
+}
+
+// normalizeNumber returns whole numbers that fit in an int64 as int64
+func normalizeNumber(n float64) interface{} {
+	if n == math.Trunc(n) && n >= math.MinInt64 && n < math.MaxInt64 {
+		return int64(n)
+	}
+	return n
+}
+
+// ResolveInputs validates the values of a run against the workflow inputs
+// and fills in the defaults of the ones that were not provided
+func (w *Workflow) ResolveInputs(values map[string]interface{}) (map[string]interface{}, error) {
+	declared := make(map[string]*Input, len(w.Inputs))
+	for _, in := range w.Inputs {
+		declared[in.Name] = in
+	}
+	for name := range values {
+		if _, ok := declared[name]; !ok {
+			return nil, fmt.Errorf("unknown input %s", name)
+		}
+	}
+	resolved := make(map[string]interface{}, len(w.Inputs))
+	for _, in := range w.Inputs {
+		v, ok := values[in.Name]
+		if !ok || v == nil {
+			if in.Default != nil {
+				resolved[in.Name] = in.Default
+				continue
+			}
+			if in.Required {
+				return nil, fmt.Errorf("missing required input %s", in.Name)
+			}
+			resolved[in.Name] = nil
+			continue
+		}
+		v, err := in.validate(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid input %s: %w", in.Name, err)
+		}
+		resolved[in.Name] = v
+	}
+	return resolved, nil
+}
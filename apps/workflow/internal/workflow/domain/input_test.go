@@ -0,0 +1,98 @@
+package domain
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func newTestInput(t *testing.T, name string, inputType InputType, required bool, defaultValue interface{}) *Input {
+	t.Helper()
+	in, err := NewInput(name, inputType, required, defaultValue, "")
+	if err != nil {
+		t.Fatalf("failed to create input %s: %v", name, err)
+	}
+	return in
+}
+
+func TestNewInput(t *testing.T) {
+	tests := []struct {
+		name         string
+		inputType    InputType
+		defaultValue interface{}
+		err          string
+	}{
+		{"count", InputTypeNumber, 3.0, ""},
+		{"_private", InputTypeString, nil, ""},
+		{"", InputTypeString, nil, "cannot be empty"},
+		{"1st", InputTypeString, nil, "must start with a letter"},
+		{"user-id", InputTypeString, nil, "must start with a letter"},
+		{"flag", InputTypeUnspecified, nil, "invalid type"},
+		{"flag", InputTypeBool, "yes", "invalid default"},
+		{"items", InputTypeList, map[string]interface{}{}, "invalid default"},
+	}
+	for _, tt := range tests {
+		_, err := NewInput(tt.name, tt.inputType, false, tt.defaultValue, "")
+		if tt.err == "" && err != nil {
+			t.Errorf("input %q: unexpected error %v", tt.name, err)
+		}
+		if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("input %q: got error %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestResolveInputs(t *testing.T) {
+	w := &Workflow{Inputs: []*Input{
+		newTestInput(t, "name", InputTypeString, true, nil),
+		newTestInput(t, "retries", InputTypeNumber, false, 3.0),
+		newTestInput(t, "verbose", InputTypeBool, false, nil),
+	}}
+
+	got, err := w.ResolveInputs(map[string]interface{}{"name": "neurun"})
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	want := map[string]interface{}{"name": "neurun", "retries": int64(3), "verbose": nil}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#v, want %#v", got, want)
+	}
+
+	errs := []struct {
+		values map[string]interface{}
+		err    string
+	}{
+		{map[string]interface{}{}, "missing required input name"},
+		{map[string]interface{}{"name": "a", "other": 1}, "unknown input other"},
+		{map[string]interface{}{"name": 1.0}, "invalid input name"},
+		{map[string]interface{}{"name": "a", "retries": "3"}, "invalid input retries"},
+	}
+	for _, tt := range errs {
+		_, err := w.ResolveInputs(tt.values)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("values %v: got error %v, want %q", tt.values, err, tt.err)
+		}
+	}
+}
+
+func TestResolveInputsNormalizesNumbers(t *testing.T) {
+	w := &Workflow{Inputs: []*Input{newTestInput(t, "n", InputTypeNumber, true, nil)}}
+	tests := []struct {
+		value interface{}
+		want  interface{}
+	}{
+		{2.0, int64(2)},
+		{int32(2), int64(2)},
+		{2.5, 2.5},
+		{1e300, 1e300},
+	}
+	for _, tt := range tests {
+		got, err := w.ResolveInputs(map[string]interface{}{"n": tt.value})
+		if err != nil {
+			t.Fatalf("resolve %v: %v", tt.value, err)
+		}
+		if got["n"] != tt.want {
+			t.Errorf("value %v: got %#v, want %#v", tt.value, got["n"], tt.want)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package domain
+
+import "fmt"
+
+// JoinMode decides when a task with several predecessors runs
+type JoinMode string
+
+const (
+	// JoinAll waits for every predecessor, the task runs if any of them completed
+	JoinAll JoinMode = "ALL"
+	// JoinAny runs the task as soon as one predecessor completed
+	JoinAny JoinMode = "ANY"
+	// JoinQuorum runs the task as soon as Quorum predecessors completed
+	JoinQuorum JoinMode = "QUORUM"
+)
+
+// Join is how a task waits for its predecessors. Tasks that cannot reach
+// the number of completed predecessors they need are skipped
+type Join struct {
+	Mode   JoinMode
+	Quorum int // predecessors that must complete, only for QUORUM
+	// CancelRemaining cancels the predecessors that have not finished once an
+	// ANY or QUORUM join runs, they keep running otherwise. Predecessors that
+	// lead to other tasks as well always keep running
+	CancelRemaining bool
+}
+
+func NewJoin(mode JoinMode, quorum int, cancelRemaining bool) (Join, error) {
+	switch mode {
+	case "":
+		mode = JoinAll
+	case JoinAll, JoinAny, JoinQuorum:
+	default:
+		return Join{}, fmt.Errorf("invalid join mode %s", mode)
+	}
+	if mode == JoinQuorum && quorum < 1 {
+		return Join{}, fmt.Errorf("quorum must be at least 1")
+	}
+	if mode != JoinQuorum && quorum != 0 {
+		return Join{}, fmt.Errorf("quorum is only used with the %s join mode", JoinQuorum)
+	}
+	if mode == JoinAll && cancelRemaining {
+		return Join{}, fmt.Errorf("cancel remaining cannot be used with the %s join mode", JoinAll)
+	}
+	return Join{Mode: mode, Quorum: quorum, CancelRemaining: cancelRemaining}, nil
+}
+
+// Needed returns how many predecessors must complete for the task to run
+func (j Join) Needed() int {
+	if j.Mode == JoinQuorum {
+		return j.Quorum
+	}
+	return 1
+}
+
+// Early reports whether the task may run before every predecessor finished
+func (j Join) Early() bool {
+	return j.Mode == JoinAny || j.Mode == JoinQuorum
+}
+
+// validateJoins checks that quorums can be reached by the predecessors of
+// their tasks
+func validateJoins(tasks []*Task) error {
+	predecessors := make(map[string]int)
+	visited := make(map[string]bool)
+	var all []*Task
+	var visit func(tasks []*Task)
+	visit = func(tasks []*Task) {
+		for _, t := range tasks {
+			if visited[t.ID] {
+				continue
+			}
+			visited[t.ID] = true
+			all = append(all, t)
+			for _, next := range t.Successors() {
+				predecessors[next.ID]++
+			}
+			visit(t.Successors())
+		}
+	}
+	visit(tasks)
+	for _, t := range all {
+		if t.Join.Mode == JoinQuorum && t.Join.Quorum > predecessors[t.ID] {
+			return fmt.Errorf("task %s has a quorum of %d but only %d predecessors", t.Name, t.Join.Quorum, predecessors[t.ID])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package domain
+
+import "testing"
+
+func TestNewJoin(t *testing.T) {
+	tests := []struct {
+		name            string
+		mode            JoinMode
+		quorum          int
+		cancelRemaining bool
+		valid           bool
+	}{
+		{"default", "", 0, false, true},
+		{"any cancelling the rest", JoinAny, 0, true, true},
+		{"quorum", JoinQuorum, 2, false, true},
+		{"unknown mode", "SOME", 0, false, false},
+		{"quorum without a count", JoinQuorum, 0, false, false},
+		{"count without quorum", JoinAny, 2, false, false},
+		{"all cancelling the rest", JoinAll, 0, true, false},
+	}
+	for _, tt := range tests {
+		j, err := NewJoin(tt.mode, tt.quorum, tt.cancelRemaining)
+		if (err == nil) != tt.valid {
+			t.Errorf("%s: got error %v, want valid %t", tt.name, err, tt.valid)
+		}
+		if err == nil && j.Mode == "" {
+			t.Errorf("%s: got an empty mode", tt.name)
+		}
+	}
+}
+
+func TestWorkflowRejectsUnreachableQuorums(t *testing.T) {
+	newTask := func(name string, join Join, next ...*Task) *Task {
+		task, err := NewTask(name, TaskTypeLog, 0, 0, "", join, "", &LogPayload{Message: name}, next, nil, nil)
+		if err != nil {
+			t.Fatalf("failed to create task %s: %v", name, err)
+		}
+		return task
+	}
+	for _, quorum := range []int{2, 3} {
+		join, err := NewJoin(JoinQuorum, quorum, false)
+		if err != nil {
+			t.Fatalf("failed to create join: %v", err)
+		}
+		j := newTask("join", join)
+		_, err = NewWorkflow("test", "", nil, []*Task{newTask("a", Join{}, j), newTask("b", Join{}, j)})
+		if valid := quorum <= 2; (err == nil) != valid {
+			t.Errorf("quorum of %d with 2 predecessors: got error %v, want valid %t", quorum, err, valid)
+		}
+	}
+}
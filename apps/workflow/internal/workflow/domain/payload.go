@@ -3,8 +3,12 @@ package domain
 import (
 	"fmt"
 	"net/url"
+	"os/user"
+	"strconv"
 	"strings"
 	"time"
+
+	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/expression"
 )
 
 type Payload interface {
@@ -12,7 +16,14 @@ type Payload interface {
 }
 
 type LogPayload struct {
-	Message string
+	Message string // may reference upstream data with {{ expression }} placeholders
+}
+
+func NewLogPayload(message string) (*LogPayload, error) {
+	if err := validateTemplate(message); err != nil {
+		return nil, fmt.Errorf("invalid message: %w", err)
+	}
+	return &LogPayload{Message: message}, nil
 }
 
 func (l *LogPayload) Type() TaskType {
@@ -33,6 +44,9 @@ const (
 	HTTPApiKeyLocationQuery  HTTPApiKeyLocation = "QUERY"
 )
 
+// HTTPPayload describes an HTTP request, the URL, body, header and query
+// param values and auth credentials may contain {{ expression }} placeholders.
+// A zero ExpectedStatusCode accepts any 2xx status
 type HTTPPayload struct {
 	URL                string
 	Method             string
@@ -50,6 +64,13 @@ func (h *HTTPPayload) Type() TaskType {
 	return TaskTypeHTTP
 }
 
+// HTTPResponse is the output produced by an HTTP task
+type HTTPResponse struct {
+	StatusCode int               `json:"statusCode"`
+	Headers    map[string]string `json:"headers"`
+	Body       interface{}       `json:"body"` // decoded JSON when the response is JSON, otherwise a string
+}
+
 func NewHTTPPayload(urlStr, method string, body []byte, headers, queryParams map[string]string,
 	timeout time.Duration, auth HTTPAuthType, followRedirects, verifySSL bool,
 	expectedStatusCode int32) (*HTTPPayload, error) {
@@ -57,7 +78,12 @@ func NewHTTPPayload(urlStr, method string, body []byte, headers, queryParams map
 	if urlStr == "" {
 		return nil, fmt.Errorf("URL cannot be empty")
 	}
-	if _, err := url.Parse(urlStr); err != nil {
+	if expression.IsTemplate(urlStr) {
+		// the rendered URL is validated when the task is executed
+		if err := validateTemplate(urlStr); err != nil {
+			return nil, fmt.Errorf("invalid URL: %w", err)
+		}
+	} else if _, err := url.Parse(urlStr); err != nil {
 		return nil, fmt.Errorf("invalid URL: %w", err)
 	}
 	if method == "" {
@@ -78,7 +104,7 @@ func NewHTTPPayload(urlStr, method string, body []byte, headers, queryParams map
 	if timeout < HTTPMinTimeout || timeout > HTTPMaxTimeout {
 		return nil, fmt.Errorf("timeout must be between %d and %d", HTTPMinTimeout, HTTPMaxTimeout)
 	}
-	if expectedStatusCode < HTTPMinStatusCode || expectedStatusCode > HTTPMaxStatusCode {
+	if expectedStatusCode != 0 && (expectedStatusCode < HTTPMinStatusCode || expectedStatusCode > HTTPMaxStatusCode) {
 		return nil, fmt.Errorf("invalid HTTP status code: %d", expectedStatusCode)
 	}
 	if auth != nil {
@@ -86,6 +112,19 @@ func NewHTTPPayload(urlStr, method string, body []byte, headers, queryParams map
 			return nil, fmt.Errorf("invalid auth: %w", err)
 		}
 	}
+	if err := validateTemplate(string(body)); err != nil {
+		return nil, fmt.Errorf("invalid body: %w", err)
+	}
+	for k, v := range headers {
+		if err := validateTemplate(v); err != nil {
+			return nil, fmt.Errorf("invalid header %s: %w", k, err)
+		}
+	}
+	for k, v := range queryParams {
+		if err := validateTemplate(v); err != nil {
+			return nil, fmt.Errorf("invalid query param %s: %w", k, err)
+		}
+	}
 	if headers == nil {
 		headers = make(map[string]string)
 	}
@@ -116,10 +155,12 @@ func validateHTTPAuth(auth HTTPAuthType) error {
 		if a.Password == "" {
 			return fmt.Errorf("basic auth password cannot be empty")
 		}
+		return validateTemplate(a.Username, a.Password)
 	case *HTTPBearerAuth:
 		if a.Token == "" {
 			return fmt.Errorf("bearer token cannot be empty")
 		}
+		return validateTemplate(a.Token)
 	case *HTTPApiKeyAuth:
 		if a.Key == "" {
 			return fmt.Errorf("API key name cannot be empty")
@@ -130,9 +171,22 @@ func validateHTTPAuth(auth HTTPAuthType) error {
 		if a.Location != HTTPApiKeyLocationHeader && a.Location != HTTPApiKeyLocationQuery {
 			return fmt.Errorf("invalid API key location")
 		}
+		return validateTemplate(a.Value)
 	default:
 		return fmt.Errorf("unknown auth type")
 	}
+}
+
+// validateTemplate checks the {{ expression }} placeholders of the given strings
+func validateTemplate(values ...string) error {
+	for _, v := range values {
+		if !expression.IsTemplate(v) {
+			continue
+		}
+		if _, err := expression.ParseTemplate(v); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -166,3 +220,586 @@ type HTTPApiKeyAuth struct {
 func (h *HTTPApiKeyAuth) Type() string {
 	return HTTPApiKeyAuthType
 }
+
+const (
+	ShellMaxTimeout           = 10 * time.Minute
+	ShellMaxArgs              = 100
+	ShellDefaultMaxOutputSize = 1 << 20 // 1 MiB
+	ShellMaxOutputSize        = 10 << 20
+	ShellMinMemory            = 16 << 20 // below this most commands cannot even start
+	ShellMinOpenFiles         = 8
+	ShellUserMaxLength        = 32
+)
+
+// limits a shell command can be killed for exceeding
+const (
+	ShellLimitTimeout   = "TIMEOUT"
+	ShellLimitCPUTime   = "CPU_TIME"
+	ShellLimitMemory    = "MEMORY"
+	ShellLimitOpenFiles = "OPEN_FILES"
+)
+
+// ShellLimits restricts the resources of a shell command, zero values mean
+// no limit. They are only enforced on Linux, where CPU time, memory and
+// open files map to RLIMIT_CPU, RLIMIT_AS and RLIMIT_NOFILE: a command over
+// its CPU time is killed, one over its memory or open files sees its
+// allocations or opens fail instead, which is reported as exceeding the
+// limit when the command fails with the matching error
+type ShellLimits struct {
+	CPUTime     time.Duration // rounded up to whole seconds
+	MemoryBytes int64         // address space of the command
+	OpenFiles   uint64
+	// User runs the command as another user, by name or uid, which needs
+	// the engine to run as root
+	User string
+	// NewNamespaces runs the command in new PID, IPC, UTS and mount namespaces
+	NewNamespaces bool
+}
+
+func (l ShellLimits) validate() error {
+	if l.CPUTime < 0 || l.CPUTime > ShellMaxTimeout {
+		return fmt.Errorf("CPU time must be between 0 and %v", ShellMaxTimeout)
+	}
+	if l.MemoryBytes < 0 || (l.MemoryBytes > 0 && l.MemoryBytes < ShellMinMemory) {
+		return fmt.Errorf("memory cannot be less than %d bytes", ShellMinMemory)
+	}
+	if l.OpenFiles > 0 && l.OpenFiles < ShellMinOpenFiles {
+		return fmt.Errorf("open files cannot be less than %d", ShellMinOpenFiles)
+	}
+	if len(l.User) > ShellUserMaxLength {
+		return fmt.Errorf("user cannot be longer than %d characters", ShellUserMaxLength)
+	}
+	if l.User != "" && isRootUser(l.User) {
+		return fmt.Errorf("user must be unprivileged")
+	}
+	return nil
+}
+
+// lookupUser resolves user names, tests replace it to fake accounts
+var lookupUser = user.Lookup
+
+// isRootUser reports whether a user name or uid resolves to uid 0, however
+// it is spelled. Unknown users are left to fail when the command runs
+func isRootUser(name string) bool {
+	if uid, err := strconv.ParseUint(name, 10, 32); err == nil && uid == 0 {
+		return true
+	}
+	u, err := lookupUser(name)
+	if err != nil {
+		return false
+	}
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	return err == nil && uid == 0
+}
+
+// ShellPayload runs a command directly, without a shell, so arguments are
+// never split or expanded. Args, working dir, env values and stdin may
+// contain {{ expression }} placeholders, the command itself may not
+type ShellPayload struct {
+	Command    string
+	Args       []string
+	WorkingDir string // defaults to the working directory of the server
+	// Env is the whole environment of the command besides PATH, the
+	// environment of the server is not passed on
+	Env           map[string]string
+	Stdin         string
+	Timeout       time.Duration // zero means the command is only bound by the workflow context
+	MaxOutputSize int64         // bytes kept of stdout and of stderr, the rest is dropped
+	Limits        ShellLimits
+}
+
+func (s *ShellPayload) Type() TaskType {
+	return TaskTypeShell
+}
+
+// ShellResult is the output produced by a shell task
+type ShellResult struct {
+	ExitCode  int    `json:"exitCode"`
+	Stdout    string `json:"stdout"`
+	Stderr    string `json:"stderr"`
+	Truncated bool   `json:"truncated"` // whether stdout or stderr went over the max output size
+	Killed    bool   `json:"killed"`    // whether the command was ended by a signal
+	// LimitExceeded is the limit that ended the command, if any
+	LimitExceeded string `json:"limitExceeded,omitempty"`
+}
+
+func NewShellPayload(command string, args []string, workingDir string, env map[string]string,
+	stdin string, timeout time.Duration, maxOutputSize int64, limits ShellLimits) (*ShellPayload, error) {
+
+	if command == "" {
+		return nil, fmt.Errorf("command cannot be empty")
+	}
+	if expression.IsTemplate(command) {
+		return nil, fmt.Errorf("command cannot contain placeholders, use args instead")
+	}
+	if len(args) > ShellMaxArgs {
+		return nil, fmt.Errorf("cannot have more than %d args", ShellMaxArgs)
+	}
+	for i, a := range args {
+		if err := validateTemplate(a); err != nil {
+			return nil, fmt.Errorf("invalid arg %d: %w", i, err)
+		}
+	}
+	if err := validateTemplate(workingDir); err != nil {
+		return nil, fmt.Errorf("invalid working directory: %w", err)
+	}
+	for k, v := range env {
+		if k == "" || strings.ContainsAny(k, "=\x00") {
+			return nil, fmt.Errorf("invalid environment variable name %q", k)
+		}
+		if err := validateTemplate(v); err != nil {
+			return nil, fmt.Errorf("invalid environment variable %s: %w", k, err)
+		}
+	}
+	if err := validateTemplate(stdin); err != nil {
+		return nil, fmt.Errorf("invalid stdin: %w", err)
+	}
+	if timeout < 0 || timeout > ShellMaxTimeout {
+		return nil, fmt.Errorf("timeout must be between 0 and %v", ShellMaxTimeout)
+	}
+	if maxOutputSize == 0 {
+		maxOutputSize = ShellDefaultMaxOutputSize
+	}
+	if maxOutputSize < 0 || maxOutputSize > ShellMaxOutputSize {
+		return nil, fmt.Errorf("max output size must be between 1 and %d bytes", ShellMaxOutputSize)
+	}
+	if err := limits.validate(); err != nil {
+		return nil, fmt.Errorf("invalid limits: %w", err)
+	}
+	if args == nil {
+		args = []string{}
+	}
+	if env == nil {
+		env = make(map[string]string)
+	}
+
+	return &ShellPayload{
+		Command:       command,
+		Args:          args,
+		WorkingDir:    workingDir,
+		Env:           env,
+		Stdin:         stdin,
+		Timeout:       timeout,
+		MaxOutputSize: maxOutputSize,
+		Limits:        limits,
+	}, nil
+}
+
+const (
+	DelayMaxDuration = 30 * 24 * time.Hour
+	// DelayTimeOfDayLayout is the layout of time of day delays, seconds are optional
+	DelayTimeOfDayLayout = "15:04:05"
+)
+
+// DelayPayload waits for a duration, until a timestamp or until the next
+// time of day in a time zone, only one of them is set
+type DelayPayload struct {
+	Duration  time.Duration
+	Until     string // RFC 3339 timestamp, may be a {{ expression }} placeholder
+	TimeOfDay string // HH:MM or HH:MM:SS
+	TimeZone  string // IANA name the time of day is in, defaults to UTC
+}
+
+func (d *DelayPayload) Type() TaskType {
+	return TaskTypeDelay
+}
+
+// DelayResult is the output produced by a delay task
+type DelayResult struct {
+	WakeAt time.Time `json:"wakeAt"`
+}
+
+func NewDelayPayload(duration time.Duration, until, timeOfDay, timeZone string) (*DelayPayload, error) {
+	set := 0
+	for _, isSet := range []bool{duration != 0, until != "", timeOfDay != ""} {
+		if isSet {
+			set++
+		}
+	}
+	if set != 1 {
+		return nil, fmt.Errorf("exactly one of duration, until and time of day must be set")
+	}
+	if duration < 0 || duration > DelayMaxDuration {
+		return nil, fmt.Errorf("duration must be between 0 and %v", DelayMaxDuration)
+	}
+	if expression.IsTemplate(until) {
+		// the rendered timestamp is validated when the task is executed
+		if err := validateTemplate(until); err != nil {
+			return nil, fmt.Errorf("invalid until: %w", err)
+		}
+	} else if until != "" {
+		if _, err := time.Parse(time.RFC3339, until); err != nil {
+			return nil, fmt.Errorf("until must be an RFC 3339 timestamp")
+		}
+	}
+	if timeOfDay != "" {
+		if _, err := parseTimeOfDay(timeOfDay); err != nil {
+			return nil, err
+		}
+		if timeZone == "" {
+			timeZone = "UTC"
+		}
+		if _, err := time.LoadLocation(timeZone); err != nil {
+			return nil, fmt.Errorf("invalid time zone %s", timeZone)
+		}
+	} else if timeZone != "" {
+		return nil, fmt.Errorf("time zone is only used with time of day")
+	}
+	return &DelayPayload{
+		Duration:  duration,
+		Until:     until,
+		TimeOfDay: timeOfDay,
+		TimeZone:  timeZone,
+	}, nil
+}
+
+// WakeAt returns when a delay started at the given time is due, the until
+// placeholder must already be rendered
+func (d *DelayPayload) WakeAt(from time.Time) (time.Time, error) {
+	var at time.Time
+	switch {
+	case d.Until != "":
+		t, err := time.Parse(time.RFC3339, d.Until)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("until must be an RFC 3339 timestamp, got %q", d.Until)
+		}
+		at = t
+	case d.TimeOfDay != "":
+		tod, err := parseTimeOfDay(d.TimeOfDay)
+		if err != nil {
+			return time.Time{}, err
+		}
+		loc, err := time.LoadLocation(d.TimeZone)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid time zone %s", d.TimeZone)
+		}
+		local := from.In(loc)
+		at = time.Date(local.Year(), local.Month(), local.Day(), tod.Hour(), tod.Minute(), tod.Second(), 0, loc)
+		if !at.After(local) {
+			at = time.Date(local.Year(), local.Month(), local.Day()+1, tod.Hour(), tod.Minute(), tod.Second(), 0, loc)
+		}
+	default:
+		at = from.Add(d.Duration)
+	}
+	if at.Sub(from) > DelayMaxDuration {
+		return time.Time{}, fmt.Errorf("cannot wait more than %v", DelayMaxDuration)
+	}
+	return at.UTC(), nil
+}
+
+func parseTimeOfDay(s string) (time.Time, error) {
+	if len(s) == len("15:04") {
+		s += ":00"
+	}
+	t, err := time.Parse(DelayTimeOfDayLayout, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("time of day must be HH:MM or HH:MM:SS")
+	}
+	return t, nil
+}
+
+// TransformPayload reshapes the run data with a jq query, the query reads
+// an object with the inputs, tasks and upstream of the task. A single result
+// is the output as is, no results give null and several give an array
+type TransformPayload struct {
+	Query string
+	// Input is the document the query runs on, it is bound when the payload
+	// is rendered and never stored
+	Input interface{}
+}
+
+func (t *TransformPayload) Type() TaskType {
+	return TaskTypeTransform
+}
+
+func NewTransformPayload(query string) (*TransformPayload, error) {
+	if _, err := expression.CompileJQ(query); err != nil {
+		return nil, err
+	}
+	return &TransformPayload{Query: query}, nil
+}
+
+const SubworkflowMaxInputs = WorkflowMaxInputs
+
+// SubworkflowPayload runs another workflow as a child execution and waits
+// for it to finish
+type SubworkflowPayload struct {
+	WorkflowID string
+	// Inputs maps child inputs to CEL expressions evaluated against the
+	// inputs and tasks of the parent run
+	Inputs map[string]string
+	// Values holds the evaluated inputs, they are bound when the payload is
+	// rendered and never stored
+	Values map[string]interface{}
+}
+
+func (s *SubworkflowPayload) Type() TaskType {
+	return TaskTypeSubworkflow
+}
+
+// SubworkflowResult is the output produced by a subworkflow task
+type SubworkflowResult struct {
+	ExecutionID string                 `json:"executionId"`
+	Status      WorklowStatus          `json:"status"`
+	Outputs     map[string]interface{} `json:"outputs"` // by task name
+}
+
+func NewSubworkflowPayload(workflowID string, inputs map[string]string) (*SubworkflowPayload, error) {
+	if workflowID == "" {
+		return nil, fmt.Errorf("workflow id cannot be empty")
+	}
+	if len(inputs) > SubworkflowMaxInputs {
+		return nil, fmt.Errorf("cannot map more than %d inputs", SubworkflowMaxInputs)
+	}
+	for name, source := range inputs {
+		if _, err := expression.Compile(source); err != nil {
+			return nil, fmt.Errorf("invalid expression for input %s: %w", name, err)
+		}
+	}
+	return &SubworkflowPayload{
+		WorkflowID: workflowID,
+		Inputs:     inputs,
+	}, nil
+}
+
+const (
+	MapMaxItems              = 1000
+	MapDefaultMaxParallelism = 1
+	MapMaxParallelism        = 50
+)
+
+// MapFailurePolicy decides the outcome of a map when some of its items fail
+type MapFailurePolicy string
+
+const (
+	// MapFailFast stops the remaining items and fails the map on the first failure
+	MapFailFast MapFailurePolicy = "FAIL_FAST"
+	// MapContinue runs every item and completes the map whatever fails
+	MapContinue MapFailurePolicy = "CONTINUE"
+	// MapTolerate fails the map once more than ToleratedFailurePercent of
+	// its items failed
+	MapTolerate MapFailurePolicy = "TOLERATE"
+)
+
+// MapPayload runs its task once per item of a list, item and index are
+// exposed to the condition and placeholders of the task. The output is the
+// array of item outputs in item order, null for failed and skipped items
+type MapPayload struct {
+	Items string // CEL expression evaluating to a list
+	// Task runs once per item, it is not part of the workflow graph so it
+	// cannot have next tasks. A subworkflow task runs a whole graph per item
+	Task                    *Task
+	MaxParallelism          int
+	FailurePolicy           MapFailurePolicy
+	ToleratedFailurePercent int
+	// Values holds the evaluated items, they are bound when the payload is
+	// rendered and never stored
+	Values []interface{}
+}
+
+func (m *MapPayload) Type() TaskType {
+	return TaskTypeMap
+}
+
+func NewMapPayload(items string, task *Task, maxParallelism int, failurePolicy MapFailurePolicy, toleratedFailurePercent int) (*MapPayload, error) {
+	if _, err := expression.Compile(items); err != nil {
+		return nil, fmt.Errorf("invalid items: %w", err)
+	}
+	if task == nil {
+		return nil, fmt.Errorf("task cannot be nil")
+	}
+	if len(task.Next) > 0 || task.OnFailure != nil || task.Compensation != nil {
+		return nil, fmt.Errorf("task of a map cannot have next, on failure or compensation tasks")
+	}
+	switch task.Type {
+	case TaskTypeMap, TaskTypeDelay, TaskTypeLoop, TaskTypeSwitch:
+		return nil, fmt.Errorf("task of a map cannot be a %s task", task.Type)
+	}
+	if maxParallelism < 0 || maxParallelism > MapMaxParallelism {
+		return nil, fmt.Errorf("max parallelism must be between 0 and %d", MapMaxParallelism)
+	}
+	if maxParallelism == 0 {
+		maxParallelism = MapDefaultMaxParallelism
+	}
+	switch failurePolicy {
+	case "":
+		failurePolicy = MapFailFast
+	case MapFailFast, MapContinue, MapTolerate:
+	default:
+		return nil, fmt.Errorf("invalid failure policy %s", failurePolicy)
+	}
+	if failurePolicy != MapTolerate && toleratedFailurePercent != 0 {
+		return nil, fmt.Errorf("tolerated failure percent is only used with the %s policy", MapTolerate)
+	}
+	if toleratedFailurePercent < 0 || toleratedFailurePercent > 100 {
+		return nil, fmt.Errorf("tolerated failure percent must be between 0 and 100")
+	}
+	return &MapPayload{
+		Items:                   items,
+		Task:                    task,
+		MaxParallelism:          maxParallelism,
+		FailurePolicy:           failurePolicy,
+		ToleratedFailurePercent: toleratedFailurePercent,
+	}, nil
+}
+
+// Tolerates reports whether the map completes with the given failures
+func (m *MapPayload) Tolerates(failed, total int) bool {
+	switch m.FailurePolicy {
+	case MapContinue:
+		return true
+	case MapTolerate:
+		return failed*100 <= m.ToleratedFailurePercent*total
+	default:
+		return failed == 0
+	}
+}
+
+const (
+	LoopDefaultMaxIterations = 100
+	LoopMaxIterations        = 10000
+	LoopMaxInterval          = 24 * time.Hour
+	LoopMaxDeadline          = DelayMaxDuration
+)
+
+// LoopPayload runs its task again while the While condition holds. The
+// condition is evaluated after every iteration with iteration, the number
+// of iterations run so far, and output, the output of the last one. The
+// task sees the same variables, output being null on the first iteration
+type LoopPayload struct {
+	// Task runs once per iteration, it is not part of the workflow graph so
+	// it cannot have next tasks. A subworkflow task loops over a whole graph
+	Task          *Task
+	While         string // CEL expression evaluating to a bool
+	MaxIterations int
+	// Interval is waited between iterations, waits do not count towards the
+	// execution timeout
+	Interval time.Duration
+	// Deadline bounds the whole loop, zero for no deadline
+	Deadline time.Duration
+}
+
+func (l *LoopPayload) Type() TaskType {
+	return TaskTypeLoop
+}
+
+// LoopResult is the output of a loop once its condition no longer holds
+type LoopResult struct {
+	Iterations int         `json:"iterations"`
+	Output     interface{} `json:"output"` // output of the last iteration
+}
+
+func NewLoopPayload(task *Task, while string, maxIterations int, interval, deadline time.Duration) (*LoopPayload, error) {
+	if task == nil {
+		return nil, fmt.Errorf("task cannot be nil")
+	}
+	if len(task.Next) > 0 || task.OnFailure != nil || task.Compensation != nil {
+		return nil, fmt.Errorf("task of a loop cannot have next, on failure or compensation tasks")
+	}
+	switch task.Type {
+	case TaskTypeMap, TaskTypeDelay, TaskTypeLoop, TaskTypeSwitch:
+		return nil, fmt.Errorf("task of a loop cannot be a %s task", task.Type)
+	}
+	if _, err := expression.CompileBool(while); err != nil {
+		return nil, fmt.Errorf("invalid while condition: %w", err)
+	}
+	if maxIterations < 0 || maxIterations > LoopMaxIterations {
+		return nil, fmt.Errorf("max iterations must be between 0 and %d", LoopMaxIterations)
+	}
+	if maxIterations == 0 {
+		maxIterations = LoopDefaultMaxIterations
+	}
+	if interval < 0 || interval > LoopMaxInterval {
+		return nil, fmt.Errorf("interval must be between 0 and %v", LoopMaxInterval)
+	}
+	if deadline < 0 || deadline > LoopMaxDeadline {
+		return nil, fmt.Errorf("deadline must be between 0 and %v", LoopMaxDeadline)
+	}
+	return &LoopPayload{
+		Task:          task,
+		While:         while,
+		MaxIterations: maxIterations,
+		Interval:      interval,
+		Deadline:      deadline,
+	}, nil
+}
+
+const SwitchMaxCases = 10
+
+// SwitchCase routes a switch to one of its next tasks, by name, when its
+// CEL expression is true
+type SwitchCase struct {
+	When string `json:"when"`
+	Next string `json:"next"`
+}
+
+// SwitchPayload follows the next task of the first matching case, or the
+// default one, the other next tasks are released as if the switch was
+// skipped. A branch that other tasks lead to still runs when one of them
+// completes
+type SwitchPayload struct {
+	Cases   []SwitchCase
+	Default string // next task followed when no case matches, none when empty
+}
+
+func (s *SwitchPayload) Type() TaskType {
+	return TaskTypeSwitch
+}
+
+// SwitchResult is the output of a switch, Case is -1 when no case matched
+type SwitchResult struct {
+	Case   int    `json:"case"`
+	Branch string `json:"branch"` // name of the next task followed, empty for none
+}
+
+func NewSwitchPayload(cases []SwitchCase, defaultNext string) (*SwitchPayload, error) {
+	if len(cases) == 0 {
+		return nil, fmt.Errorf("cases cannot be empty")
+	}
+	if len(cases) > SwitchMaxCases {
+		return nil, fmt.Errorf("cannot have more than %d cases", SwitchMaxCases)
+	}
+	for i, c := range cases {
+		if _, err := expression.CompileBool(c.When); err != nil {
+			return nil, fmt.Errorf("invalid expression for case %d: %w", i, err)
+		}
+		if c.Next == "" {
+			return nil, fmt.Errorf("next task of case %d cannot be empty", i)
+		}
+	}
+	return &SwitchPayload{
+		Cases:   cases,
+		Default: defaultNext,
+	}, nil
+}
+
+// validateBranches checks that the cases lead to next tasks of the switch
+// and that every next task can be reached
+func (s *SwitchPayload) validateBranches(next []*Task) error {
+	names := make(map[string]bool, len(next))
+	for _, t := range next {
+		if names[t.Name] {
+			return fmt.Errorf("next tasks of a switch must have unique names, %s is repeated", t.Name)
+		}
+		names[t.Name] = true
+	}
+	branches := make(map[string]bool, len(s.Cases)+1)
+	for i, c := range s.Cases {
+		if !names[c.Next] {
+			return fmt.Errorf("next task %s of case %d is not a next task of the switch", c.Next, i)
+		}
+		branches[c.Next] = true
+	}
+	if s.Default != "" {
+		if !names[s.Default] {
+			return fmt.Errorf("default next task %s is not a next task of the switch", s.Default)
+		}
+		branches[s.Default] = true
+	}
+	for name := range names {
+		if !branches[name] {
+			return fmt.Errorf("next task %s is not reached by any case of the switch", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+package domain
+
+import (
+	"os/user"
+	"testing"
+	"time"
+)
+
+func TestShellLimitsRejectRoot(t *testing.T) {
+	accounts := map[string]*user.User{
+		"toor":   {Username: "toor", Uid: "0", Gid: "0"},
+		"nobody": {Username: "nobody", Uid: "65534", Gid: "65534"},
+	}
+	lookup := lookupUser
+	lookupUser = func(name string) (*user.User, error) {
+		if u, ok := accounts[name]; ok {
+			return u, nil
+		}
+		return nil, user.UnknownUserError(name)
+	}
+	t.Cleanup(func() { lookupUser = lookup })
+
+	// uid 0 is rejected however the user is spelled
+	for _, name := range []string{"0", "00", "toor"} {
+		if err := (ShellLimits{User: name}).validate(); err == nil {
+			t.Errorf("expected user %s to be rejected", name)
+		}
+	}
+	// unknown users are only resolved once the command runs
+	for _, name := range []string{"nobody", "1000", "ghost"} {
+		if err := (ShellLimits{User: name}).validate(); err != nil {
+			t.Errorf("user %s: %v", name, err)
+		}
+	}
+}
+
+func TestNewDelayPayload(t *testing.T) {
+	tests := []struct {
+		name                       string
+		duration                   time.Duration
+		until, timeOfDay, timeZone string
+	}{
+		{"nothing set", 0, "", "", ""},
+		{"two set", time.Minute, "2026-01-01T00:00:00Z", "", ""},
+		{"duration over the maximum", DelayMaxDuration + time.Second, "", "", ""},
+		{"invalid until", 0, "tomorrow", "", ""},
+		{"invalid time of day", 0, "", "25:00", ""},
+		{"invalid time zone", 0, "", "09:00", "Mars/Olympus"},
+		{"time zone without time of day", time.Minute, "", "", "UTC"},
+	}
+	for _, tt := range tests {
+		if _, err := NewDelayPayload(tt.duration, tt.until, tt.timeOfDay, tt.timeZone); err == nil {
+			t.Errorf("%s: expected the payload to be rejected", tt.name)
+		}
+	}
+	// a placeholder in until is only checked once rendered
+	if _, err := NewDelayPayload(0, "{{ inputs.at }}", "", ""); err != nil {
+		t.Errorf("until placeholder: %v", err)
+	}
+}
+
+func TestDelayPayloadWakeAt(t *testing.T) {
+	from := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		payload DelayPayload
+		want    time.Time
+	}{
+		{"duration", DelayPayload{Duration: 90 * time.Second}, from.Add(90 * time.Second)},
+		{"until", DelayPayload{Until: "2026-03-11T08:30:00+01:00"}, time.Date(2026, 3, 11, 7, 30, 0, 0, time.UTC)},
+		{"time of day later today", DelayPayload{TimeOfDay: "18:15", TimeZone: "UTC"}, time.Date(2026, 3, 10, 18, 15, 0, 0, time.UTC)},
+		{"time of day already past", DelayPayload{TimeOfDay: "12:00:00", TimeZone: "UTC"}, time.Date(2026, 3, 11, 12, 0, 0, 0, time.UTC)},
+		// 09:00 in New York is 13:00 UTC during daylight saving time
+		{"time of day in a time zone", DelayPayload{TimeOfDay: "09:00", TimeZone: "America/New_York"}, time.Date(2026, 3, 10, 13, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got, err := tt.payload.WakeAt(from)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	if _, err := (&DelayPayload{Until: "2027-01-01T00:00:00Z"}).WakeAt(from); err == nil {
+		t.Errorf("expected a wake time over the maximum delay to be rejected")
+	}
+}
+
+func TestNewMapPayload(t *testing.T) {
+	newTask := func(taskType TaskType, payload Payload, next ...*Task) *Task {
+		task, err := NewTask("item", taskType, 0, 0, "", Join{}, "", payload, next, nil, nil)
+		if err != nil {
+			t.Fatalf("failed to create task: %v", err)
+		}
+		return task
+	}
+	log := newTask(TaskTypeLog, &LogPayload{Message: "{{ item }}"})
+	// a switch always has next tasks, it is built by hand to reach the type check
+	sw := &Task{Type: TaskTypeSwitch, Payload: &SwitchPayload{}}
+	delay, err := NewDelayPayload(time.Second, "", "", "")
+	if err != nil {
+		t.Fatalf("failed to create delay payload: %v", err)
+	}
+	tests := []struct {
+		name        string
+		items       string
+		task        *Task
+		parallelism int
+		policy      MapFailurePolicy
+		tolerated   int
+	}{
+		{"invalid items", "[1,", log, 0, "", 0},
+		{"no task", "[1]", nil, 0, "", 0},
+		{"task with next tasks", "[1]", newTask(TaskTypeLog, &LogPayload{}, log), 0, "", 0},
+		{"task with an on failure task", "[1]", &Task{Type: TaskTypeLog, OnFailure: log}, 0, "", 0},
+		{"task with a compensation task", "[1]", &Task{Type: TaskTypeLog, Compensation: log}, 0, "", 0},
+		{"delay task", "[1]", newTask(TaskTypeDelay, delay), 0, "", 0},
+		{"switch task", "[1]", sw, 0, "", 0},
+		{"parallelism over the maximum", "[1]", log, MapMaxParallelism + 1, "", 0},
+		{"unknown policy", "[1]", log, 0, "SOMETIMES", 0},
+		{"tolerated percent without tolerate", "[1]", log, 0, MapContinue, 10},
+		{"tolerated percent over 100", "[1]", log, 0, MapTolerate, 101},
+	}
+	for _, tt := range tests {
+		if _, err := NewMapPayload(tt.items, tt.task, tt.parallelism, tt.policy, tt.tolerated); err == nil {
+			t.Errorf("%s: expected the payload to be rejected", tt.name)
+		}
+	}
+
+	p, err := NewMapPayload("[1]", log, 0, "", 0)
+	if err != nil {
+		t.Fatalf("new map payload: %v", err)
+	}
+	if p.MaxParallelism != MapDefaultMaxParallelism || p.FailurePolicy != MapFailFast {
+		t.Errorf("got parallelism %d and policy %s, want the defaults", p.MaxParallelism, p.FailurePolicy)
+	}
+}
+
+func TestNewLoopPayload(t *testing.T) {
+	body, err := NewTask("body", TaskTypeLog, 0, 0, "", Join{}, "", &LogPayload{}, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+	withNext, err := NewTask("with next", TaskTypeLog, 0, 0, "", Join{}, "", &LogPayload{}, []*Task{body}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+	loop, err := NewLoopPayload(body, "true", 0, 0, 0)
+	if err != nil {
+		t.Fatalf("new loop payload: %v", err)
+	}
+	if loop.MaxIterations != LoopDefaultMaxIterations {
+		t.Errorf("got %d max iterations, want the default", loop.MaxIterations)
+	}
+	nested, err := NewTask("nested", TaskTypeLoop, 0, 0, "", Join{}, "", loop, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		task          *Task
+		while         string
+		maxIterations int
+		interval      time.Duration
+		deadline      time.Duration
+	}{
+		{"no task", nil, "true", 0, 0, 0},
+		{"task with next tasks", withNext, "true", 0, 0, 0},
+		{"task with an on failure task", &Task{Type: TaskTypeLog, OnFailure: body}, "true", 0, 0, 0},
+		{"task with a compensation task", &Task{Type: TaskTypeLog, Compensation: body}, "true", 0, 0, 0},
+		{"nested loop", nested, "true", 0, 0, 0},
+		{"switch task", &Task{Type: TaskTypeSwitch, Payload: &SwitchPayload{}}, "true", 0, 0, 0},
+		{"condition that is not a bool", body, "iteration + 1", 0, 0, 0},
+		{"max iterations over the maximum", body, "true", LoopMaxIterations + 1, 0, 0},
+		{"negative interval", body, "true", 0, -time.Second, 0},
+		{"deadline over the maximum", body, "true", 0, 0, LoopMaxDeadline + time.Second},
+	}
+	for _, tt := range tests {
+		if _, err := NewLoopPayload(tt.task, tt.while, tt.maxIterations, tt.interval, tt.deadline); err == nil {
+			t.Errorf("%s: expected the payload to be rejected", tt.name)
+		}
+	}
+}
+
+func TestNewSwitchPayload(t *testing.T) {
+	tests := []struct {
+		name  string
+		cases []SwitchCase
+	}{
+		{"no cases", nil},
+		{"condition that is not a bool", []SwitchCase{{When: "1 + 1", Next: "a"}}},
+		{"case without next task", []SwitchCase{{When: "true"}}},
+	}
+	for _, tt := range tests {
+		if _, err := NewSwitchPayload(tt.cases, ""); err == nil {
+			t.Errorf("%s: expected the payload to be rejected", tt.name)
+		}
+	}
+
+	a, err := NewTask("a", TaskTypeLog, 0, 0, "", Join{}, "", &LogPayload{}, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+	b, err := NewTask("b", TaskTypeLog, 0, 0, "", Join{}, "", &LogPayload{}, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+	branches := []struct {
+		name        string
+		defaultNext string
+		next        []*Task
+		valid       bool
+	}{
+		{"every next task reached", "b", []*Task{a, b}, true},
+		{"next task never reached", "", []*Task{a, b}, false},
+		{"unknown default", "c", []*Task{a, b}, false},
+		{"case leading to no next task", "", []*Task{b}, false},
+		{"repeated names", "", []*Task{a, a}, false},
+	}
+	for _, tt := range branches {
+		p, err := NewSwitchPayload([]SwitchCase{{When: "true", Next: "a"}}, tt.defaultNext)
+		if err != nil {
+			t.Fatalf("new switch payload: %v", err)
+		}
+		_, err = NewTask("switch", TaskTypeSwitch, 0, 0, "", Join{}, "", p, tt.next, nil, nil)
+		if (err == nil) != tt.valid {
+			t.Errorf("%s: got error %v, want valid %t", tt.name, err, tt.valid)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package domain
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robfig/cron/v3"
+)
+
+// MissedFirePolicy decides what happens to the fires of a schedule that
+// were missed while the server was down
+type MissedFirePolicy string
+
+const (
+	MissedFirePolicyUnspecified MissedFirePolicy = "UNSPECIFIED"
+	MissedFirePolicySkip        MissedFirePolicy = "SKIP"     // drop every missed fire
+	MissedFirePolicyRunOnce     MissedFirePolicy = "RUN_ONCE" // run once for all the missed fires
+	MissedFirePolicyCatchUp     MissedFirePolicy = "CATCH_UP" // run once for every missed fire
+)
+
+const (
+	ScheduleCronMaxLength = 100
+	// ScheduleMaxCatchUpFires caps the runs started by the catch up policy,
+	// only the most recent missed fires are run
+	ScheduleMaxCatchUpFires = 10
+)
+
+// cron expressions have five fields, minute hour day month weekday, or
+// use a descriptor such as @daily or @every 1h
+var cronParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// Schedule runs a workflow on a cron expression evaluated in a time zone
+type Schedule struct {
+	ID               string
+	WorkflowID       string
+	Cron             string
+	TimeZone         string // IANA name, such as Europe/Lisbon
+	Inputs           map[string]interface{}
+	MissedFirePolicy MissedFirePolicy
+	Paused           bool
+	LastFireAt       time.Time // zero until the schedule fires for the first time
+	CreatedAt        time.Time
+}
+
+type ScheduleRepository interface {
+	CreateSchedule(s *Schedule) error
+	GetSchedule(id string) (*Schedule, error)
+	// ListSchedules returns the schedules of a workflow, or every schedule
+	// when workflowID is empty, oldest first
+	ListSchedules(workflowID string) ([]*Schedule, error)
+	SetSchedulePaused(id string, paused bool) error
+	// RecordScheduleFire stores the time of the last fire handled
+	RecordScheduleFire(id string, at time.Time) error
+	DeleteSchedule(id string) error
+}
+
+func NewSchedule(workflowID, cronExpr, timeZone string, inputs map[string]interface{}, policy MissedFirePolicy) (*Schedule, error) {
+	if workflowID == "" {
+		return nil, fmt.Errorf("workflow id cannot be empty")
+	}
+	cronExpr = strings.TrimSpace(cronExpr)
+	if cronExpr == "" {
+		return nil, fmt.Errorf("cron expression cannot be empty")
+	}
+	if len(cronExpr) > ScheduleCronMaxLength {
+		return nil, fmt.Errorf("cron expression cannot be longer than %d characters", ScheduleCronMaxLength)
+	}
+	if strings.HasPrefix(cronExpr, "TZ=") || strings.HasPrefix(cronExpr, "CRON_TZ=") {
+		return nil, fmt.Errorf("cron expression cannot set a time zone, use the time zone field")
+	}
+	if timeZone == "" {
+		timeZone = "UTC"
+	}
+	if _, err := time.LoadLocation(timeZone); err != nil {
+		return nil, fmt.Errorf("invalid time zone %s", timeZone)
+	}
+	switch policy {
+	case "", MissedFirePolicyUnspecified:
+		policy = MissedFirePolicySkip
+	case MissedFirePolicySkip, MissedFirePolicyRunOnce, MissedFirePolicyCatchUp:
+	default:
+		return nil, fmt.Errorf("invalid missed fire policy %s", policy)
+	}
+	s := &Schedule{
+		ID:               uuid.NewString(),
+		WorkflowID:       workflowID,
+		Cron:             cronExpr,
+		TimeZone:         timeZone,
+		Inputs:           inputs,
+		MissedFirePolicy: policy,
+		CreatedAt:        time.Now().UTC(),
+	}
+	if _, err := s.Spec(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Spec parses the cron expression in the time zone of the schedule
+func (s *Schedule) Spec() (cron.Schedule, error) {
+	spec, err := cronParser.Parse(fmt.Sprintf("CRON_TZ=%s %s", s.TimeZone, s.Cron))
+	if err != nil {
+		return nil, fmt.Errorf("invalid cron expression: %w", err)
+	}
+	return spec, nil
+}
+
+// Next returns the first fire of the schedule after the given time
+func (s *Schedule) Next(after time.Time) (time.Time, error) {
+	spec, err := s.Spec()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return spec.Next(after), nil
+}
+
+// MissedFires returns the fires between the last fire, or the creation of
+// the schedule, and now that must still be run according to the policy
+func (s *Schedule) MissedFires(now time.Time) ([]time.Time, error) {
+	spec, err := s.Spec()
+	if err != nil {
+		return nil, err
+	}
+	from := s.LastFireAt
+	if from.IsZero() {
+		from = s.CreatedAt
+	}
+	var missed []time.Time
+	for t := spec.Next(from); !t.IsZero() && !t.After(now); t = spec.Next(t) {
+		missed = append(missed, t)
+		// only the most recent fires are kept
+		if len(missed) > ScheduleMaxCatchUpFires {
+			missed = missed[1:]
+		}
+	}
+	switch s.MissedFirePolicy {
+	case MissedFirePolicyRunOnce:
+		if len(missed) > 1 {
+			missed = missed[len(missed)-1:]
+		}
+		return missed, nil
+	case MissedFirePolicyCatchUp:
+		return missed, nil
+	default:
+		return nil, nil
+	}
+}
+
+func (s *Schedule) Clone() *Schedule {
+	out := *s
+	return &out
+}
+
+func (s *Schedule) String() string {
+	return fmt.Sprintf("Id %s, Workflow %s, Cron %s %s", s.ID, s.WorkflowID, s.Cron, s.TimeZone)
+}
@@ -0,0 +1,91 @@
+package domain
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestNewSchedule(t *testing.T) {
+	s, err := NewSchedule("w", " 0 * * * * ", "", nil, "")
+	if err != nil {
+		t.Fatalf("new schedule: %v", err)
+	}
+	if s.Cron != "0 * * * *" || s.TimeZone != "UTC" || s.MissedFirePolicy != MissedFirePolicySkip {
+		t.Errorf("got %+v, want the defaults applied", s)
+	}
+	for _, tt := range []struct {
+		name     string
+		cron, tz string
+		policy   MissedFirePolicy
+	}{
+		{"invalid cron", "61 * * * *", "UTC", MissedFirePolicySkip},
+		{"seconds field", "0 0 * * * *", "UTC", MissedFirePolicySkip},
+		{"time zone in cron", "CRON_TZ=UTC 0 * * * *", "UTC", MissedFirePolicySkip},
+		{"invalid time zone", "0 * * * *", "Mars/Olympus", MissedFirePolicySkip},
+		{"invalid policy", "0 * * * *", "UTC", "SOMETIMES"},
+	} {
+		if _, err := NewSchedule("w", tt.cron, tt.tz, nil, tt.policy); err == nil {
+			t.Errorf("%s: expected the schedule to be rejected", tt.name)
+		}
+	}
+}
+
+func TestScheduleTimeZone(t *testing.T) {
+	s, err := NewSchedule("w", "0 9 * * *", "Europe/Lisbon", nil, "")
+	if err != nil {
+		t.Fatalf("new schedule: %v", err)
+	}
+	// Lisbon is on UTC+1 in summer
+	next, err := s.Next(time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("next: %v", err)
+	}
+	if want := time.Date(2026, 7, 1, 8, 0, 0, 0, time.UTC); !next.Equal(want) {
+		t.Errorf("got next fire %s, want %s", next.UTC(), want)
+	}
+}
+
+func TestMissedFires(t *testing.T) {
+	created := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	hours := func(hs ...int) string {
+		var out []string
+		for _, h := range hs {
+			out = append(out, created.Add(time.Duration(h)*time.Hour).Format(time.RFC3339))
+		}
+		return fmt.Sprint(out)
+	}
+	tests := []struct {
+		name       string
+		policy     MissedFirePolicy
+		lastFireAt time.Time
+		now        time.Time
+		want       string
+	}{
+		{"skip", MissedFirePolicySkip, time.Time{}, created.Add(150 * time.Minute), "[]"},
+		{"run once", MissedFirePolicyRunOnce, time.Time{}, created.Add(150 * time.Minute), hours(2)},
+		{"catch up", MissedFirePolicyCatchUp, time.Time{}, created.Add(150 * time.Minute), hours(1, 2)},
+		{"catch up from last fire", MissedFirePolicyCatchUp, created.Add(time.Hour), created.Add(3 * time.Hour), hours(2, 3)},
+		{"catch up is capped", MissedFirePolicyCatchUp, time.Time{}, created.Add(12 * time.Hour), hours(3, 4, 5, 6, 7, 8, 9, 10, 11, 12)},
+		{"nothing missed", MissedFirePolicyCatchUp, time.Time{}, created.Add(30 * time.Minute), "[]"},
+	}
+	for _, tt := range tests {
+		s, err := NewSchedule("w", "0 * * * *", "UTC", nil, tt.policy)
+		if err != nil {
+			t.Fatalf("new schedule: %v", err)
+		}
+		s.CreatedAt = created
+		s.LastFireAt = tt.lastFireAt
+		missed, err := s.MissedFires(tt.now)
+		if err != nil {
+			t.Fatalf("%s: missed fires: %v", tt.name, err)
+		}
+		var got []string
+		for _, at := range missed {
+			got = append(got, at.UTC().Format(time.RFC3339))
+		}
+		if fmt.Sprint(got) != tt.want {
+			t.Errorf("%s: got %v, want %s", tt.name, got, tt.want)
+		}
+	}
+}
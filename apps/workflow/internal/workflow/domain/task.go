@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/expression"
 )
 
 type TaskType string
@@ -13,6 +14,13 @@ const (
 	TaskTypeUnspecified TaskType = "UNSPECIFIED"
 	TaskTypeLog         TaskType = "LOG"
 	TaskTypeHTTP        TaskType = "HTTP"
+	TaskTypeShell       TaskType = "SHELL"
+	TaskTypeDelay       TaskType = "DELAY"
+	TaskTypeTransform   TaskType = "TRANSFORM"
+	TaskTypeSubworkflow TaskType = "SUBWORKFLOW"
+	TaskTypeMap         TaskType = "MAP"
+	TaskTypeLoop        TaskType = "LOOP"
+	TaskTypeSwitch      TaskType = "SWITCH"
 	// add more in the future...
 )
 
@@ -23,9 +31,22 @@ const (
 	TaskStatusRunning   TaskStatus = "RUNNING"
 	TaskStatusCompleted TaskStatus = "COMPLETED"
 	TaskStatusFailed    TaskStatus = "FAILED"
+	TaskStatusSkipped   TaskStatus = "SKIPPED"
+	TaskStatusCancelled TaskStatus = "CANCELLED"
 	// add more in the future...
 )
 
+// TaskFailurePolicy decides what a failed task does to the rest of the run
+type TaskFailurePolicy string
+
+const (
+	// TaskFailWorkflow fails the workflow and stops the tasks still running
+	TaskFailWorkflow TaskFailurePolicy = "FAIL_WORKFLOW"
+	// TaskContinue marks the task failed and skips its next tasks, unless
+	// another of their predecessors completes, independent branches keep running
+	TaskContinue TaskFailurePolicy = "CONTINUE"
+)
+
 const (
 	TaskNameMaxLength        = 30
 	TaskDescriptionMaxLength = 100
@@ -39,12 +60,21 @@ type Task struct {
 	ID         string
 	Name       string
 	Type       TaskType
-	Status     TaskStatus
 	Retries    uint8
 	RetryDelay time.Duration
-	Condition  string
+	Condition  string // CEL expression, the task is skipped when it evaluates to false
+	Join       Join
 	Payload    Payload
 	Next       []*Task
+	// FailurePolicy applies to tasks without an on failure task, those never
+	// fail the workflow since OnFailure handles their failures
+	FailurePolicy TaskFailurePolicy
+	// OnFailure runs only when the task fails, the error is found in upstream
+	OnFailure *Task
+	// Compensation undoes the task once it completed and the workflow then
+	// failed or was cancelled, it is not part of the graph and finds the
+	// output of the task in upstream
+	Compensation *Task
 }
 
 type TaskRepository interface {
@@ -58,8 +88,12 @@ func NewTask(
 	retries uint32,
 	retryDelay time.Duration,
 	condition string,
+	join Join,
+	failurePolicy TaskFailurePolicy,
 	payload Payload,
 	next []*Task,
+	onFailure *Task,
+	compensation *Task,
 ) (*Task, error) {
 	if name == "" {
 		return nil, fmt.Errorf("name cannot be empty")
@@ -76,6 +110,21 @@ func NewTask(
 	if retryDelay < TaskMinRetryDelay || retryDelay > TaskMaxRetryDelay {
 		return nil, fmt.Errorf("retry delay must be between %v and %v", TaskMinRetryDelay, TaskMaxRetryDelay)
 	}
+	if condition != "" {
+		if _, err := expression.CompileBool(condition); err != nil {
+			return nil, fmt.Errorf("invalid condition: %w", err)
+		}
+	}
+	if join.Mode == "" {
+		join.Mode = JoinAll
+	}
+	switch failurePolicy {
+	case "":
+		failurePolicy = TaskFailWorkflow
+	case TaskFailWorkflow, TaskContinue:
+	default:
+		return nil, fmt.Errorf("invalid failure policy %s", failurePolicy)
+	}
 	if payload == nil {
 		return nil, fmt.Errorf("payload cannot be nil")
 	}
@@ -85,19 +134,71 @@ func NewTask(
 	if len(next) > TaskMaxNextLength {
 		return nil, fmt.Errorf("cannot have more than %d next tasks", TaskMaxNextLength)
 	}
+	for _, t := range next {
+		if onFailure != nil && t == onFailure {
+			return nil, fmt.Errorf("on failure task cannot also be a next task")
+		}
+	}
+	if p, ok := payload.(*SwitchPayload); ok {
+		if err := p.validateBranches(next); err != nil {
+			return nil, err
+		}
+	}
+	if compensation != nil {
+		if err := validateCompensation(compensation); err != nil {
+			return nil, err
+		}
+	}
 	return &Task{
 		ID:         uuid.NewString(),
 		Name:       name,
 		Type:       taskType,
-		Status:     TaskStatusPending,
 		Retries:    uint8(retries),
 		RetryDelay: retryDelay,
 		Condition:  condition,
+		Join:       join,
 		Payload:    payload,
 		Next:       next,
+
+		FailurePolicy: failurePolicy,
+		OnFailure:     onFailure,
+		Compensation:  compensation,
 	}, nil
 }
 
+// validateCompensation checks that a compensation runs on its own, it only
+// runs once the rest of the run is over
+func validateCompensation(c *Task) error {
+	if len(c.Next) > 0 || c.OnFailure != nil || c.Compensation != nil {
+		return fmt.Errorf("compensation task cannot have next, on failure or compensation tasks")
+	}
+	switch c.Type {
+	case TaskTypeMap, TaskTypeDelay, TaskTypeLoop, TaskTypeSwitch:
+		return fmt.Errorf("compensation task cannot be a %s task", c.Type)
+	}
+	return nil
+}
+
+// Successors returns the next tasks followed by the on failure task, if any
+func (t *Task) Successors() []*Task {
+	if t.OnFailure == nil {
+		return t.Next
+	}
+	out := make([]*Task, 0, len(t.Next)+1)
+	out = append(out, t.Next...)
+	return append(out, t.OnFailure)
+}
+
+// HandlesFailure reports whether the run goes on when the task fails
+func (t *Task) HandlesFailure() bool {
+	return t.FailurePolicy == TaskContinue || t.OnFailure != nil
+}
+
+// IsOnFailure reports whether next is the on failure task of the task
+func (t *Task) IsOnFailure(next *Task) bool {
+	return t.OnFailure != nil && t.OnFailure.ID == next.ID
+}
+
 func (t *Task) String() string {
 	return fmt.Sprintf("Id %s, Name %s, Type %s", t.ID, t.Name, t.Type)
 }
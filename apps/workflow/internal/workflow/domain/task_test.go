@@ -0,0 +1,66 @@
+package domain
+
+import "testing"
+
+func TestNewTaskFailurePolicy(t *testing.T) {
+	handler, err := NewTask("handler", TaskTypeLog, 0, 0, "", Join{}, "", &LogPayload{}, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+	task, err := NewTask("task", TaskTypeLog, 0, 0, "", Join{}, "", &LogPayload{}, nil, handler, nil)
+	if err != nil {
+		t.Fatalf("new task: %v", err)
+	}
+	if task.FailurePolicy != TaskFailWorkflow {
+		t.Errorf("got failure policy %s, want the default %s", task.FailurePolicy, TaskFailWorkflow)
+	}
+	// the on failure task handles failures whatever the policy
+	if !task.HandlesFailure() || !task.IsOnFailure(handler) {
+		t.Errorf("expected the on failure task to handle failures")
+	}
+	if got := task.Successors(); len(got) != 1 || got[0] != handler {
+		t.Errorf("got successors %v, want the on failure task", got)
+	}
+
+	if _, err := NewTask("task", TaskTypeLog, 0, 0, "", Join{}, "SOMETIMES", &LogPayload{}, nil, nil, nil); err == nil {
+		t.Errorf("expected an unknown failure policy to be rejected")
+	}
+	if _, err := NewTask("task", TaskTypeLog, 0, 0, "", Join{}, "", &LogPayload{}, []*Task{handler}, handler, nil); err == nil {
+		t.Errorf("expected an on failure task that is also a next task to be rejected")
+	}
+}
+
+func TestNewTaskCompensation(t *testing.T) {
+	undo, err := NewTask("undo", TaskTypeLog, 0, 0, "", Join{}, "", &LogPayload{}, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+	task, err := NewTask("task", TaskTypeLog, 0, 0, "", Join{}, "", &LogPayload{}, nil, nil, undo)
+	if err != nil {
+		t.Fatalf("new task: %v", err)
+	}
+	// the compensation only runs once the workflow stops, it is not a successor
+	if task.Compensation != undo || len(task.Successors()) != 0 {
+		t.Errorf("got compensation %v and successors %v, want only the compensation", task.Compensation, task.Successors())
+	}
+
+	tests := []struct {
+		name         string
+		compensation *Task
+	}{
+		{"compensation with next tasks", &Task{Type: TaskTypeLog, Next: []*Task{undo}}},
+		{"compensation with an on failure task", &Task{Type: TaskTypeLog, OnFailure: undo}},
+		{"compensation with a compensation task", &Task{Type: TaskTypeLog, Compensation: undo}},
+		{"delay compensation", &Task{Type: TaskTypeDelay}},
+		{"map compensation", &Task{Type: TaskTypeMap}},
+		{"loop compensation", &Task{Type: TaskTypeLoop}},
+		{"switch compensation", &Task{Type: TaskTypeSwitch}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewTask("task", TaskTypeLog, 0, 0, "", Join{}, "", &LogPayload{}, nil, nil, tt.compensation); err == nil {
+				t.Errorf("expected the compensation to be rejected")
+			}
+		})
+	}
+}
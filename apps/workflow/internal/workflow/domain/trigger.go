@@ -0,0 +1,94 @@
+package domain
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/expression"
+)
+
+const (
+	TriggerMaxInputs = WorkflowMaxInputs
+	// TriggerMaxChainDepth bounds how many executions can be chained by
+	// completion triggers starting from one that was not triggered
+	TriggerMaxChainDepth = 10
+	// TriggerInputOutputs is passed to the target workflow, when it declares
+	// it and no expression is mapped to it, with the outputs of the finished
+	// run by task name
+	TriggerInputOutputs = "outputs"
+)
+
+// CompletionTrigger starts a workflow when a run of another one finishes
+type CompletionTrigger struct {
+	ID               string
+	WorkflowID       string          // workflow whose runs fire the trigger
+	TargetWorkflowID string          // workflow started by the trigger
+	On               []WorklowStatus // final statuses that fire the trigger
+	// Inputs maps target inputs to CEL expressions evaluated against the
+	// inputs and tasks of the finished run
+	Inputs    map[string]string
+	CreatedAt time.Time
+}
+
+type TriggerRepository interface {
+	CreateTrigger(t *CompletionTrigger) error
+	// ListTriggers returns the triggers fired by a workflow, or every trigger
+	// when workflowID is empty, oldest first
+	ListTriggers(workflowID string) ([]*CompletionTrigger, error)
+	DeleteTrigger(id string) error
+}
+
+func NewCompletionTrigger(workflowID, targetWorkflowID string, on []WorklowStatus, inputs map[string]string) (*CompletionTrigger, error) {
+	if workflowID == "" || targetWorkflowID == "" {
+		return nil, fmt.Errorf("workflow id and target workflow id cannot be empty")
+	}
+	if workflowID == targetWorkflowID {
+		return nil, fmt.Errorf("workflow cannot trigger itself")
+	}
+	if len(on) == 0 {
+		on = []WorklowStatus{WorkflowStatusCompleted}
+	}
+	seen := make(map[WorklowStatus]bool, len(on))
+	for _, s := range on {
+		switch s {
+		case WorkflowStatusCompleted, WorkflowStatusCompletedWithErrors, WorkflowStatusFailed, WorkflowStatusCancelled:
+		default:
+			return nil, fmt.Errorf("trigger cannot fire on status %s", s)
+		}
+		if seen[s] {
+			return nil, fmt.Errorf("duplicate status %s", s)
+		}
+		seen[s] = true
+	}
+	if len(inputs) > TriggerMaxInputs {
+		return nil, fmt.Errorf("cannot map more than %d inputs", TriggerMaxInputs)
+	}
+	for name, source := range inputs {
+		if _, err := expression.Compile(source); err != nil {
+			return nil, fmt.Errorf("invalid expression for input %s: %w", name, err)
+		}
+	}
+	return &CompletionTrigger{
+		ID:               uuid.NewString(),
+		WorkflowID:       workflowID,
+		TargetWorkflowID: targetWorkflowID,
+		On:               on,
+		Inputs:           inputs,
+		CreatedAt:        time.Now().UTC(),
+	}, nil
+}
+
+// FiresOn reports whether a run that finished with the given status fires the trigger
+func (t *CompletionTrigger) FiresOn(status WorklowStatus) bool {
+	for _, s := range t.On {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *CompletionTrigger) String() string {
+	return fmt.Sprintf("Id %s, Workflow %s, Target %s", t.ID, t.WorkflowID, t.TargetWorkflowID)
+}
@@ -0,0 +1,56 @@
+package domain
+
+import (
+	"testing"
+)
+
+func TestNewCompletionTrigger(t *testing.T) {
+	tr, err := NewCompletionTrigger("a", "b", nil, map[string]string{"n": "inputs.n + 1"})
+	if err != nil {
+		t.Fatalf("new trigger: %v", err)
+	}
+	if !tr.FiresOn(WorkflowStatusCompleted) || tr.FiresOn(WorkflowStatusFailed) {
+		t.Errorf("got statuses %v, want only completed by default", tr.On)
+	}
+	tests := []struct {
+		name   string
+		target string
+		on     []WorklowStatus
+		inputs map[string]string
+	}{
+		{"itself", "a", nil, nil},
+		{"no target", "", nil, nil},
+		{"running status", "b", []WorklowStatus{WorkflowStatusRunning}, nil},
+		{"duplicate status", "b", []WorklowStatus{WorkflowStatusFailed, WorkflowStatusFailed}, nil},
+		{"invalid expression", "b", nil, map[string]string{"n": "inputs.n +"}},
+	}
+	for _, tt := range tests {
+		if _, err := NewCompletionTrigger("a", tt.target, tt.on, tt.inputs); err == nil {
+			t.Errorf("%s: expected the trigger to be rejected", tt.name)
+		}
+	}
+}
+
+func TestExecutionCanTrigger(t *testing.T) {
+	e := &Execution{WorkflowID: "c", TriggerChain: []string{"a", "b"}}
+	if got := e.NextTriggerChain(); len(got) != 3 || got[2] != "c" {
+		t.Errorf("got next chain %v, want [a b c]", got)
+	}
+	if err := e.CanTrigger("d"); err != nil {
+		t.Errorf("got %v for a new workflow", err)
+	}
+	// every workflow already in the chain, including the current one, loops
+	for _, id := range []string{"a", "b", "c"} {
+		if err := e.CanTrigger(id); err == nil {
+			t.Errorf("expected triggering %s to be rejected as a loop", id)
+		}
+	}
+
+	long := &Execution{WorkflowID: "w"}
+	for i := 0; i < TriggerMaxChainDepth-1; i++ {
+		long.TriggerChain = append(long.TriggerChain, string(rune('a'+i)))
+	}
+	if err := long.CanTrigger("z"); err == nil {
+		t.Errorf("expected a chain of %d executions to stop", TriggerMaxChainDepth)
+	}
+}
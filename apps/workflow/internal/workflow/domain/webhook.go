@@ -0,0 +1,204 @@
+package domain
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// WebhookMode decides whether a webhook call waits for the run to finish
+type WebhookMode string
+
+const (
+	WebhookModeUnspecified WebhookMode = "UNSPECIFIED"
+	WebhookModeAsync       WebhookMode = "ASYNC" // answer as soon as the run starts
+	WebhookModeSync        WebhookMode = "SYNC"  // answer when the run finishes
+)
+
+const (
+	WebhookSecretMinLength = 16
+	WebhookSecretMaxLength = 256
+	WebhookMaxPerWorkflow  = 10
+	WebhookMaxBodySize     = 1 << 20 // 1 MiB
+	// WebhookSignatureHeader carries the hex HMAC-SHA256 of the request body,
+	// prefixed with sha256=, the same format GitHub uses
+	WebhookSignatureHeader = "X-Hub-Signature-256"
+)
+
+// inputs a webhook call fills, only the ones the workflow declares are passed
+const (
+	WebhookInputBody    = "body"
+	WebhookInputHeaders = "headers"
+	WebhookInputQuery   = "query"
+)
+
+// credentialHeaders are never passed to the run, lower case names
+var credentialHeaders = map[string]bool{
+	"authorization":         true,
+	"proxy-authorization":   true,
+	"cookie":                true,
+	"x-api-key":             true,
+	"x-auth-token":          true,
+	"x-csrf-token":          true,
+	"x-xsrf-token":          true,
+	"x-gitlab-token":        true,
+	"x-hub-signature":       true,
+	"x-hub-signature-256":   true,
+	"x-slack-signature":     true,
+	"stripe-signature":      true,
+	"x-shopify-hmac-sha256": true,
+}
+
+var (
+	// ErrWebhookNotFound is returned for unknown workflows and wrong tokens alike
+	ErrWebhookNotFound   = errors.New("webhook not found")
+	ErrWebhookSignature  = errors.New("invalid webhook signature")
+	ErrWebhookBadRequest = errors.New("invalid webhook request")
+)
+
+// Webhook is an HTTP endpoint that starts a workflow, it is addressed by
+// the workflow id and a random token that acts as its secret
+type Webhook struct {
+	ID         string
+	WorkflowID string
+	Token      string
+	Secret     string // when set, calls must be signed with it
+	Mode       WebhookMode
+	CreatedAt  time.Time
+}
+
+type WebhookRepository interface {
+	CreateWebhook(w *Webhook) error
+	// ListWebhooks returns the webhooks of a workflow, oldest first
+	ListWebhooks(workflowID string) ([]*Webhook, error)
+	DeleteWebhook(id string) error
+}
+
+func NewWebhook(workflowID string, mode WebhookMode, secret string) (*Webhook, error) {
+	if workflowID == "" {
+		return nil, fmt.Errorf("workflow id cannot be empty")
+	}
+	switch mode {
+	case "", WebhookModeUnspecified:
+		mode = WebhookModeAsync
+	case WebhookModeAsync, WebhookModeSync:
+	default:
+		return nil, fmt.Errorf("invalid webhook mode %s", mode)
+	}
+	if secret != "" && (len(secret) < WebhookSecretMinLength || len(secret) > WebhookSecretMaxLength) {
+		return nil, fmt.Errorf("secret must be between %d and %d characters", WebhookSecretMinLength, WebhookSecretMaxLength)
+	}
+	token := make([]byte, 24)
+	if _, err := rand.Read(token); err != nil {
+		return nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+	return &Webhook{
+		ID:         uuid.NewString(),
+		WorkflowID: workflowID,
+		Token:      hex.EncodeToString(token),
+		Secret:     secret,
+		Mode:       mode,
+		CreatedAt:  time.Now().UTC(),
+	}, nil
+}
+
+// Path returns the path the webhook is served at
+func (w *Webhook) Path() string {
+	return fmt.Sprintf("/hooks/%s/%s", w.WorkflowID, w.Token)
+}
+
+// MatchToken compares the token in constant time
+func (w *Webhook) MatchToken(token string) bool {
+	return subtle.ConstantTimeCompare([]byte(w.Token), []byte(token)) == 1
+}
+
+// VerifySignature checks the signature of the body when the webhook has a secret
+func (w *Webhook) VerifySignature(body []byte, signature string) error {
+	if w.Secret == "" {
+		return nil
+	}
+	got, ok := strings.CutPrefix(signature, "sha256=")
+	if !ok {
+		return ErrWebhookSignature
+	}
+	sum, err := hex.DecodeString(got)
+	if err != nil {
+		return ErrWebhookSignature
+	}
+	mac := hmac.New(sha256.New, []byte(w.Secret))
+	mac.Write(body)
+	if !hmac.Equal(sum, mac.Sum(nil)) {
+		return ErrWebhookSignature
+	}
+	return nil
+}
+
+func (w *Webhook) String() string {
+	return fmt.Sprintf("Id %s, Workflow %s, Mode %s", w.ID, w.WorkflowID, w.Mode)
+}
+
+// WebhookCall is an inbound request to a webhook
+type WebhookCall struct {
+	WorkflowID string
+	Token      string
+	Signature  string
+	Body       []byte
+	Headers    map[string]string // lower case names
+	Query      map[string]string
+}
+
+// Inputs returns the run inputs of the call for the inputs the workflow
+// declares, a JSON body is decoded and any other body is passed as a string.
+// Credential and signature headers are left out, inputs end up in the
+// execution history
+func (c *WebhookCall) Inputs(w *Workflow) map[string]interface{} {
+	var body interface{}
+	if len(c.Body) > 0 {
+		if err := json.Unmarshal(c.Body, &body); err != nil {
+			body = string(c.Body)
+		}
+	}
+	values := map[string]interface{}{
+		WebhookInputBody:    body,
+		WebhookInputHeaders: publicHeaders(c.Headers),
+		WebhookInputQuery:   stringMap(c.Query),
+	}
+	inputs := make(map[string]interface{})
+	for _, in := range w.Inputs {
+		if v, ok := values[in.Name]; ok && v != nil {
+			inputs[in.Name] = v
+		}
+	}
+	return inputs
+}
+
+// publicHeaders drops the headers that carry credentials, including any
+// signature or secret header of a provider not listed in credentialHeaders
+func publicHeaders(headers map[string]string) map[string]interface{} {
+	out := make(map[string]interface{}, len(headers))
+	for name, v := range headers {
+		name = strings.ToLower(name)
+		if credentialHeaders[name] || strings.Contains(name, "signature") || strings.Contains(name, "secret") {
+			continue
+		}
+		out[name] = v
+	}
+	return out
+}
+
+func stringMap(m map[string]string) map[string]interface{} {
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,112 @@
+package domain
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestNewWebhook(t *testing.T) {
+	w, err := NewWebhook("w", "", "")
+	if err != nil {
+		t.Fatalf("new webhook: %v", err)
+	}
+	if w.Mode != WebhookModeAsync || len(w.Token) != 48 || w.Path() != "/hooks/w/"+w.Token {
+		t.Errorf("got %+v, want an async webhook with a random token", w)
+	}
+	if other, _ := NewWebhook("w", "", ""); other.Token == w.Token {
+		t.Errorf("expected every webhook to get its own token")
+	}
+	if _, err := NewWebhook("w", "SOMETIMES", ""); err == nil {
+		t.Errorf("expected an invalid mode to be rejected")
+	}
+	if _, err := NewWebhook("w", WebhookModeSync, "short"); err == nil {
+		t.Errorf("expected a secret under the minimum length to be rejected")
+	}
+}
+
+func TestWebhookMatchToken(t *testing.T) {
+	w, err := NewWebhook("w", "", "")
+	if err != nil {
+		t.Fatalf("new webhook: %v", err)
+	}
+	if !w.MatchToken(w.Token) {
+		t.Errorf("expected the webhook token to match")
+	}
+	for _, token := range []string{"", w.Token[1:], w.Token + "0"} {
+		if w.MatchToken(token) {
+			t.Errorf("expected token %q not to match", token)
+		}
+	}
+}
+
+func TestWebhookVerifySignature(t *testing.T) {
+	const secret = "0123456789abcdef"
+	body := []byte(`{"ref":"main"}`)
+	w, err := NewWebhook("w", "", secret)
+	if err != nil {
+		t.Fatalf("new webhook: %v", err)
+	}
+	if err := w.VerifySignature(body, sign(secret, body)); err != nil {
+		t.Errorf("got %v for a valid signature", err)
+	}
+	for name, signature := range map[string]string{
+		"missing":        "",
+		"without prefix": sign(secret, body)[len("sha256="):],
+		"not hex":        "sha256=xyz",
+		"other secret":   sign("fedcba9876543210", body),
+		"other body":     sign(secret, []byte(`{"ref":"dev"}`)),
+	} {
+		if err := w.VerifySignature(body, signature); !errors.Is(err, ErrWebhookSignature) {
+			t.Errorf("%s: got %v, want %v", name, err, ErrWebhookSignature)
+		}
+	}
+	// webhooks without a secret only rely on their token
+	w.Secret = ""
+	if err := w.VerifySignature(body, ""); err != nil {
+		t.Errorf("got %v without a secret", err)
+	}
+}
+
+func TestWebhookCallInputs(t *testing.T) {
+	var inputs []*Input
+	for _, name := range []string{WebhookInputBody, WebhookInputHeaders} {
+		in, err := NewInput(name, InputTypeObject, false, nil, "")
+		if err != nil {
+			t.Fatalf("new input: %v", err)
+		}
+		inputs = append(inputs, in)
+	}
+	w := &Workflow{Inputs: inputs}
+	call := &WebhookCall{
+		Body: []byte(`{"n":1}`),
+		Headers: map[string]string{
+			"content-type":        "application/json",
+			"authorization":       "Bearer x",
+			"cookie":              "session=x",
+			"x-hub-signature-256": "sha256=00",
+			"x-custom-signature":  "00",
+			"x-webhook-secret":    "x",
+		},
+		Query: map[string]string{"q": "1"},
+	}
+	got := call.Inputs(w)
+	// the query is not declared by the workflow
+	if got, want := fmt.Sprint(got), "map[body:map[n:1] headers:map[content-type:application/json]]"; got != want {
+		t.Errorf("got inputs %s, want %s", got, want)
+	}
+
+	call.Body = []byte("plain text")
+	if body := call.Inputs(w)[WebhookInputBody]; body != "plain text" {
+		t.Errorf("got body %v, want the raw text", body)
+	}
+}
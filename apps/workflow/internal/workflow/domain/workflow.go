@@ -13,6 +13,10 @@ const (
 	WorkflowStatusRunning   WorklowStatus = "RUNNING"
 	WorkflowStatusCompleted WorklowStatus = "COMPLETED"
 	WorkflowStatusFailed    WorklowStatus = "FAILED"
+	WorkflowStatusCancelled WorklowStatus = "CANCELLED"
+	// WorkflowStatusCompletedWithErrors is the status of runs that went on
+	// after tasks whose failures were handled
+	WorkflowStatusCompletedWithErrors WorklowStatus = "COMPLETED_WITH_ERRORS"
 	// add more in the future...
 )
 
@@ -20,23 +24,59 @@ const (
 	WorkflowNameMaxLength        = 30
 	WorkflowDescriptionMaxLength = 100
 	WorkflowMaxTasks             = 10
+	WorkflowMaxInputs            = 10
+	WorkflowDefaultPageSize      = 20
+	WorkflowMaxPageSize          = 100
 )
 
 type Workflow struct {
 	ID          string
 	Name        string
 	Description string
-	Status      WorklowStatus
+	Inputs      []*Input
 	Tasks       []*Task
 }
 
+// WorkflowFilter selects workflows when listing them, zero fields match everything
+type WorkflowFilter struct {
+	Name      string // case insensitive substring of the name
+	PageSize  int
+	PageToken string // returned by the previous page, empty for the first one
+}
+
 type WorkflowRepository interface {
 	Create(w *Workflow) error
 	Get(id string) (*Workflow, error)
-	// Update(w *Workflow) error
+	// List returns the workflows matching the filter sorted by name, and the
+	// token of the next page or an empty string on the last one
+	List(f WorkflowFilter) ([]*Workflow, string, error)
+	// Update replaces the workflow definition, including its whole task graph
+	Update(w *Workflow) error
+	Delete(id string) error
+}
+
+// NewWorkflowFilter validates the filter and applies the default page size
+func NewWorkflowFilter(name string, pageSize int, pageToken string) (WorkflowFilter, error) {
+	if len([]rune(name)) > WorkflowNameMaxLength {
+		return WorkflowFilter{}, fmt.Errorf("name cannot be longer than %d characters", WorkflowNameMaxLength)
+	}
+	if pageSize < 0 || pageSize > WorkflowMaxPageSize {
+		return WorkflowFilter{}, fmt.Errorf("page size must be between 0 and %d", WorkflowMaxPageSize)
+	}
+	if pageSize == 0 {
+		pageSize = WorkflowDefaultPageSize
+	}
+	if _, err := ParsePageToken(pageToken); err != nil {
+		return WorkflowFilter{}, err
+	}
+	return WorkflowFilter{
+		Name:      name,
+		PageSize:  pageSize,
+		PageToken: pageToken,
+	}, nil
 }
 
-func NewWorkflow(name string, description string, tasks []*Task) (*Workflow, error) {
+func NewWorkflow(name string, description string, inputs []*Input, tasks []*Task) (*Workflow, error) {
 	if name == "" {
 		return nil, fmt.Errorf("name cannot be empty")
 	}
@@ -46,15 +86,28 @@ func NewWorkflow(name string, description string, tasks []*Task) (*Workflow, err
 	if len([]rune(description)) > WorkflowDescriptionMaxLength {
 		return nil, fmt.Errorf("description cannot be longer than %d characters", WorkflowDescriptionMaxLength)
 	}
+	if len(inputs) > WorkflowMaxInputs {
+		return nil, fmt.Errorf("cannot have more than %d inputs", WorkflowMaxInputs)
+	}
+	inputNames := make(map[string]bool, len(inputs))
+	for _, in := range inputs {
+		if inputNames[in.Name] {
+			return nil, fmt.Errorf("duplicate input %s", in.Name)
+		}
+		inputNames[in.Name] = true
+	}
 	totalTasks := countAllTasks(tasks)
 	if totalTasks > WorkflowMaxTasks {
 		return nil, fmt.Errorf("cannot have more than %d total tasks", WorkflowMaxTasks)
 	}
+	if err := validateJoins(tasks); err != nil {
+		return nil, err
+	}
 	return &Workflow{
 		ID:          uuid.NewString(),
 		Name:        name,
 		Description: description,
-		Status:      WorkflowStatusIDLE,
+		Inputs:      inputs,
 		Tasks:       tasks,
 	}, nil
 }
@@ -77,7 +130,18 @@ func countTasksRecursive(tasks []*Task, visited map[string]bool) int {
 		if !visited[task.ID] {
 			visited[task.ID] = true
 			count++
-			count += countTasksRecursive(task.Next, visited)
+			// the task of a map or loop and compensations count even though
+			// they are not part of the graph
+			switch p := task.Payload.(type) {
+			case *MapPayload:
+				count += countTasksRecursive([]*Task{p.Task}, visited)
+			case *LoopPayload:
+				count += countTasksRecursive([]*Task{p.Task}, visited)
+			}
+			if task.Compensation != nil {
+				count += countTasksRecursive([]*Task{task.Compensation}, visited)
+			}
+			count += countTasksRecursive(task.Successors(), visited)
 		}
 	}
 	return count
@@ -0,0 +1,21 @@
+package domain
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewWorkflowFilter(t *testing.T) {
+	if f, err := NewWorkflowFilter("", 0, ""); err != nil || f.PageSize != WorkflowDefaultPageSize {
+		t.Errorf("got %+v, %v, want the default page size", f, err)
+	}
+	if _, err := NewWorkflowFilter("", WorkflowMaxPageSize+1, ""); err == nil {
+		t.Errorf("expected a page size over the maximum to be rejected")
+	}
+	if _, err := NewWorkflowFilter(strings.Repeat("x", WorkflowNameMaxLength+1), 0, ""); err == nil {
+		t.Errorf("expected a name over the maximum length to be rejected")
+	}
+	if _, err := NewWorkflowFilter("", 0, "abc"); err == nil {
+		t.Errorf("expected an invalid page token to be rejected")
+	}
+}
@@ -0,0 +1,96 @@
+package workflow
+
+import (
+	"context"
+	"sync"
+
+	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/domain"
+)
+
+// executionStream keeps the events of a running execution so any number of
+// watchers can replay them and follow the live ones
+type executionStream struct {
+	mu       sync.Mutex
+	events   []*domain.ExecutionEvent // event with sequence n is at index n-1
+	updated  chan struct{}            // closed and replaced on every change
+	done     bool
+	err      error         // error the execution finished with
+	finished chan struct{} // closed when the execution finishes
+	cancel   context.CancelCauseFunc
+}
+
+// newExecutionStream creates the stream of an execution, history holds the
+// events published before a restart so sequence numbers carry on
+func newExecutionStream(cancel context.CancelCauseFunc, history []*domain.ExecutionEvent) *executionStream {
+	return &executionStream{
+		cancel:   cancel,
+		events:   history,
+		updated:  make(chan struct{}),
+		finished: make(chan struct{}),
+	}
+}
+
+// publish assigns the next sequence number to the event and wakes up watchers
+func (st *executionStream) publish(ev *domain.ExecutionEvent) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	ev.Seq = int64(len(st.events) + 1)
+	st.events = append(st.events, ev)
+	close(st.updated)
+	st.updated = make(chan struct{})
+}
+
+// finish marks the end of the execution, no events are published after it
+func (st *executionStream) finish(err error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.done = true
+	st.err = err
+	close(st.updated)
+	close(st.finished)
+}
+
+// wait blocks until the execution finishes and returns its error
+func (st *executionStream) wait(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-st.finished:
+		st.mu.Lock()
+		defer st.mu.Unlock()
+		return st.err
+	}
+}
+
+// watch calls fn for every event starting at sequence fromSeq, then for the
+// live ones until the execution finishes or the context is done
+func (st *executionStream) watch(ctx context.Context, fromSeq int64, fn func(*domain.ExecutionEvent) error) error {
+	next := max(fromSeq, 1)
+	for {
+		st.mu.Lock()
+		var pending []*domain.ExecutionEvent
+		if int(next-1) < len(st.events) {
+			pending = st.events[next-1:]
+		}
+		done, updated := st.done, st.updated
+		st.mu.Unlock()
+
+		for _, ev := range pending {
+			if err := fn(ev); err != nil {
+				return err
+			}
+			next++
+		}
+		if len(pending) > 0 {
+			continue
+		}
+		if done {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-updated:
+		}
+	}
+}
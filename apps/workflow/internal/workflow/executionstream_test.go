@@ -0,0 +1,81 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/domain"
+)
+
+// collect watches the stream until it finishes and returns the sequence
+// numbers of the events it saw
+func collect(ctx context.Context, st *executionStream, fromSeq int64) ([]int64, error) {
+	var seqs []int64
+	err := st.watch(ctx, fromSeq, func(ev *domain.ExecutionEvent) error {
+		seqs = append(seqs, ev.Seq)
+		return nil
+	})
+	return seqs, err
+}
+
+func TestExecutionStreamReplaysAndFollows(t *testing.T) {
+	st := newExecutionStream(func(error) {}, nil)
+	for i := 0; i < 3; i++ {
+		st.publish(&domain.ExecutionEvent{})
+	}
+
+	type result struct {
+		seqs []int64
+		err  error
+	}
+	results := make(chan result, 2)
+	for _, from := range []int64{0, 3} {
+		go func() {
+			seqs, err := collect(context.Background(), st, from)
+			results <- result{seqs, err}
+		}()
+	}
+	// live events reach watchers that already replayed the history
+	time.Sleep(50 * time.Millisecond)
+	st.publish(&domain.ExecutionEvent{})
+	st.finish(nil)
+
+	got := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		r := <-results
+		if r.err != nil {
+			t.Fatalf("watch: %v", r.err)
+		}
+		got[fmt.Sprint(r.seqs)] = true
+	}
+	for _, want := range []string{"[1 2 3 4]", "[3 4]"} {
+		if !got[want] {
+			t.Errorf("got %v, want a watcher to see %s", got, want)
+		}
+	}
+}
+
+func TestExecutionStreamWatchStops(t *testing.T) {
+	st := newExecutionStream(func(error) {}, nil)
+	st.publish(&domain.ExecutionEvent{})
+
+	// the callback error ends the watch
+	boom := errors.New("boom")
+	if err := st.watch(context.Background(), 0, func(*domain.ExecutionEvent) error { return boom }); !errors.Is(err, boom) {
+		t.Errorf("got error %v, want %v", err, boom)
+	}
+	// so does the context while waiting for live events
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := collect(ctx, st, 2); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got error %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	st.finish(boom)
+	if err := st.wait(context.Background()); !errors.Is(err, boom) {
+		t.Errorf("got error %v, want the execution error", err)
+	}
+}
@@ -2,92 +2,405 @@ package workflow
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/domain"
+	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/expression"
 )
 
 type WorkflowExecutor interface {
-	Execute(ctx context.Context, w *domain.Workflow, resultCh chan<- map[string]interface{}) error
+	Execute(ctx context.Context, w *domain.Workflow, e *domain.Execution, eventCh chan<- *domain.ExecutionEvent) error
+	// Resume continues an execution that was running when the server stopped
+	Resume(ctx context.Context, w *domain.Workflow, e *domain.Execution, eventCh chan<- *domain.ExecutionEvent) error
+	// SetTriggerStarter sets what starts the workflows chained by completion
+	// triggers, no trigger fires until it is set
+	SetTriggerStarter(ts TriggerStarter)
+	// SetSubworkflowRunner sets what runs the child executions of subworkflow
+	// tasks, they fail until it is set
+	SetSubworkflowRunner(sr SubworkflowRunner)
+}
+
+// TriggerStarter starts the executions chained by completion triggers
+type TriggerStarter interface {
+	StartTriggered(parent *domain.Execution, workflowID string, inputs map[string]interface{}) (*domain.Execution, error)
+}
+
+// SubworkflowRunner runs the child executions of subworkflow tasks
+type SubworkflowRunner interface {
+	RunChild(ctx context.Context, parent *domain.Execution, taskID, workflowID string, inputs map[string]interface{}) (*domain.Execution, error)
 }
 
 type workflowExecutor struct {
 	te TaskExecutor
 	r  domain.WorkflowRepository
+	er domain.ExecutionRepository
+	tr domain.TriggerRepository
+
+	mu sync.RWMutex
+	ts TriggerStarter
+	sr SubworkflowRunner
 }
 
-func NewWorkflowExecutor(r domain.WorkflowRepository, te TaskExecutor) WorkflowExecutor {
+func NewWorkflowExecutor(r domain.WorkflowRepository, er domain.ExecutionRepository, tr domain.TriggerRepository, te TaskExecutor) WorkflowExecutor {
 	return &workflowExecutor{
 		r:  r,
+		er: er,
+		tr: tr,
 		te: te,
 	}
 }
 
-func (we *workflowExecutor) Execute(ctx context.Context, w *domain.Workflow, resultCh chan<- map[string]interface{}) error {
-	// create timeout context and defer cancel to cleanup
-	ctx, timeout := context.WithTimeout(ctx, 5*time.Minute)
-	defer timeout()
-	// create cancelable context and defer cancel to cleanup
-	ctx, cancel := context.WithCancel(ctx)
-	defer cancel()
+func (we *workflowExecutor) SetTriggerStarter(ts TriggerStarter) {
+	we.mu.Lock()
+	defer we.mu.Unlock()
+	we.ts = ts
+}
+
+func (we *workflowExecutor) SetSubworkflowRunner(sr SubworkflowRunner) {
+	we.mu.Lock()
+	defer we.mu.Unlock()
+	we.sr = sr
+}
+
+// executionTimeout bounds how long a run may take, time spent waiting on
+// delay tasks and subworkflows is not counted
+const executionTimeout = 5 * time.Minute
+
+// Execute runs the workflow and records its progress in the execution, the
+// execution inputs must already be resolved against the workflow inputs.
+// The execution must not be accessed by the caller until Execute returns
+func (we *workflowExecutor) Execute(ctx context.Context, w *domain.Workflow, e *domain.Execution, eventCh chan<- *domain.ExecutionEvent) error {
+	// Build pending dependency counters for fan-in support and the
+	// state of this run
+	r := newRun(w, e, we.er, we.buildPendingDeps(w.Tasks), eventCh)
+
+	steps := make([]func(ctx context.Context) error, 0, len(w.Tasks))
+	for _, t := range w.Tasks {
+		steps = append(steps, func(ctx context.Context) error {
+			return we.executeTaskChain(ctx, r, t)
+		})
+	}
+	return we.execute(ctx, r, steps)
+}
+
+// Resume continues an execution that was running when the server stopped,
+// finished tasks keep their results and delay tasks wait until they were
+// due. Tasks interrupted in any other way cannot be resumed safely, the
+// execution fails instead
+func (we *workflowExecutor) Resume(ctx context.Context, w *domain.Workflow, e *domain.Execution, eventCh chan<- *domain.ExecutionEvent) error {
+	r := newRun(w, e, we.er, we.buildPendingDeps(w.Tasks), eventCh)
+	steps, err := we.restore(r)
+	if err != nil {
+		err = we.compensate(ctx, r, fmt.Errorf("failed to resume execution: %w", err))
+		r.setStatus(domain.WorkflowStatusFailed, err)
+		r.emit(nil, 0)
+		we.fireTriggers(r)
+		return err
+	}
+	return we.execute(ctx, r, steps)
+}
+
+// restore rebuilds the state of a run from its execution history and
+// returns the steps that continue it
+func (we *workflowExecutor) restore(r *run) ([]func(ctx context.Context) error, error) {
+	var steps []func(ctx context.Context) error
+	var ready []*domain.Task
+	visited := make(map[string]bool)
+	var visit func(tasks []*domain.Task) error
+	visit = func(tasks []*domain.Task) error {
+		for _, t := range tasks {
+			if visited[t.ID] {
+				continue
+			}
+			visited[t.ID] = true
+			te, ok := r.execution.Tasks[t.ID]
+			if !ok {
+				return fmt.Errorf("task %s (name: %s) is missing from the execution", t.ID, t.Name)
+			}
+			switch p, isDelay := t.Payload.(*domain.DelayPayload); {
+			case te.Status == domain.TaskStatusCompleted || te.Status == domain.TaskStatusSkipped ||
+				te.Status == domain.TaskStatusCancelled ||
+				te.Status == domain.TaskStatusFailed && !te.EndedAt.IsZero() && t.HandlesFailure():
+				// cancelled tasks of a running execution were cancelled by a
+				// join and failed ones had their failure handled
+				if te.Status == domain.TaskStatusFailed {
+					r.failed.Add(1)
+					r.data.setTaskFailure(t, te.Error)
+				} else if err := r.data.setTaskResult(t, te.Status, te.Output); err != nil {
+					return err
+				}
+				r.visited.Store(t.ID, true)
+				r.deps[t.ID].released.Store(true)
+				r.executed.Add(1)
+				for _, next := range t.Successors() {
+					deps := r.deps[next.ID]
+					if restoredCompleted(t, te, next) {
+						deps.completed.Add(1)
+					}
+					deps.pending.Add(-1)
+				}
+			case te.Status == domain.TaskStatusRunning && isDelay && !te.WakeAt.IsZero():
+				r.visited.Store(t.ID, true)
+				r.deps[t.ID].released.Store(true)
+				steps = append(steps, func(ctx context.Context) error {
+					return we.runTask(ctx, r, t, func(ctx context.Context) (func(next *domain.Task) bool, error) {
+						return completedAll, we.delayTask(ctx, r, t, p)
+					})
+				})
+			case te.Status == domain.TaskStatusPending:
+				ready = append(ready, t)
+			default:
+				return fmt.Errorf("task %s (name: %s) was interrupted while %s", t.ID, t.Name, te.Status)
+			}
+			if err := visit(t.Successors()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := visit(r.w.Tasks); err != nil {
+		return nil, err
+	}
+	// pending tasks whose predecessors are done were about to start
+	for _, t := range ready {
+		if r.deps[t.ID].release() {
+			steps = append(steps, func(ctx context.Context) error {
+				return we.executeTaskChain(ctx, r, t)
+			})
+		}
+	}
+	return steps, nil
+}
 
-	// Build pending dependency counters for fan-in support
-	pendingDeps := we.buildPendingDeps(w.Tasks)
+// restoredCompleted reports whether a next task saw a finished task as
+// completed before the run was interrupted
+func restoredCompleted(t *domain.Task, te *domain.TaskExecution, next *domain.Task) bool {
+	switch te.Status {
+	case domain.TaskStatusCompleted:
+		if t.IsOnFailure(next) {
+			return false
+		}
+		// a switch only completed for the branch it followed
+		_, isSwitch := t.Payload.(*domain.SwitchPayload)
+		return !isSwitch || switchBranch(te.Output) == next.Name
+	case domain.TaskStatusFailed:
+		return t.IsOnFailure(next)
+	default:
+		return false
+	}
+}
 
-	// Calculate total tasks in the workflow (count all tasks in pendingDeps map)
-	totalTasks := len(pendingDeps)
+// execute runs the steps of the run concurrently and records how it ended
+func (we *workflowExecutor) execute(ctx context.Context, r *run, steps []func(ctx context.Context) error) error {
+	// create cancelable context and defer cancel to cleanup, the run timeout
+	// cancels it with a cause wrapping context.DeadlineExceeded
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	r.timeout = newRunTimeout(executionTimeout, cancel)
+	defer r.timeout.stop()
 
 	// track root tasks
 	var wg sync.WaitGroup
 	// buffered channel to capture first error without blocking
 	errCh := make(chan error, 1)
-	// track completed tasks to prevent cycles (thread-safe)
-	completed := &sync.Map{}
-	// track executed tasks count (thread-safe)
-	executedCount := &atomic.Int32{}
 
-	w.Status = domain.WorkflowStatusRunning
-	for _, t := range w.Tasks {
+	r.setStatus(domain.WorkflowStatusRunning, nil)
+	for _, step := range steps {
 		wg.Add(1) // increment wg counter
-		go func(task *domain.Task) {
+		go func(step func(ctx context.Context) error) {
 			defer wg.Done() // decrement wg counter
-			if err := we.executeTaskChain(ctx, w, task, resultCh, pendingDeps, completed, executedCount, totalTasks); err != nil {
+			if err := step(ctx); err != nil {
 				select {
 				case errCh <- err:
-					cancel() // cancel all other tasks
+					cancel(errRunStopped) // cancel all other tasks
 				default: // error already sent, ignore
 				}
 			}
-		}(t)
+		}(step)
 	}
 	// block until all tasks are done
 	wg.Wait()
 
-	select {
-	case err := <-errCh:
-		w.Status = domain.WorkflowStatusFailed
+	var err error
+	status := domain.WorkflowStatusCompleted
+	if cause := context.Cause(ctx); errors.Is(cause, domain.ErrExecutionCancelled) {
+		// a cancelled run stops the tasks that have not finished yet
+		r.cancelUnfinished()
+		status, err = domain.WorkflowStatusCancelled, cause
+	} else {
+		select {
+		case err = <-errCh:
+			// so does a failed one, the tasks stopped by the failure are cancelled
+			r.cancelUnfinished()
+			status = domain.WorkflowStatusFailed
+		default:
+		}
+	}
+	if status == domain.WorkflowStatusFailed || status == domain.WorkflowStatusCancelled {
+		err = we.compensate(ctx, r, err)
+	}
+	if failed := r.failed.Load(); status == domain.WorkflowStatusCompleted && failed > 0 {
+		// the run went on after handled failures, they are summed up as
+		// the execution error but do not fail the run
+		status = domain.WorkflowStatusCompletedWithErrors
+		r.setStatus(status, fmt.Errorf("%d task(s) failed", failed))
+	} else {
+		r.setStatus(status, err)
+	}
+	r.emit(nil, 0)
+	we.fireTriggers(r)
+	return err
+}
+
+// compensate undoes the completed tasks of a failed or cancelled run by
+// running their compensations one at a time, the last completed task first.
+// They run even though the run was stopped, a failed compensation does not
+// stop the others but is added to the error of the run
+func (we *workflowExecutor) compensate(ctx context.Context, r *run, err error) error {
+	tasks := r.toCompensate()
+	if len(tasks) == 0 {
 		return err
-	default:
-		w.Status = domain.WorkflowStatusCompleted
-		resultCh <- map[string]interface{}{
-			"taskId":         "",
-			"status":         "",
-			"output":         "",
-			"workflowStatus": w.Status,
-			"totalTasks":     totalTasks,
-			"executedTasks":  int(executedCount.Load()),
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), executionTimeout)
+	defer cancel()
+
+	failed := 0
+	for _, ct := range tasks {
+		t, c := ct.task, ct.task.Compensation
+		// the result is set again since a run that failed to resume may not
+		// have restored it
+		if err := r.data.setTaskResult(t, ct.te.Status, ct.te.Output); err != nil {
+			log.Printf("failed to restore the output of task %s of execution %s: %v", t.ID, r.execution.ID, err)
 		}
-		return nil
+		r.startCompensation(t)
+		r.emitCompensation(t, domain.TaskStatusRunning, nil, nil, 0, int(c.Retries)+1)
+		_, cerr := we.runPart(ctx, r, c, c, r.data.vars([]*domain.Task{t}), func(status domain.TaskStatus, output interface{}, err error, attempt, maxAttempts int) {
+			// attempt is 0 when the compensation could not start
+			final := status != domain.TaskStatusFailed || attempt == 0 || attempt >= maxAttempts
+			r.finishCompensation(t, status, output, err, attempt, final)
+			r.emitCompensation(t, status, output, err, attempt, maxAttempts)
+		})
+		if cerr != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%w, %d compensation(s) failed", err, failed)
+	}
+	return err
+}
+
+// fireTriggers starts the workflows chained to the finished run, failures
+// are logged since they do not change the outcome of the run
+func (we *workflowExecutor) fireTriggers(r *run) {
+	we.mu.RLock()
+	ts := we.ts
+	we.mu.RUnlock()
+	if ts == nil {
+		return
+	}
+	triggers, err := we.tr.ListTriggers(r.w.ID)
+	if err != nil {
+		log.Printf("failed to load triggers of workflow %s: %v", r.w.ID, err)
+		return
+	}
+	r.mu.Lock()
+	e := r.execution.Clone()
+	r.mu.Unlock()
+	vars := r.data.vars(nil)
+
+	for _, t := range triggers {
+		if !t.FiresOn(e.Status) {
+			continue
+		}
+		if err := e.CanTrigger(t.TargetWorkflowID); err != nil {
+			log.Printf("trigger %s not fired: %v", t.ID, err)
+			continue
+		}
+		inputs, err := we.triggerInputs(t, e, vars)
+		if err != nil {
+			log.Printf("trigger %s not fired: %v", t.ID, err)
+			continue
+		}
+		started, err := ts.StartTriggered(e, t.TargetWorkflowID, inputs)
+		if err != nil {
+			log.Printf("trigger %s failed to start workflow %s: %v", t.ID, t.TargetWorkflowID, err)
+			continue
+		}
+		log.Printf("trigger %s started execution %s of workflow %s", t.ID, started.ID, t.TargetWorkflowID)
+	}
+}
+
+// triggerInputs evaluates the input expressions of a trigger against the
+// finished run, the outputs of the run are passed when the target declares them
+func (we *workflowExecutor) triggerInputs(t *domain.CompletionTrigger, e *domain.Execution, vars map[string]interface{}) (map[string]interface{}, error) {
+	inputs := make(map[string]interface{}, len(t.Inputs)+1)
+	for name, source := range t.Inputs {
+		expr, err := expression.Compile(source)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expression for input %s: %w", name, err)
+		}
+		// the run context may be done already, evaluations are cost limited
+		value, err := expr.Eval(context.Background(), vars)
+		if err != nil {
+			return nil, fmt.Errorf("failed to evaluate input %s: %w", name, err)
+		}
+		inputs[name] = value
+	}
+	if _, mapped := inputs[domain.TriggerInputOutputs]; mapped {
+		return inputs, nil
 	}
+	target, err := we.r.Get(t.TargetWorkflowID)
+	if err != nil {
+		return nil, err
+	}
+	for _, in := range target.Inputs {
+		if in.Name != domain.TriggerInputOutputs {
+			continue
+		}
+		outputs, err := toPlainValue(e.Outputs())
+		if err != nil {
+			return nil, err
+		}
+		inputs[domain.TriggerInputOutputs] = outputs
+	}
+	return inputs, nil
+}
+
+// taskDeps tracks the fan-in state of a task during a workflow execution
+type taskDeps struct {
+	predecessors []*domain.Task
+	join         domain.Join
+	total        int32        // number of predecessors
+	pending      atomic.Int32 // predecessors that have not finished yet
+	completed    atomic.Int32 // predecessors that finished without being skipped
+	released     atomic.Bool  // set once the task was handed over to run
+}
+
+// ready reports whether the task can start: every predecessor finished, or
+// enough of them completed for a join that does not wait for the rest
+func (d *taskDeps) ready() bool {
+	if d.pending.Load() == 0 {
+		return true
+	}
+	return d.join.Early() && int(d.completed.Load()) >= d.join.Needed()
+}
+
+// release reports whether the caller is the one to start the task, a task
+// becomes ready once but early joins are released again by later predecessors
+func (d *taskDeps) release() bool {
+	return d.ready() && d.released.CompareAndSwap(false, true)
 }
 
 // buildPendingDeps traverses the task graph and builds atomic counters
 // representing how many predecessors must complete before each task can run
-func (we *workflowExecutor) buildPendingDeps(rootTasks []*domain.Task) map[string]*atomic.Int32 {
-	pendingDeps := make(map[string]*atomic.Int32)
+func (we *workflowExecutor) buildPendingDeps(rootTasks []*domain.Task) map[string]*taskDeps {
+	pendingDeps := make(map[string]*taskDeps)
 	visited := make(map[string]bool)
 
 	var traverse func(task *domain.Task)
@@ -97,19 +410,19 @@ func (we *workflowExecutor) buildPendingDeps(rootTasks []*domain.Task) map[strin
 		}
 		visited[task.ID] = true
 
-		// initialize atomic counter to 0 if not exists
+		// initialize counters if not exists
 		if _, exists := pendingDeps[task.ID]; !exists {
-			pendingDeps[task.ID] = &atomic.Int32{}
-			pendingDeps[task.ID].Store(0)
+			pendingDeps[task.ID] = &taskDeps{join: task.Join}
 		}
 
 		// each next task has one more predecessor
-		for _, nextTask := range task.Next {
+		for _, nextTask := range task.Successors() {
 			if _, exists := pendingDeps[nextTask.ID]; !exists {
-				pendingDeps[nextTask.ID] = &atomic.Int32{}
-				pendingDeps[nextTask.ID].Store(0)
+				pendingDeps[nextTask.ID] = &taskDeps{join: nextTask.Join}
 			}
-			pendingDeps[nextTask.ID].Add(1)
+			pendingDeps[nextTask.ID].predecessors = append(pendingDeps[nextTask.ID].predecessors, task)
+			pendingDeps[nextTask.ID].total++
+			pendingDeps[nextTask.ID].pending.Add(1)
 			traverse(nextTask)
 		}
 	}
@@ -121,74 +434,614 @@ func (we *workflowExecutor) buildPendingDeps(rootTasks []*domain.Task) map[strin
 	return pendingDeps
 }
 
-func (we *workflowExecutor) executeTaskChain(
-	ctx context.Context,
-	w *domain.Workflow,
-	task *domain.Task,
-	resultCh chan<- map[string]interface{},
-	pendingDeps map[string]*atomic.Int32,
-	completed *sync.Map,
-	executedCount *atomic.Int32,
-	totalTasks int,
-) error {
+func (we *workflowExecutor) executeTaskChain(ctx context.Context, r *run, task *domain.Task) error {
 	// check for context cancellation
 	select {
 	case <-ctx.Done():
-		return ctx.Err()
+		return context.Cause(ctx)
 	default:
 	}
 
-	// check for cycle: if task already completed, return error
-	if _, alreadyCompleted := completed.Load(task.ID); alreadyCompleted {
-		return fmt.Errorf("cycle detected: task %s (name: %s) already executed in this workflow execution", task.ID, task.Name)
-	}
-
 	// check if all dependencies are satisfied
-	counter := pendingDeps[task.ID]
-	if counter.Load() > 0 {
+	deps := r.deps[task.ID]
+	if !deps.ready() {
 		// not ready yet, skip (another goroutine will execute when ready)
 		return nil
 	}
 
-	// execute task
-	result, err := we.te.Execute(ctx, task)
-	if err != nil {
+	// check for cycle: if task already executed, return error
+	if _, alreadyExecuted := r.visited.LoadOrStore(task.ID, true); alreadyExecuted {
+		return fmt.Errorf("cycle detected: task %s (name: %s) already executed in this workflow execution", task.ID, task.Name)
+	}
+
+	// a task is skipped when too few of its predecessors completed for its
+	// join or when its condition is false, skipped tasks still release their
+	// next tasks
+	vars := r.data.vars(deps.predecessors)
+	run := deps.total == 0 || int(deps.completed.Load()) >= deps.join.Needed()
+	if run {
+		var err error
+		if run, err = evalCondition(ctx, task, vars); err != nil {
+			return err
+		}
+	}
+	if !run {
+		return we.skipTask(ctx, r, task)
+	}
+
+	// an early join no longer needs the predecessors that are left, the ones
+	// other tasks still wait for keep running and the join just stops waiting
+	if deps.join.CancelRemaining {
+		for _, p := range deps.predecessors {
+			if onlyLeadsTo(p, task) {
+				r.cancelTask(p)
+			}
+		}
+	}
+	return we.runTask(ctx, r, task, func(ctx context.Context) (func(next *domain.Task) bool, error) {
+		return we.executeTask(ctx, r, task, vars)
+	})
+}
+
+// onlyLeadsTo reports whether every successor of a task is the given task
+func onlyLeadsTo(t, next *domain.Task) bool {
+	for _, s := range t.Successors() {
+		if s.ID != next.ID {
+			return false
+		}
+	}
+	return true
+}
+
+// errJoinCancelled is the cause of tasks cancelled by a join that no longer
+// waits for them, the rest of the run goes on
+var errJoinCancelled = errors.New("cancelled by a join that no longer waits for the task")
+
+// errRunStopped is the cause of tasks stopped because another task failed
+// the run, they are cancelled rather than failed
+var errRunStopped = errors.New("stopped after another task failed")
+
+// cancelCause returns the cause of a task stopped on request, with the whole
+// execution or by a join, or by the failure of another task, and nil otherwise
+func cancelCause(ctx context.Context) error {
+	cause := context.Cause(ctx)
+	if errors.Is(cause, domain.ErrExecutionCancelled) || errors.Is(cause, errJoinCancelled) ||
+		errors.Is(cause, errRunStopped) {
+		return cause
+	}
+	return nil
+}
+
+// runTask runs a task that is ready with a context of its own, so a join
+// can cancel it without stopping the run, and then releases its next tasks.
+// fn returns whether each next task sees the task as completed
+func (we *workflowExecutor) runTask(ctx context.Context, r *run, task *domain.Task,
+	fn func(ctx context.Context) (func(next *domain.Task) bool, error)) error {
+	taskCtx, done := r.trackTask(ctx, task)
+	var (
+		completed func(next *domain.Task) bool
+		err       error
+	)
+	if err = context.Cause(taskCtx); err == nil {
+		r.timeout.begin()
+		completed, err = fn(taskCtx)
+		r.timeout.end()
+	}
+	done()
+	if err == nil {
+		return we.releaseNext(ctx, r, task, func(next *domain.Task) bool {
+			return !task.IsOnFailure(next) && completed(next)
+		})
+	}
+	if ctx.Err() != nil {
+		return err
+	}
+	if errors.Is(context.Cause(taskCtx), errJoinCancelled) {
+		// cancelled tasks count as executed so progress still reaches the total
+		r.executed.Add(1)
+		r.finishTask(task, domain.TaskStatusCancelled, nil, errJoinCancelled, true)
+		r.emit(task, int(task.Retries)+1)
+		return we.executeNext(ctx, r, task, false)
+	}
+	taskErr, failed := r.failedWith(task)
+	if !failed || !task.HandlesFailure() {
 		return err
 	}
+	// the failure is handled, only the on failure task sees the task as
+	// completed and finds the error in upstream
+	r.failed.Add(1)
+	r.data.setTaskFailure(task, taskErr)
+	return we.releaseNext(ctx, r, task, task.IsOnFailure)
+}
 
-	// mark task as completed
-	completed.Store(task.ID, true)
+// completedAll releases every next task as completed
+func completedAll(*domain.Task) bool {
+	return true
+}
+
+// executeTask runs a task with its placeholders resolved and returns
+// whether each next task sees it as completed
+func (we *workflowExecutor) executeTask(ctx context.Context, r *run, task *domain.Task, vars map[string]interface{}) (func(next *domain.Task) bool, error) {
+	// resolve placeholders referencing inputs and upstream outputs, the
+	// task executor works on a copy so the definition stays untouched
+	payload, err := renderPayload(ctx, task.Payload, vars)
+	if err != nil {
+		r.executed.Add(1)
+		r.finishTask(task, domain.TaskStatusFailed, nil, err, true)
+		r.emit(task, int(task.Retries)+1)
+		return nil, fmt.Errorf("task %s (name: %s): %w", task.ID, task.Name, err)
+	}
+	rendered := *task
+	rendered.Payload = payload
 
-	// increment executed count
-	count := executedCount.Add(1)
+	switch p := payload.(type) {
+	case *domain.DelayPayload:
+		// delays are handled by the run itself so they can be paused and resumed
+		return completedAll, we.delayTask(ctx, r, task, p)
+	case *domain.MapPayload:
+		// maps and loops retry each item or iteration on its own
+		return completedAll, we.mapTask(ctx, r, task, p, vars)
+	case *domain.LoopPayload:
+		return completedAll, we.loopTask(ctx, r, task, p, vars)
+	case *domain.SwitchPayload:
+		return we.switchTask(ctx, r, task, p, vars)
+	default:
+		return completedAll, we.retryTask(ctx, r, task, &rendered)
+	}
+}
+
+// retryTask executes a task, retrying failed attempts up to task.Retries times
+func (we *workflowExecutor) retryTask(ctx context.Context, r *run, task, rendered *domain.Task) error {
+	maxAttempts := int(task.Retries) + 1
+	var result interface{}
+	for {
+		attempt := r.startAttempt(task)
+		var err error
+		result, err = we.executeAttempt(ctx, r, task, rendered)
+		if err == nil {
+			break
+		}
+		if cause := cancelCause(ctx); cause != nil {
+			// interrupted rather than failed, Execute marks it cancelled
+			return cause
+		}
+		final := attempt >= maxAttempts || ctx.Err() != nil
+		if final {
+			r.executed.Add(1)
+		}
+		r.finishTask(task, domain.TaskStatusFailed, nil, err, final)
+		// stream the failed attempt so clients can follow the retries
+		r.emit(task, maxAttempts)
+		if final {
+			return fmt.Errorf("task %s (name: %s) failed after %d attempt(s): %w", task.ID, task.Name, attempt, err)
+		}
+		if err := sleep(ctx, task.RetryDelay); err != nil {
+			return err
+		}
+	}
+
+	// mark task as completed
+	if err := r.data.setTaskResult(task, domain.TaskStatusCompleted, result); err != nil {
+		return err
+	}
+	r.executed.Add(1)
+	r.finishTask(task, domain.TaskStatusCompleted, result, nil, true)
 
 	// stream result to channel
-	resultCh <- map[string]interface{}{
-		"taskId":         task.ID,
-		"status":         task.Status,
-		"output":         result,
-		"workflowStatus": w.Status,
-		"totalTasks":     totalTasks,
-		"executedTasks":  int(count),
+	r.emit(task, maxAttempts)
+	return nil
+}
+
+// delayTask waits until the delay is due without holding the run timeout,
+// the wake time is persisted first so the wait survives a server restart
+func (we *workflowExecutor) delayTask(ctx context.Context, r *run, task *domain.Task, p *domain.DelayPayload) error {
+	maxAttempts := int(task.Retries) + 1
+	wakeAt, err := r.startDelay(task, p)
+	if err != nil {
+		r.executed.Add(1)
+		r.finishTask(task, domain.TaskStatusFailed, nil, err, true)
+		r.emit(task, maxAttempts)
+		return fmt.Errorf("task %s (name: %s) failed: %w", task.ID, task.Name, err)
+	}
+
+	// a waiting delay runs without holding the clock
+	r.timeout.pause()
+	err = sleep(ctx, time.Until(wakeAt))
+	r.timeout.resume()
+	if err != nil {
+		if cause := cancelCause(ctx); cause != nil {
+			// left running, the run cancels it with its other unfinished tasks
+			return cause
+		}
+		r.executed.Add(1)
+		r.finishTask(task, domain.TaskStatusFailed, nil, err, true)
+		r.emit(task, maxAttempts)
+		return fmt.Errorf("task %s (name: %s) failed: %w", task.ID, task.Name, err)
+	}
+
+	result := &domain.DelayResult{WakeAt: wakeAt}
+	if err := r.data.setTaskResult(task, domain.TaskStatusCompleted, result); err != nil {
+		return err
+	}
+	r.executed.Add(1)
+	r.finishTask(task, domain.TaskStatusCompleted, result, nil, true)
+	r.emit(task, maxAttempts)
+	return nil
+}
+
+// executeAttempt runs a single attempt of a rendered task, owner is the task
+// of the workflow graph it runs for, the task itself when it is not part of a map
+func (we *workflowExecutor) executeAttempt(ctx context.Context, r *run, owner, rendered *domain.Task) (interface{}, error) {
+	if p, ok := rendered.Payload.(*domain.SubworkflowPayload); ok {
+		return we.runSubworkflow(ctx, r, owner, p)
+	}
+	return we.te.Execute(ctx, rendered)
+}
+
+// mapTask runs the task of the map once per item, at most MaxParallelism at
+// a time, and records the outputs in item order
+func (we *workflowExecutor) mapTask(ctx context.Context, r *run, task *domain.Task, p *domain.MapPayload, vars map[string]interface{}) error {
+	r.startAttempt(task)
+	// the map itself only waits for its items, they hold the run timeout
+	r.timeout.pause()
+	results, failed, firstErr := we.runItems(ctx, r, task, p, vars)
+	r.timeout.resume()
+	if cause := cancelCause(ctx); cause != nil {
+		// items stopped along with the run are not failures of the map
+		return cause
+	}
+
+	total := len(p.Values)
+	var err error
+	if failed > 0 {
+		err = fmt.Errorf("%d of %d items failed, first %w", failed, total, firstErr)
+	}
+	if !p.Tolerates(failed, total) || ctx.Err() != nil {
+		if err == nil {
+			err = context.Cause(ctx)
+		}
+		r.executed.Add(1)
+		r.finishTask(task, domain.TaskStatusFailed, nil, err, true)
+		r.emit(task, 1)
+		return fmt.Errorf("task %s (name: %s) failed: %w", task.ID, task.Name, err)
+	}
+
+	if err := r.data.setTaskResult(task, domain.TaskStatusCompleted, results); err != nil {
+		return err
+	}
+	r.executed.Add(1)
+	// tolerated failures are kept as the error of the completed task
+	r.finishTask(task, domain.TaskStatusCompleted, results, err, true)
+	r.emit(task, 1)
+	return nil
+}
+
+// runItems runs every item of a map and returns their outputs, how many
+// failed and the first failure. Items left once the failure policy gives up
+// are stopped and do not count as failed
+func (we *workflowExecutor) runItems(ctx context.Context, r *run, task *domain.Task, p *domain.MapPayload, vars map[string]interface{}) ([]interface{}, int, error) {
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+
+	results := make([]interface{}, len(p.Values))
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex // guards failed and firstErr
+		failed   int
+		firstErr error
+	)
+	slots := make(chan struct{}, p.MaxParallelism)
+	for i, item := range p.Values {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(index int, item interface{}) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			out, err := we.runItem(ctx, r, task, p.Task, index, item, vars)
+			if err != nil && ctx.Err() == nil {
+				mu.Lock()
+				failed++
+				if firstErr == nil {
+					firstErr = fmt.Errorf("item %d: %w", index, err)
+				}
+				if !p.Tolerates(failed, len(p.Values)) {
+					stop()
+				}
+				mu.Unlock()
+				return
+			}
+			results[index] = out
+		}(i, item)
+	}
+	wg.Wait()
+	return results, failed, firstErr
+}
+
+// runItem runs the task of a map for one item
+func (we *workflowExecutor) runItem(ctx context.Context, r *run, owner, task *domain.Task, index int, item interface{}, vars map[string]interface{}) (interface{}, error) {
+	itemVars := make(map[string]interface{}, len(vars)+2)
+	for k, v := range vars {
+		itemVars[k] = v
+	}
+	itemVars[expression.VarItem] = item
+	itemVars[expression.VarIndex] = index
+
+	return we.runPart(ctx, r, owner, task, itemVars, func(status domain.TaskStatus, output interface{}, err error, attempt, maxAttempts int) {
+		r.emitItem(owner, index, status, output, err, attempt, maxAttempts)
+	})
+}
+
+// runPart runs the task of a map or loop once, retrying failed attempts.
+// Its progress is streamed through emit since it is not part of the graph
+func (we *workflowExecutor) runPart(ctx context.Context, r *run, owner, task *domain.Task, vars map[string]interface{},
+	emit func(status domain.TaskStatus, output interface{}, err error, attempt, maxAttempts int)) (interface{}, error) {
+	maxAttempts := int(task.Retries) + 1
+	run, err := evalCondition(ctx, task, vars)
+	if err != nil {
+		emit(domain.TaskStatusFailed, nil, err, 0, maxAttempts)
+		return nil, err
+	}
+	if !run {
+		emit(domain.TaskStatusSkipped, nil, nil, 0, maxAttempts)
+		return nil, nil
+	}
+	payload, err := renderPayload(ctx, task.Payload, vars)
+	if err != nil {
+		err = fmt.Errorf("task %s (name: %s): %w", task.ID, task.Name, err)
+		emit(domain.TaskStatusFailed, nil, err, 0, maxAttempts)
+		return nil, err
+	}
+	rendered := *task
+	rendered.Payload = payload
+
+	r.timeout.begin()
+	defer r.timeout.end()
+	for attempt := 1; ; attempt++ {
+		out, err := we.executeAttempt(ctx, r, owner, &rendered)
+		if err == nil {
+			emit(domain.TaskStatusCompleted, out, nil, attempt, maxAttempts)
+			return out, nil
+		}
+		if ctx.Err() != nil {
+			// stopped by the failure policy, the deadline or the run
+			emit(domain.TaskStatusCancelled, nil, err, attempt, maxAttempts)
+			return nil, err
+		}
+		emit(domain.TaskStatusFailed, nil, err, attempt, maxAttempts)
+		if attempt >= maxAttempts {
+			return nil, err
+		}
+		if err := sleep(ctx, task.RetryDelay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// loopTask runs the task of the loop until its while condition no longer
+// holds, the output is the number of iterations and the last output
+func (we *workflowExecutor) loopTask(ctx context.Context, r *run, task *domain.Task, p *domain.LoopPayload, vars map[string]interface{}) error {
+	r.startAttempt(task)
+	// the loop itself only waits for its iterations, so like delays the
+	// intervals between iterations do not hold the run timeout
+	r.timeout.pause()
+	result, err := we.runIterations(ctx, r, task, p, vars)
+	r.timeout.resume()
+	if cause := cancelCause(ctx); cause != nil {
+		// an iteration cut short by the run does not fail the loop
+		return cause
+	}
+	if err != nil {
+		r.executed.Add(1)
+		r.finishTask(task, domain.TaskStatusFailed, nil, err, true)
+		r.emit(task, 1)
+		return fmt.Errorf("task %s (name: %s) failed: %w", task.ID, task.Name, err)
 	}
 
+	if err := r.data.setTaskResult(task, domain.TaskStatusCompleted, result); err != nil {
+		return err
+	}
+	r.executed.Add(1)
+	r.finishTask(task, domain.TaskStatusCompleted, result, nil, true)
+	r.emit(task, 1)
+	return nil
+}
+
+// runIterations runs the iterations of a loop one after the other. The loop
+// fails when an iteration fails, when its deadline passes or when the
+// condition still holds after the last iteration allowed
+func (we *workflowExecutor) runIterations(ctx context.Context, r *run, task *domain.Task, p *domain.LoopPayload, vars map[string]interface{}) (*domain.LoopResult, error) {
+	while, err := expression.CompileBool(p.While)
+	if err != nil {
+		return nil, fmt.Errorf("invalid while condition: %w", err)
+	}
+	if p.Deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, p.Deadline,
+			fmt.Errorf("loop deadline of %v passed: %w", p.Deadline, context.DeadlineExceeded))
+		defer cancel()
+	}
+
+	iterationVars := make(map[string]interface{}, len(vars)+2)
+	for k, v := range vars {
+		iterationVars[k] = v
+	}
+	var output interface{}
+	for iteration := 1; ; iteration++ {
+		iterationVars[expression.VarIteration] = iteration
+		out, err := we.runPart(ctx, r, task, p.Task, iterationVars, func(status domain.TaskStatus, output interface{}, err error, attempt, maxAttempts int) {
+			r.emitIteration(task, iteration, status, output, err, attempt, maxAttempts)
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				err = context.Cause(ctx)
+			}
+			return nil, fmt.Errorf("iteration %d: %w", iteration, err)
+		}
+		output = out
+		plain, err := toPlainValue(out)
+		if err != nil {
+			return nil, fmt.Errorf("iteration %d: %w", iteration, err)
+		}
+		iterationVars[expression.VarOutput] = plain
+
+		again, err := while.EvalBool(ctx, iterationVars)
+		if err != nil {
+			return nil, fmt.Errorf("iteration %d: failed to evaluate while condition: %w", iteration, err)
+		}
+		if !again {
+			return &domain.LoopResult{Iterations: iteration, Output: output}, nil
+		}
+		if iteration >= p.MaxIterations {
+			return nil, fmt.Errorf("while condition still held after %d iterations", iteration)
+		}
+
+		if err := sleep(ctx, p.Interval); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// runSubworkflow runs the workflow of the task as a child execution, the
+// child is bound to the run so cancelling the run cancels it too
+func (we *workflowExecutor) runSubworkflow(ctx context.Context, r *run, task *domain.Task, p *domain.SubworkflowPayload) (interface{}, error) {
+	we.mu.RLock()
+	sr := we.sr
+	we.mu.RUnlock()
+	if sr == nil {
+		return nil, fmt.Errorf("subworkflows are not available")
+	}
+	r.mu.Lock()
+	parent := r.execution.Clone()
+	r.mu.Unlock()
+
+	// the child is bound by its own timeout
+	r.timeout.pause()
+	child, err := sr.RunChild(ctx, parent, task.ID, p.WorkflowID, p.Values)
+	r.timeout.resume()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run subworkflow %s: %w", p.WorkflowID, err)
+	}
+	// handled failures of the child are left to the output status
+	if child.Status != domain.WorkflowStatusCompleted && child.Status != domain.WorkflowStatusCompletedWithErrors {
+		return nil, fmt.Errorf("subworkflow execution %s finished with status %s: %s", child.ID, child.Status, child.Error)
+	}
+	return &domain.SubworkflowResult{
+		ExecutionID: child.ID,
+		Status:      child.Status,
+		Outputs:     child.Outputs(),
+	}, nil
+}
+
+// switchTask completes the switch with the branch it follows, only the
+// followed next task sees it as completed so the others are skipped unless
+// another of their predecessors completes
+func (we *workflowExecutor) switchTask(ctx context.Context, r *run, task *domain.Task, p *domain.SwitchPayload, vars map[string]interface{}) (func(next *domain.Task) bool, error) {
+	r.startAttempt(task)
+	result, err := selectBranch(ctx, p, vars)
+	if err != nil {
+		r.executed.Add(1)
+		r.finishTask(task, domain.TaskStatusFailed, nil, err, true)
+		r.emit(task, 1)
+		return nil, fmt.Errorf("task %s (name: %s) failed: %w", task.ID, task.Name, err)
+	}
+
+	if err := r.data.setTaskResult(task, domain.TaskStatusCompleted, result); err != nil {
+		return nil, err
+	}
+	r.executed.Add(1)
+	r.finishTask(task, domain.TaskStatusCompleted, result, nil, true)
+	r.emit(task, 1)
+
+	return func(next *domain.Task) bool {
+		return next.Name == result.Branch
+	}, nil
+}
+
+// selectBranch evaluates the cases of a switch in order and returns the
+// first one that matches, or the default branch
+func selectBranch(ctx context.Context, p *domain.SwitchPayload, vars map[string]interface{}) (*domain.SwitchResult, error) {
+	for i, c := range p.Cases {
+		expr, err := expression.CompileBool(c.When)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expression for case %d: %w", i, err)
+		}
+		match, err := expr.EvalBool(ctx, vars)
+		if err != nil {
+			return nil, fmt.Errorf("failed to evaluate case %d: %w", i, err)
+		}
+		if match {
+			return &domain.SwitchResult{Case: i, Branch: c.Next}, nil
+		}
+	}
+	return &domain.SwitchResult{Case: -1, Branch: p.Default}, nil
+}
+
+// switchBranch returns the branch recorded in the output of a switch, which
+// is decoded from JSON when the execution was loaded from the repository
+func switchBranch(output interface{}) string {
+	switch o := output.(type) {
+	case *domain.SwitchResult:
+		return o.Branch
+	case map[string]interface{}:
+		branch, _ := o["branch"].(string)
+		return branch
+	default:
+		return ""
+	}
+}
+
+// skipTask marks a task as skipped and releases its next tasks
+func (we *workflowExecutor) skipTask(ctx context.Context, r *run, task *domain.Task) error {
+	if err := r.data.setTaskResult(task, domain.TaskStatusSkipped, nil); err != nil {
+		return err
+	}
+	// skipped tasks count as executed so progress still reaches the total
+	r.executed.Add(1)
+	r.finishTask(task, domain.TaskStatusSkipped, nil, nil, true)
+	r.emit(task, 0)
+	return we.executeNext(ctx, r, task, false)
+}
+
+// executeNext releases the fan-in counters of the next tasks and executes
+// the ones whose dependencies are all satisfied
+func (we *workflowExecutor) executeNext(ctx context.Context, r *run, task *domain.Task, taskCompleted bool) error {
+	return we.releaseNext(ctx, r, task, func(*domain.Task) bool {
+		return taskCompleted
+	})
+}
+
+// releaseNext is executeNext for tasks that did not complete for every next
+// task, completed reports whether a next task sees the task as completed.
+// The on failure task is released along with the next tasks
+func (we *workflowExecutor) releaseNext(ctx context.Context, r *run, task *domain.Task, completed func(next *domain.Task) bool) error {
 	// track next tasks
 	var wg sync.WaitGroup
 	// buffered channel to capture first error without blocking
 	errCh := make(chan error, 1)
 
-	// execute next tasks if current task succeeded
-	for _, nextTask := range task.Next {
+	for _, nextTask := range task.Successors() {
+		deps := r.deps[nextTask.ID]
+		// must be recorded before releasing the pending count so the
+		// goroutine that sees it reach 0 observes it
+		if completed(nextTask) {
+			deps.completed.Add(1)
+		}
 		// atomically decrement the pending count for the next task
-		newCount := pendingDeps[nextTask.ID].Add(-1)
+		deps.pending.Add(-1)
 
-		// if count reaches 0, all dependencies are satisfied
-		if newCount == 0 {
+		// the first predecessor to find the next task ready starts it
+		if deps.release() {
 			wg.Add(1) // increment wg counter
 			go func(nt *domain.Task) {
 				defer wg.Done() // decrement wg counter
 				// recursively execute next tasks
-				if err := we.executeTaskChain(ctx, w, nt, resultCh, pendingDeps, completed, executedCount, totalTasks); err != nil {
+				if err := we.executeTaskChain(ctx, r, nt); err != nil {
 					select {
 					case errCh <- err: // capture first error
 					default: // error already sent, ignore
@@ -208,3 +1061,96 @@ func (we *workflowExecutor) executeTaskChain(
 		return nil
 	}
 }
+
+// sleep waits for the given duration or until the context is done
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return context.Cause(ctx)
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	case <-timer.C:
+		return nil
+	}
+}
+
+// runTimeout cancels a run once it has been running for a given time, it
+// counts the tasks, map items and loop iterations running and the ones among
+// them that are waiting. The clock only stops while every one of them waits,
+// so a delay in one branch does not lift the timeout of the others
+type runTimeout struct {
+	mu        sync.Mutex
+	d         time.Duration
+	remaining time.Duration
+	started   time.Time
+	running   int // tasks, items and iterations running
+	waiting   int // running ones that wait on a delay, a child or their parts
+	paused    bool
+	stopped   bool
+	timer     *time.Timer
+	cancel    context.CancelCauseFunc
+}
+
+func newRunTimeout(d time.Duration, cancel context.CancelCauseFunc) *runTimeout {
+	t := &runTimeout{d: d, remaining: d, started: time.Now(), cancel: cancel}
+	t.timer = time.AfterFunc(d, t.expire)
+	return t
+}
+
+func (t *runTimeout) expire() {
+	t.cancel(fmt.Errorf("execution timed out after %v: %w", t.d, context.DeadlineExceeded))
+}
+
+// begin and end surround a task, item or iteration that runs
+func (t *runTimeout) begin() {
+	t.update(func() { t.running++ })
+}
+
+func (t *runTimeout) end() {
+	t.update(func() { t.running-- })
+}
+
+// pause and resume surround a wait of a running task, item or iteration
+func (t *runTimeout) pause() {
+	t.update(func() { t.waiting++ })
+}
+
+func (t *runTimeout) resume() {
+	t.update(func() { t.waiting-- })
+}
+
+// update applies the change and stops or restarts the clock accordingly
+func (t *runTimeout) update(change func()) {
+	if t == nil {
+		// compensations of a run that failed to resume run without a timeout
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	change()
+	if t.stopped {
+		return
+	}
+	pause := t.running > 0 && t.waiting == t.running
+	switch {
+	case pause && !t.paused:
+		if t.timer.Stop() {
+			t.remaining -= time.Since(t.started)
+			t.paused = true
+		}
+	case !pause && t.paused:
+		t.paused = false
+		t.started = time.Now()
+		t.timer = time.AfterFunc(t.remaining, t.expire)
+	}
+}
+
+func (t *runTimeout) stop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.stopped = true
+	t.timer.Stop()
+}
@@ -0,0 +1,394 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/domain"
+	wr "github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/repository"
+)
+
+// flakyTaskExecutor fails the first attempts of every task, log tasks
+// output their message
+type flakyTaskExecutor struct {
+	failures int
+
+	mu       sync.Mutex
+	attempts map[string][]time.Time    // start of every attempt by task name
+	payloads map[string]domain.Payload // last payload executed by task name
+}
+
+func (fe *flakyTaskExecutor) Execute(ctx context.Context, t *domain.Task) (interface{}, error) {
+	fe.mu.Lock()
+	defer fe.mu.Unlock()
+	if fe.attempts == nil {
+		fe.attempts = make(map[string][]time.Time)
+		fe.payloads = make(map[string]domain.Payload)
+	}
+	fe.attempts[t.Name] = append(fe.attempts[t.Name], time.Now())
+	fe.payloads[t.Name] = t.Payload
+	if len(fe.attempts[t.Name]) <= fe.failures {
+		return nil, errors.New("boom")
+	}
+	if p, ok := t.Payload.(*domain.LogPayload); ok {
+		return p.Message, nil
+	}
+	return t.Name, nil
+}
+
+func newLogTask(t *testing.T, name string, retries uint32, retryDelay time.Duration, next ...*domain.Task) *domain.Task {
+	t.Helper()
+	task, err := domain.NewTask(name, domain.TaskTypeLog, retries, retryDelay, "", domain.Join{}, "", &domain.LogPayload{Message: name}, next, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create task %s: %v", name, err)
+	}
+	return task
+}
+
+func newTestWorkflow(t *testing.T, tasks ...*domain.Task) *domain.Workflow {
+	t.Helper()
+	w, err := domain.NewWorkflow("test", "", nil, tasks)
+	if err != nil {
+		t.Fatalf("failed to create workflow: %v", err)
+	}
+	return w
+}
+
+// testExecutor runs workflows against an in-memory repository
+type testExecutor struct {
+	WorkflowExecutor
+	repo *wr.MemoryRepo
+}
+
+func newTestExecutor(te TaskExecutor) *testExecutor {
+	repo := wr.NewMemoryRepository()
+	return &testExecutor{
+		WorkflowExecutor: NewWorkflowExecutor(repo, repo, repo, te),
+		repo:             repo,
+	}
+}
+
+// run executes the workflow to the end and returns its execution and the
+// events it streamed
+func (te *testExecutor) run(ctx context.Context, w *domain.Workflow, inputs map[string]interface{}) (*domain.Execution, []*domain.ExecutionEvent, error) {
+	e := domain.NewExecution(w, inputs)
+	if err := te.repo.CreateExecution(e); err != nil {
+		return nil, nil, err
+	}
+	eventCh := make(chan *domain.ExecutionEvent)
+	var events []*domain.ExecutionEvent
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for ev := range eventCh {
+			events = append(events, ev)
+		}
+	}()
+	err := te.Execute(ctx, w, e, eventCh)
+	close(eventCh)
+	<-done
+	return e, events, err
+}
+
+func TestExecuteRetriesFailedAttempts(t *testing.T) {
+	te := &flakyTaskExecutor{failures: 2}
+	task := newLogTask(t, "flaky", 2, 50*time.Millisecond)
+
+	_, events, err := newTestExecutor(te).run(context.Background(), newTestWorkflow(t, task), nil)
+	if err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+
+	attempts := te.attempts["flaky"]
+	if len(attempts) != 3 {
+		t.Fatalf("got %d attempts, want 3", len(attempts))
+	}
+	for i := 1; i < len(attempts); i++ {
+		if gap := attempts[i].Sub(attempts[i-1]); gap < task.RetryDelay {
+			t.Errorf("attempt %d started %v after the previous one, want at least %v", i+1, gap, task.RetryDelay)
+		}
+	}
+
+	// every failed attempt is streamed before the result
+	var got []int
+	for _, ev := range events {
+		if ev.TaskID != task.ID {
+			continue
+		}
+		got = append(got, ev.Attempt)
+		if ev.MaxAttempts != 3 {
+			t.Errorf("got max attempts %d, want 3", ev.MaxAttempts)
+		}
+		failed := ev.TaskStatus == domain.TaskStatusFailed
+		if last := ev.Attempt == 3; failed == last {
+			t.Errorf("attempt %d: got status %s", ev.Attempt, ev.TaskStatus)
+		}
+	}
+	if fmt.Sprint(got) != "[1 2 3]" {
+		t.Errorf("got attempts %v, want [1 2 3]", got)
+	}
+}
+
+func TestExecuteFailsOnceRetriesRunOut(t *testing.T) {
+	te := &flakyTaskExecutor{failures: 5}
+	task := newLogTask(t, "flaky", 1, 0)
+
+	_, _, err := newTestExecutor(te).run(context.Background(), newTestWorkflow(t, task), nil)
+	if err == nil || !strings.Contains(err.Error(), "failed after 2 attempt(s)") {
+		t.Fatalf("got error %v, want the task to fail after 2 attempts", err)
+	}
+	if len(te.attempts["flaky"]) != 2 {
+		t.Errorf("got %d attempts, want 2", len(te.attempts["flaky"]))
+	}
+}
+
+func TestExecuteStopsRetryingWhenCancelled(t *testing.T) {
+	te := &flakyTaskExecutor{failures: 5}
+	task := newLogTask(t, "flaky", 5, domain.TaskMaxRetryDelay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, _, err := newTestExecutor(te).run(ctx, newTestWorkflow(t, task), nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got error %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed >= domain.TaskMaxRetryDelay {
+		t.Errorf("the retry delay was not interrupted, execute took %v", elapsed)
+	}
+	if len(te.attempts["flaky"]) != 1 {
+		t.Errorf("got %d attempts, want 1", len(te.attempts["flaky"]))
+	}
+}
+
+func assertTaskStatus(t *testing.T, e *domain.Execution, task *domain.Task, want domain.TaskStatus) {
+	t.Helper()
+	if got := e.Tasks[task.ID].Status; got != want {
+		t.Errorf("task %s: got status %s, want %s", task.Name, got, want)
+	}
+}
+
+func newConditionTask(t *testing.T, name, condition string, next ...*domain.Task) *domain.Task {
+	t.Helper()
+	task, err := domain.NewTask(name, domain.TaskTypeLog, 0, 0, condition, domain.Join{}, "", &domain.LogPayload{Message: name}, next, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create task %s: %v", name, err)
+	}
+	return task
+}
+
+func TestExecuteSkipsTasksWithFalseConditions(t *testing.T) {
+	// a -> b (true)
+	// a -> c (false) -> d
+	// b, d -> e
+	e := newConditionTask(t, "e", "")
+	d := newConditionTask(t, "d", "", e)
+	c := newConditionTask(t, "c", `tasks.a.output == "other"`, d)
+	b := newConditionTask(t, "b", `tasks.a.output == "a" && tasks.a.status == "COMPLETED"`, e)
+	a := newConditionTask(t, "a", "", b, c)
+
+	te := &flakyTaskExecutor{}
+	ex, events, err := newTestExecutor(te).run(context.Background(), newTestWorkflow(t, a), nil)
+	if err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+
+	assertTaskStatus(t, ex, a, domain.TaskStatusCompleted)
+	assertTaskStatus(t, ex, b, domain.TaskStatusCompleted)
+	assertTaskStatus(t, ex, c, domain.TaskStatusSkipped)
+	// every predecessor of d was skipped
+	assertTaskStatus(t, ex, d, domain.TaskStatusSkipped)
+	// one predecessor of e completed
+	assertTaskStatus(t, ex, e, domain.TaskStatusCompleted)
+	for _, task := range []*domain.Task{c, d} {
+		if len(te.attempts[task.Name]) != 0 {
+			t.Errorf("skipped task %s was executed", task.Name)
+		}
+	}
+	last := events[len(events)-1]
+	if last.ExecutedTasks != 5 || last.TotalTasks != 5 {
+		t.Errorf("got %d of %d tasks executed, want skipped tasks to count", last.ExecutedTasks, last.TotalTasks)
+	}
+}
+
+func TestExecuteFailsOnConditionErrors(t *testing.T) {
+	// the condition type checks but the field does not exist at runtime
+	a := newConditionTask(t, "a", "tasks.missing.output == 1")
+
+	_, _, err := newTestExecutor(&flakyTaskExecutor{}).run(context.Background(), newTestWorkflow(t, a), nil)
+	if err == nil || !strings.Contains(err.Error(), "failed to evaluate condition") {
+		t.Fatalf("got error %v, want the condition to fail", err)
+	}
+}
+
+func TestNewTaskRejectsInvalidConditions(t *testing.T) {
+	for _, condition := range []string{"tasks.a.output ==", `"not a bool"`, "unknown == 1"} {
+		_, err := domain.NewTask("a", domain.TaskTypeLog, 0, 0, condition, domain.Join{}, "", &domain.LogPayload{}, nil, nil, nil)
+		if err == nil {
+			t.Errorf("condition %q: expected an error", condition)
+		}
+	}
+}
+
+func TestExecuteRendersUpstreamOutputs(t *testing.T) {
+	// a -> b -> c, c only sees b as upstream
+	c := newConditionTask(t, "c", "")
+	c.Payload = &domain.LogPayload{Message: "{{ upstream.b.output }} after {{ tasks.a.output }}"}
+	b := newConditionTask(t, "b", "", c)
+	b.Payload = &domain.LogPayload{Message: "{{ upstream.a.status }}"}
+	a := newConditionTask(t, "a", "", b)
+
+	te := &flakyTaskExecutor{}
+	if _, _, err := newTestExecutor(te).run(context.Background(), newTestWorkflow(t, a), nil); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if got := te.payloads["b"].(*domain.LogPayload).Message; got != "COMPLETED" {
+		t.Errorf("got message %q for b, want %q", got, "COMPLETED")
+	}
+	if got := te.payloads["c"].(*domain.LogPayload).Message; got != "COMPLETED after a" {
+		t.Errorf("got message %q for c, want %q", got, "COMPLETED after a")
+	}
+	// the definition keeps its placeholders for the next run
+	if got := c.Payload.(*domain.LogPayload).Message; !strings.HasPrefix(got, "{{") {
+		t.Errorf("the task definition was rendered in place: %q", got)
+	}
+}
+
+func TestExecuteFailsOnRenderErrors(t *testing.T) {
+	b := newConditionTask(t, "b", "")
+	b.Payload = &domain.LogPayload{Message: "{{ upstream.missing.output }}"}
+	a := newConditionTask(t, "a", "", b)
+
+	_, _, err := newTestExecutor(&flakyTaskExecutor{}).run(context.Background(), newTestWorkflow(t, a), nil)
+	if err == nil || !strings.Contains(err.Error(), "failed to render") {
+		t.Fatalf("got error %v, want the payload to fail rendering", err)
+	}
+}
+
+func TestExecuteEvaluatesInputs(t *testing.T) {
+	w := newTestWorkflow(t)
+	in, err := domain.NewInput("n", domain.InputTypeNumber, true, nil, "")
+	if err != nil {
+		t.Fatalf("failed to create input: %v", err)
+	}
+	w.Inputs = []*domain.Input{in}
+	// integral inputs support integer arithmetic
+	a := newConditionTask(t, "a", "inputs.n + 1 == 3")
+	a.Payload = &domain.LogPayload{Message: "{{ inputs.n * 2 }}"}
+	w.Tasks = []*domain.Task{a}
+
+	inputs, err := w.ResolveInputs(map[string]interface{}{"n": 2.0})
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	te := &flakyTaskExecutor{}
+	if _, _, err := newTestExecutor(te).run(context.Background(), w, inputs); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if got := te.payloads["a"].(*domain.LogPayload).Message; got != "4" {
+		t.Errorf("got message %q, want %q", got, "4")
+	}
+}
+
+func TestExecuteConcurrentRunsAreIsolated(t *testing.T) {
+	sum := newConditionTask(t, "sum", "")
+	sum.Payload = &domain.LogPayload{Message: "{{ int(tasks.double.output) + 1 }}"}
+	double := newConditionTask(t, "double", "", sum)
+	double.Payload = &domain.LogPayload{Message: "{{ inputs.n * 2 }}"}
+	w := newTestWorkflow(t, double)
+	te := newTestExecutor(&flakyTaskExecutor{})
+
+	const runs = 10
+	var wg sync.WaitGroup
+	executions := make([]*domain.Execution, runs)
+	errs := make([]error, runs)
+	for i := 0; i < runs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			executions[i], _, errs[i] = te.run(context.Background(), w, map[string]interface{}{"n": int64(i)})
+		}()
+	}
+	wg.Wait()
+
+	ids := make(map[string]bool)
+	for i, e := range executions {
+		if errs[i] != nil {
+			t.Fatalf("run %d: %v", i, errs[i])
+		}
+		if ids[e.ID] {
+			t.Errorf("run %d reuses execution %s", i, e.ID)
+		}
+		ids[e.ID] = true
+		if e.Status != domain.WorkflowStatusCompleted {
+			t.Errorf("run %d: got status %s, want %s", i, e.Status, domain.WorkflowStatusCompleted)
+		}
+		if got, want := e.Tasks[sum.ID].Output, fmt.Sprint(i*2+1); got != want {
+			t.Errorf("run %d: got output %v, want %s", i, got, want)
+		}
+	}
+	// runs never write to the definition they share
+	if got := sum.Payload.(*domain.LogPayload).Message; got != "{{ int(tasks.double.output) + 1 }}" {
+		t.Errorf("the definition of %s changed to %q", sum.Name, got)
+	}
+}
+
+func TestExecuteRecordsTaskState(t *testing.T) {
+	task := newLogTask(t, "flaky", 1, 0)
+	w := newTestWorkflow(t, task)
+
+	e, _, err := newTestExecutor(&flakyTaskExecutor{failures: 1}).run(context.Background(), w, nil)
+	if err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if e.WorkflowID != w.ID || e.StartedAt.IsZero() || e.EndedAt.IsZero() {
+		t.Errorf("got execution %+v, want it started and ended", e)
+	}
+	te := e.Tasks[task.ID]
+	if te.Status != domain.TaskStatusCompleted || te.Attempts != 2 || te.Error != "" || te.Output != "flaky" {
+		t.Errorf("got task state %+v", te)
+	}
+	if te.StartedAt.IsZero() || te.EndedAt.Before(te.StartedAt) {
+		t.Errorf("got task times %v - %v", te.StartedAt, te.EndedAt)
+	}
+}
+
+// failingTaskExecutor fails the task named fail and blocks the others until
+// the run stops them
+type failingTaskExecutor struct {
+	fail string
+}
+
+func (fe *failingTaskExecutor) Execute(ctx context.Context, t *domain.Task) (interface{}, error) {
+	if t.Name == fe.fail {
+		return nil, errors.New("boom")
+	}
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestExecuteCancelsTasksStoppedByAFailure(t *testing.T) {
+	after := newLogTask(t, "after", 0, 0)
+	slow := newLogTask(t, "slow", 3, time.Second, after)
+	bad := newLogTask(t, "bad", 0, 0)
+
+	e, _, err := newTestExecutor(&failingTaskExecutor{fail: "bad"}).run(context.Background(), newTestWorkflow(t, bad, slow), nil)
+	if err == nil || !strings.Contains(err.Error(), "bad") {
+		t.Fatalf("got error %v, want the failure of bad", err)
+	}
+	if e.Status != domain.WorkflowStatusFailed {
+		t.Errorf("got workflow status %s, want %s", e.Status, domain.WorkflowStatusFailed)
+	}
+	assertTaskStatus(t, e, bad, domain.TaskStatusFailed)
+	// the interrupted task is not retried and its next task never runs
+	assertTaskStatus(t, e, slow, domain.TaskStatusCancelled)
+	assertTaskStatus(t, e, after, domain.TaskStatusCancelled)
+	if got := e.Tasks[slow.ID].Attempts; got > 1 {
+		t.Errorf("got %d attempts of slow, want at most 1", got)
+	}
+}
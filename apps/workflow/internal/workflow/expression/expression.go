@@ -0,0 +1,196 @@
+package expression
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/google/cel-go/cel"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Variables exposed to every expression
+const (
+	VarInputs   = "inputs"   // workflow run inputs by name
+	VarTasks    = "tasks"    // finished tasks by id and by name
+	VarUpstream = "upstream" // direct predecessors of the current task by id and by name
+	VarItem     = "item"     // current item within the task of a map, null elsewhere
+	VarIndex    = "index"    // position of the current item within a map, null elsewhere
+	// VarIteration is the number of the current iteration within a loop,
+	// starting at 1, null elsewhere
+	VarIteration = "iteration"
+	VarOutput    = "output" // output of the last iteration of a loop, null elsewhere
+)
+
+const (
+	// MaxCost bounds the work a single evaluation can perform
+	MaxCost = 100_000
+	// MaxLength bounds the size of an expression source
+	MaxLength = 1000
+	// MaxCached bounds the number of compiled expressions and templates kept around
+	MaxCached = 10_000
+)
+
+var structValueType = reflect.TypeOf(&structpb.Value{})
+
+// Expression is a compiled CEL expression. CEL is side-effect free and not
+// Turing complete, on top of that evaluations are cost limited
+type Expression struct {
+	source  string
+	program cel.Program
+}
+
+var newEnv = sync.OnceValues(func() (*cel.Env, error) {
+	return cel.NewEnv(
+		cel.Variable(VarInputs, cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable(VarTasks, cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable(VarUpstream, cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable(VarItem, cel.DynType),
+		cel.Variable(VarIndex, cel.DynType),
+		cel.Variable(VarIteration, cel.DynType),
+		cel.Variable(VarOutput, cel.DynType),
+	)
+})
+
+// compiled expressions and templates are immutable and safe for concurrent
+// use, so the same source is only compiled once
+var (
+	cacheMu sync.Mutex
+	cache   = map[cacheKey]interface{}{}
+)
+
+type cacheKind int
+
+const (
+	cacheExpression cacheKind = iota
+	cacheBoolExpression
+	cacheTemplate
+)
+
+type cacheKey struct {
+	kind   cacheKind
+	source string
+}
+
+// Compile parses and type-checks an expression
+func Compile(source string) (*Expression, error) {
+	return cached(cacheKey{cacheExpression, source}, func() (*Expression, error) {
+		env, ast, err := compile(source)
+		if err != nil {
+			return nil, err
+		}
+		return newExpression(env, source, ast)
+	})
+}
+
+// CompileBool compiles an expression that must evaluate to a boolean
+func CompileBool(source string) (*Expression, error) {
+	return cached(cacheKey{cacheBoolExpression, source}, func() (*Expression, error) {
+		env, ast, err := compile(source)
+		if err != nil {
+			return nil, err
+		}
+		if t := ast.OutputType(); !t.IsExactType(cel.BoolType) && !t.IsExactType(cel.DynType) {
+			return nil, fmt.Errorf("expression %q must evaluate to a bool, got %s", source, t)
+		}
+		return newExpression(env, source, ast)
+	})
+}
+
+// cached returns the value compiled for key, compiling it on a miss.
+// Errors are not cached, once full the cache stops growing
+func cached[T any](key cacheKey, compile func() (T, error)) (T, error) {
+	cacheMu.Lock()
+	v, ok := cache[key]
+	cacheMu.Unlock()
+	if ok {
+		return v.(T), nil
+	}
+	out, err := compile()
+	if err != nil {
+		return out, err
+	}
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	if len(cache) < MaxCached {
+		cache[key] = out
+	}
+	return out, nil
+}
+
+func compile(source string) (*cel.Env, *cel.Ast, error) {
+	if source == "" {
+		return nil, nil, fmt.Errorf("expression cannot be empty")
+	}
+	if len(source) > MaxLength {
+		return nil, nil, fmt.Errorf("expression cannot be longer than %d characters", MaxLength)
+	}
+	env, err := newEnv()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create expression environment: %w", err)
+	}
+	ast, iss := env.Compile(source)
+	if iss.Err() != nil {
+		return nil, nil, fmt.Errorf("invalid expression %q: %w", source, iss.Err())
+	}
+	return env, ast, nil
+}
+
+func newExpression(env *cel.Env, source string, ast *cel.Ast) (*Expression, error) {
+	program, err := env.Program(ast,
+		cel.CostLimit(MaxCost),
+		cel.InterruptCheckFrequency(100),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression %q: %w", source, err)
+	}
+	return &Expression{source: source, program: program}, nil
+}
+
+func (e *Expression) String() string {
+	return e.source
+}
+
+// Eval evaluates the expression and returns the result as a plain Go value
+// (nil, bool, float64, string, []interface{} or map[string]interface{})
+func (e *Expression) Eval(ctx context.Context, vars map[string]interface{}) (interface{}, error) {
+	out, _, err := e.program.ContextEval(ctx, withDefaults(vars))
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate expression %q: %w", e.source, err)
+	}
+	native, err := out.ConvertToNative(structValueType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert result of expression %q: %w", e.source, err)
+	}
+	return native.(*structpb.Value).AsInterface(), nil
+}
+
+// EvalBool evaluates the expression and requires a boolean result
+func (e *Expression) EvalBool(ctx context.Context, vars map[string]interface{}) (bool, error) {
+	out, err := e.Eval(ctx, vars)
+	if err != nil {
+		return false, err
+	}
+	b, ok := out.(bool)
+	if !ok {
+		return false, fmt.Errorf("expression %q must evaluate to a bool, got %T", e.source, out)
+	}
+	return b, nil
+}
+
+// withDefaults makes sure every declared variable is bound
+func withDefaults(vars map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(vars)+7)
+	out[VarInputs] = map[string]interface{}{}
+	out[VarTasks] = map[string]interface{}{}
+	out[VarUpstream] = map[string]interface{}{}
+	out[VarItem] = nil
+	out[VarIndex] = nil
+	out[VarIteration] = nil
+	out[VarOutput] = nil
+	for k, v := range vars {
+		out[k] = v
+	}
+	return out
+}
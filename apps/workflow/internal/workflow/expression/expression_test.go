@@ -0,0 +1,93 @@
+package expression
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEval(t *testing.T) {
+	vars := map[string]interface{}{
+		VarInputs: map[string]interface{}{"name": "neurun"},
+		VarTasks: map[string]interface{}{
+			"fetch": map[string]interface{}{"output": map[string]interface{}{"items": []interface{}{1.0, 2.0}}},
+		},
+	}
+	tests := []struct {
+		source string
+		want   interface{}
+	}{
+		{`inputs.name + "!"`, "neurun!"},
+		{"size(tasks.fetch.output.items)", 2.0},
+		{"tasks.fetch.output.items[1]", 2.0},
+		{`{"ok": true}`, map[string]interface{}{"ok": true}},
+	}
+	for _, tt := range tests {
+		e, err := Compile(tt.source)
+		if err != nil {
+			t.Fatalf("compile %q: %v", tt.source, err)
+		}
+		got, err := e.Eval(context.Background(), vars)
+		if err != nil {
+			t.Fatalf("eval %q: %v", tt.source, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got %#v, want %#v", tt.source, got, tt.want)
+		}
+	}
+}
+
+func TestCompileBool(t *testing.T) {
+	if _, err := CompileBool(`"text"`); err == nil {
+		t.Errorf("expected a string expression to be rejected")
+	}
+	// dynamic values are only checked when evaluated
+	e, err := CompileBool("inputs.flag")
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	if _, err := e.EvalBool(context.Background(), map[string]interface{}{VarInputs: map[string]interface{}{"flag": "yes"}}); err == nil {
+		t.Errorf("expected a non-bool result to fail")
+	}
+	ok, err := e.EvalBool(context.Background(), map[string]interface{}{VarInputs: map[string]interface{}{"flag": true}})
+	if err != nil || !ok {
+		t.Errorf("got %v, %v, want true", ok, err)
+	}
+}
+
+func TestCompileLimits(t *testing.T) {
+	if _, err := Compile(""); err == nil {
+		t.Errorf("expected an empty expression to be rejected")
+	}
+	if _, err := Compile(strings.Repeat("1+", MaxLength) + "1"); err == nil {
+		t.Errorf("expected a long expression to be rejected")
+	}
+	// a comprehension over a large list exceeds the cost limit
+	e, err := Compile("[1,2,3,4,5,6,7,8,9,10].map(a, [1,2,3,4,5,6,7,8,9,10].map(b, [1,2,3,4,5,6,7,8,9,10].map(c, [1,2,3,4,5,6,7,8,9,10].map(d, [1,2,3,4,5,6,7,8,9,10].map(f, a+b+c+d+f)))))")
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	if _, err := e.Eval(context.Background(), nil); err == nil {
+		t.Errorf("expected the evaluation to exceed the cost limit")
+	}
+}
+
+func TestCompileCachesPrograms(t *testing.T) {
+	a, err := Compile("1 + 1 == 2")
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	b, _ := Compile("1 + 1 == 2")
+	if a != b {
+		t.Errorf("expected the same expression to be compiled once")
+	}
+	// bool expressions are checked separately
+	c, _ := CompileBool("1 + 1 == 2")
+	if c == a {
+		t.Errorf("expected bool expressions to be cached apart")
+	}
+	if _, err := CompileBool(`"text"`); err == nil {
+		t.Errorf("expected the error to be returned again")
+	}
+}
@@ -0,0 +1,111 @@
+package expression
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/itchyny/gojq"
+)
+
+const (
+	// JQMaxLength bounds the size of a jq query source
+	JQMaxLength = 10_000
+	// JQMaxResults bounds how many values a single evaluation can produce
+	JQMaxResults = 1000
+)
+
+// undefinedName extracts the function or variable gojq compile errors refer to
+var undefinedName = regexp.MustCompile(`not defined: (\$?[A-Za-z_][A-Za-z0-9_:]*)|^(input)\(s\)/0 is not allowed`)
+
+// JQ is a compiled jq query. Queries cannot read the environment, files or
+// any input other than the one they are evaluated with, so they have no side
+// effects
+type JQ struct {
+	source string
+	code   *gojq.Code
+}
+
+// CompileJQ parses and compiles a jq query, errors report the line and
+// column they were found at
+func CompileJQ(source string) (*JQ, error) {
+	if strings.TrimSpace(source) == "" {
+		return nil, fmt.Errorf("query cannot be empty")
+	}
+	if len(source) > JQMaxLength {
+		return nil, fmt.Errorf("query cannot be longer than %d characters", JQMaxLength)
+	}
+	query, err := gojq.Parse(source)
+	if err != nil {
+		var perr *gojq.ParseError
+		if errors.As(err, &perr) {
+			line, col := position(source, max(perr.Offset-len(perr.Token), 0))
+			return nil, fmt.Errorf("invalid query at line %d, column %d: %w", line, col, err)
+		}
+		return nil, fmt.Errorf("invalid query: %w", err)
+	}
+	// no environ loader or input iterator is given, $ENV is empty and
+	// input fails to compile
+	code, err := gojq.Compile(query)
+	if err != nil {
+		if m := undefinedName.FindStringSubmatch(err.Error()); m != nil {
+			if offset := indexWord(source, m[1]+m[2]); offset >= 0 {
+				line, col := position(source, offset)
+				return nil, fmt.Errorf("invalid query at line %d, column %d: %w", line, col, err)
+			}
+		}
+		return nil, fmt.Errorf("invalid query: %w", err)
+	}
+	return &JQ{source: source, code: code}, nil
+}
+
+func (q *JQ) String() string {
+	return q.source
+}
+
+// Eval runs the query against a plain Go value (nil, bool, float64, string,
+// []interface{} or map[string]interface{}) and returns every value it produces
+func (q *JQ) Eval(ctx context.Context, input interface{}) ([]interface{}, error) {
+	iter := q.code.RunWithContext(ctx, input)
+	var out []interface{}
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			return out, nil
+		}
+		if err, isErr := v.(error); isErr {
+			var herr *gojq.HaltError
+			if errors.As(err, &herr) && herr.Value() == nil {
+				// halt stops the query without an error
+				return out, nil
+			}
+			return nil, fmt.Errorf("failed to evaluate query: %w", err)
+		}
+		if len(out) == JQMaxResults {
+			return nil, fmt.Errorf("query cannot produce more than %d results", JQMaxResults)
+		}
+		out = append(out, v)
+	}
+}
+
+// position returns the line and column of a byte offset, both starting at 1
+func position(source string, offset int) (int, int) {
+	before := source[:min(offset, len(source))]
+	line := strings.Count(before, "\n") + 1
+	col := utf8.RuneCountInString(before[strings.LastIndex(before, "\n")+1:]) + 1
+	return line, col
+}
+
+// indexWord returns the offset of the first occurrence of name that is not
+// part of a longer identifier, or -1
+func indexWord(source, name string) int {
+	re := regexp.MustCompile(`(^|[^A-Za-z0-9_$])` + regexp.QuoteMeta(name) + `($|[^A-Za-z0-9_])`)
+	loc := re.FindStringSubmatchIndex(source)
+	if loc == nil {
+		return -1
+	}
+	return loc[3]
+}
@@ -0,0 +1,78 @@
+package expression
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompileJQReportsErrorPositions(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{".a |", "line 1, column 5"},
+		{`"é" | .a ]`, "line 1, column 10"},
+		{".a\n| foo(1)", "line 2, column 3"},
+		{"{a: .b,\n  c: $x}", "line 2, column 6"},
+		// input would read past the document the query is given
+		{".a | input", "line 1, column 6"},
+	}
+	for _, tt := range tests {
+		_, err := CompileJQ(tt.source)
+		if err == nil || !strings.Contains(err.Error(), "invalid query at "+tt.want+":") {
+			t.Errorf("%q: got error %v, want one at %s", tt.source, err, tt.want)
+		}
+	}
+	for _, source := range []string{"", "  ", strings.Repeat(".", JQMaxLength+1)} {
+		if _, err := CompileJQ(source); err == nil {
+			t.Errorf("expected a query of %d characters to be rejected", len(source))
+		}
+	}
+}
+
+func TestJQEval(t *testing.T) {
+	input := map[string]interface{}{
+		"items": []interface{}{
+			map[string]interface{}{"name": "a", "price": 2.0},
+			map[string]interface{}{"name": "b", "price": 5.0},
+		},
+	}
+	tests := []struct {
+		source string
+		want   []interface{}
+	}{
+		{"[.items[] | select(.price > 3) | .name]", []interface{}{[]interface{}{"b"}}},
+		{".items[].name", []interface{}{"a", "b"}},
+		{"empty", nil},
+		{"halt", nil},
+		// the environment of the server is not visible
+		{"$ENV | length", []interface{}{0}},
+	}
+	for _, tt := range tests {
+		q, err := CompileJQ(tt.source)
+		if err != nil {
+			t.Fatalf("compile %q: %v", tt.source, err)
+		}
+		got, err := q.Eval(context.Background(), input)
+		if err != nil {
+			t.Fatalf("eval %q: %v", tt.source, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got %#v, want %#v", tt.source, got, tt.want)
+		}
+	}
+}
+
+func TestJQEvalErrors(t *testing.T) {
+	for _, source := range []string{`error("boom")`, ".items + 1", "range(10000)"} {
+		q, err := CompileJQ(source)
+		if err != nil {
+			t.Fatalf("compile %q: %v", source, err)
+		}
+		if _, err := q.Eval(context.Background(), map[string]interface{}{"items": []interface{}{}}); err == nil {
+			t.Errorf("%q: expected the evaluation to fail", source)
+		}
+	}
+}
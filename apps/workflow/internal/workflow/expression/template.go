@@ -0,0 +1,143 @@
+package expression
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const (
+	templateOpen  = "{{"
+	templateClose = "}}"
+)
+
+// Template is a string with embedded {{ expression }} placeholders,
+// e.g. "https://api.example.com/users/{{ tasks.login.output.body.id }}"
+type Template struct {
+	source string
+	parts  []templatePart
+}
+
+type templatePart struct {
+	literal string
+	expr    *Expression
+}
+
+// IsTemplate reports whether s contains any placeholder
+func IsTemplate(s string) bool {
+	return strings.Contains(s, templateOpen)
+}
+
+// ParseTemplate splits the source into literals and compiled expressions
+func ParseTemplate(source string) (*Template, error) {
+	return cached(cacheKey{cacheTemplate, source}, func() (*Template, error) {
+		return parseTemplate(source)
+	})
+}
+
+func parseTemplate(source string) (*Template, error) {
+	t := &Template{source: source}
+	rest := source
+	offset := 0
+	for {
+		start := strings.Index(rest, templateOpen)
+		if start < 0 {
+			if rest != "" {
+				t.parts = append(t.parts, templatePart{literal: rest})
+			}
+			return t, nil
+		}
+		if start > 0 {
+			t.parts = append(t.parts, templatePart{literal: rest[:start]})
+		}
+		body := rest[start+len(templateOpen):]
+		end := findTemplateClose(body)
+		if end < 0 {
+			return nil, fmt.Errorf("unclosed %q at offset %d", templateOpen, offset+start)
+		}
+		expr, err := Compile(strings.TrimSpace(body[:end]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid placeholder at offset %d: %w", offset+start, err)
+		}
+		t.parts = append(t.parts, templatePart{expr: expr})
+		consumed := start + len(templateOpen) + end + len(templateClose)
+		rest = rest[consumed:]
+		offset += consumed
+	}
+}
+
+// findTemplateClose returns the index of the closing delimiter, ignoring
+// braces and delimiters inside string literals and nested map literals
+func findTemplateClose(s string) int {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if quote != 0 {
+			switch c {
+			case '\\':
+				i++
+			case quote:
+				quote = 0
+			}
+			continue
+		}
+		switch c {
+		case '\'', '"':
+			quote = c
+		case '{':
+			depth++
+		case '}':
+			if depth == 0 && strings.HasPrefix(s[i:], templateClose) {
+				return i
+			}
+			depth--
+		}
+	}
+	return -1
+}
+
+func (t *Template) String() string {
+	return t.source
+}
+
+// Render evaluates every placeholder, strings are inserted as they are and
+// any other value is encoded as JSON
+func (t *Template) Render(ctx context.Context, vars map[string]interface{}) (string, error) {
+	var sb strings.Builder
+	for _, p := range t.parts {
+		if p.expr == nil {
+			sb.WriteString(p.literal)
+			continue
+		}
+		v, err := p.expr.Eval(ctx, vars)
+		if err != nil {
+			return "", err
+		}
+		switch o := v.(type) {
+		case nil:
+		case string:
+			sb.WriteString(o)
+		default:
+			b, err := json.Marshal(o)
+			if err != nil {
+				return "", fmt.Errorf("failed to encode result of expression %q: %w", p.expr, err)
+			}
+			sb.Write(b)
+		}
+	}
+	return sb.String(), nil
+}
+
+// Render parses and renders s, strings without placeholders are returned unchanged
+func Render(ctx context.Context, s string, vars map[string]interface{}) (string, error) {
+	if !IsTemplate(s) {
+		return s, nil
+	}
+	t, err := ParseTemplate(s)
+	if err != nil {
+		return "", err
+	}
+	return t.Render(ctx, vars)
+}
@@ -0,0 +1,72 @@
+package expression
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	vars := map[string]interface{}{
+		VarInputs: map[string]interface{}{"id": 7.0, "name": "neurun"},
+		VarUpstream: map[string]interface{}{
+			"login": map[string]interface{}{"output": map[string]interface{}{"token": "abc"}},
+		},
+	}
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"plain", "plain"},
+		{"/users/{{ inputs.id }}", "/users/7"},
+		{"Bearer {{upstream.login.output.token}}", "Bearer abc"},
+		{`{{ inputs.name + "}}" }}`, "neurun}}"},
+		{`{"user": {{ {"id": inputs.id} }}}`, `{"user": {"id":7}}`},
+		{"{{ [1, 2] }}-{{ null }}", "[1,2]-"},
+	}
+	for _, tt := range tests {
+		got, err := Render(context.Background(), tt.source, vars)
+		if err != nil {
+			t.Errorf("render %q: %v", tt.source, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("render %q: got %q, want %q", tt.source, got, tt.want)
+		}
+	}
+}
+
+func TestParseTemplateErrors(t *testing.T) {
+	tests := []struct {
+		source string
+		err    string
+	}{
+		{"/users/{{ inputs.id", `unclosed "{{" at offset 7`},
+		{"a {{ }} b", "invalid placeholder at offset 2"},
+		{"{{ inputs.id + }}", "invalid placeholder at offset 0"},
+	}
+	for _, tt := range tests {
+		_, err := ParseTemplate(tt.source)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("parse %q: got error %v, want %q", tt.source, err, tt.err)
+		}
+	}
+}
+
+func TestRenderEvalErrors(t *testing.T) {
+	_, err := Render(context.Background(), "{{ upstream.missing.output }}", nil)
+	if err == nil {
+		t.Errorf("expected a missing upstream task to fail")
+	}
+}
+
+func TestParseTemplateCachesTemplates(t *testing.T) {
+	a, err := ParseTemplate("/users/{{ inputs.id }}")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	b, _ := ParseTemplate("/users/{{ inputs.id }}")
+	if a != b {
+		t.Errorf("expected the same template to be parsed once")
+	}
+}
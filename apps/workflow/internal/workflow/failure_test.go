@@ -0,0 +1,96 @@
+package workflow
+
+import (
+	"context"
+	"testing"
+
+	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/domain"
+)
+
+// newFailingTask fails with message, itemTaskExecutor fails messages
+// starting with fail
+func newFailingTask(t *testing.T, message string, policy domain.TaskFailurePolicy, onFailure *domain.Task, next ...*domain.Task) *domain.Task {
+	t.Helper()
+	task, err := domain.NewTask("failing", domain.TaskTypeLog, 0, 0, "", domain.Join{}, policy,
+		&domain.LogPayload{Message: message}, next, onFailure, nil)
+	if err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+	return task
+}
+
+func TestFailurePolicies(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy domain.TaskFailurePolicy
+		status domain.WorklowStatus
+		// status of the task after the failing one and of an independent branch
+		next, other domain.TaskStatus
+	}{
+		{"fail workflow", domain.TaskFailWorkflow, domain.WorkflowStatusFailed, domain.TaskStatusCancelled, domain.TaskStatusCancelled},
+		{"continue", domain.TaskContinue, domain.WorkflowStatusCompletedWithErrors, domain.TaskStatusSkipped, domain.TaskStatusCompleted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := newLogTask(t, "next", 0, 0)
+			failing := newFailingTask(t, "fail boom", tt.policy, nil, next)
+			other := newLogTask(t, "5", 0, 0)
+
+			e, _, err := newTestExecutor(&itemTaskExecutor{}).run(context.Background(), newTestWorkflow(t, failing, other), nil)
+			if (err != nil) != (tt.status == domain.WorkflowStatusFailed) {
+				t.Errorf("got error %v for status %s", err, tt.status)
+			}
+			if e.Status != tt.status {
+				t.Errorf("got status %s, want %s", e.Status, tt.status)
+			}
+			assertTaskStatus(t, e, failing, domain.TaskStatusFailed)
+			assertTaskStatus(t, e, next, tt.next)
+			assertTaskStatus(t, e, other, tt.other)
+		})
+	}
+}
+
+func TestOnFailureHandlesTheError(t *testing.T) {
+	// the on failure task finds the error of the failed task in upstream
+	handler, err := domain.NewTask("handler", domain.TaskTypeLog, 0, 0, "", domain.Join{}, "",
+		&domain.LogPayload{Message: "handled {{ upstream.failing.error }}"}, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+	next := newLogTask(t, "next", 0, 0)
+	failing := newFailingTask(t, "fail boom", "", handler, next)
+
+	e, _, err := newTestExecutor(&itemTaskExecutor{}).run(context.Background(), newTestWorkflow(t, failing), nil)
+	if err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if e.Status != domain.WorkflowStatusCompletedWithErrors || e.Error != "1 task(s) failed" {
+		t.Errorf("got status %s with error %q, want %s", e.Status, e.Error, domain.WorkflowStatusCompletedWithErrors)
+	}
+	assertTaskStatus(t, e, failing, domain.TaskStatusFailed)
+	assertTaskStatus(t, e, next, domain.TaskStatusSkipped)
+	assertTaskStatus(t, e, handler, domain.TaskStatusCompleted)
+	if got := e.Tasks[handler.ID].Output; got != "handled fail boom" {
+		t.Errorf("got on failure output %v, want the error of the failed task", got)
+	}
+}
+
+func TestOnFailureIsSkippedWhenTheTaskCompletes(t *testing.T) {
+	handler := newLogTask(t, "handler", 0, 0)
+	next := newLogTask(t, "next", 0, 0)
+	task, err := domain.NewTask("ok", domain.TaskTypeLog, 0, 0, "", domain.Join{}, "", &domain.LogPayload{Message: "ok"},
+		[]*domain.Task{next}, handler, nil)
+	if err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+
+	e, _, err := newTestExecutor(&flakyTaskExecutor{}).run(context.Background(), newTestWorkflow(t, task), nil)
+	if err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if e.Status != domain.WorkflowStatusCompleted {
+		t.Errorf("got status %s, want %s", e.Status, domain.WorkflowStatusCompleted)
+	}
+	assertTaskStatus(t, e, next, domain.TaskStatusCompleted)
+	assertTaskStatus(t, e, handler, domain.TaskStatusSkipped)
+}
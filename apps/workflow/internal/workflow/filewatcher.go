@@ -0,0 +1,238 @@
+package workflow
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/domain"
+)
+
+// FileWatcher starts executions of workflows for the files that land in
+// the directories of their file watches
+type FileWatcher interface {
+	// Start loads the stored file watches and starts watching their
+	// directories, files created while the server was down are not picked up
+	Start(es ExecutionStarter) error
+	// Stop stops watching every directory, running executions are not affected
+	Stop()
+	// Add starts watching the directory of a file watch, replacing it if it
+	// was already added
+	Add(fw *domain.FileWatch) error
+	Remove(id string)
+}
+
+type fileWatcher struct {
+	r  domain.WorkflowRepository
+	fr domain.FileWatchRepository
+
+	mu      sync.Mutex
+	es      ExecutionStarter
+	watches map[string]*dirWatch // by file watch id
+}
+
+func NewFileWatcher(r domain.WorkflowRepository, fr domain.FileWatchRepository) FileWatcher {
+	return &fileWatcher{
+		r:       r,
+		fr:      fr,
+		watches: make(map[string]*dirWatch),
+	}
+}
+
+func (fwr *fileWatcher) Start(es ExecutionStarter) error {
+	fwr.mu.Lock()
+	fwr.es = es
+	fwr.mu.Unlock()
+
+	watches, err := fwr.fr.ListFileWatches("")
+	if err != nil {
+		return fmt.Errorf("failed to load file watches: %w", err)
+	}
+	for _, fw := range watches {
+		// a missing directory must not keep the server from starting
+		if err := fwr.Add(fw); err != nil {
+			log.Printf("failed to watch %s for file watch %s: %v", fw.Dir, fw.ID, err)
+		}
+	}
+	return nil
+}
+
+func (fwr *fileWatcher) Stop() {
+	fwr.mu.Lock()
+	defer fwr.mu.Unlock()
+	for id, d := range fwr.watches {
+		d.close()
+		delete(fwr.watches, id)
+	}
+}
+
+func (fwr *fileWatcher) Add(fw *domain.FileWatch) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create watcher: %w", err)
+	}
+	if err := watcher.Add(fw.Dir); err != nil {
+		watcher.Close()
+		return fmt.Errorf("failed to watch directory %s: %w", fw.Dir, err)
+	}
+	// only once the watched directory is known to be valid
+	if fw.ArchiveDir != "" {
+		if err := os.MkdirAll(fw.ArchiveDir, 0o755); err != nil {
+			watcher.Close()
+			return fmt.Errorf("failed to create archive directory: %w", err)
+		}
+	}
+	d := &dirWatch{
+		fwr:     fwr,
+		fw:      fw.Clone(),
+		watcher: watcher,
+		pending: make(map[string]*time.Timer),
+	}
+	fwr.mu.Lock()
+	if old, exists := fwr.watches[fw.ID]; exists {
+		old.close()
+	}
+	fwr.watches[fw.ID] = d
+	fwr.mu.Unlock()
+	go d.run()
+	return nil
+}
+
+func (fwr *fileWatcher) Remove(id string) {
+	fwr.mu.Lock()
+	defer fwr.mu.Unlock()
+	if d, exists := fwr.watches[id]; exists {
+		d.close()
+		delete(fwr.watches, id)
+	}
+}
+
+// dirWatch watches the directory of a single file watch
+type dirWatch struct {
+	fwr     *fileWatcher
+	fw      *domain.FileWatch
+	watcher *fsnotify.Watcher
+
+	mu      sync.Mutex
+	closed  bool
+	pending map[string]*time.Timer // debounced files by path
+}
+
+func (d *dirWatch) run() {
+	for {
+		select {
+		case ev, ok := <-d.watcher.Events:
+			if !ok {
+				return
+			}
+			if !ev.Has(fsnotify.Create) && !ev.Has(fsnotify.Write) {
+				continue
+			}
+			if d.fw.Match(filepath.Base(ev.Name)) {
+				d.debounce(ev.Name)
+			}
+		case err, ok := <-d.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("file watch %s: %v", d.fw.ID, err)
+		}
+	}
+}
+
+// debounce fires the file once it has gone without changes for the
+// debounce of the watch
+func (d *dirWatch) debounce(path string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return
+	}
+	if t, exists := d.pending[path]; exists {
+		t.Reset(d.fw.Debounce)
+		return
+	}
+	d.pending[path] = time.AfterFunc(d.fw.Debounce, func() {
+		d.mu.Lock()
+		delete(d.pending, path)
+		closed := d.closed
+		d.mu.Unlock()
+		if !closed {
+			d.fire(path)
+		}
+	})
+}
+
+func (d *dirWatch) close() {
+	d.mu.Lock()
+	d.closed = true
+	for path, t := range d.pending {
+		t.Stop()
+		delete(d.pending, path)
+	}
+	d.mu.Unlock()
+	if err := d.watcher.Close(); err != nil {
+		log.Printf("failed to close file watch %s: %v", d.fw.ID, err)
+	}
+}
+
+// fire starts an execution of the workflow for a file, failures are logged
+// since there is no caller to report them to
+func (d *dirWatch) fire(path string) {
+	d.fwr.mu.Lock()
+	es := d.fwr.es
+	d.fwr.mu.Unlock()
+	if es == nil {
+		return
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		// the file was moved or removed before it settled
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("file watch %s: %v", d.fw.ID, err)
+		}
+		return
+	}
+	if !info.Mode().IsRegular() {
+		return
+	}
+	w, err := d.fwr.r.Get(d.fw.WorkflowID)
+	if err != nil {
+		log.Printf("file watch %s: %v", d.fw.ID, err)
+		return
+	}
+	if d.fw.ArchiveDir != "" {
+		archived := archivePath(d.fw.ArchiveDir, filepath.Base(path))
+		if err := os.Rename(path, archived); err != nil {
+			log.Printf("file watch %s failed to archive %s: %v", d.fw.ID, path, err)
+			return
+		}
+		path = archived
+	}
+	ev := domain.FileEvent{Path: path, Size: info.Size(), ModTime: info.ModTime()}
+	e, err := es.Start(d.fw.WorkflowID, ev.Inputs(w))
+	if err != nil {
+		log.Printf("failed to start workflow %s for file %s: %v", d.fw.WorkflowID, path, err)
+		return
+	}
+	log.Printf("started execution %s of workflow %s for file %s", e.ID, d.fw.WorkflowID, path)
+}
+
+// archivePath returns a path in dir for the file name that does not
+// overwrite previously archived files
+func archivePath(dir, name string) string {
+	path := filepath.Join(dir, name)
+	if _, err := os.Lstat(path); errors.Is(err, fs.ErrNotExist) {
+		return path
+	}
+	ext := filepath.Ext(name)
+	return filepath.Join(dir, fmt.Sprintf("%s-%d%s", strings.TrimSuffix(name, ext), time.Now().UnixNano(), ext))
+}
@@ -0,0 +1,130 @@
+package workflow
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/domain"
+	wr "github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/repository"
+)
+
+// newTestFileWatcher watches dir for the files of a workflow that declares
+// the path input
+func newTestFileWatcher(t *testing.T, dir, archiveDir string, debounce time.Duration) (*recordingStarter, *domain.FileWatch) {
+	t.Helper()
+	repo := wr.NewMemoryRepository()
+	w := newTestWorkflow(t, newLogTask(t, "a", 0, 0))
+	path, err := domain.NewInput(domain.FileWatchInputPath, domain.InputTypeString, false, nil, "")
+	if err != nil {
+		t.Fatalf("new input: %v", err)
+	}
+	w.Inputs = []*domain.Input{path}
+	if err := repo.Create(w); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	fw, err := domain.NewFileWatch(w.ID, dir, "*.csv", debounce, archiveDir)
+	if err != nil {
+		t.Fatalf("new file watch: %v", err)
+	}
+	rs := &recordingStarter{}
+	fwr := NewFileWatcher(repo, repo)
+	if err := fwr.Start(rs); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	t.Cleanup(fwr.Stop)
+	if err := fwr.Add(fw); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	return rs, fw
+}
+
+// waitForStarts waits until n executions were started and a bit longer to
+// catch extra ones
+func waitForStarts(t *testing.T, rs *recordingStarter, n int) []map[string]interface{} {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for len(rs.starts()) < n && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(200 * time.Millisecond)
+	starts := rs.starts()
+	if len(starts) != n {
+		t.Fatalf("got %d executions started, want %d", len(starts), n)
+	}
+	return starts
+}
+
+func TestFileWatcherDebouncesWrites(t *testing.T) {
+	dir := t.TempDir()
+	rs, _ := newTestFileWatcher(t, dir, "", 100*time.Millisecond)
+
+	// a file written in several steps starts a single run
+	path := filepath.Join(dir, "a.csv")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("create file: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		if _, err := f.WriteString("row\n"); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		time.Sleep(30 * time.Millisecond)
+	}
+	f.Close()
+	// files that do not match the pattern are ignored
+	if err := os.WriteFile(filepath.Join(dir, "b.txt"), nil, 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	starts := waitForStarts(t, rs, 1)
+	if got := starts[0][domain.FileWatchInputPath]; got != path {
+		t.Errorf("got path %v, want %s", got, path)
+	}
+}
+
+func TestFileWatcherArchivesFiles(t *testing.T) {
+	dir, archiveDir := t.TempDir(), filepath.Join(t.TempDir(), "done")
+	rs, _ := newTestFileWatcher(t, dir, archiveDir, 50*time.Millisecond)
+
+	// an archived file with the same name is not overwritten
+	if err := os.WriteFile(filepath.Join(archiveDir, "a.csv"), []byte("old"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "a.csv"), []byte("new"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	starts := waitForStarts(t, rs, 1)
+	path, _ := starts[0][domain.FileWatchInputPath].(string)
+	if filepath.Dir(path) != archiveDir || filepath.Base(path) == "a.csv" {
+		t.Fatalf("got path %s, want a new file in %s", path, archiveDir)
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != "new" {
+		t.Errorf("got archived file %q, %v, want new", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a.csv")); !os.IsNotExist(err) {
+		t.Errorf("expected the file to be moved out of the watched directory")
+	}
+}
+
+func TestServiceCreateFileWatchOnMissingDirectory(t *testing.T) {
+	s, w := newTestService(t, &flakyTaskExecutor{}, newLogTask(t, "a", 0, 0))
+	root := t.TempDir()
+	archiveDir := filepath.Join(root, "done")
+	fw, err := domain.NewFileWatch(w.ID, filepath.Join(root, "missing"), "*", 0, archiveDir)
+	if err != nil {
+		t.Fatalf("new file watch: %v", err)
+	}
+	if _, err := s.CreateFileWatch(fw); err == nil {
+		t.Fatalf("expected watching a missing directory to fail")
+	}
+	// neither the watch nor its archive directory are left behind
+	if watches, err := s.ListFileWatches(w.ID); err != nil || len(watches) != 0 {
+		t.Errorf("got %d file watches, %v, want none", len(watches), err)
+	}
+	if _, err := os.Stat(archiveDir); !os.IsNotExist(err) {
+		t.Errorf("expected the archive directory not to be created")
+	}
+}
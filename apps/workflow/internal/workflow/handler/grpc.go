@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 
+	"google.golang.org/grpc"
+
 	pb "github.com/luis12loureiro/neurun/apps/workflow/gen"
 	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow"
 	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/domain"
@@ -19,15 +21,7 @@ func NewServer(s workflow.Service) pb.WorkflowServiceServer {
 }
 
 func (h *handler) CreateWorkflow(_ context.Context, in *pb.CreateWorkflowRequest) (*pb.WorkflowResponse, error) {
-	tasks := []*domain.Task{}
-	for _, t := range in.Tasks {
-		task, err := TaskFromProto(t)
-		if err != nil {
-			return nil, err
-		}
-		tasks = append(tasks, task)
-	}
-	w, err := domain.NewWorkflow(in.GetName(), in.GetDescription(), tasks)
+	w, err := WorkflowFromProto(in.GetName(), in.GetDescription(), in.GetInputs(), in.GetTasks())
 	if err != nil {
 		return nil, err
 	}
@@ -35,13 +29,7 @@ func (h *handler) CreateWorkflow(_ context.Context, in *pb.CreateWorkflowRequest
 	if err != nil {
 		return nil, err
 	}
-	return &pb.WorkflowResponse{
-		Id:          wf.ID,
-		Name:        wf.Name,
-		Description: wf.Description,
-		Status:      string(wf.Status),
-		Tasks:       convertNextToProto(wf.Tasks),
-	}, nil
+	return WorkflowToProto(wf), nil
 }
 
 func (h *handler) GetWorkflow(ctx context.Context, in *pb.GetWorkflowRequest) (*pb.WorkflowResponse, error) {
@@ -49,33 +37,90 @@ func (h *handler) GetWorkflow(ctx context.Context, in *pb.GetWorkflowRequest) (*
 	if err != nil {
 		return nil, err
 	}
-	tasks := make([]*pb.Task, len(wf.Tasks))
-	for i, t := range wf.Tasks {
-		tasks[i] = TaskToProto(t)
+	return WorkflowToProto(wf), nil
+}
+
+func (h *handler) ListWorkflows(_ context.Context, in *pb.ListWorkflowsRequest) (*pb.ListWorkflowsResponse, error) {
+	f, err := domain.NewWorkflowFilter(in.GetName(), int(in.GetPageSize()), in.GetPageToken())
+	if err != nil {
+		return nil, err
 	}
-	return &pb.WorkflowResponse{
-		Id:          wf.ID,
-		Name:        wf.Name,
-		Description: wf.Description,
-		Status:      string(wf.Status),
-		Tasks:       tasks,
+	workflows, nextPageToken, err := h.s.List(f)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*pb.WorkflowResponse, len(workflows))
+	for i, wf := range workflows {
+		out[i] = WorkflowToProto(wf)
+	}
+	return &pb.ListWorkflowsResponse{
+		Workflows:     out,
+		NextPageToken: nextPageToken,
 	}, nil
 }
 
+func (h *handler) UpdateWorkflow(_ context.Context, in *pb.UpdateWorkflowRequest) (*pb.WorkflowResponse, error) {
+	if in.GetId() == "" {
+		return nil, fmt.Errorf("id cannot be empty")
+	}
+	w, err := WorkflowFromProto(in.GetName(), in.GetDescription(), in.GetInputs(), in.GetTasks())
+	if err != nil {
+		return nil, err
+	}
+	// the new definition keeps the identity of the workflow it replaces
+	w.ID = in.GetId()
+	wf, err := h.s.Update(w)
+	if err != nil {
+		return nil, err
+	}
+	return WorkflowToProto(wf), nil
+}
+
+func (h *handler) DeleteWorkflow(_ context.Context, in *pb.DeleteWorkflowRequest) (*pb.DeleteWorkflowResponse, error) {
+	if err := h.s.Delete(in.GetId()); err != nil {
+		return nil, err
+	}
+	return &pb.DeleteWorkflowResponse{}, nil
+}
+
 func (h *handler) ExecuteWorkflow(req *pb.ExecuteWorkflowRequest, stream pb.WorkflowService_ExecuteWorkflowServer) error {
-	ctx := stream.Context()
-	resultCh := make(chan map[string]interface{})
+	return sendExecutionEvents(stream, func(eventCh chan<- *domain.ExecutionEvent) error {
+		return h.s.Execute(stream.Context(), req.GetId(), req.GetInputs().AsMap(), eventCh)
+	})
+}
+
+func (h *handler) StartExecution(_ context.Context, in *pb.StartExecutionRequest) (*pb.StartExecutionResponse, error) {
+	e, err := h.s.Start(in.GetId(), in.GetInputs().AsMap())
+	if err != nil {
+		return nil, err
+	}
+	return &pb.StartExecutionResponse{ExecutionId: e.ID}, nil
+}
+
+func (h *handler) WatchExecution(req *pb.WatchExecutionRequest, stream pb.WorkflowService_WatchExecutionServer) error {
+	if req.GetFromSeq() < 0 {
+		return fmt.Errorf("from sequence cannot be negative")
+	}
+	return sendExecutionEvents(stream, func(eventCh chan<- *domain.ExecutionEvent) error {
+		return h.s.Watch(stream.Context(), req.GetExecutionId(), req.GetFromSeq(), eventCh)
+	})
+}
+
+// sendExecutionEvents runs produce in the background and sends every event
+// it emits to the stream, the error of produce is returned to the client
+func sendExecutionEvents(stream grpc.ServerStreamingServer[pb.ExecuteWorkflowResponse], produce func(chan<- *domain.ExecutionEvent) error) error {
+	eventCh := make(chan *domain.ExecutionEvent)
 	errCh := make(chan error, 1)
 	go func() {
-		defer close(resultCh)
-		if err := h.s.Execute(ctx, req.GetId(), resultCh); err != nil {
+		defer close(eventCh)
+		if err := produce(eventCh); err != nil {
 			errCh <- err
 		}
 	}()
 
 	for {
 		select {
-		case result, ok := <-resultCh:
+		case event, ok := <-eventCh:
 			if !ok {
 				// Channel closed, check for error
 				select {
@@ -85,23 +130,9 @@ func (h *handler) ExecuteWorkflow(req *pb.ExecuteWorkflowRequest, stream pb.Work
 					return nil // Success
 				}
 			}
-			r, ok := result["output"].(string)
-			if !ok {
-				return fmt.Errorf("output is not a string, got type %T", result["output"])
-			}
-
-			taskID, _ := result["taskId"].(string)
-			workflowStatus, _ := result["workflowStatus"].(domain.WorklowStatus)
-			totalTasks, _ := result["totalTasks"].(int)
-			executedTasks, _ := result["executedTasks"].(int)
-
-			resp := &pb.ExecuteWorkflowResponse{
-				WorkflowId:     req.GetId(),
-				TaskId:         taskID,
-				TaskResult:     r,
-				WorkflowStatus: pb.WorkflowStatus(pb.WorkflowStatus_value["WORKFLOW_STATUS_"+string(workflowStatus)]),
-				TotalTasks:     int32(totalTasks),
-				ExecutedTasks:  int32(executedTasks),
+			resp, err := ExecutionEventToProto(event)
+			if err != nil {
+				return err
 			}
 			if err := stream.Send(resp); err != nil {
 				return err
@@ -111,3 +142,194 @@ func (h *handler) ExecuteWorkflow(req *pb.ExecuteWorkflowRequest, stream pb.Work
 		}
 	}
 }
+
+func (h *handler) CancelExecution(ctx context.Context, in *pb.CancelExecutionRequest) (*pb.ExecutionResponse, error) {
+	cause, err := domain.NewCancelError(in.GetReason())
+	if err != nil {
+		return nil, err
+	}
+	e, err := h.s.Cancel(ctx, in.GetExecutionId(), cause)
+	if err != nil {
+		return nil, err
+	}
+	return ExecutionToProto(e)
+}
+
+func (h *handler) ListExecutions(_ context.Context, in *pb.ListExecutionsRequest) (*pb.ListExecutionsResponse, error) {
+	var status domain.WorklowStatus
+	if in.Status != nil {
+		status = convertWorkflowStatusFromProto(in.GetStatus())
+	}
+	f, err := domain.NewExecutionFilter(
+		in.GetWorkflowId(),
+		status,
+		timestampFromProto(in.GetStartedAfter()),
+		timestampFromProto(in.GetStartedBefore()),
+		int(in.GetPageSize()),
+		in.GetPageToken(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	executions, nextPageToken, err := h.s.ListExecutions(f)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*pb.ExecutionResponse, len(executions))
+	for i, e := range executions {
+		if out[i], err = ExecutionToProto(e); err != nil {
+			return nil, err
+		}
+	}
+	return &pb.ListExecutionsResponse{
+		Executions:    out,
+		NextPageToken: nextPageToken,
+	}, nil
+}
+
+func (h *handler) GetExecution(_ context.Context, in *pb.GetExecutionRequest) (*pb.ExecutionResponse, error) {
+	e, err := h.s.GetExecution(in.GetId())
+	if err != nil {
+		return nil, err
+	}
+	return ExecutionToProto(e)
+}
+
+func (h *handler) CreateSchedule(_ context.Context, in *pb.CreateScheduleRequest) (*pb.ScheduleResponse, error) {
+	sc, err := ScheduleFromProto(in)
+	if err != nil {
+		return nil, err
+	}
+	sc, err = h.s.CreateSchedule(sc)
+	if err != nil {
+		return nil, err
+	}
+	return ScheduleToProto(sc)
+}
+
+func (h *handler) ListSchedules(_ context.Context, in *pb.ListSchedulesRequest) (*pb.ListSchedulesResponse, error) {
+	schedules, err := h.s.ListSchedules(in.GetWorkflowId())
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*pb.ScheduleResponse, len(schedules))
+	for i, sc := range schedules {
+		if out[i], err = ScheduleToProto(sc); err != nil {
+			return nil, err
+		}
+	}
+	return &pb.ListSchedulesResponse{Schedules: out}, nil
+}
+
+func (h *handler) PauseSchedule(_ context.Context, in *pb.PauseScheduleRequest) (*pb.ScheduleResponse, error) {
+	sc, err := h.s.PauseSchedule(in.GetId(), in.GetPaused())
+	if err != nil {
+		return nil, err
+	}
+	return ScheduleToProto(sc)
+}
+
+func (h *handler) DeleteSchedule(_ context.Context, in *pb.DeleteScheduleRequest) (*pb.DeleteScheduleResponse, error) {
+	if err := h.s.DeleteSchedule(in.GetId()); err != nil {
+		return nil, err
+	}
+	return &pb.DeleteScheduleResponse{}, nil
+}
+
+func (h *handler) CreateWebhook(_ context.Context, in *pb.CreateWebhookRequest) (*pb.WebhookResponse, error) {
+	wh, err := domain.NewWebhook(in.GetWorkflowId(), convertWebhookModeFromProto(in.GetMode()), in.GetSecret())
+	if err != nil {
+		return nil, err
+	}
+	wh, err = h.s.CreateWebhook(wh)
+	if err != nil {
+		return nil, err
+	}
+	return WebhookToProto(wh), nil
+}
+
+func (h *handler) ListWebhooks(_ context.Context, in *pb.ListWebhooksRequest) (*pb.ListWebhooksResponse, error) {
+	webhooks, err := h.s.ListWebhooks(in.GetWorkflowId())
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*pb.WebhookResponse, len(webhooks))
+	for i, wh := range webhooks {
+		out[i] = WebhookToProto(wh)
+	}
+	return &pb.ListWebhooksResponse{Webhooks: out}, nil
+}
+
+func (h *handler) DeleteWebhook(_ context.Context, in *pb.DeleteWebhookRequest) (*pb.DeleteWebhookResponse, error) {
+	if err := h.s.DeleteWebhook(in.GetId()); err != nil {
+		return nil, err
+	}
+	return &pb.DeleteWebhookResponse{}, nil
+}
+
+func (h *handler) CreateTrigger(_ context.Context, in *pb.CreateTriggerRequest) (*pb.TriggerResponse, error) {
+	on := make([]domain.WorklowStatus, len(in.GetOn()))
+	for i, s := range in.GetOn() {
+		on[i] = convertWorkflowStatusFromProto(s)
+	}
+	t, err := domain.NewCompletionTrigger(in.GetWorkflowId(), in.GetTargetWorkflowId(), on, in.GetInputs())
+	if err != nil {
+		return nil, err
+	}
+	t, err = h.s.CreateTrigger(t)
+	if err != nil {
+		return nil, err
+	}
+	return TriggerToProto(t), nil
+}
+
+func (h *handler) ListTriggers(_ context.Context, in *pb.ListTriggersRequest) (*pb.ListTriggersResponse, error) {
+	triggers, err := h.s.ListTriggers(in.GetWorkflowId())
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*pb.TriggerResponse, len(triggers))
+	for i, t := range triggers {
+		out[i] = TriggerToProto(t)
+	}
+	return &pb.ListTriggersResponse{Triggers: out}, nil
+}
+
+func (h *handler) DeleteTrigger(_ context.Context, in *pb.DeleteTriggerRequest) (*pb.DeleteTriggerResponse, error) {
+	if err := h.s.DeleteTrigger(in.GetId()); err != nil {
+		return nil, err
+	}
+	return &pb.DeleteTriggerResponse{}, nil
+}
+
+func (h *handler) CreateFileWatch(_ context.Context, in *pb.CreateFileWatchRequest) (*pb.FileWatchResponse, error) {
+	fw, err := domain.NewFileWatch(in.GetWorkflowId(), in.GetDir(), in.GetPattern(),
+		in.GetDebounce().AsDuration(), in.GetArchiveDir())
+	if err != nil {
+		return nil, err
+	}
+	fw, err = h.s.CreateFileWatch(fw)
+	if err != nil {
+		return nil, err
+	}
+	return FileWatchToProto(fw), nil
+}
+
+func (h *handler) ListFileWatches(_ context.Context, in *pb.ListFileWatchesRequest) (*pb.ListFileWatchesResponse, error) {
+	watches, err := h.s.ListFileWatches(in.GetWorkflowId())
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*pb.FileWatchResponse, len(watches))
+	for i, fw := range watches {
+		out[i] = FileWatchToProto(fw)
+	}
+	return &pb.ListFileWatchesResponse{FileWatches: out}, nil
+}
+
+func (h *handler) DeleteFileWatch(_ context.Context, in *pb.DeleteFileWatchRequest) (*pb.DeleteFileWatchResponse, error) {
+	if err := h.s.DeleteFileWatch(in.GetId()); err != nil {
+		return nil, err
+	}
+	return &pb.DeleteFileWatchResponse{}, nil
+}
@@ -1,23 +1,126 @@
 package handler
 
 import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
 	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/domain"
 
 	pb "github.com/luis12loureiro/neurun/apps/workflow/gen"
 	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
+func WorkflowFromProto(name, description string, pbInputs []*pb.WorkflowInput, pbTasks []*pb.CreateTaskRequest) (*domain.Workflow, error) {
+	inputs := []*domain.Input{}
+	for _, i := range pbInputs {
+		input, err := InputFromProto(i)
+		if err != nil {
+			return nil, err
+		}
+		inputs = append(inputs, input)
+	}
+	refs := newTaskRefs(pbTasks)
+	tasks := []*domain.Task{}
+	for _, t := range pbTasks {
+		task, err := refs.build(t)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+	return domain.NewWorkflow(name, description, inputs, tasks)
+}
+
+// taskRefs builds the tasks of a workflow, a task referenced by several
+// others is built once and shared by all of them
+type taskRefs struct {
+	byName   map[string][]*pb.CreateTaskRequest // definitions in the graph by name
+	built    map[*pb.CreateTaskRequest]*domain.Task
+	building map[*pb.CreateTaskRequest]bool // used to detect cycles through refs
+}
+
+func newTaskRefs(pbTasks []*pb.CreateTaskRequest) *taskRefs {
+	refs := &taskRefs{
+		byName:   make(map[string][]*pb.CreateTaskRequest),
+		built:    make(map[*pb.CreateTaskRequest]*domain.Task),
+		building: make(map[*pb.CreateTaskRequest]bool),
+	}
+	seen := make(map[*pb.CreateTaskRequest]bool)
+	var visit func(ts []*pb.CreateTaskRequest)
+	visit = func(ts []*pb.CreateTaskRequest) {
+		for _, t := range ts {
+			if t == nil || t.Ref != nil || seen[t] {
+				continue
+			}
+			seen[t] = true
+			refs.byName[t.GetName()] = append(refs.byName[t.GetName()], t)
+			visit(t.GetNext())
+			visit([]*pb.CreateTaskRequest{t.GetOnFailure()})
+		}
+	}
+	visit(pbTasks)
+	return refs
+}
+
+// build returns the task of a definition or of the definition it refers to
+func (refs *taskRefs) build(pbTask *pb.CreateTaskRequest) (*domain.Task, error) {
+	if pbTask.Ref != nil {
+		defs := refs.byName[pbTask.GetRef()]
+		switch len(defs) {
+		case 0:
+			return nil, fmt.Errorf("unknown task %s", pbTask.GetRef())
+		case 1:
+			pbTask = defs[0]
+		default:
+			return nil, fmt.Errorf("task %s is ambiguous, more than one task has that name", pbTask.GetRef())
+		}
+	}
+	if task, ok := refs.built[pbTask]; ok {
+		return task, nil
+	}
+	if refs.building[pbTask] {
+		return nil, fmt.Errorf("cycle detected through task %s", pbTask.GetName())
+	}
+	refs.building[pbTask] = true
+	task, err := taskFromProto(pbTask, refs)
+	if err != nil {
+		return nil, err
+	}
+	refs.built[pbTask] = task
+	return task, nil
+}
+
+func WorkflowToProto(wf *domain.Workflow) *pb.WorkflowResponse {
+	return &pb.WorkflowResponse{
+		Id:          wf.ID,
+		Name:        wf.Name,
+		Description: wf.Description,
+		Tasks:       convertNextToProto(wf.Tasks, make(map[string]bool)),
+		Inputs:      convertInputsToProto(wf.Inputs),
+	}
+}
+
 func TaskFromProto(pbTask *pb.CreateTaskRequest) (*domain.Task, error) {
-	next, err := convertNextFromProto(pbTask.GetNext())
+	return newTaskRefs([]*pb.CreateTaskRequest{pbTask}).build(pbTask)
+}
+
+func taskFromProto(pbTask *pb.CreateTaskRequest, refs *taskRefs) (*domain.Task, error) {
+	next, err := convertNextFromProto(pbTask.GetNext(), refs)
 	if err != nil {
 		return nil, err
 	}
 	var payload domain.Payload
 	switch pbTask.GetPayload().(type) {
 	case *pb.CreateTaskRequest_LogPayload:
-		payload = &domain.LogPayload{
-			Message: pbTask.GetLogPayload().GetMessage(),
+		logPayloadDomain, err := domain.NewLogPayload(pbTask.GetLogPayload().GetMessage())
+		if err != nil {
+			return nil, err
 		}
+		payload = logPayloadDomain
 	case *pb.CreateTaskRequest_HttpPayload:
 		httpPayload := pbTask.GetHttpPayload()
 		httpPayloadDomain, err := domain.NewHTTPPayload(
@@ -36,6 +139,118 @@ func TaskFromProto(pbTask *pb.CreateTaskRequest) (*domain.Task, error) {
 			return nil, err
 		}
 		payload = httpPayloadDomain
+	case *pb.CreateTaskRequest_ShellPayload:
+		shellPayload := pbTask.GetShellPayload()
+		shellPayloadDomain, err := domain.NewShellPayload(
+			shellPayload.GetCommand(),
+			shellPayload.GetArgs(),
+			shellPayload.GetWorkingDir(),
+			shellPayload.GetEnv(),
+			shellPayload.GetStdin(),
+			shellPayload.GetTimeout().AsDuration(),
+			shellPayload.GetMaxOutputSize(),
+			convertShellLimitsFromProto(shellPayload.GetLimits()),
+		)
+		if err != nil {
+			return nil, err
+		}
+		payload = shellPayloadDomain
+	case *pb.CreateTaskRequest_DelayPayload:
+		delayPayload := pbTask.GetDelayPayload()
+		delayPayloadDomain, err := domain.NewDelayPayload(
+			delayPayload.GetDuration().AsDuration(),
+			delayPayload.GetUntil(),
+			delayPayload.GetTimeOfDay(),
+			delayPayload.GetTimeZone(),
+		)
+		if err != nil {
+			return nil, err
+		}
+		payload = delayPayloadDomain
+	case *pb.CreateTaskRequest_TransformPayload:
+		transformPayloadDomain, err := domain.NewTransformPayload(pbTask.GetTransformPayload().GetQuery())
+		if err != nil {
+			return nil, err
+		}
+		payload = transformPayloadDomain
+	case *pb.CreateTaskRequest_SubworkflowPayload:
+		subworkflowPayload := pbTask.GetSubworkflowPayload()
+		subworkflowPayloadDomain, err := domain.NewSubworkflowPayload(
+			subworkflowPayload.GetWorkflowId(),
+			subworkflowPayload.GetInputs(),
+		)
+		if err != nil {
+			return nil, err
+		}
+		payload = subworkflowPayloadDomain
+	case *pb.CreateTaskRequest_MapPayload:
+		mapPayload := pbTask.GetMapPayload()
+		if mapPayload.GetTask() == nil {
+			return nil, fmt.Errorf("task of a map cannot be empty")
+		}
+		body, err := TaskFromProto(mapPayload.GetTask())
+		if err != nil {
+			return nil, fmt.Errorf("invalid task of map: %w", err)
+		}
+		mapPayloadDomain, err := domain.NewMapPayload(
+			mapPayload.GetItems(),
+			body,
+			int(mapPayload.GetMaxParallelism()),
+			convertMapFailurePolicyFromProto(mapPayload.GetFailurePolicy()),
+			int(mapPayload.GetToleratedFailurePercent()),
+		)
+		if err != nil {
+			return nil, err
+		}
+		payload = mapPayloadDomain
+	case *pb.CreateTaskRequest_LoopPayload:
+		loopPayload := pbTask.GetLoopPayload()
+		if loopPayload.GetTask() == nil {
+			return nil, fmt.Errorf("task of a loop cannot be empty")
+		}
+		body, err := TaskFromProto(loopPayload.GetTask())
+		if err != nil {
+			return nil, fmt.Errorf("invalid task of loop: %w", err)
+		}
+		loopPayloadDomain, err := domain.NewLoopPayload(
+			body,
+			loopPayload.GetWhile(),
+			int(loopPayload.GetMaxIterations()),
+			loopPayload.GetInterval().AsDuration(),
+			loopPayload.GetDeadline().AsDuration(),
+		)
+		if err != nil {
+			return nil, err
+		}
+		payload = loopPayloadDomain
+	case *pb.CreateTaskRequest_SwitchPayload:
+		switchPayload := pbTask.GetSwitchPayload()
+		switchPayloadDomain, err := domain.NewSwitchPayload(
+			convertSwitchCasesFromProto(switchPayload.GetCases()),
+			switchPayload.GetDefault(),
+		)
+		if err != nil {
+			return nil, err
+		}
+		payload = switchPayloadDomain
+	}
+	join, err := convertJoinFromProto(pbTask.GetJoin())
+	if err != nil {
+		return nil, err
+	}
+	var onFailure *domain.Task
+	if pbTask.GetOnFailure() != nil {
+		onFailure, err = refs.build(pbTask.GetOnFailure())
+		if err != nil {
+			return nil, fmt.Errorf("invalid on failure task: %w", err)
+		}
+	}
+	var compensation *domain.Task
+	if pbTask.GetCompensation() != nil {
+		compensation, err = TaskFromProto(pbTask.GetCompensation())
+		if err != nil {
+			return nil, fmt.Errorf("invalid compensation task: %w", err)
+		}
 	}
 	task, err := domain.NewTask(
 		pbTask.GetName(),
@@ -43,8 +258,12 @@ func TaskFromProto(pbTask *pb.CreateTaskRequest) (*domain.Task, error) {
 		pbTask.GetRetries(),
 		pbTask.GetRetryDelay().AsDuration(),
 		pbTask.GetCondition(),
+		join,
+		convertTaskFailurePolicyFromProto(pbTask.GetFailurePolicy()),
 		payload,
 		next,
+		onFailure,
+		compensation,
 	)
 	if err != nil {
 		return nil, err
@@ -53,32 +272,48 @@ func TaskFromProto(pbTask *pb.CreateTaskRequest) (*domain.Task, error) {
 }
 
 func TaskToProto(t *domain.Task) *pb.Task {
+	return taskToProto(t, make(map[string]bool))
+}
+
+// taskToProto converts a task and the tasks after it, a task reached again
+// through another predecessor is only referenced by its id
+func taskToProto(t *domain.Task, seen map[string]bool) *pb.Task {
+	if seen[t.ID] {
+		return &pb.Task{Id: &t.ID, Name: t.Name, Ref: &t.ID}
+	}
+	seen[t.ID] = true
 	switch p := t.Payload.(type) {
 	case *domain.LogPayload:
 		return &pb.Task{
-			Id:         &t.ID,
-			Name:       t.Name,
-			Type:       convertTaskTypeToProto(t.Type),
-			Status:     convertTaskStatusToProto(t.Status),
-			Retries:    uint32(t.Retries),
-			RetryDelay: durationpb.New(t.RetryDelay),
-			Condition:  &t.Condition,
+			Id:            &t.ID,
+			Name:          t.Name,
+			Type:          convertTaskTypeToProto(t.Type),
+			Retries:       uint32(t.Retries),
+			RetryDelay:    durationpb.New(t.RetryDelay),
+			Condition:     &t.Condition,
+			Join:          convertJoinToProto(t.Join),
+			FailurePolicy: convertTaskFailurePolicyToProto(t.FailurePolicy),
+			OnFailure:     convertOptionalTaskToProto(t.OnFailure, seen),
+			Compensation:  convertOptionalTaskToProto(t.Compensation, seen),
 			Payload: &pb.Task_LogPayload{
 				LogPayload: &pb.LogPayload{
 					Message: p.Message,
 				},
 			},
-			Next: convertNextToProto(t.Next),
+			Next: convertNextToProto(t.Next, seen),
 		}
 	case *domain.HTTPPayload:
 		return &pb.Task{
-			Id:         &t.ID,
-			Name:       t.Name,
-			Type:       convertTaskTypeToProto(t.Type),
-			Status:     convertTaskStatusToProto(t.Status),
-			Retries:    uint32(t.Retries),
-			RetryDelay: durationpb.New(t.RetryDelay),
-			Condition:  &t.Condition,
+			Id:            &t.ID,
+			Name:          t.Name,
+			Type:          convertTaskTypeToProto(t.Type),
+			Retries:       uint32(t.Retries),
+			RetryDelay:    durationpb.New(t.RetryDelay),
+			Condition:     &t.Condition,
+			Join:          convertJoinToProto(t.Join),
+			FailurePolicy: convertTaskFailurePolicyToProto(t.FailurePolicy),
+			OnFailure:     convertOptionalTaskToProto(t.OnFailure, seen),
+			Compensation:  convertOptionalTaskToProto(t.Compensation, seen),
 			Payload: &pb.Task_HttpPayload{
 				HttpPayload: &pb.HTTPPayload{
 					Url:                p.URL,
@@ -93,22 +328,337 @@ func TaskToProto(t *domain.Task) *pb.Task {
 					ExpectedStatusCode: p.ExpectedStatusCode,
 				},
 			},
-			Next: convertNextToProto(t.Next),
+			Next: convertNextToProto(t.Next, seen),
+		}
+	case *domain.ShellPayload:
+		return &pb.Task{
+			Id:            &t.ID,
+			Name:          t.Name,
+			Type:          convertTaskTypeToProto(t.Type),
+			Retries:       uint32(t.Retries),
+			RetryDelay:    durationpb.New(t.RetryDelay),
+			Condition:     &t.Condition,
+			Join:          convertJoinToProto(t.Join),
+			FailurePolicy: convertTaskFailurePolicyToProto(t.FailurePolicy),
+			OnFailure:     convertOptionalTaskToProto(t.OnFailure, seen),
+			Compensation:  convertOptionalTaskToProto(t.Compensation, seen),
+			Payload: &pb.Task_ShellPayload{
+				ShellPayload: &pb.ShellPayload{
+					Command:       p.Command,
+					Args:          p.Args,
+					WorkingDir:    &p.WorkingDir,
+					Env:           p.Env,
+					Stdin:         &p.Stdin,
+					Timeout:       durationpb.New(p.Timeout),
+					MaxOutputSize: p.MaxOutputSize,
+					Limits:        convertShellLimitsToProto(p.Limits),
+				},
+			},
+			Next: convertNextToProto(t.Next, seen),
+		}
+	case *domain.DelayPayload:
+		return &pb.Task{
+			Id:            &t.ID,
+			Name:          t.Name,
+			Type:          convertTaskTypeToProto(t.Type),
+			Retries:       uint32(t.Retries),
+			RetryDelay:    durationpb.New(t.RetryDelay),
+			Condition:     &t.Condition,
+			Join:          convertJoinToProto(t.Join),
+			FailurePolicy: convertTaskFailurePolicyToProto(t.FailurePolicy),
+			OnFailure:     convertOptionalTaskToProto(t.OnFailure, seen),
+			Compensation:  convertOptionalTaskToProto(t.Compensation, seen),
+			Payload: &pb.Task_DelayPayload{
+				DelayPayload: convertDelayPayloadToProto(p),
+			},
+			Next: convertNextToProto(t.Next, seen),
+		}
+	case *domain.TransformPayload:
+		return &pb.Task{
+			Id:            &t.ID,
+			Name:          t.Name,
+			Type:          convertTaskTypeToProto(t.Type),
+			Retries:       uint32(t.Retries),
+			RetryDelay:    durationpb.New(t.RetryDelay),
+			Condition:     &t.Condition,
+			Join:          convertJoinToProto(t.Join),
+			FailurePolicy: convertTaskFailurePolicyToProto(t.FailurePolicy),
+			OnFailure:     convertOptionalTaskToProto(t.OnFailure, seen),
+			Compensation:  convertOptionalTaskToProto(t.Compensation, seen),
+			Payload: &pb.Task_TransformPayload{
+				TransformPayload: &pb.TransformPayload{
+					Query: p.Query,
+				},
+			},
+			Next: convertNextToProto(t.Next, seen),
+		}
+	case *domain.SubworkflowPayload:
+		return &pb.Task{
+			Id:            &t.ID,
+			Name:          t.Name,
+			Type:          convertTaskTypeToProto(t.Type),
+			Retries:       uint32(t.Retries),
+			RetryDelay:    durationpb.New(t.RetryDelay),
+			Condition:     &t.Condition,
+			Join:          convertJoinToProto(t.Join),
+			FailurePolicy: convertTaskFailurePolicyToProto(t.FailurePolicy),
+			OnFailure:     convertOptionalTaskToProto(t.OnFailure, seen),
+			Compensation:  convertOptionalTaskToProto(t.Compensation, seen),
+			Payload: &pb.Task_SubworkflowPayload{
+				SubworkflowPayload: &pb.SubworkflowPayload{
+					WorkflowId: p.WorkflowID,
+					Inputs:     p.Inputs,
+				},
+			},
+			Next: convertNextToProto(t.Next, seen),
+		}
+	case *domain.MapPayload:
+		return &pb.Task{
+			Id:            &t.ID,
+			Name:          t.Name,
+			Type:          convertTaskTypeToProto(t.Type),
+			Retries:       uint32(t.Retries),
+			RetryDelay:    durationpb.New(t.RetryDelay),
+			Condition:     &t.Condition,
+			Join:          convertJoinToProto(t.Join),
+			FailurePolicy: convertTaskFailurePolicyToProto(t.FailurePolicy),
+			OnFailure:     convertOptionalTaskToProto(t.OnFailure, seen),
+			Compensation:  convertOptionalTaskToProto(t.Compensation, seen),
+			Payload: &pb.Task_MapPayload{
+				MapPayload: &pb.MapPayload{
+					Items:                   p.Items,
+					Task:                    convertTaskToCreateRequest(TaskToProto(p.Task)),
+					MaxParallelism:          int32(p.MaxParallelism),
+					FailurePolicy:           convertMapFailurePolicyToProto(p.FailurePolicy),
+					ToleratedFailurePercent: int32(p.ToleratedFailurePercent),
+				},
+			},
+			Next: convertNextToProto(t.Next, seen),
+		}
+	case *domain.LoopPayload:
+		return &pb.Task{
+			Id:            &t.ID,
+			Name:          t.Name,
+			Type:          convertTaskTypeToProto(t.Type),
+			Retries:       uint32(t.Retries),
+			RetryDelay:    durationpb.New(t.RetryDelay),
+			Condition:     &t.Condition,
+			Join:          convertJoinToProto(t.Join),
+			FailurePolicy: convertTaskFailurePolicyToProto(t.FailurePolicy),
+			OnFailure:     convertOptionalTaskToProto(t.OnFailure, seen),
+			Compensation:  convertOptionalTaskToProto(t.Compensation, seen),
+			Payload: &pb.Task_LoopPayload{
+				LoopPayload: &pb.LoopPayload{
+					Task:          convertTaskToCreateRequest(TaskToProto(p.Task)),
+					While:         p.While,
+					MaxIterations: int32(p.MaxIterations),
+					Interval:      durationpb.New(p.Interval),
+					Deadline:      durationpb.New(p.Deadline),
+				},
+			},
+			Next: convertNextToProto(t.Next, seen),
+		}
+	case *domain.SwitchPayload:
+		return &pb.Task{
+			Id:            &t.ID,
+			Name:          t.Name,
+			Type:          convertTaskTypeToProto(t.Type),
+			Retries:       uint32(t.Retries),
+			RetryDelay:    durationpb.New(t.RetryDelay),
+			Condition:     &t.Condition,
+			Join:          convertJoinToProto(t.Join),
+			FailurePolicy: convertTaskFailurePolicyToProto(t.FailurePolicy),
+			OnFailure:     convertOptionalTaskToProto(t.OnFailure, seen),
+			Compensation:  convertOptionalTaskToProto(t.Compensation, seen),
+			Payload: &pb.Task_SwitchPayload{
+				SwitchPayload: &pb.SwitchPayload{
+					Cases:   convertSwitchCasesToProto(p.Cases),
+					Default: &p.Default,
+				},
+			},
+			Next: convertNextToProto(t.Next, seen),
 		}
 	default:
 		return &pb.Task{
-			Id:         &t.ID,
-			Name:       t.Name,
-			Type:       convertTaskTypeToProto(t.Type),
-			Status:     convertTaskStatusToProto(t.Status),
-			Retries:    uint32(t.Retries),
-			RetryDelay: durationpb.New(t.RetryDelay),
-			Condition:  &t.Condition,
-			Next:       convertNextToProto(t.Next),
+			Id:            &t.ID,
+			Name:          t.Name,
+			Type:          convertTaskTypeToProto(t.Type),
+			Retries:       uint32(t.Retries),
+			RetryDelay:    durationpb.New(t.RetryDelay),
+			Condition:     &t.Condition,
+			Join:          convertJoinToProto(t.Join),
+			FailurePolicy: convertTaskFailurePolicyToProto(t.FailurePolicy),
+			OnFailure:     convertOptionalTaskToProto(t.OnFailure, seen),
+			Compensation:  convertOptionalTaskToProto(t.Compensation, seen),
+			Next:          convertNextToProto(t.Next, seen),
 		}
 	}
 }
 
+func convertShellLimitsFromProto(l *pb.ShellLimits) domain.ShellLimits {
+	return domain.ShellLimits{
+		CPUTime:       l.GetCpuTime().AsDuration(),
+		MemoryBytes:   l.GetMemoryBytes(),
+		OpenFiles:     l.GetOpenFiles(),
+		User:          l.GetUser(),
+		NewNamespaces: l.GetNewNamespaces(),
+	}
+}
+
+func convertShellLimitsToProto(l domain.ShellLimits) *pb.ShellLimits {
+	return &pb.ShellLimits{
+		CpuTime:       durationpb.New(l.CPUTime),
+		MemoryBytes:   l.MemoryBytes,
+		OpenFiles:     l.OpenFiles,
+		User:          &l.User,
+		NewNamespaces: l.NewNamespaces,
+	}
+}
+
+// convertTaskToCreateRequest returns the definition of a task in the form it
+// is created with, used for tasks nested in payloads which have no next, on
+// failure or compensation tasks
+func convertTaskToCreateRequest(t *pb.Task) *pb.CreateTaskRequest {
+	out := &pb.CreateTaskRequest{
+		Name:          t.GetName(),
+		Type:          t.GetType(),
+		Retries:       t.GetRetries(),
+		RetryDelay:    t.GetRetryDelay(),
+		Condition:     t.Condition,
+		Join:          t.GetJoin(),
+		FailurePolicy: t.GetFailurePolicy(),
+	}
+	switch p := t.GetPayload().(type) {
+	case *pb.Task_LogPayload:
+		out.Payload = &pb.CreateTaskRequest_LogPayload{LogPayload: p.LogPayload}
+	case *pb.Task_HttpPayload:
+		out.Payload = &pb.CreateTaskRequest_HttpPayload{HttpPayload: p.HttpPayload}
+	case *pb.Task_ShellPayload:
+		out.Payload = &pb.CreateTaskRequest_ShellPayload{ShellPayload: p.ShellPayload}
+	case *pb.Task_DelayPayload:
+		out.Payload = &pb.CreateTaskRequest_DelayPayload{DelayPayload: p.DelayPayload}
+	case *pb.Task_TransformPayload:
+		out.Payload = &pb.CreateTaskRequest_TransformPayload{TransformPayload: p.TransformPayload}
+	case *pb.Task_SubworkflowPayload:
+		out.Payload = &pb.CreateTaskRequest_SubworkflowPayload{SubworkflowPayload: p.SubworkflowPayload}
+	case *pb.Task_MapPayload:
+		out.Payload = &pb.CreateTaskRequest_MapPayload{MapPayload: p.MapPayload}
+	case *pb.Task_LoopPayload:
+		out.Payload = &pb.CreateTaskRequest_LoopPayload{LoopPayload: p.LoopPayload}
+	case *pb.Task_SwitchPayload:
+		out.Payload = &pb.CreateTaskRequest_SwitchPayload{SwitchPayload: p.SwitchPayload}
+	}
+	return out
+}
+
+func convertTaskFailurePolicyFromProto(p pb.TaskFailurePolicy) domain.TaskFailurePolicy {
+	switch p {
+	case pb.TaskFailurePolicy_TASK_FAILURE_POLICY_CONTINUE:
+		return domain.TaskContinue
+	default:
+		return domain.TaskFailWorkflow
+	}
+}
+
+func convertTaskFailurePolicyToProto(p domain.TaskFailurePolicy) pb.TaskFailurePolicy {
+	switch p {
+	case domain.TaskContinue:
+		return pb.TaskFailurePolicy_TASK_FAILURE_POLICY_CONTINUE
+	default:
+		return pb.TaskFailurePolicy_TASK_FAILURE_POLICY_FAIL_WORKFLOW
+	}
+}
+
+// convertOptionalTaskToProto returns nil for tasks without an on failure or
+// compensation task
+func convertOptionalTaskToProto(t *domain.Task, seen map[string]bool) *pb.Task {
+	if t == nil {
+		return nil
+	}
+	return taskToProto(t, seen)
+}
+
+func convertJoinFromProto(j *pb.Join) (domain.Join, error) {
+	var mode domain.JoinMode
+	switch j.GetMode() {
+	case pb.JoinMode_JOIN_MODE_ANY:
+		mode = domain.JoinAny
+	case pb.JoinMode_JOIN_MODE_QUORUM:
+		mode = domain.JoinQuorum
+	default:
+		mode = domain.JoinAll
+	}
+	return domain.NewJoin(mode, int(j.GetQuorum()), j.GetCancelRemaining())
+}
+
+func convertJoinToProto(j domain.Join) *pb.Join {
+	out := &pb.Join{
+		Quorum:          int32(j.Quorum),
+		CancelRemaining: j.CancelRemaining,
+	}
+	switch j.Mode {
+	case domain.JoinAny:
+		out.Mode = pb.JoinMode_JOIN_MODE_ANY
+	case domain.JoinQuorum:
+		out.Mode = pb.JoinMode_JOIN_MODE_QUORUM
+	default:
+		out.Mode = pb.JoinMode_JOIN_MODE_ALL
+	}
+	return out
+}
+
+func convertSwitchCasesFromProto(cases []*pb.SwitchCase) []domain.SwitchCase {
+	out := make([]domain.SwitchCase, 0, len(cases))
+	for _, c := range cases {
+		out = append(out, domain.SwitchCase{When: c.GetWhen(), Next: c.GetNext()})
+	}
+	return out
+}
+
+func convertSwitchCasesToProto(cases []domain.SwitchCase) []*pb.SwitchCase {
+	out := make([]*pb.SwitchCase, 0, len(cases))
+	for _, c := range cases {
+		out = append(out, &pb.SwitchCase{When: c.When, Next: c.Next})
+	}
+	return out
+}
+
+func convertMapFailurePolicyFromProto(fp pb.MapFailurePolicy) domain.MapFailurePolicy {
+	switch fp {
+	case pb.MapFailurePolicy_MAP_FAILURE_POLICY_CONTINUE:
+		return domain.MapContinue
+	case pb.MapFailurePolicy_MAP_FAILURE_POLICY_TOLERATE:
+		return domain.MapTolerate
+	default:
+		return domain.MapFailFast
+	}
+}
+
+func convertMapFailurePolicyToProto(fp domain.MapFailurePolicy) pb.MapFailurePolicy {
+	switch fp {
+	case domain.MapContinue:
+		return pb.MapFailurePolicy_MAP_FAILURE_POLICY_CONTINUE
+	case domain.MapTolerate:
+		return pb.MapFailurePolicy_MAP_FAILURE_POLICY_TOLERATE
+	default:
+		return pb.MapFailurePolicy_MAP_FAILURE_POLICY_FAIL_FAST
+	}
+}
+
+func convertDelayPayloadToProto(p *domain.DelayPayload) *pb.DelayPayload {
+	out := &pb.DelayPayload{}
+	switch {
+	case p.Until != "":
+		out.Wait = &pb.DelayPayload_Until{Until: p.Until}
+	case p.TimeOfDay != "":
+		out.Wait = &pb.DelayPayload_TimeOfDay{TimeOfDay: p.TimeOfDay}
+		out.TimeZone = &p.TimeZone
+	default:
+		out.Wait = &pb.DelayPayload_Duration{Duration: durationpb.New(p.Duration)}
+	}
+	return out
+}
+
 func convertTaskStatusToProto(s domain.TaskStatus) pb.TaskStatus {
 	switch s {
 	case domain.TaskStatusPending:
@@ -119,21 +669,25 @@ func convertTaskStatusToProto(s domain.TaskStatus) pb.TaskStatus {
 		return pb.TaskStatus_TASK_STATUS_COMPLETED
 	case domain.TaskStatusFailed:
 		return pb.TaskStatus_TASK_STATUS_FAILED
+	case domain.TaskStatusSkipped:
+		return pb.TaskStatus_TASK_STATUS_SKIPPED
+	case domain.TaskStatusCancelled:
+		return pb.TaskStatus_TASK_STATUS_CANCELLED
 	default:
 		return pb.TaskStatus_TASK_STATUS_PENDING
 	}
 }
 
-func convertNextFromProto(pbNext []*pb.CreateTaskRequest) ([]*domain.Task, error) {
+func convertNextFromProto(pbNext []*pb.CreateTaskRequest, refs *taskRefs) ([]*domain.Task, error) {
 	if len(pbNext) == 0 {
 		return []*domain.Task{}, nil
 	}
 	out := []*domain.Task{}
 	for _, t := range pbNext {
-		if t == nil || t.GetName() == "" {
+		if t == nil || (t.GetName() == "" && t.Ref == nil) {
 			continue
 		}
-		from, err := TaskFromProto(t)
+		from, err := refs.build(t)
 		if err != nil {
 			return nil, err
 		}
@@ -142,14 +696,14 @@ func convertNextFromProto(pbNext []*pb.CreateTaskRequest) ([]*domain.Task, error
 	return out, nil
 }
 
-func convertNextToProto(t []*domain.Task) []*pb.Task {
+func convertNextToProto(t []*domain.Task, seen map[string]bool) []*pb.Task {
 	if len(t) == 0 {
 		// protobuf reads nil as empty slice and retuns an emtpy array
 		return nil
 	}
 	out := make([]*pb.Task, len(t))
 	for i, t := range t {
-		out[i] = TaskToProto(t)
+		out[i] = taskToProto(t, seen)
 	}
 	return out
 }
@@ -162,6 +716,20 @@ func convertTaskTypeFromProto(tt pb.TaskType) domain.TaskType {
 		return domain.TaskTypeLog
 	case pb.TaskType_TASK_TYPE_HTTP:
 		return domain.TaskTypeHTTP
+	case pb.TaskType_TASK_TYPE_SHELL:
+		return domain.TaskTypeShell
+	case pb.TaskType_TASK_TYPE_DELAY:
+		return domain.TaskTypeDelay
+	case pb.TaskType_TASK_TYPE_TRANSFORM:
+		return domain.TaskTypeTransform
+	case pb.TaskType_TASK_TYPE_SUBWORKFLOW:
+		return domain.TaskTypeSubworkflow
+	case pb.TaskType_TASK_TYPE_MAP:
+		return domain.TaskTypeMap
+	case pb.TaskType_TASK_TYPE_LOOP:
+		return domain.TaskTypeLoop
+	case pb.TaskType_TASK_TYPE_SWITCH:
+		return domain.TaskTypeSwitch
 	default:
 		return domain.TaskTypeUnspecified
 	}
@@ -175,6 +743,20 @@ func convertTaskTypeToProto(tt domain.TaskType) pb.TaskType {
 		return pb.TaskType_TASK_TYPE_LOG
 	case domain.TaskTypeHTTP:
 		return pb.TaskType_TASK_TYPE_HTTP
+	case domain.TaskTypeShell:
+		return pb.TaskType_TASK_TYPE_SHELL
+	case domain.TaskTypeDelay:
+		return pb.TaskType_TASK_TYPE_DELAY
+	case domain.TaskTypeTransform:
+		return pb.TaskType_TASK_TYPE_TRANSFORM
+	case domain.TaskTypeSubworkflow:
+		return pb.TaskType_TASK_TYPE_SUBWORKFLOW
+	case domain.TaskTypeMap:
+		return pb.TaskType_TASK_TYPE_MAP
+	case domain.TaskTypeLoop:
+		return pb.TaskType_TASK_TYPE_LOOP
+	case domain.TaskTypeSwitch:
+		return pb.TaskType_TASK_TYPE_SWITCH
 	default:
 		return pb.TaskType_TASK_TYPE_UNSPECIFIED
 	}
@@ -259,3 +841,363 @@ func convertHTTPApiKeyLocationToProto(location domain.HTTPApiKeyLocation) pb.HTT
 		return pb.HTTPApiKeyLocation_HTTP_API_KEY_LOCATION_HEADER
 	}
 }
+
+func InputFromProto(pbInput *pb.WorkflowInput) (*domain.Input, error) {
+	var defaultValue interface{}
+	if pbInput.GetDefaultValue() != nil {
+		defaultValue = pbInput.GetDefaultValue().AsInterface()
+	}
+	return domain.NewInput(
+		pbInput.GetName(),
+		convertInputTypeFromProto(pbInput.GetType()),
+		pbInput.GetRequired(),
+		defaultValue,
+		pbInput.GetDescription(),
+	)
+}
+
+func InputToProto(i *domain.Input) *pb.WorkflowInput {
+	out := &pb.WorkflowInput{
+		Name:        i.Name,
+		Type:        convertInputTypeToProto(i.Type),
+		Required:    i.Required,
+		Description: i.Description,
+	}
+	if i.Default != nil {
+		// defaults are validated on creation so the conversion cannot fail
+		out.DefaultValue, _ = structpb.NewValue(i.Default)
+	}
+	return out
+}
+
+func convertInputsToProto(inputs []*domain.Input) []*pb.WorkflowInput {
+	if len(inputs) == 0 {
+		return nil
+	}
+	out := make([]*pb.WorkflowInput, len(inputs))
+	for i, in := range inputs {
+		out[i] = InputToProto(in)
+	}
+	return out
+}
+
+func convertInputTypeFromProto(it pb.InputType) domain.InputType {
+	switch it {
+	case pb.InputType_INPUT_TYPE_STRING:
+		return domain.InputTypeString
+	case pb.InputType_INPUT_TYPE_NUMBER:
+		return domain.InputTypeNumber
+	case pb.InputType_INPUT_TYPE_BOOL:
+		return domain.InputTypeBool
+	case pb.InputType_INPUT_TYPE_OBJECT:
+		return domain.InputTypeObject
+	case pb.InputType_INPUT_TYPE_LIST:
+		return domain.InputTypeList
+	default:
+		return domain.InputTypeUnspecified
+	}
+}
+
+func convertInputTypeToProto(it domain.InputType) pb.InputType {
+	switch it {
+	case domain.InputTypeString:
+		return pb.InputType_INPUT_TYPE_STRING
+	case domain.InputTypeNumber:
+		return pb.InputType_INPUT_TYPE_NUMBER
+	case domain.InputTypeBool:
+		return pb.InputType_INPUT_TYPE_BOOL
+	case domain.InputTypeObject:
+		return pb.InputType_INPUT_TYPE_OBJECT
+	case domain.InputTypeList:
+		return pb.InputType_INPUT_TYPE_LIST
+	default:
+		return pb.InputType_INPUT_TYPE_UNSPECIFIED
+	}
+}
+
+func ExecutionEventToProto(ev *domain.ExecutionEvent) (*pb.ExecuteWorkflowResponse, error) {
+	output, err := outputToString(ev.Output)
+	if err != nil {
+		return nil, err
+	}
+	resp := &pb.ExecuteWorkflowResponse{
+		WorkflowId:     ev.WorkflowID,
+		ExecutionId:    ev.ExecutionID,
+		Seq:            ev.Seq,
+		TaskId:         ev.TaskID,
+		TaskResult:     output,
+		WorkflowStatus: convertWorkflowStatusToProto(ev.WorkflowStatus),
+		TotalTasks:     int32(ev.TotalTasks),
+		ExecutedTasks:  int32(ev.ExecutedTasks),
+		Attempt:        int32(ev.Attempt),
+		MaxAttempts:    int32(ev.MaxAttempts),
+		Error:          ev.Error,
+		Compensates:    ev.Compensates,
+	}
+	if ev.TaskID != "" {
+		resp.TaskStatus = convertTaskStatusToProto(ev.TaskStatus)
+	}
+	if ev.ItemIndex != nil {
+		index := int32(*ev.ItemIndex)
+		resp.ItemIndex = &index
+	}
+	if ev.Join != nil {
+		resp.Join = convertJoinToProto(*ev.Join)
+	}
+	if ev.Iteration != nil {
+		iteration := int32(*ev.Iteration)
+		resp.Iteration = &iteration
+	}
+	return resp, nil
+}
+
+func convertWorkflowStatusToProto(s domain.WorklowStatus) pb.WorkflowStatus {
+	switch s {
+	case domain.WorkflowStatusIDLE:
+		return pb.WorkflowStatus_WORKFLOW_STATUS_IDLE
+	case domain.WorkflowStatusRunning:
+		return pb.WorkflowStatus_WORKFLOW_STATUS_RUNNING
+	case domain.WorkflowStatusCompleted:
+		return pb.WorkflowStatus_WORKFLOW_STATUS_COMPLETED
+	case domain.WorkflowStatusFailed:
+		return pb.WorkflowStatus_WORKFLOW_STATUS_FAILED
+	case domain.WorkflowStatusCancelled:
+		return pb.WorkflowStatus_WORKFLOW_STATUS_CANCELLED
+	case domain.WorkflowStatusCompletedWithErrors:
+		return pb.WorkflowStatus_WORKFLOW_STATUS_COMPLETED_WITH_ERRORS
+	default:
+		return pb.WorkflowStatus_WORKFLOW_STATUS_UNSPECIFIED
+	}
+}
+
+// outputToString converts a task output into the string sent on the stream,
+// structured outputs (e.g. HTTP responses) are encoded as JSON
+func outputToString(output interface{}) (string, error) {
+	switch o := output.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return o, nil
+	default:
+		b, err := json.Marshal(o)
+		if err != nil {
+			return "", fmt.Errorf("failed to encode task output of type %T: %w", output, err)
+		}
+		return string(b), nil
+	}
+}
+
+func ExecutionToProto(e *domain.Execution) (*pb.ExecutionResponse, error) {
+	inputs, err := structpb.NewStruct(e.Inputs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode inputs of execution %s: %w", e.ID, err)
+	}
+	tasks, err := convertTaskExecutionsToProto(e.Tasks)
+	if err != nil {
+		return nil, err
+	}
+	compensations, err := convertTaskExecutionsToProto(e.Compensations)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.ExecutionResponse{
+		Id:                e.ID,
+		WorkflowId:        e.WorkflowID,
+		Status:            convertWorkflowStatusToProto(e.Status),
+		Inputs:            inputs,
+		Tasks:             tasks,
+		StartedAt:         timestampToProto(e.StartedAt),
+		EndedAt:           timestampToProto(e.EndedAt),
+		Error:             e.Error,
+		TriggeredBy:       e.TriggeredBy,
+		ParentExecutionId: e.ParentExecutionID,
+		ParentTaskId:      e.ParentTaskID,
+		Depth:             int32(e.Depth),
+		Compensations:     compensations,
+	}, nil
+}
+
+func convertTaskExecutionsToProto(tes map[string]*domain.TaskExecution) ([]*pb.TaskExecution, error) {
+	tasks := make([]*pb.TaskExecution, 0, len(tes))
+	for _, t := range tes {
+		output, err := outputToString(t.Output)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, &pb.TaskExecution{
+			TaskId:      t.TaskID,
+			TaskName:    t.TaskName,
+			Status:      convertTaskStatusToProto(t.Status),
+			Attempts:    int32(t.Attempts),
+			Output:      output,
+			Error:       t.Error,
+			StartedAt:   timestampToProto(t.StartedAt),
+			EndedAt:     timestampToProto(t.EndedAt),
+			WakeAt:      timestampToProto(t.WakeAt),
+			Compensates: t.Compensates,
+		})
+	}
+	// tasks are kept in a map, order them by start time for a readable timeline
+	sort.SliceStable(tasks, func(i, j int) bool {
+		return tasks[i].GetStartedAt().AsTime().Before(tasks[j].GetStartedAt().AsTime())
+	})
+	return tasks, nil
+}
+
+func convertWorkflowStatusFromProto(s pb.WorkflowStatus) domain.WorklowStatus {
+	switch s {
+	case pb.WorkflowStatus_WORKFLOW_STATUS_IDLE:
+		return domain.WorkflowStatusIDLE
+	case pb.WorkflowStatus_WORKFLOW_STATUS_RUNNING:
+		return domain.WorkflowStatusRunning
+	case pb.WorkflowStatus_WORKFLOW_STATUS_COMPLETED:
+		return domain.WorkflowStatusCompleted
+	case pb.WorkflowStatus_WORKFLOW_STATUS_FAILED:
+		return domain.WorkflowStatusFailed
+	case pb.WorkflowStatus_WORKFLOW_STATUS_CANCELLED:
+		return domain.WorkflowStatusCancelled
+	case pb.WorkflowStatus_WORKFLOW_STATUS_COMPLETED_WITH_ERRORS:
+		return domain.WorkflowStatusCompletedWithErrors
+	default:
+		return ""
+	}
+}
+
+// timestampToProto leaves zero times unset
+func timestampToProto(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
+
+// timestampFromProto returns the zero time for unset timestamps
+func timestampFromProto(ts *timestamppb.Timestamp) time.Time {
+	if ts == nil {
+		return time.Time{}
+	}
+	return ts.AsTime()
+}
+
+func ScheduleFromProto(in *pb.CreateScheduleRequest) (*domain.Schedule, error) {
+	return domain.NewSchedule(
+		in.GetWorkflowId(),
+		in.GetCron(),
+		in.GetTimeZone(),
+		in.GetInputs().AsMap(),
+		convertMissedFirePolicyFromProto(in.GetMissedFirePolicy()),
+	)
+}
+
+func ScheduleToProto(s *domain.Schedule) (*pb.ScheduleResponse, error) {
+	inputs, err := structpb.NewStruct(s.Inputs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode inputs of schedule %s: %w", s.ID, err)
+	}
+	out := &pb.ScheduleResponse{
+		Id:               s.ID,
+		WorkflowId:       s.WorkflowID,
+		Cron:             s.Cron,
+		TimeZone:         s.TimeZone,
+		Inputs:           inputs,
+		MissedFirePolicy: convertMissedFirePolicyToProto(s.MissedFirePolicy),
+		Paused:           s.Paused,
+		LastFireAt:       timestampToProto(s.LastFireAt),
+		CreatedAt:        timestampToProto(s.CreatedAt),
+	}
+	if !s.Paused {
+		next, err := s.Next(time.Now())
+		if err != nil {
+			return nil, err
+		}
+		out.NextFireAt = timestampToProto(next)
+	}
+	return out, nil
+}
+
+func convertMissedFirePolicyFromProto(p pb.MissedFirePolicy) domain.MissedFirePolicy {
+	switch p {
+	case pb.MissedFirePolicy_MISSED_FIRE_POLICY_SKIP:
+		return domain.MissedFirePolicySkip
+	case pb.MissedFirePolicy_MISSED_FIRE_POLICY_RUN_ONCE:
+		return domain.MissedFirePolicyRunOnce
+	case pb.MissedFirePolicy_MISSED_FIRE_POLICY_CATCH_UP:
+		return domain.MissedFirePolicyCatchUp
+	default:
+		return domain.MissedFirePolicyUnspecified
+	}
+}
+
+func convertMissedFirePolicyToProto(p domain.MissedFirePolicy) pb.MissedFirePolicy {
+	switch p {
+	case domain.MissedFirePolicySkip:
+		return pb.MissedFirePolicy_MISSED_FIRE_POLICY_SKIP
+	case domain.MissedFirePolicyRunOnce:
+		return pb.MissedFirePolicy_MISSED_FIRE_POLICY_RUN_ONCE
+	case domain.MissedFirePolicyCatchUp:
+		return pb.MissedFirePolicy_MISSED_FIRE_POLICY_CATCH_UP
+	default:
+		return pb.MissedFirePolicy_MISSED_FIRE_POLICY_UNSPECIFIED
+	}
+}
+
+func WebhookToProto(w *domain.Webhook) *pb.WebhookResponse {
+	return &pb.WebhookResponse{
+		Id:         w.ID,
+		WorkflowId: w.WorkflowID,
+		Path:       w.Path(),
+		Token:      w.Token,
+		Mode:       convertWebhookModeToProto(w.Mode),
+		Signed:     w.Secret != "",
+		CreatedAt:  timestampToProto(w.CreatedAt),
+	}
+}
+
+func convertWebhookModeFromProto(m pb.WebhookMode) domain.WebhookMode {
+	switch m {
+	case pb.WebhookMode_WEBHOOK_MODE_ASYNC:
+		return domain.WebhookModeAsync
+	case pb.WebhookMode_WEBHOOK_MODE_SYNC:
+		return domain.WebhookModeSync
+	default:
+		return domain.WebhookModeUnspecified
+	}
+}
+
+func convertWebhookModeToProto(m domain.WebhookMode) pb.WebhookMode {
+	switch m {
+	case domain.WebhookModeAsync:
+		return pb.WebhookMode_WEBHOOK_MODE_ASYNC
+	case domain.WebhookModeSync:
+		return pb.WebhookMode_WEBHOOK_MODE_SYNC
+	default:
+		return pb.WebhookMode_WEBHOOK_MODE_UNSPECIFIED
+	}
+}
+
+func TriggerToProto(t *domain.CompletionTrigger) *pb.TriggerResponse {
+	on := make([]pb.WorkflowStatus, len(t.On))
+	for i, s := range t.On {
+		on[i] = convertWorkflowStatusToProto(s)
+	}
+	return &pb.TriggerResponse{
+		Id:               t.ID,
+		WorkflowId:       t.WorkflowID,
+		TargetWorkflowId: t.TargetWorkflowID,
+		On:               on,
+		Inputs:           t.Inputs,
+		CreatedAt:        timestampToProto(t.CreatedAt),
+	}
+}
+
+func FileWatchToProto(fw *domain.FileWatch) *pb.FileWatchResponse {
+	return &pb.FileWatchResponse{
+		Id:         fw.ID,
+		WorkflowId: fw.WorkflowID,
+		Dir:        fw.Dir,
+		Pattern:    fw.Pattern,
+		Debounce:   durationpb.New(fw.Debounce),
+		ArchiveDir: fw.ArchiveDir,
+		CreatedAt:  timestampToProto(fw.CreatedAt),
+	}
+}
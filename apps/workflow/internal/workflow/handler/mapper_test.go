@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"testing"
+
+	pb "github.com/luis12loureiro/neurun/apps/workflow/gen"
+	"google.golang.org/protobuf/proto"
+)
+
+func transformRequest(name string, next ...*pb.CreateTaskRequest) *pb.CreateTaskRequest {
+	return &pb.CreateTaskRequest{
+		Name: name,
+		Type: pb.TaskType_TASK_TYPE_TRANSFORM,
+		Payload: &pb.CreateTaskRequest_TransformPayload{
+			TransformPayload: &pb.TransformPayload{Query: "."},
+		},
+		Next: next,
+	}
+}
+
+func refRequest(name string) *pb.CreateTaskRequest {
+	return &pb.CreateTaskRequest{Ref: proto.String(name)}
+}
+
+func TestWorkflowFromProtoSharesReferencedTasks(t *testing.T) {
+	join := transformRequest("join")
+	// the join is referenced before it is defined
+	a := transformRequest("a", refRequest("join"))
+	b := transformRequest("b", join)
+
+	w, err := WorkflowFromProto("fan-in", "", nil, []*pb.CreateTaskRequest{a, b})
+	if err != nil {
+		t.Fatalf("WorkflowFromProto: %v", err)
+	}
+	if w.Tasks[0].Next[0] != w.Tasks[1].Next[0] {
+		t.Fatalf("a and b lead to different join tasks")
+	}
+
+	out := WorkflowToProto(w).GetTasks()
+	first, second := out[0].GetNext()[0], out[1].GetNext()[0]
+	if first.Ref != nil || first.GetPayload() == nil {
+		t.Errorf("first occurrence of the join should be defined in full, got %v", first)
+	}
+	if second.GetRef() != first.GetId() {
+		t.Errorf("second occurrence of the join should reference %s, got %v", first.GetId(), second)
+	}
+}
+
+func TestWorkflowFromProtoRejectsBadRefs(t *testing.T) {
+	tests := []struct {
+		name  string
+		tasks []*pb.CreateTaskRequest
+	}{
+		{"unknown", []*pb.CreateTaskRequest{transformRequest("a", refRequest("missing"))}},
+		{"ambiguous", []*pb.CreateTaskRequest{
+			transformRequest("a", refRequest("dup")),
+			transformRequest("b", transformRequest("dup")),
+			transformRequest("c", transformRequest("dup")),
+		}},
+		{"cycle", []*pb.CreateTaskRequest{transformRequest("a", transformRequest("b", refRequest("a")))}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := WorkflowFromProto("refs", "", nil, tt.tasks); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
+
+func TestTaskOnFailureRoundTrip(t *testing.T) {
+	task := transformRequest("task", transformRequest("next"))
+	task.FailurePolicy = pb.TaskFailurePolicy_TASK_FAILURE_POLICY_CONTINUE
+	task.OnFailure = transformRequest("handler")
+
+	got, err := TaskFromProto(task)
+	if err != nil {
+		t.Fatalf("TaskFromProto: %v", err)
+	}
+	if got.OnFailure == nil || got.OnFailure.Name != "handler" || len(got.Next) != 1 {
+		t.Fatalf("got on failure %v and next %v, want handler and next", got.OnFailure, got.Next)
+	}
+
+	out := TaskToProto(got)
+	if out.GetFailurePolicy() != task.FailurePolicy {
+		t.Errorf("got failure policy %s, want %s", out.GetFailurePolicy(), task.FailurePolicy)
+	}
+	if out.GetOnFailure().GetName() != "handler" {
+		t.Errorf("got on failure %v, want handler", out.GetOnFailure())
+	}
+}
+
+func TestTaskCompensationRoundTrip(t *testing.T) {
+	task := transformRequest("task", transformRequest("next"))
+	task.Compensation = transformRequest("undo")
+
+	got, err := TaskFromProto(task)
+	if err != nil {
+		t.Fatalf("TaskFromProto: %v", err)
+	}
+	if got.Compensation == nil || got.Compensation.Name != "undo" || len(got.Next) != 1 {
+		t.Fatalf("got compensation %v and next %v, want undo and next", got.Compensation, got.Next)
+	}
+
+	if out := TaskToProto(got); out.GetCompensation().GetName() != "undo" {
+		t.Errorf("got compensation %v, want undo", out.GetCompensation())
+	}
+}
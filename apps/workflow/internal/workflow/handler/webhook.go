@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow"
+	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/domain"
+)
+
+type webhookHandler struct {
+	s workflow.Service
+}
+
+// NewWebhookHandler serves the webhooks of workflows at POST /hooks/{workflowId}/{token}
+func NewWebhookHandler(s workflow.Service) http.Handler {
+	h := &webhookHandler{s: s}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /hooks/{workflowId}/{token}", h.trigger)
+	return mux
+}
+
+// webhookResponse is the JSON answer to a webhook call
+type webhookResponse struct {
+	ExecutionID string                 `json:"executionId,omitempty"`
+	Status      string                 `json:"status,omitempty"`
+	Outputs     map[string]interface{} `json:"outputs,omitempty"` // by task name, sync webhooks only
+	Error       string                 `json:"error,omitempty"`
+}
+
+func (h *webhookHandler) trigger(w http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, req.Body, domain.WebhookMaxBodySize))
+	if err != nil {
+		writeWebhookResponse(w, http.StatusRequestEntityTooLarge, &webhookResponse{Error: "request body too large"})
+		return
+	}
+	headers := make(map[string]string, len(req.Header))
+	for name := range req.Header {
+		headers[strings.ToLower(name)] = req.Header.Get(name)
+	}
+	query := make(map[string]string)
+	for name, values := range req.URL.Query() {
+		query[name] = values[0]
+	}
+
+	e, err := h.s.TriggerWebhook(req.Context(), &domain.WebhookCall{
+		WorkflowID: req.PathValue("workflowId"),
+		Token:      req.PathValue("token"),
+		Signature:  req.Header.Get(domain.WebhookSignatureHeader),
+		Body:       body,
+		Headers:    headers,
+		Query:      query,
+	})
+	switch {
+	case errors.Is(err, domain.ErrWebhookNotFound):
+		writeWebhookResponse(w, http.StatusNotFound, &webhookResponse{Error: err.Error()})
+		return
+	case errors.Is(err, domain.ErrWebhookSignature):
+		writeWebhookResponse(w, http.StatusUnauthorized, &webhookResponse{Error: err.Error()})
+		return
+	case errors.Is(err, domain.ErrWebhookBadRequest):
+		writeWebhookResponse(w, http.StatusBadRequest, &webhookResponse{Error: err.Error()})
+		return
+	case err != nil:
+		log.Printf("failed to trigger webhook of workflow %s: %v", req.PathValue("workflowId"), err)
+		writeWebhookResponse(w, http.StatusInternalServerError, &webhookResponse{Error: "failed to start workflow"})
+		return
+	}
+
+	resp := &webhookResponse{
+		ExecutionID: e.ID,
+		Status:      string(e.Status),
+		Error:       e.Error,
+	}
+	// async webhooks answer as soon as the run is created
+	if e.EndedAt.IsZero() {
+		writeWebhookResponse(w, http.StatusAccepted, resp)
+		return
+	}
+	resp.Outputs = make(map[string]interface{})
+	for _, t := range e.Tasks {
+		if t.Status == domain.TaskStatusCompleted {
+			resp.Outputs[t.TaskName] = t.Output
+		}
+	}
+	writeWebhookResponse(w, http.StatusOK, resp)
+}
+
+func writeWebhookResponse(w http.ResponseWriter, status int, resp *webhookResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("failed to write webhook response: %v", err)
+	}
+}
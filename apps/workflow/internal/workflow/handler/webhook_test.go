@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow"
+	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/domain"
+)
+
+// webhookService answers webhook calls with a fixed result
+type webhookService struct {
+	workflow.Service
+	call *domain.WebhookCall
+	e    *domain.Execution
+	err  error
+}
+
+func (s *webhookService) TriggerWebhook(_ context.Context, call *domain.WebhookCall) (*domain.Execution, error) {
+	s.call = call
+	return s.e, s.err
+}
+
+func postWebhook(t *testing.T, s workflow.Service, body string, headers map[string]string) (int, webhookResponse) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/hooks/w1/tok?ref=main", strings.NewReader(body))
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	NewWebhookHandler(s).ServeHTTP(rec, req)
+	var resp webhookResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	return rec.Code, resp
+}
+
+func TestWebhookHandlerPassesTheCall(t *testing.T) {
+	s := &webhookService{e: &domain.Execution{ID: "e1", Status: domain.WorkflowStatusRunning}}
+	code, resp := postWebhook(t, s, `{"n":1}`, map[string]string{
+		domain.WebhookSignatureHeader: "sha256=00",
+		"X-Request-Id":                "r1",
+	})
+	// async runs are accepted before they finish
+	if code != http.StatusAccepted || resp.ExecutionID != "e1" || resp.Outputs != nil {
+		t.Errorf("got %d %+v, want 202 with the execution id", code, resp)
+	}
+	c := s.call
+	if c.WorkflowID != "w1" || c.Token != "tok" || c.Signature != "sha256=00" || string(c.Body) != `{"n":1}` ||
+		c.Headers["x-request-id"] != "r1" || c.Query["ref"] != "main" {
+		t.Errorf("got call %+v", c)
+	}
+}
+
+func TestWebhookHandlerReturnsSyncOutputs(t *testing.T) {
+	s := &webhookService{e: &domain.Execution{
+		ID:     "e1",
+		Status: domain.WorkflowStatusCompleted,
+		Tasks: map[string]*domain.TaskExecution{
+			"t1": {TaskName: "a", Status: domain.TaskStatusCompleted, Output: "out"},
+			"t2": {TaskName: "b", Status: domain.TaskStatusSkipped},
+		},
+		EndedAt: time.Now(),
+	}}
+	code, resp := postWebhook(t, s, "", nil)
+	if code != http.StatusOK || resp.Status != string(domain.WorkflowStatusCompleted) || len(resp.Outputs) != 1 || resp.Outputs["a"] != "out" {
+		t.Errorf("got %d %+v, want 200 with the output of a", code, resp)
+	}
+}
+
+func TestWebhookHandlerStatusCodes(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{domain.ErrWebhookNotFound, http.StatusNotFound},
+		{domain.ErrWebhookSignature, http.StatusUnauthorized},
+		{domain.ErrWebhookBadRequest, http.StatusBadRequest},
+		{context.Canceled, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		if code, _ := postWebhook(t, &webhookService{err: tt.err}, "", nil); code != tt.want {
+			t.Errorf("%v: got status %d, want %d", tt.err, code, tt.want)
+		}
+	}
+	body := strings.Repeat("x", domain.WebhookMaxBodySize+1)
+	if code, _ := postWebhook(t, &webhookService{}, body, nil); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("got status %d for a large body, want %d", code, http.StatusRequestEntityTooLarge)
+	}
+}
@@ -0,0 +1,158 @@
+package workflow
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/domain"
+)
+
+// HTTPMaxResponseBodySize caps how much of a response body is read into the task output
+const HTTPMaxResponseBodySize = 10 << 20 // 10 MiB
+
+type HTTPTaskExecutor interface {
+	Execute(ctx context.Context, p *domain.HTTPPayload) (*domain.HTTPResponse, error)
+}
+
+type httpTaskExecutor struct {
+	// one transport per TLS mode so connections are pooled across tasks
+	transport         *http.Transport
+	insecureTransport *http.Transport
+}
+
+func NewHTTPTaskExecutor() HTTPTaskExecutor {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	insecureTransport := http.DefaultTransport.(*http.Transport).Clone()
+	insecureTransport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	return &httpTaskExecutor{
+		transport:         transport,
+		insecureTransport: insecureTransport,
+	}
+}
+
+func (he *httpTaskExecutor) Execute(ctx context.Context, p *domain.HTTPPayload) (*domain.HTTPResponse, error) {
+	// a zero timeout means the request is only bound by the workflow context
+	if p.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.Timeout)
+		defer cancel()
+	}
+
+	req, err := he.buildRequest(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := he.client(p).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("HTTP request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// one byte past the limit tells a body at the limit from a larger one
+	body, err := io.ReadAll(io.LimitReader(resp.Body, HTTPMaxResponseBodySize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	if len(body) > HTTPMaxResponseBodySize {
+		return nil, fmt.Errorf("response body is larger than %d bytes", HTTPMaxResponseBodySize)
+	}
+
+	headers := make(map[string]string, len(resp.Header))
+	for k, v := range resp.Header {
+		headers[k] = strings.Join(v, ", ")
+	}
+	out := &domain.HTTPResponse{
+		StatusCode: resp.StatusCode,
+		Headers:    headers,
+		Body:       decodeResponseBody(resp.Header.Get("Content-Type"), body),
+	}
+
+	if !expectedStatus(p.ExpectedStatusCode, resp.StatusCode) {
+		if p.ExpectedStatusCode == 0 {
+			return out, fmt.Errorf("unexpected HTTP status code: got %d, expected 2xx", resp.StatusCode)
+		}
+		return out, fmt.Errorf("unexpected HTTP status code: got %d, expected %d", resp.StatusCode, p.ExpectedStatusCode)
+	}
+	return out, nil
+}
+
+// expectedStatus reports whether a response status is the expected one,
+// any 2xx status is when no status is expected
+func expectedStatus(expected int32, status int) bool {
+	if expected == 0 {
+		return status >= 200 && status < 300
+	}
+	return int32(status) == expected
+}
+
+func (he *httpTaskExecutor) buildRequest(ctx context.Context, p *domain.HTTPPayload) (*http.Request, error) {
+	u, err := url.Parse(p.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL: %w", err)
+	}
+	q := u.Query()
+	for k, v := range p.QueryParams {
+		q.Set(k, v)
+	}
+	if a, ok := p.Auth.(*domain.HTTPApiKeyAuth); ok && a.Location == domain.HTTPApiKeyLocationQuery {
+		q.Set(a.Key, a.Value)
+	}
+	u.RawQuery = q.Encode()
+
+	var body io.Reader
+	if len(p.Body) > 0 {
+		body = bytes.NewReader(p.Body)
+	}
+	req, err := http.NewRequestWithContext(ctx, p.Method, u.String(), body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	for k, v := range p.Headers {
+		req.Header.Set(k, v)
+	}
+
+	switch a := p.Auth.(type) {
+	case *domain.HTTPBasicAuth:
+		req.SetBasicAuth(a.Username, a.Password)
+	case *domain.HTTPBearerAuth:
+		req.Header.Set("Authorization", "Bearer "+a.Token)
+	case *domain.HTTPApiKeyAuth:
+		if a.Location == domain.HTTPApiKeyLocationHeader {
+			req.Header.Set(a.Key, a.Value)
+		}
+	}
+	return req, nil
+}
+
+func (he *httpTaskExecutor) client(p *domain.HTTPPayload) *http.Client {
+	c := &http.Client{Transport: he.transport}
+	if !p.VerifySSL {
+		c.Transport = he.insecureTransport
+	}
+	if !p.FollowRedirects {
+		c.CheckRedirect = func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	}
+	return c
+}
+
+// decodeResponseBody returns JSON bodies as decoded values so downstream
+// consumers can navigate them, and everything else as plain text
+func decodeResponseBody(contentType string, body []byte) interface{} {
+	if strings.Contains(strings.ToLower(contentType), "json") {
+		var v interface{}
+		if err := json.Unmarshal(body, &v); err == nil {
+			return v
+		}
+	}
+	return string(body)
+}
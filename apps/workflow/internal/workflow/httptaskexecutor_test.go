@@ -0,0 +1,153 @@
+package workflow
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/domain"
+)
+
+func newHTTPPayload(t *testing.T, url string, auth domain.HTTPAuthType, followRedirects, verifySSL bool, expectedStatusCode int32) *domain.HTTPPayload {
+	t.Helper()
+	p, err := domain.NewHTTPPayload(url, "GET", nil, nil, nil, 0, auth, followRedirects, verifySSL, expectedStatusCode)
+	if err != nil {
+		t.Fatalf("failed to create HTTP payload: %v", err)
+	}
+	return p
+}
+
+func TestHTTPTaskExecutorAuth(t *testing.T) {
+	tests := []struct {
+		name string
+		auth domain.HTTPAuthType
+		ok   func(r *http.Request) bool
+	}{
+		{"basic", &domain.HTTPBasicAuth{Username: "user", Password: "secret"}, func(r *http.Request) bool {
+			u, p, ok := r.BasicAuth()
+			return ok && u == "user" && p == "secret"
+		}},
+		{"bearer", &domain.HTTPBearerAuth{Token: "token"}, func(r *http.Request) bool {
+			return r.Header.Get("Authorization") == "Bearer token"
+		}},
+		{"api key header", &domain.HTTPApiKeyAuth{Key: "X-Api-Key", Value: "key", Location: domain.HTTPApiKeyLocationHeader}, func(r *http.Request) bool {
+			return r.Header.Get("X-Api-Key") == "key"
+		}},
+		{"api key query", &domain.HTTPApiKeyAuth{Key: "api_key", Value: "key", Location: domain.HTTPApiKeyLocationQuery}, func(r *http.Request) bool {
+			return r.URL.Query().Get("api_key") == "key"
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if !tt.ok(r) {
+					w.WriteHeader(http.StatusUnauthorized)
+				}
+			}))
+			defer srv.Close()
+
+			out, err := NewHTTPTaskExecutor().Execute(context.Background(), newHTTPPayload(t, srv.URL, tt.auth, false, false, 200))
+			if err != nil {
+				t.Fatalf("execute: %v", err)
+			}
+			if out.StatusCode != http.StatusOK {
+				t.Errorf("got status %d, want %d", out.StatusCode, http.StatusOK)
+			}
+		})
+	}
+}
+
+func TestHTTPTaskExecutorRedirects(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/new", http.StatusFound)
+		}
+	}))
+	defer srv.Close()
+
+	out, err := NewHTTPTaskExecutor().Execute(context.Background(), newHTTPPayload(t, srv.URL+"/old", nil, true, false, 200))
+	if err != nil || out.StatusCode != http.StatusOK {
+		t.Errorf("following redirects: got %v, %v, want status %d", out, err, http.StatusOK)
+	}
+	out, err = NewHTTPTaskExecutor().Execute(context.Background(), newHTTPPayload(t, srv.URL+"/old", nil, false, false, 302))
+	if err != nil || out.StatusCode != http.StatusFound {
+		t.Errorf("not following redirects: got %v, %v, want status %d", out, err, http.StatusFound)
+	}
+}
+
+func TestHTTPTaskExecutorVerifySSL(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer srv.Close()
+
+	// the certificate of the test server is self-signed
+	if _, err := NewHTTPTaskExecutor().Execute(context.Background(), newHTTPPayload(t, srv.URL, nil, false, true, 200)); err == nil {
+		t.Errorf("expected the certificate to be rejected")
+	}
+	if _, err := NewHTTPTaskExecutor().Execute(context.Background(), newHTTPPayload(t, srv.URL, nil, false, false, 200)); err != nil {
+		t.Errorf("expected the certificate to be accepted without verification: %v", err)
+	}
+}
+
+func TestHTTPTaskExecutorExpectedStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		expected int32
+		ok       bool
+	}{
+		{"expected", http.StatusCreated, 201, true},
+		{"unexpected", http.StatusOK, 201, false},
+		{"any 2xx", http.StatusAccepted, 0, true},
+		{"not 2xx", http.StatusNotFound, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+
+			out, err := NewHTTPTaskExecutor().Execute(context.Background(), newHTTPPayload(t, srv.URL, nil, false, false, tt.expected))
+			if (err == nil) != tt.ok {
+				t.Errorf("got error %v, want ok %v", err, tt.ok)
+			}
+			// the response is the output even when the status is unexpected
+			if out == nil || out.StatusCode != tt.status {
+				t.Errorf("got output %v, want status %d", out, tt.status)
+			}
+		})
+	}
+}
+
+func TestHTTPTaskExecutorBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/json":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"id": 1}`))
+		case "/text":
+			w.Write([]byte("hello"))
+		case "/large":
+			w.Write([]byte(strings.Repeat("a", HTTPMaxResponseBodySize+1)))
+		}
+	}))
+	defer srv.Close()
+
+	he := NewHTTPTaskExecutor()
+	out, err := he.Execute(context.Background(), newHTTPPayload(t, srv.URL+"/json", nil, false, false, 200))
+	if err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if body, ok := out.Body.(map[string]interface{}); !ok || body["id"] != float64(1) {
+		t.Errorf("got JSON body %#v, want the decoded object", out.Body)
+	}
+	out, err = he.Execute(context.Background(), newHTTPPayload(t, srv.URL+"/text", nil, false, false, 200))
+	if err != nil || out.Body != "hello" {
+		t.Errorf("got text body %#v, %v, want %q", out, err, "hello")
+	}
+	if _, err := he.Execute(context.Background(), newHTTPPayload(t, srv.URL+"/large", nil, false, false, 200)); err == nil {
+		t.Errorf("expected a body over the limit to fail the task")
+	}
+}
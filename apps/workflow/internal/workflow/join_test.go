@@ -0,0 +1,82 @@
+package workflow
+
+import (
+	"context"
+	"testing"
+
+	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/domain"
+)
+
+// newJoinTask logs message once its predecessors meet the join
+func newJoinTask(t *testing.T, mode domain.JoinMode, quorum int, cancelRemaining bool) *domain.Task {
+	t.Helper()
+	join, err := domain.NewJoin(mode, quorum, cancelRemaining)
+	if err != nil {
+		t.Fatalf("failed to create join: %v", err)
+	}
+	task, err := domain.NewTask("join", domain.TaskTypeLog, 0, 0, "", join, "", &domain.LogPayload{Message: "join"}, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+	return task
+}
+
+func TestJoinModes(t *testing.T) {
+	tests := []struct {
+		name   string
+		mode   domain.JoinMode
+		quorum int
+		want   domain.TaskStatus
+		// whether the join waits for the slow predecessor before it runs
+		waits bool
+	}{
+		{"all", domain.JoinAll, 0, domain.TaskStatusCompleted, true},
+		{"any", domain.JoinAny, 0, domain.TaskStatusCompleted, false},
+		{"quorum reached", domain.JoinQuorum, 2, domain.TaskStatusCompleted, true},
+		// the skipped predecessor never counts towards the quorum
+		{"quorum missed", domain.JoinQuorum, 3, domain.TaskStatusSkipped, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			join := newJoinTask(t, tt.mode, tt.quorum, false)
+			fast := newLogTask(t, "1", 0, 0, join)
+			slow := newLogTask(t, "10", 0, 0, join)
+			skipped := newConditionTask(t, "skipped", "false", join)
+
+			e, _, err := newTestExecutor(&itemTaskExecutor{}).run(context.Background(), newTestWorkflow(t, fast, slow, skipped), nil)
+			if err != nil {
+				t.Fatalf("execute: %v", err)
+			}
+			assertTaskStatus(t, e, slow, domain.TaskStatusCompleted)
+			assertTaskStatus(t, e, skipped, domain.TaskStatusSkipped)
+			assertTaskStatus(t, e, join, tt.want)
+			if tt.want != domain.TaskStatusCompleted {
+				return
+			}
+			if waited := !e.Tasks[join.ID].StartedAt.Before(e.Tasks[slow.ID].EndedAt); waited != tt.waits {
+				t.Errorf("join waited for the slow predecessor: %v, want %v", waited, tt.waits)
+			}
+		})
+	}
+}
+
+func TestJoinCancelRemainingKeepsSharedPredecessors(t *testing.T) {
+	join := newJoinTask(t, domain.JoinAny, 0, true)
+	other := newLogTask(t, "other", 0, 0)
+	fast := newLogTask(t, "1", 0, 0, join)
+	// shared also leads to another task, which still waits for it
+	shared := newLogTask(t, "10", 0, 0, join, other)
+	only := newLogTask(t, "20", 0, 0, join)
+
+	e, _, err := newTestExecutor(&itemTaskExecutor{}).run(context.Background(), newTestWorkflow(t, fast, shared, only), nil)
+	if err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if e.Status != domain.WorkflowStatusCompleted {
+		t.Errorf("got status %s, want %s", e.Status, domain.WorkflowStatusCompleted)
+	}
+	assertTaskStatus(t, e, join, domain.TaskStatusCompleted)
+	assertTaskStatus(t, e, shared, domain.TaskStatusCompleted)
+	assertTaskStatus(t, e, other, domain.TaskStatusCompleted)
+	assertTaskStatus(t, e, only, domain.TaskStatusCancelled)
+}
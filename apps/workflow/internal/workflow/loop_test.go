@@ -0,0 +1,78 @@
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/domain"
+)
+
+// newLoopTask loops over a log task printing message
+func newLoopTask(t *testing.T, message, while string, maxIterations int, interval, deadline time.Duration) *domain.Task {
+	t.Helper()
+	body, err := domain.NewTask("body", domain.TaskTypeLog, 0, 0, "", domain.Join{}, "", &domain.LogPayload{Message: message}, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create loop task: %v", err)
+	}
+	p, err := domain.NewLoopPayload(body, while, maxIterations, interval, deadline)
+	if err != nil {
+		t.Fatalf("failed to create loop payload: %v", err)
+	}
+	task, err := domain.NewTask("loop", domain.TaskTypeLoop, 0, 0, "", domain.Join{}, "", p, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+	return task
+}
+
+func TestLoopRunsWhileConditionHolds(t *testing.T) {
+	// the condition sees the output of the iteration that just ran
+	loop := newLoopTask(t, "{{ iteration }}", `output != "3"`, 0, 0, 0)
+	e, events, err := newTestExecutor(&flakyTaskExecutor{}).run(context.Background(), newTestWorkflow(t, loop), nil)
+	if err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	out, ok := e.Tasks[loop.ID].Output.(*domain.LoopResult)
+	if !ok || out.Iterations != 3 || out.Output != "3" {
+		t.Fatalf("got output %#v, want 3 iterations ending with 3", e.Tasks[loop.ID].Output)
+	}
+	var iterations []int
+	for _, ev := range events {
+		if ev.Iteration != nil && ev.TaskStatus == domain.TaskStatusCompleted {
+			iterations = append(iterations, *ev.Iteration)
+		}
+	}
+	if got := fmt.Sprint(iterations); got != "[1 2 3]" {
+		t.Errorf("got iteration events %s, want [1 2 3]", got)
+	}
+}
+
+func TestLoopFailures(t *testing.T) {
+	tests := []struct {
+		name     string
+		loop     *domain.Task
+		want     string
+		maxTaken time.Duration
+	}{
+		{"iteration fails", newLoopTask(t, "fail {{ iteration }}", "true", 0, 0, 0), "iteration 1: fail 1", time.Second},
+		{"max iterations", newLoopTask(t, "x", "iteration < 10", 2, 0, 0), "still held after 2 iterations", time.Second},
+		// the deadline interrupts the wait between iterations
+		{"deadline", newLoopTask(t, "x", "true", 0, 50*time.Millisecond, 120*time.Millisecond), "loop deadline of 120ms passed", 2 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			e, _, err := newTestExecutor(&itemTaskExecutor{}).run(context.Background(), newTestWorkflow(t, tt.loop), nil)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("got error %v, want %q", err, tt.want)
+			}
+			assertTaskStatus(t, e, tt.loop, domain.TaskStatusFailed)
+			if elapsed := time.Since(start); elapsed > tt.maxTaken {
+				t.Errorf("the loop took %v", elapsed)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/domain"
+)
+
+// itemTaskExecutor outputs the message of log tasks after waiting as many
+// times 20ms as the message says, messages starting with fail fail instead
+type itemTaskExecutor struct {
+	started atomic.Int32
+}
+
+func (ie *itemTaskExecutor) Execute(ctx context.Context, t *domain.Task) (interface{}, error) {
+	ie.started.Add(1)
+	msg := t.Payload.(*domain.LogPayload).Message
+	if strings.HasPrefix(msg, "fail") {
+		return nil, errors.New(msg)
+	}
+	if n, err := strconv.Atoi(msg); err == nil {
+		if err := sleep(ctx, time.Duration(n)*20*time.Millisecond); err != nil {
+			return nil, err
+		}
+	}
+	return msg, nil
+}
+
+// newMapTask maps items over a log task printing each item
+func newMapTask(t *testing.T, name, items string, maxParallelism int, policy domain.MapFailurePolicy, tolerated int) *domain.Task {
+	t.Helper()
+	item, err := domain.NewTask(name+" item", domain.TaskTypeLog, 0, 0, "", domain.Join{}, "", &domain.LogPayload{Message: "{{ item }}"}, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create item task: %v", err)
+	}
+	p, err := domain.NewMapPayload(items, item, maxParallelism, policy, tolerated)
+	if err != nil {
+		t.Fatalf("failed to create map payload: %v", err)
+	}
+	task, err := domain.NewTask(name, domain.TaskTypeMap, 0, 0, "", domain.Join{}, "", p, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create task %s: %v", name, err)
+	}
+	return task
+}
+
+func TestMapKeepsItemOrder(t *testing.T) {
+	m := newMapTask(t, "map", "[3, 1, 2]", 3, "", 0)
+	e, events, err := newTestExecutor(&itemTaskExecutor{}).run(context.Background(), newTestWorkflow(t, m), nil)
+	if err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	// items finish in reverse but their outputs are kept in item order
+	if got := fmt.Sprint(e.Tasks[m.ID].Output); got != "[3 1 2]" {
+		t.Errorf("got output %s, want [3 1 2]", got)
+	}
+	var finished []int
+	for _, ev := range events {
+		if ev.ItemIndex != nil && ev.TaskStatus == domain.TaskStatusCompleted {
+			finished = append(finished, *ev.ItemIndex)
+		}
+	}
+	if got := fmt.Sprint(finished); got != "[1 2 0]" {
+		t.Errorf("got items finishing in order %s, want [1 2 0]", got)
+	}
+}
+
+func TestMapFailurePolicies(t *testing.T) {
+	const items = `["ok", "fail 1", "ok", "fail 3"]`
+	tests := []struct {
+		name      string
+		policy    domain.MapFailurePolicy
+		tolerated int
+		status    domain.TaskStatus
+		output    string
+		started   int32
+	}{
+		// the first failure stops the items that have not started
+		{"fail fast", domain.MapFailFast, 0, domain.TaskStatusFailed, "<nil>", 2},
+		{"continue", domain.MapContinue, 0, domain.TaskStatusCompleted, "[ok <nil> ok <nil>]", 4},
+		{"tolerate enough", domain.MapTolerate, 50, domain.TaskStatusCompleted, "[ok <nil> ok <nil>]", 4},
+		{"tolerate too few", domain.MapTolerate, 25, domain.TaskStatusFailed, "<nil>", 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMapTask(t, "map", items, 1, tt.policy, tt.tolerated)
+			ie := &itemTaskExecutor{}
+			e, _, _ := newTestExecutor(ie).run(context.Background(), newTestWorkflow(t, m), nil)
+			te := e.Tasks[m.ID]
+			if te.Status != tt.status || fmt.Sprint(te.Output) != tt.output {
+				t.Errorf("got %s with output %v, want %s with %s", te.Status, te.Output, tt.status, tt.output)
+			}
+			if got := ie.started.Load(); got != tt.started {
+				t.Errorf("got %d items started, want %d", got, tt.started)
+			}
+			// failures are kept on the map even when tolerated
+			if !strings.Contains(te.Error, "items failed, first item 1: fail 1") {
+				t.Errorf("got error %q, want the first failed item", te.Error)
+			}
+		})
+	}
+}
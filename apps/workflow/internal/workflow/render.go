@@ -0,0 +1,161 @@
+package workflow
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/domain"
+	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/expression"
+)
+
+// renderPayload returns a copy of the payload with every {{ expression }}
+// placeholder resolved against vars, the task definition is left untouched
+func renderPayload(ctx context.Context, p domain.Payload, vars map[string]interface{}) (domain.Payload, error) {
+	r := &renderer{ctx: ctx, vars: vars}
+	switch p := p.(type) {
+	case *domain.LogPayload:
+		out := *p
+		out.Message = r.render(p.Message)
+		return &out, r.err
+	case *domain.HTTPPayload:
+		out := *p
+		out.URL = r.render(p.URL)
+		out.Body = []byte(r.render(string(p.Body)))
+		out.Headers = r.renderMap(p.Headers)
+		out.QueryParams = r.renderMap(p.QueryParams)
+		out.Auth = r.renderHTTPAuth(p.Auth)
+		return &out, r.err
+	case *domain.ShellPayload:
+		out := *p
+		out.Args = r.renderSlice(p.Args)
+		out.WorkingDir = r.render(p.WorkingDir)
+		out.Env = r.renderMap(p.Env)
+		out.Stdin = r.render(p.Stdin)
+		return &out, r.err
+	case *domain.DelayPayload:
+		out := *p
+		out.Until = r.render(p.Until)
+		return &out, r.err
+	case *domain.TransformPayload:
+		// queries are not templates, they read the run data directly
+		input, err := toPlainValue(vars)
+		if err != nil {
+			return nil, fmt.Errorf("failed to prepare transform input: %w", err)
+		}
+		out := *p
+		out.Input = input
+		return &out, nil
+	case *domain.SubworkflowPayload:
+		out := *p
+		out.Values = r.evalMap(p.Inputs)
+		return &out, r.err
+	case *domain.MapPayload:
+		// the task of the map is rendered once per item
+		out := *p
+		out.Values = r.evalList(p.Items)
+		return &out, r.err
+	case *domain.LoopPayload:
+		// the task of the loop is rendered once per iteration
+		return p, nil
+	case *domain.SwitchPayload:
+		// cases are evaluated when the switch runs
+		return p, nil
+	default:
+		return p, nil
+	}
+}
+
+// renderer keeps the first error so payload fields can be rendered in sequence
+type renderer struct {
+	ctx  context.Context
+	vars map[string]interface{}
+	err  error
+}
+
+func (r *renderer) render(s string) string {
+	if r.err != nil || !expression.IsTemplate(s) {
+		return s
+	}
+	out, err := expression.Render(r.ctx, s, r.vars)
+	if err != nil {
+		r.err = fmt.Errorf("failed to render %q: %w", s, err)
+		return s
+	}
+	return out
+}
+
+func (r *renderer) renderMap(m map[string]string) map[string]string {
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		out[k] = r.render(v)
+	}
+	return out
+}
+
+// evalMap evaluates a map of expressions, used where values keep their type
+// instead of being rendered into strings
+func (r *renderer) evalMap(m map[string]string) map[string]interface{} {
+	out := make(map[string]interface{}, len(m))
+	for k, source := range m {
+		if r.err != nil {
+			return out
+		}
+		expr, err := expression.Compile(source)
+		if err != nil {
+			r.err = fmt.Errorf("invalid expression for %s: %w", k, err)
+			return out
+		}
+		if out[k], err = expr.Eval(r.ctx, r.vars); err != nil {
+			r.err = fmt.Errorf("failed to evaluate %s: %w", k, err)
+		}
+	}
+	return out
+}
+
+// evalList evaluates an expression that must produce the items of a map
+func (r *renderer) evalList(source string) []interface{} {
+	if r.err != nil {
+		return nil
+	}
+	expr, err := expression.Compile(source)
+	if err != nil {
+		r.err = fmt.Errorf("invalid items: %w", err)
+		return nil
+	}
+	value, err := expr.Eval(r.ctx, r.vars)
+	if err != nil {
+		r.err = fmt.Errorf("failed to evaluate items: %w", err)
+		return nil
+	}
+	items, ok := value.([]interface{})
+	if !ok {
+		r.err = fmt.Errorf("items must evaluate to a list, got %T", value)
+		return nil
+	}
+	if len(items) > domain.MapMaxItems {
+		r.err = fmt.Errorf("cannot map more than %d items, got %d", domain.MapMaxItems, len(items))
+		return nil
+	}
+	return items
+}
+
+func (r *renderer) renderSlice(s []string) []string {
+	out := make([]string, len(s))
+	for i, v := range s {
+		out[i] = r.render(v)
+	}
+	return out
+}
+
+func (r *renderer) renderHTTPAuth(auth domain.HTTPAuthType) domain.HTTPAuthType {
+	switch a := auth.(type) {
+	case *domain.HTTPBasicAuth:
+		return &domain.HTTPBasicAuth{Username: r.render(a.Username), Password: r.render(a.Password)}
+	case *domain.HTTPBearerAuth:
+		return &domain.HTTPBearerAuth{Token: r.render(a.Token)}
+	case *domain.HTTPApiKeyAuth:
+		return &domain.HTTPApiKeyAuth{Key: a.Key, Value: r.render(a.Value), Location: a.Location}
+	default:
+		return auth
+	}
+}
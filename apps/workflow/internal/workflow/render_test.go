@@ -0,0 +1,82 @@
+package workflow
+
+import (
+	"context"
+	"testing"
+
+	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/domain"
+	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/expression"
+)
+
+func TestRenderHTTPPayload(t *testing.T) {
+	p, err := domain.NewHTTPPayload(
+		"https://api.example.com/users/{{ inputs.id }}", "POST",
+		[]byte(`{"name": {{ upstream.fetch.output.name }}}`),
+		map[string]string{"X-Trace": "{{ inputs.trace }}"},
+		map[string]string{"page": "{{ inputs.id + 1.0 }}"},
+		0, &domain.HTTPBearerAuth{Token: "{{ inputs.token }}"}, false, false, 0,
+	)
+	if err != nil {
+		t.Fatalf("failed to create HTTP payload: %v", err)
+	}
+	vars := map[string]interface{}{
+		expression.VarInputs: map[string]interface{}{"id": 7.0, "trace": "t1", "token": "secret"},
+		expression.VarUpstream: map[string]interface{}{
+			"fetch": map[string]interface{}{"output": map[string]interface{}{"name": "ada"}},
+		},
+	}
+
+	out, err := renderPayload(context.Background(), p, vars)
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	rendered := out.(*domain.HTTPPayload)
+	if rendered.URL != "https://api.example.com/users/7" {
+		t.Errorf("got URL %q", rendered.URL)
+	}
+	if string(rendered.Body) != `{"name": ada}` {
+		t.Errorf("got body %q", rendered.Body)
+	}
+	if rendered.Headers["X-Trace"] != "t1" || rendered.QueryParams["page"] != "8" {
+		t.Errorf("got headers %v and query params %v", rendered.Headers, rendered.QueryParams)
+	}
+	if auth := rendered.Auth.(*domain.HTTPBearerAuth); auth.Token != "secret" {
+		t.Errorf("got token %q", auth.Token)
+	}
+	// the original payload is left untouched
+	if p.Headers["X-Trace"] != "{{ inputs.trace }}" || p.Auth.(*domain.HTTPBearerAuth).Token != "{{ inputs.token }}" {
+		t.Errorf("the payload was rendered in place")
+	}
+}
+
+func TestNewPayloadsRejectInvalidPlaceholders(t *testing.T) {
+	if _, err := domain.NewLogPayload("hello {{ name"); err == nil {
+		t.Errorf("expected an unclosed placeholder to be rejected")
+	}
+	if _, err := domain.NewHTTPPayload("https://example.com", "GET", nil, map[string]string{"A": "{{ 1 + }}"}, nil, 0, nil, false, false, 0); err == nil {
+		t.Errorf("expected an invalid header placeholder to be rejected")
+	}
+}
+
+func TestRenderShellPayload(t *testing.T) {
+	p, err := domain.NewShellPayload("/bin/echo", []string{"{{ inputs.name }}", "-n"}, "/tmp/{{ inputs.name }}",
+		map[string]string{"NAME": "{{ inputs.name }}"}, "{{ inputs.name }}\n", 0, 0, domain.ShellLimits{})
+	if err != nil {
+		t.Fatalf("failed to create shell payload: %v", err)
+	}
+	vars := map[string]interface{}{expression.VarInputs: map[string]interface{}{"name": "a b"}}
+
+	out, err := renderPayload(context.Background(), p, vars)
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	// a rendered value stays a single argument
+	rendered := out.(*domain.ShellPayload)
+	if len(rendered.Args) != 2 || rendered.Args[0] != "a b" || rendered.WorkingDir != "/tmp/a b" ||
+		rendered.Env["NAME"] != "a b" || rendered.Stdin != "a b\n" {
+		t.Errorf("got %+v", rendered)
+	}
+	if p.Args[0] != "{{ inputs.name }}" {
+		t.Errorf("the payload was rendered in place")
+	}
+}
@@ -0,0 +1,239 @@
+package repository
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/domain"
+)
+
+// executionRepositories returns every ExecutionRepository implementation
+func executionRepositories(t *testing.T) map[string]domain.ExecutionRepository {
+	return map[string]domain.ExecutionRepository{
+		"memory": NewMemoryRepository(),
+		"sqlite": newTestSQLiteRepository(t, t.TempDir()),
+	}
+}
+
+// createExecutions stores n executions started a minute apart, the first
+// one being the oldest, alternating between two workflows and statuses
+func createExecutions(t *testing.T, r domain.ExecutionRepository, n int) []*domain.Execution {
+	t.Helper()
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	var executions []*domain.Execution
+	for i := 0; i < n; i++ {
+		e := &domain.Execution{
+			ID:         fmt.Sprintf("e%02d", i),
+			WorkflowID: fmt.Sprintf("w%d", i%2),
+			Status:     domain.WorkflowStatusCompleted,
+			Tasks: map[string]*domain.TaskExecution{
+				"t": {TaskID: "t", TaskName: "task", Status: domain.TaskStatusCompleted, Attempts: 1, Output: "out"},
+			},
+			StartedAt: start.Add(time.Duration(i) * time.Minute),
+		}
+		if i%3 == 0 {
+			e.Status = domain.WorkflowStatusFailed
+		}
+		if err := r.CreateExecution(e); err != nil {
+			t.Fatalf("create execution: %v", err)
+		}
+		executions = append(executions, e)
+	}
+	return executions
+}
+
+func ids(executions []*domain.Execution) string {
+	var out []string
+	for _, e := range executions {
+		out = append(out, e.ID)
+	}
+	return fmt.Sprint(out)
+}
+
+func TestListExecutionsPagination(t *testing.T) {
+	for name, r := range executionRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			createExecutions(t, r, 5)
+
+			// most recent first, the last page has no next token
+			var pages []string
+			token := ""
+			for {
+				page, next, err := r.ListExecutions(domain.ExecutionFilter{PageSize: 2, PageToken: token})
+				if err != nil {
+					t.Fatalf("list: %v", err)
+				}
+				pages = append(pages, ids(page))
+				if next == "" {
+					break
+				}
+				token = next
+			}
+			if got, want := fmt.Sprint(pages), "[[e04 e03] [e02 e01] [e00]]"; got != want {
+				t.Errorf("got pages %s, want %s", got, want)
+			}
+
+			// a full last page does not point to an empty one
+			page, next, err := r.ListExecutions(domain.ExecutionFilter{PageSize: 5})
+			if err != nil || len(page) != 5 || next != "" {
+				t.Errorf("got %d executions and token %q, %v, want 5 and no token", len(page), next, err)
+			}
+			if got := page[0].Tasks["t"]; got == nil || got.Status != domain.TaskStatusCompleted || got.Output != "out" {
+				t.Errorf("got task execution %+v", got)
+			}
+
+			if _, _, err := r.ListExecutions(domain.ExecutionFilter{PageSize: 2, PageToken: "abc"}); err == nil {
+				t.Errorf("expected an invalid page token to be rejected")
+			}
+			page, next, err = r.ListExecutions(domain.ExecutionFilter{PageSize: 2, PageToken: "10"})
+			if err != nil || len(page) != 0 || next != "" {
+				t.Errorf("got %s and token %q, %v past the end, want nothing", ids(page), next, err)
+			}
+		})
+	}
+}
+
+func TestListExecutionsFilters(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		filter domain.ExecutionFilter
+		want   string
+	}{
+		{"workflow", domain.ExecutionFilter{WorkflowID: "w1"}, "[e05 e03 e01]"},
+		{"status", domain.ExecutionFilter{Status: domain.WorkflowStatusFailed}, "[e03 e00]"},
+		{"workflow and status", domain.ExecutionFilter{WorkflowID: "w1", Status: domain.WorkflowStatusFailed}, "[e03]"},
+		// started after is inclusive and started before exclusive
+		{"time range", domain.ExecutionFilter{StartedAfter: start.Add(time.Minute), StartedBefore: start.Add(3 * time.Minute)}, "[e02 e01]"},
+		{"time zones", domain.ExecutionFilter{StartedAfter: start.Add(4 * time.Minute).In(time.FixedZone("X", 3600))}, "[e05 e04]"},
+	}
+	for name, r := range executionRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			createExecutions(t, r, 6)
+			for _, tt := range tests {
+				tt.filter.PageSize = 10
+				page, _, err := r.ListExecutions(tt.filter)
+				if err != nil {
+					t.Fatalf("%s: list: %v", tt.name, err)
+				}
+				if got := ids(page); got != tt.want {
+					t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestListExecutionEvents(t *testing.T) {
+	for name, r := range executionRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			e := createExecutions(t, r, 1)[0]
+			for seq := int64(1); seq <= 3; seq++ {
+				ev := &domain.ExecutionEvent{Seq: seq, ExecutionID: e.ID, WorkflowID: e.WorkflowID, TaskID: "t",
+					TaskStatus: domain.TaskStatusCompleted, Output: map[string]interface{}{"n": 1.0}, Time: e.StartedAt}
+				if err := r.AppendExecutionEvent(ev); err != nil {
+					t.Fatalf("append: %v", err)
+				}
+			}
+
+			events, err := r.ListExecutionEvents(e.ID, 2)
+			if err != nil {
+				t.Fatalf("list: %v", err)
+			}
+			if len(events) != 2 || events[0].Seq != 2 || events[1].Seq != 3 {
+				t.Fatalf("got %d events, want the events from sequence 2", len(events))
+			}
+			ev := events[0]
+			if ev.TaskID != "t" || ev.TaskStatus != domain.TaskStatusCompleted || !ev.Time.Equal(e.StartedAt) ||
+				fmt.Sprint(ev.Output) != "map[n:1]" {
+				t.Errorf("got event %+v", ev)
+			}
+		})
+	}
+}
+
+func TestExecutionTriggerChain(t *testing.T) {
+	for name, r := range executionRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			e := &domain.Execution{ID: "e1", WorkflowID: "c", Status: domain.WorkflowStatusRunning,
+				Tasks: map[string]*domain.TaskExecution{}, StartedAt: time.Now(),
+				TriggeredBy: "e0", TriggerChain: []string{"a", "b"}}
+			if err := r.CreateExecution(e); err != nil {
+				t.Fatalf("create execution: %v", err)
+			}
+			got, err := r.GetExecution(e.ID)
+			if err != nil {
+				t.Fatalf("get execution: %v", err)
+			}
+			if got.TriggeredBy != "e0" || fmt.Sprint(got.TriggerChain) != "[a b]" {
+				t.Errorf("got triggered by %q with chain %v, want e0 with [a b]", got.TriggeredBy, got.TriggerChain)
+			}
+		})
+	}
+}
+
+func TestTaskExecutionWakeAt(t *testing.T) {
+	for name, r := range executionRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			e := createExecutions(t, r, 1)[0]
+			wakeAt := time.Date(2026, 1, 2, 9, 30, 0, 0, time.UTC)
+			te := &domain.TaskExecution{TaskID: "t", TaskName: "task", Status: domain.TaskStatusRunning, Attempts: 1, WakeAt: wakeAt}
+			if err := r.UpdateTaskExecution(e.ID, te); err != nil {
+				t.Fatalf("update task execution: %v", err)
+			}
+			got, err := r.GetExecution(e.ID)
+			if err != nil {
+				t.Fatalf("get execution: %v", err)
+			}
+			if got := got.Tasks["t"]; got.Status != domain.TaskStatusRunning || !got.WakeAt.Equal(wakeAt) {
+				t.Errorf("got task %s waking at %v, want RUNNING waking at %v", got.Status, got.WakeAt, wakeAt)
+			}
+		})
+	}
+}
+
+func TestExecutionParent(t *testing.T) {
+	for name, r := range executionRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			e := &domain.Execution{ID: "c1", WorkflowID: "child", Status: domain.WorkflowStatusRunning,
+				Tasks: map[string]*domain.TaskExecution{}, StartedAt: time.Now(),
+				ParentExecutionID: "p1", ParentTaskID: "sub", Depth: 2}
+			if err := r.CreateExecution(e); err != nil {
+				t.Fatalf("create execution: %v", err)
+			}
+			got, err := r.GetExecution(e.ID)
+			if err != nil {
+				t.Fatalf("get execution: %v", err)
+			}
+			if got.ParentExecutionID != "p1" || got.ParentTaskID != "sub" || got.Depth != 2 {
+				t.Errorf("got parent %q, task %q and depth %d, want p1, sub and 2", got.ParentExecutionID, got.ParentTaskID, got.Depth)
+			}
+		})
+	}
+}
+
+func TestExecutionCompensations(t *testing.T) {
+	for name, r := range executionRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			e := createExecutions(t, r, 1)[0]
+			c := &domain.TaskExecution{TaskID: "undo", TaskName: "undo", Status: domain.TaskStatusCompleted, Attempts: 1,
+				Output: "undone", Compensates: "t"}
+			if err := r.UpdateTaskExecution(e.ID, c); err != nil {
+				t.Fatalf("update task execution: %v", err)
+			}
+			got, err := r.GetExecution(e.ID)
+			if err != nil {
+				t.Fatalf("get execution: %v", err)
+			}
+			// the compensation is kept apart from the task it undoes
+			if got := got.Tasks["t"]; got.Status != domain.TaskStatusCompleted || got.Output != "out" {
+				t.Errorf("got task %s with output %v, want it untouched", got.Status, got.Output)
+			}
+			gc := got.Compensations["t"]
+			if gc == nil || gc.TaskID != "undo" || gc.Status != domain.TaskStatusCompleted || gc.Output != "undone" {
+				t.Errorf("got compensation %+v, want the completed undo task", gc)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/domain"
+)
+
+func TestFileWatches(t *testing.T) {
+	for name, r := range workflowRepositories(t) {
+		fr := r.(domain.FileWatchRepository)
+		t.Run(name, func(t *testing.T) {
+			w := newLogWorkflow(t, "test", "a")
+			if err := r.Create(w); err != nil {
+				t.Fatalf("create: %v", err)
+			}
+			fw, err := domain.NewFileWatch(w.ID, "/data/in", "*.csv", 1500*time.Millisecond, "/data/done")
+			if err != nil {
+				t.Fatalf("new file watch: %v", err)
+			}
+			if err := fr.CreateFileWatch(fw); err != nil {
+				t.Fatalf("create file watch: %v", err)
+			}
+
+			watches, err := fr.ListFileWatches("")
+			if err != nil || len(watches) != 1 {
+				t.Fatalf("got %d file watches, %v, want 1", len(watches), err)
+			}
+			got := watches[0]
+			if got.Dir != fw.Dir || got.Pattern != fw.Pattern || got.Debounce != fw.Debounce || got.ArchiveDir != fw.ArchiveDir {
+				t.Errorf("got file watch %+v, want %+v", got, fw)
+			}
+
+			if err := fr.DeleteFileWatch(fw.ID); err != nil {
+				t.Fatalf("delete file watch: %v", err)
+			}
+			if watches, err := fr.ListFileWatches(w.ID); err != nil || len(watches) != 0 {
+				t.Errorf("got %d file watches after deleting, %v, want none", len(watches), err)
+			}
+		})
+	}
+}
@@ -2,30 +2,132 @@ package repository
 
 import (
 	"fmt"
+	"sort"
+	"strings"
+	"sync"
 
 	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/domain"
 	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/repository/storage"
 )
 
 type MemoryRepo struct {
-	workflows map[string]domain.Workflow
+	mu          sync.RWMutex
+	workflows   map[string]domain.Workflow
+	executions  map[string]*domain.Execution
+	events      map[string][]*domain.ExecutionEvent // by execution id, in sequence order
+	schedules   map[string]*domain.Schedule
+	webhooks    map[string]*domain.Webhook
+	triggers    map[string]*domain.CompletionTrigger
+	fileWatches map[string]*domain.FileWatch
 }
 
-func NewMemoryRepository() domain.WorkflowRepository {
+func NewMemoryRepository() *MemoryRepo {
+	// copy the defaults so repositories never share the same map
+	workflows := make(map[string]domain.Workflow, len(storage.DefaultWorkflows))
+	for id, w := range storage.DefaultWorkflows {
+		workflows[id] = w
+	}
 	return &MemoryRepo{
-		workflows: storage.DefaultWorkflows,
+		workflows:   workflows,
+		executions:  make(map[string]*domain.Execution),
+		events:      make(map[string][]*domain.ExecutionEvent),
+		schedules:   make(map[string]*domain.Schedule),
+		webhooks:    make(map[string]*domain.Webhook),
+		triggers:    make(map[string]*domain.CompletionTrigger),
+		fileWatches: make(map[string]*domain.FileWatch),
 	}
 }
 
 func (r *MemoryRepo) Create(t *domain.Workflow) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	r.workflows[t.ID] = *t
 	return nil
 }
 
 func (r *MemoryRepo) Get(id string) (*domain.Workflow, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	w, exists := r.workflows[id]
 	if !exists {
 		return nil, fmt.Errorf("workflow with id %s not found", id)
 	}
 	return &w, nil
 }
+
+func (r *MemoryRepo) List(f domain.WorkflowFilter) ([]*domain.Workflow, string, error) {
+	offset, err := domain.ParsePageToken(f.PageToken)
+	if err != nil {
+		return nil, "", err
+	}
+	pageSize := f.PageSize
+	if pageSize <= 0 {
+		pageSize = domain.WorkflowDefaultPageSize
+	}
+	name := strings.ToLower(f.Name)
+
+	r.mu.RLock()
+	matches := []*domain.Workflow{}
+	for _, w := range r.workflows {
+		if name != "" && !strings.Contains(strings.ToLower(w.Name), name) {
+			continue
+		}
+		wc := w
+		matches = append(matches, &wc)
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Name != matches[j].Name {
+			return matches[i].Name < matches[j].Name
+		}
+		return matches[i].ID < matches[j].ID
+	})
+	if offset >= len(matches) {
+		return []*domain.Workflow{}, "", nil
+	}
+	end := min(offset+pageSize, len(matches))
+	page := matches[offset:end]
+	return page, domain.NextPageToken(offset, pageSize, len(page), end < len(matches)), nil
+}
+
+func (r *MemoryRepo) Update(w *domain.Workflow) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.workflows[w.ID]; !exists {
+		return fmt.Errorf("workflow with id %s not found for update", w.ID)
+	}
+	r.workflows[w.ID] = *w
+	return nil
+}
+
+func (r *MemoryRepo) Delete(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.workflows[id]; !exists {
+		return fmt.Errorf("workflow with id %s not found", id)
+	}
+	// execution history is kept even after its workflow is removed
+	delete(r.workflows, id)
+	for sid, s := range r.schedules {
+		if s.WorkflowID == id {
+			delete(r.schedules, sid)
+		}
+	}
+	for wid, w := range r.webhooks {
+		if w.WorkflowID == id {
+			delete(r.webhooks, wid)
+		}
+	}
+	for tid, t := range r.triggers {
+		if t.WorkflowID == id || t.TargetWorkflowID == id {
+			delete(r.triggers, tid)
+		}
+	}
+	for fid, fw := range r.fileWatches {
+		if fw.WorkflowID == id {
+			delete(r.fileWatches, fid)
+		}
+	}
+	return nil
+}
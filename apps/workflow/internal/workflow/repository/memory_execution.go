@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/domain"
+)
+
+func (r *MemoryRepo) CreateExecution(e *domain.Execution) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.executions[e.ID]; exists {
+		return fmt.Errorf("execution with id %s already exists", e.ID)
+	}
+	r.executions[e.ID] = e.Clone()
+	return nil
+}
+
+func (r *MemoryRepo) UpdateExecution(e *domain.Execution) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, exists := r.executions[e.ID]
+	if !exists {
+		return fmt.Errorf("execution with id %s not found", e.ID)
+	}
+	// task states are updated on their own, keep the stored ones
+	updated := e.Clone()
+	updated.Tasks = stored.Tasks
+	updated.Compensations = stored.Compensations
+	r.executions[e.ID] = updated
+	return nil
+}
+
+func (r *MemoryRepo) UpdateTaskExecution(executionID string, t *domain.TaskExecution) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, exists := r.executions[executionID]
+	if !exists {
+		return fmt.Errorf("execution with id %s not found", executionID)
+	}
+	tc := *t
+	if t.Compensates != "" {
+		stored.Compensations[t.Compensates] = &tc
+		return nil
+	}
+	stored.Tasks[t.TaskID] = &tc
+	return nil
+}
+
+func (r *MemoryRepo) GetExecution(id string) (*domain.Execution, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	e, exists := r.executions[id]
+	if !exists {
+		return nil, fmt.Errorf("execution with id %s not found", id)
+	}
+	return e.Clone(), nil
+}
+
+func (r *MemoryRepo) ListExecutions(f domain.ExecutionFilter) ([]*domain.Execution, string, error) {
+	offset, err := domain.ParsePageToken(f.PageToken)
+	if err != nil {
+		return nil, "", err
+	}
+	r.mu.RLock()
+	matches := []*domain.Execution{}
+	for _, e := range r.executions {
+		if f.WorkflowID != "" && e.WorkflowID != f.WorkflowID {
+			continue
+		}
+		if f.Status != "" && e.Status != f.Status {
+			continue
+		}
+		if !f.StartedAfter.IsZero() && e.StartedAt.Before(f.StartedAfter) {
+			continue
+		}
+		if !f.StartedBefore.IsZero() && !e.StartedAt.Before(f.StartedBefore) {
+			continue
+		}
+		matches = append(matches, e.Clone())
+	}
+	r.mu.RUnlock()
+
+	// most recent first, ties broken by id so pages are stable
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].StartedAt.Equal(matches[j].StartedAt) {
+			return matches[i].ID < matches[j].ID
+		}
+		return matches[i].StartedAt.After(matches[j].StartedAt)
+	})
+	pageSize := f.PageSize
+	if pageSize <= 0 {
+		pageSize = domain.ExecutionDefaultPageSize
+	}
+	if offset >= len(matches) {
+		return []*domain.Execution{}, "", nil
+	}
+	end := min(offset+pageSize, len(matches))
+	page := matches[offset:end]
+	return page, domain.NextPageToken(offset, pageSize, len(page), end < len(matches)), nil
+}
+
+func (r *MemoryRepo) AppendExecutionEvent(ev *domain.ExecutionEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.executions[ev.ExecutionID]; !exists {
+		return fmt.Errorf("execution with id %s not found", ev.ExecutionID)
+	}
+	evc := *ev
+	r.events[ev.ExecutionID] = append(r.events[ev.ExecutionID], &evc)
+	return nil
+}
+
+func (r *MemoryRepo) ListExecutionEvents(executionID string, fromSeq int64) ([]*domain.ExecutionEvent, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := []*domain.ExecutionEvent{}
+	for _, ev := range r.events[executionID] {
+		if ev.Seq >= fromSeq {
+			evc := *ev
+			out = append(out, &evc)
+		}
+	}
+	return out, nil
+}
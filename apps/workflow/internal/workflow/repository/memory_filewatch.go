@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/domain"
+)
+
+func (r *MemoryRepo) CreateFileWatch(fw *domain.FileWatch) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.workflows[fw.WorkflowID]; !exists {
+		return fmt.Errorf("workflow with id %s not found", fw.WorkflowID)
+	}
+	r.fileWatches[fw.ID] = fw.Clone()
+	return nil
+}
+
+func (r *MemoryRepo) ListFileWatches(workflowID string) ([]*domain.FileWatch, error) {
+	r.mu.RLock()
+	watches := []*domain.FileWatch{}
+	for _, fw := range r.fileWatches {
+		if workflowID == "" || fw.WorkflowID == workflowID {
+			watches = append(watches, fw.Clone())
+		}
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(watches, func(i, j int) bool {
+		if !watches[i].CreatedAt.Equal(watches[j].CreatedAt) {
+			return watches[i].CreatedAt.Before(watches[j].CreatedAt)
+		}
+		return watches[i].ID < watches[j].ID
+	})
+	return watches, nil
+}
+
+func (r *MemoryRepo) DeleteFileWatch(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.fileWatches[id]; !exists {
+		return fmt.Errorf("file watch with id %s not found", id)
+	}
+	delete(r.fileWatches, id)
+	return nil
+}
@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/domain"
+)
+
+func (r *MemoryRepo) CreateSchedule(s *domain.Schedule) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.workflows[s.WorkflowID]; !exists {
+		return fmt.Errorf("workflow with id %s not found", s.WorkflowID)
+	}
+	r.schedules[s.ID] = s.Clone()
+	return nil
+}
+
+func (r *MemoryRepo) GetSchedule(id string) (*domain.Schedule, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	s, exists := r.schedules[id]
+	if !exists {
+		return nil, fmt.Errorf("schedule with id %s not found", id)
+	}
+	return s.Clone(), nil
+}
+
+func (r *MemoryRepo) ListSchedules(workflowID string) ([]*domain.Schedule, error) {
+	r.mu.RLock()
+	schedules := []*domain.Schedule{}
+	for _, s := range r.schedules {
+		if workflowID == "" || s.WorkflowID == workflowID {
+			schedules = append(schedules, s.Clone())
+		}
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(schedules, func(i, j int) bool {
+		if !schedules[i].CreatedAt.Equal(schedules[j].CreatedAt) {
+			return schedules[i].CreatedAt.Before(schedules[j].CreatedAt)
+		}
+		return schedules[i].ID < schedules[j].ID
+	})
+	return schedules, nil
+}
+
+func (r *MemoryRepo) SetSchedulePaused(id string, paused bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, exists := r.schedules[id]
+	if !exists {
+		return fmt.Errorf("schedule with id %s not found", id)
+	}
+	s.Paused = paused
+	return nil
+}
+
+func (r *MemoryRepo) RecordScheduleFire(id string, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, exists := r.schedules[id]
+	if !exists {
+		return fmt.Errorf("schedule with id %s not found", id)
+	}
+	s.LastFireAt = at.UTC()
+	return nil
+}
+
+func (r *MemoryRepo) DeleteSchedule(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.schedules[id]; !exists {
+		return fmt.Errorf("schedule with id %s not found", id)
+	}
+	delete(r.schedules, id)
+	return nil
+}
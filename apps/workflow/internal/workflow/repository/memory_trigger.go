@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/domain"
+)
+
+func (r *MemoryRepo) CreateTrigger(t *domain.CompletionTrigger) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, id := range []string{t.WorkflowID, t.TargetWorkflowID} {
+		if _, exists := r.workflows[id]; !exists {
+			return fmt.Errorf("workflow with id %s not found", id)
+		}
+	}
+	tc := *t
+	r.triggers[t.ID] = &tc
+	return nil
+}
+
+func (r *MemoryRepo) ListTriggers(workflowID string) ([]*domain.CompletionTrigger, error) {
+	r.mu.RLock()
+	triggers := []*domain.CompletionTrigger{}
+	for _, t := range r.triggers {
+		if workflowID == "" || t.WorkflowID == workflowID {
+			tc := *t
+			triggers = append(triggers, &tc)
+		}
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(triggers, func(i, j int) bool {
+		if !triggers[i].CreatedAt.Equal(triggers[j].CreatedAt) {
+			return triggers[i].CreatedAt.Before(triggers[j].CreatedAt)
+		}
+		return triggers[i].ID < triggers[j].ID
+	})
+	return triggers, nil
+}
+
+func (r *MemoryRepo) DeleteTrigger(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.triggers[id]; !exists {
+		return fmt.Errorf("trigger with id %s not found", id)
+	}
+	delete(r.triggers, id)
+	return nil
+}
@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/domain"
+)
+
+func (r *MemoryRepo) CreateWebhook(w *domain.Webhook) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.workflows[w.WorkflowID]; !exists {
+		return fmt.Errorf("workflow with id %s not found", w.WorkflowID)
+	}
+	wc := *w
+	r.webhooks[w.ID] = &wc
+	return nil
+}
+
+func (r *MemoryRepo) ListWebhooks(workflowID string) ([]*domain.Webhook, error) {
+	r.mu.RLock()
+	webhooks := []*domain.Webhook{}
+	for _, w := range r.webhooks {
+		if w.WorkflowID == workflowID {
+			wc := *w
+			webhooks = append(webhooks, &wc)
+		}
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(webhooks, func(i, j int) bool {
+		if !webhooks[i].CreatedAt.Equal(webhooks[j].CreatedAt) {
+			return webhooks[i].CreatedAt.Before(webhooks[j].CreatedAt)
+		}
+		return webhooks[i].ID < webhooks[j].ID
+	})
+	return webhooks, nil
+}
+
+func (r *MemoryRepo) DeleteWebhook(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.webhooks[id]; !exists {
+		return fmt.Errorf("webhook with id %s not found", id)
+	}
+	delete(r.webhooks, id)
+	return nil
+}
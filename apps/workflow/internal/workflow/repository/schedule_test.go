@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/domain"
+)
+
+func TestSchedules(t *testing.T) {
+	for name, r := range workflowRepositories(t) {
+		sr := r.(domain.ScheduleRepository)
+		t.Run(name, func(t *testing.T) {
+			w := newLogWorkflow(t, "test", "a")
+			if err := r.Create(w); err != nil {
+				t.Fatalf("create: %v", err)
+			}
+			s, err := domain.NewSchedule(w.ID, "*/5 * * * *", "Europe/Lisbon", map[string]interface{}{"n": 1.0}, domain.MissedFirePolicyCatchUp)
+			if err != nil {
+				t.Fatalf("new schedule: %v", err)
+			}
+			if err := sr.CreateSchedule(s); err != nil {
+				t.Fatalf("create schedule: %v", err)
+			}
+
+			firedAt := time.Date(2026, 1, 1, 10, 5, 0, 0, time.UTC)
+			if err := sr.RecordScheduleFire(s.ID, firedAt); err != nil {
+				t.Fatalf("record fire: %v", err)
+			}
+			if err := sr.SetSchedulePaused(s.ID, true); err != nil {
+				t.Fatalf("pause: %v", err)
+			}
+			got, err := sr.GetSchedule(s.ID)
+			if err != nil {
+				t.Fatalf("get schedule: %v", err)
+			}
+			if got.Cron != s.Cron || got.TimeZone != s.TimeZone || got.MissedFirePolicy != s.MissedFirePolicy ||
+				got.Inputs["n"] != 1.0 || !got.Paused || !got.LastFireAt.Equal(firedAt) {
+				t.Errorf("got schedule %+v", got)
+			}
+
+			if schedules, err := sr.ListSchedules("other"); err != nil || len(schedules) != 0 {
+				t.Errorf("got %d schedules of another workflow, %v, want none", len(schedules), err)
+			}
+			if schedules, err := sr.ListSchedules(""); err != nil || len(schedules) != 1 {
+				t.Errorf("got %d schedules, %v, want 1", len(schedules), err)
+			}
+			if err := sr.DeleteSchedule(s.ID); err != nil {
+				t.Fatalf("delete schedule: %v", err)
+			}
+			if _, err := sr.GetSchedule(s.ID); err == nil {
+				t.Errorf("expected a deleted schedule to be gone")
+			}
+		})
+	}
+}
@@ -15,8 +15,10 @@ type SQLiteRepo struct {
 	db *sql.DB
 }
 
-func NewSQLiteRepository(dbPath string, name string) (domain.WorkflowRepository, error) {
-	filePath := filepath.Join(dbPath, name)
+func NewSQLiteRepository(dbPath string, name string) (*SQLiteRepo, error) {
+	// wait for locks instead of failing right away, executions write concurrently,
+	// foreign keys must be enabled for deletes to cascade
+	filePath := filepath.Join(dbPath, name) + "?_busy_timeout=5000&_foreign_keys=on"
 	db, err := sql.Open("sqlite3", filePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
@@ -25,6 +27,9 @@ func NewSQLiteRepository(dbPath string, name string) (domain.WorkflowRepository,
 	if err := repo.createTables(); err != nil {
 		return nil, fmt.Errorf("failed to create tables: %w", err)
 	}
+	if err := repo.migrate(); err != nil {
+		return nil, fmt.Errorf("failed to migrate tables: %w", err)
+	}
 	return repo, nil
 }
 
@@ -36,16 +41,17 @@ func (r *SQLiteRepo) Create(w *domain.Workflow) error {
 	}
 	defer tx.Rollback()
 	query := `
-		INSERT INTO workflow (id, name, description, status)
-		VALUES (?, ?, ?, ?)`
-	_, err = tx.Exec(query, w.ID, w.Name, w.Description, w.Status)
+		INSERT INTO workflow (id, name, description)
+		VALUES (?, ?, ?)`
+	_, err = tx.Exec(query, w.ID, w.Name, w.Description)
 	if err != nil {
 		return fmt.Errorf("failed to insert workflow: %w", err)
 	}
-	for _, task := range w.Tasks {
-		if err := r.createTask(tx, task, w.ID); err != nil {
-			return fmt.Errorf("failed to insert task %s: %w", task.ID, err)
-		}
+	if err := r.insertInputs(tx, w); err != nil {
+		return err
+	}
+	if err := r.insertTasks(tx, w); err != nil {
+		return err
 	}
 	// commit transaction
 	if err := tx.Commit(); err != nil {
@@ -57,17 +63,35 @@ func (r *SQLiteRepo) Create(w *domain.Workflow) error {
 func (r *SQLiteRepo) Get(id string) (*domain.Workflow, error) {
 	query := `
 		SELECT 
-			w.id, w.name, w.description, w.status,
-			t.id, t.name, t.type, t.status, t.retries, t.retry_delay, t.condition,
+			w.id, w.name, w.description,
+			t.id, t.name, t.type, t.retries, t.retry_delay_ms, t.condition,
+			t.join_mode, t.join_quorum, t.join_cancel_remaining, t.failure_policy,
 			lp.message,
 			hp.url, hp.method, hp.body, hp.headers, hp.query_params, 
 			hp.timeout, hp.follow_redirects, hp.verify_ssl, hp.expected_status_code,
-			ha.auth_type, ha.auth_data
+			ha.auth_type, ha.auth_data,
+			sp.command, sp.args, sp.working_dir, sp.env, sp.stdin, sp.timeout_ms, sp.max_output_size,
+			sp.cpu_time_ms, sp.memory_bytes, sp.open_files, sp.run_as_user, sp.new_namespaces,
+			dp.duration_ms, dp.until, dp.time_of_day, dp.time_zone,
+			tp.query,
+			swp.workflow_id, swp.inputs,
+			mp.items, mp.task_id_to_run, mp.max_parallelism, mp.failure_policy, mp.tolerated_failure_percent,
+			lop.task_id_to_run, lop.while_condition, lop.max_iterations, lop.interval_ms, lop.deadline_ms,
+			swc.cases, swc.default_next,
+			tc.compensation_task_id
 		FROM workflow w
 		LEFT JOIN task t ON w.id = t.workflow_id
 		LEFT JOIN log_payload lp ON t.id = lp.task_id
 		LEFT JOIN http_payload hp ON t.id = hp.task_id
 		LEFT JOIN http_auth ha ON t.id = ha.task_id
+		LEFT JOIN shell_payload sp ON t.id = sp.task_id
+		LEFT JOIN delay_payload dp ON t.id = dp.task_id
+		LEFT JOIN transform_payload tp ON t.id = tp.task_id
+		LEFT JOIN subworkflow_payload swp ON t.id = swp.task_id
+		LEFT JOIN map_payload mp ON t.id = mp.task_id
+		LEFT JOIN loop_payload lop ON t.id = lop.task_id
+		LEFT JOIN switch_payload swc ON t.id = swc.task_id
+		LEFT JOIN task_compensation tc ON t.id = tc.task_id
 		WHERE w.id = ?
 		ORDER BY t.id`
 
@@ -79,15 +103,20 @@ func (r *SQLiteRepo) Get(id string) (*domain.Workflow, error) {
 
 	var workflow *domain.Workflow
 	tasksMap := make(map[string]*domain.Task)
+	tasksToRun := make(map[string]string)    // task run by each map and loop task
+	compensations := make(map[string]string) // compensation of each task that has one
 
 	for rows.Next() {
 		var (
 			// workflow fields
-			wID, wName, wDescription, wStatus string
+			wID, wName, wDescription string
 			// task fields (nullable)
-			tID, tName, tType, tStatus, tCondition sql.NullString
-			tRetries                               sql.NullInt32
-			tRetryDelayMs                          sql.NullInt64
+			tID, tName, tType, tCondition sql.NullString
+			tRetries                      sql.NullInt32
+			tRetryDelayMs                 sql.NullInt64
+			tJoinMode, tFailurePolicy     sql.NullString
+			tJoinQuorum                   sql.NullInt32
+			tJoinCancelRemaining          sql.NullBool
 			// log payload (nullable)
 			logMessage sql.NullString
 			// HTTP payload (nullable)
@@ -97,15 +126,49 @@ func (r *SQLiteRepo) Get(id string) (*domain.Workflow, error) {
 			httpExpectedStatusCode                                      sql.NullInt32
 			// HTTP auth (nullable)
 			authType, authDataJSON sql.NullString
+			// shell payload (nullable)
+			shellCommand, shellArgs, shellWorkingDir, shellEnv, shellStdin sql.NullString
+			shellTimeoutMs, shellMaxOutputSize                             sql.NullInt64
+			shellCPUTimeMs, shellMemoryBytes, shellOpenFiles               sql.NullInt64
+			shellUser                                                      sql.NullString
+			shellNewNamespaces                                             sql.NullBool
+			// delay payload (nullable)
+			delayDurationMs                           sql.NullInt64
+			delayUntil, delayTimeOfDay, delayTimeZone sql.NullString
+			// transform payload (nullable)
+			transformQuery sql.NullString
+			// subworkflow payload (nullable)
+			subworkflowID, subworkflowInputs sql.NullString
+			// map payload (nullable)
+			mapItems, mapTaskID, mapFailurePolicy  sql.NullString
+			mapMaxParallelism, mapToleratedPercent sql.NullInt32
+			// loop payload (nullable)
+			loopTaskID, loopWhile          sql.NullString
+			loopMaxIterations              sql.NullInt32
+			loopIntervalMs, loopDeadlineMs sql.NullInt64
+			// switch payload (nullable)
+			switchCases, switchDefault sql.NullString
+			// compensation (nullable)
+			compensationTaskID sql.NullString
 		)
 
 		err := rows.Scan(
-			&wID, &wName, &wDescription, &wStatus,
-			&tID, &tName, &tType, &tStatus, &tRetries, &tRetryDelayMs, &tCondition,
+			&wID, &wName, &wDescription,
+			&tID, &tName, &tType, &tRetries, &tRetryDelayMs, &tCondition,
+			&tJoinMode, &tJoinQuorum, &tJoinCancelRemaining, &tFailurePolicy,
 			&logMessage,
 			&httpURL, &httpMethod, &httpBody, &httpHeaders, &httpQueryParams,
 			&httpTimeoutMs, &httpFollowRedirects, &httpVerifySSL, &httpExpectedStatusCode,
 			&authType, &authDataJSON,
+			&shellCommand, &shellArgs, &shellWorkingDir, &shellEnv, &shellStdin, &shellTimeoutMs, &shellMaxOutputSize,
+			&shellCPUTimeMs, &shellMemoryBytes, &shellOpenFiles, &shellUser, &shellNewNamespaces,
+			&delayDurationMs, &delayUntil, &delayTimeOfDay, &delayTimeZone,
+			&transformQuery,
+			&subworkflowID, &subworkflowInputs,
+			&mapItems, &mapTaskID, &mapMaxParallelism, &mapFailurePolicy, &mapToleratedPercent,
+			&loopTaskID, &loopWhile, &loopMaxIterations, &loopIntervalMs, &loopDeadlineMs,
+			&switchCases, &switchDefault,
+			&compensationTaskID,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan row: %w", err)
@@ -117,7 +180,6 @@ func (r *SQLiteRepo) Get(id string) (*domain.Workflow, error) {
 				ID:          wID,
 				Name:        wName,
 				Description: wDescription,
-				Status:      domain.WorklowStatus(wStatus),
 			}
 		}
 
@@ -134,10 +196,15 @@ func (r *SQLiteRepo) Get(id string) (*domain.Workflow, error) {
 				ID:         taskID,
 				Name:       tName.String,
 				Type:       domain.TaskType(tType.String),
-				Status:     domain.TaskStatus(tStatus.String),
 				Retries:    uint8(tRetries.Int32),
-				RetryDelay: time.Duration(tRetryDelayMs.Int64) * time.Second,
+				RetryDelay: time.Duration(tRetryDelayMs.Int64) * time.Millisecond,
 				Condition:  tCondition.String,
+				Join: domain.Join{
+					Mode:            domain.JoinMode(tJoinMode.String),
+					Quorum:          int(tJoinQuorum.Int32),
+					CancelRemaining: tJoinCancelRemaining.Bool,
+				},
+				FailurePolicy: domain.TaskFailurePolicy(tFailurePolicy.String),
 			}
 
 			// set payload based on task type
@@ -180,6 +247,91 @@ func (r *SQLiteRepo) Get(id string) (*domain.Workflow, error) {
 					}
 					task.Payload = httpPayload
 				}
+			case domain.TaskTypeShell:
+				if shellCommand.Valid {
+					shellPayload := &domain.ShellPayload{
+						Command:       shellCommand.String,
+						WorkingDir:    shellWorkingDir.String,
+						Stdin:         shellStdin.String,
+						Timeout:       time.Duration(shellTimeoutMs.Int64) * time.Millisecond,
+						MaxOutputSize: shellMaxOutputSize.Int64,
+						Limits: domain.ShellLimits{
+							CPUTime:       time.Duration(shellCPUTimeMs.Int64) * time.Millisecond,
+							MemoryBytes:   shellMemoryBytes.Int64,
+							OpenFiles:     uint64(shellOpenFiles.Int64),
+							User:          shellUser.String,
+							NewNamespaces: shellNewNamespaces.Bool,
+						},
+					}
+					if err := json.Unmarshal([]byte(shellArgs.String), &shellPayload.Args); err != nil {
+						return nil, fmt.Errorf("failed to unmarshal args: %w", err)
+					}
+					if err := json.Unmarshal([]byte(shellEnv.String), &shellPayload.Env); err != nil {
+						return nil, fmt.Errorf("failed to unmarshal env: %w", err)
+					}
+					task.Payload = shellPayload
+				}
+			case domain.TaskTypeDelay:
+				if delayDurationMs.Valid {
+					task.Payload = &domain.DelayPayload{
+						Duration:  time.Duration(delayDurationMs.Int64) * time.Millisecond,
+						Until:     delayUntil.String,
+						TimeOfDay: delayTimeOfDay.String,
+						TimeZone:  delayTimeZone.String,
+					}
+				}
+			case domain.TaskTypeTransform:
+				if transformQuery.Valid {
+					task.Payload = &domain.TransformPayload{
+						Query: transformQuery.String,
+					}
+				}
+			case domain.TaskTypeSubworkflow:
+				if subworkflowID.Valid {
+					subworkflowPayload := &domain.SubworkflowPayload{
+						WorkflowID: subworkflowID.String,
+					}
+					if err := json.Unmarshal([]byte(subworkflowInputs.String), &subworkflowPayload.Inputs); err != nil {
+						return nil, fmt.Errorf("failed to unmarshal subworkflow inputs: %w", err)
+					}
+					task.Payload = subworkflowPayload
+				}
+			case domain.TaskTypeMap:
+				if mapItems.Valid {
+					// the task to run is attached once every task is loaded
+					task.Payload = &domain.MapPayload{
+						Items:                   mapItems.String,
+						MaxParallelism:          int(mapMaxParallelism.Int32),
+						FailurePolicy:           domain.MapFailurePolicy(mapFailurePolicy.String),
+						ToleratedFailurePercent: int(mapToleratedPercent.Int32),
+					}
+					tasksToRun[taskID] = mapTaskID.String
+				}
+			case domain.TaskTypeLoop:
+				if loopWhile.Valid {
+					// the task to run is attached once every task is loaded
+					task.Payload = &domain.LoopPayload{
+						While:         loopWhile.String,
+						MaxIterations: int(loopMaxIterations.Int32),
+						Interval:      time.Duration(loopIntervalMs.Int64) * time.Millisecond,
+						Deadline:      time.Duration(loopDeadlineMs.Int64) * time.Millisecond,
+					}
+					tasksToRun[taskID] = loopTaskID.String
+				}
+			case domain.TaskTypeSwitch:
+				if switchCases.Valid {
+					switchPayload := &domain.SwitchPayload{
+						Default: switchDefault.String,
+					}
+					if err := json.Unmarshal([]byte(switchCases.String), &switchPayload.Cases); err != nil {
+						return nil, fmt.Errorf("failed to unmarshal switch cases: %w", err)
+					}
+					task.Payload = switchPayload
+				}
+			}
+			if compensationTaskID.Valid {
+				// attached once every task is loaded, like the tasks to run
+				compensations[taskID] = compensationTaskID.String
 			}
 			tasksMap[taskID] = task
 		}
@@ -192,51 +344,231 @@ func (r *SQLiteRepo) Get(id string) (*domain.Workflow, error) {
 		return nil, fmt.Errorf("workflow with id %s not found", id)
 	}
 
+	inputs, err := r.loadInputs(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load inputs: %w", err)
+	}
+	workflow.Inputs = inputs
+
 	// load task relationships
 	if len(tasksMap) > 0 {
 		if err := r.loadTaskRelationships(tasksMap, id); err != nil {
 			return nil, fmt.Errorf("failed to load task relationships: %w", err)
 		}
 	}
+	for id, runID := range tasksToRun {
+		toRun, ok := tasksMap[runID]
+		if !ok {
+			return nil, fmt.Errorf("task %s run by task %s not found", runID, id)
+		}
+		switch p := tasksMap[id].Payload.(type) {
+		case *domain.MapPayload:
+			p.Task = toRun
+		case *domain.LoopPayload:
+			p.Task = toRun
+		}
+	}
+	for id, compensationID := range compensations {
+		compensation, ok := tasksMap[compensationID]
+		if !ok {
+			return nil, fmt.Errorf("compensation %s of task %s not found", compensationID, id)
+		}
+		tasksMap[id].Compensation = compensation
+	}
 	// find root tasks
 	workflow.Tasks = r.findRootTasks(tasksMap)
 	return workflow, nil
 }
 
-func (r *SQLiteRepo) Update(w *domain.Workflow) error {
-	tasksJSON, err := json.Marshal(w.Tasks)
+func (r *SQLiteRepo) List(f domain.WorkflowFilter) ([]*domain.Workflow, string, error) {
+	offset, err := domain.ParsePageToken(f.PageToken)
 	if err != nil {
-		return fmt.Errorf("failed to marshal tasks: %w", err)
+		return nil, "", err
+	}
+	pageSize := f.PageSize
+	if pageSize <= 0 {
+		pageSize = domain.WorkflowDefaultPageSize
 	}
+	// fetch one extra row to know if there is a next page
+	query := `
+		SELECT id
+		FROM workflow
+		WHERE ? = '' OR instr(lower(name), lower(?)) > 0
+		ORDER BY name, id
+		LIMIT ? OFFSET ?`
+	rows, err := r.db.Query(query, f.Name, f.Name, pageSize+1, offset)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to query workflows: %w", err)
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, "", fmt.Errorf("failed to scan workflow: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, "", fmt.Errorf("error iterating rows: %w", err)
+	}
+	more := len(ids) > pageSize
+	if more {
+		ids = ids[:pageSize]
+	}
+	workflows := make([]*domain.Workflow, 0, len(ids))
+	for _, id := range ids {
+		w, err := r.Get(id)
+		if err != nil {
+			return nil, "", err
+		}
+		workflows = append(workflows, w)
+	}
+	return workflows, domain.NextPageToken(offset, pageSize, len(workflows), more), nil
+}
 
+func (r *SQLiteRepo) Update(w *domain.Workflow) error {
+	// start transaction
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
 	query := `
 		UPDATE workflow
-		SET name = ?, description = ?, status = ?, tasks_json = ?, updated_at = CURRENT_TIMESTAMP
+		SET name = ?, description = ?, updated_at = CURRENT_TIMESTAMP
 		WHERE id = ?`
-
-	result, err := r.db.Exec(query, w.Name, w.Description, w.Status, string(tasksJSON), w.ID)
+	result, err := tx.Exec(query, w.Name, w.Description, w.ID)
 	if err != nil {
 		return fmt.Errorf("failed to update workflow: %w", err)
 	}
-
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
 		return fmt.Errorf("failed to get rows affected: %w", err)
 	}
-
 	if rowsAffected == 0 {
 		return fmt.Errorf("workflow with id %s not found for update", w.ID)
 	}
+	// replace inputs and the task graph, payloads and edges of the old
+	// tasks are removed by cascade
+	if _, err := tx.Exec(`DELETE FROM workflow_input WHERE workflow_id = ?`, w.ID); err != nil {
+		return fmt.Errorf("failed to delete inputs: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM task WHERE workflow_id = ?`, w.ID); err != nil {
+		return fmt.Errorf("failed to delete tasks: %w", err)
+	}
+	if err := r.insertInputs(tx, w); err != nil {
+		return err
+	}
+	if err := r.insertTasks(tx, w); err != nil {
+		return err
+	}
+	// commit transaction
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+func (r *SQLiteRepo) Delete(id string) error {
+	// inputs, tasks and payloads are removed by cascade, execution history is kept
+	result, err := r.db.Exec(`DELETE FROM workflow WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete workflow: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("workflow with id %s not found", id)
+	}
+	return nil
+}
 
+func (r *SQLiteRepo) insertTasks(tx *sql.Tx, w *domain.Workflow) error {
+	// tasks shared by several predecessors are inserted once
+	created := make(map[string]bool)
+	for _, task := range w.Tasks {
+		if err := r.createTask(tx, task, w.ID, created); err != nil {
+			return fmt.Errorf("failed to insert task %s: %w", task.ID, err)
+		}
+	}
 	return nil
 }
 
-func (r *SQLiteRepo) createTask(tx *sql.Tx, task *domain.Task, workflowID string) error {
+func (r *SQLiteRepo) insertInputs(tx *sql.Tx, w *domain.Workflow) error {
+	query := `
+        INSERT INTO workflow_input (workflow_id, name, type, required, default_value, description, position)
+        VALUES (?, ?, ?, ?, ?, ?, ?)`
+	for i, in := range w.Inputs {
+		var defaultJSON sql.NullString
+		if in.Default != nil {
+			b, err := json.Marshal(in.Default)
+			if err != nil {
+				return fmt.Errorf("failed to marshal default of input %s: %w", in.Name, err)
+			}
+			defaultJSON = sql.NullString{String: string(b), Valid: true}
+		}
+		_, err := tx.Exec(query, w.ID, in.Name, in.Type, in.Required, defaultJSON, in.Description, i)
+		if err != nil {
+			return fmt.Errorf("failed to insert input %s: %w", in.Name, err)
+		}
+	}
+	return nil
+}
+
+func (r *SQLiteRepo) loadInputs(workflowID string) ([]*domain.Input, error) {
+	query := `
+		SELECT name, type, required, default_value, description
+		FROM workflow_input
+		WHERE workflow_id = ?
+		ORDER BY position`
+	rows, err := r.db.Query(query, workflowID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query inputs: %w", err)
+	}
+	defer rows.Close()
+	var inputs []*domain.Input
+	for rows.Next() {
+		var (
+			name, inputType string
+			required        bool
+			defaultJSON     sql.NullString
+			description     sql.NullString
+			defaultValue    interface{}
+		)
+		if err := rows.Scan(&name, &inputType, &required, &defaultJSON, &description); err != nil {
+			return nil, fmt.Errorf("failed to scan input: %w", err)
+		}
+		if defaultJSON.Valid {
+			if err := json.Unmarshal([]byte(defaultJSON.String), &defaultValue); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal default of input %s: %w", name, err)
+			}
+		}
+		// NewInput normalizes the decoded default the same way it was on create
+		in, err := domain.NewInput(name, domain.InputType(inputType), required, defaultValue, description.String)
+		if err != nil {
+			return nil, err
+		}
+		inputs = append(inputs, in)
+	}
+	return inputs, rows.Err()
+}
+
+func (r *SQLiteRepo) createTask(tx *sql.Tx, task *domain.Task, workflowID string, created map[string]bool) error {
+	if created[task.ID] {
+		return nil
+	}
+	created[task.ID] = true
 	taskQuery := `
-        INSERT INTO task (id, name, type, status, retries, retry_delay, condition, workflow_id)
-        VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
-	_, err := tx.Exec(taskQuery, task.ID, task.Name, task.Type, task.Status,
-		task.Retries, task.RetryDelay.Seconds(), task.Condition, workflowID)
+        INSERT INTO task (id, name, type, retries, retry_delay_ms, condition,
+            join_mode, join_quorum, join_cancel_remaining, failure_policy, workflow_id)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := tx.Exec(taskQuery, task.ID, task.Name, task.Type,
+		task.Retries, task.RetryDelay.Milliseconds(), task.Condition,
+		task.Join.Mode, task.Join.Quorum, task.Join.CancelRemaining, task.FailurePolicy, workflowID)
 	if err != nil {
 		return fmt.Errorf("failed to insert task: %w", err)
 	}
@@ -249,15 +581,55 @@ func (r *SQLiteRepo) createTask(tx *sql.Tx, task *domain.Task, workflowID string
 		if err := r.insertHTTPPayload(tx, task); err != nil {
 			return err
 		}
+	case domain.TaskTypeShell:
+		if err := r.insertShellPayload(tx, task); err != nil {
+			return err
+		}
+	case domain.TaskTypeDelay:
+		if err := r.insertDelayPayload(tx, task); err != nil {
+			return err
+		}
+	case domain.TaskTypeTransform:
+		if err := r.insertTransformPayload(tx, task); err != nil {
+			return err
+		}
+	case domain.TaskTypeSubworkflow:
+		if err := r.insertSubworkflowPayload(tx, task); err != nil {
+			return err
+		}
+	case domain.TaskTypeMap:
+		if err := r.insertMapPayload(tx, task, workflowID, created); err != nil {
+			return err
+		}
+	case domain.TaskTypeLoop:
+		if err := r.insertLoopPayload(tx, task, workflowID, created); err != nil {
+			return err
+		}
+	case domain.TaskTypeSwitch:
+		if err := r.insertSwitchPayload(tx, task); err != nil {
+			return err
+		}
 	}
-	for _, nextTask := range task.Next {
-		if err := r.createTask(tx, nextTask, workflowID); err != nil {
+	if task.Compensation != nil {
+		if err := r.createTask(tx, task.Compensation, workflowID, created); err != nil {
 			return err
 		}
-		nextQuery := `
-            INSERT INTO task_next (task_id, next_task_id)
+		compensationQuery := `
+            INSERT INTO task_compensation (task_id, compensation_task_id)
             VALUES (?, ?)`
-		_, err := tx.Exec(nextQuery, task.ID, nextTask.ID)
+		_, err := tx.Exec(compensationQuery, task.ID, task.Compensation.ID)
+		if err != nil {
+			return fmt.Errorf("failed to insert task compensation: %w", err)
+		}
+	}
+	for _, nextTask := range task.Successors() {
+		if err := r.createTask(tx, nextTask, workflowID, created); err != nil {
+			return err
+		}
+		nextQuery := `
+            INSERT INTO task_next (task_id, next_task_id, on_failure)
+            VALUES (?, ?, ?)`
+		_, err := tx.Exec(nextQuery, task.ID, nextTask.ID, task.IsOnFailure(nextTask))
 		if err != nil {
 			return fmt.Errorf("failed to insert task next: %w", err)
 		}
@@ -312,6 +684,141 @@ func (r *SQLiteRepo) insertHTTPPayload(tx *sql.Tx, task *domain.Task) error {
 	return nil
 }
 
+func (r *SQLiteRepo) insertShellPayload(tx *sql.Tx, task *domain.Task) error {
+	shellPayload, ok := task.Payload.(*domain.ShellPayload)
+	if !ok {
+		return fmt.Errorf("invalid payload type for shell task")
+	}
+	argsJSON, err := json.Marshal(shellPayload.Args)
+	if err != nil {
+		return fmt.Errorf("failed to marshal args: %w", err)
+	}
+	envJSON, err := json.Marshal(shellPayload.Env)
+	if err != nil {
+		return fmt.Errorf("failed to marshal env: %w", err)
+	}
+	query := `
+        INSERT INTO shell_payload (task_id, command, args, working_dir, env, stdin, timeout_ms, max_output_size,
+            cpu_time_ms, memory_bytes, open_files, run_as_user, new_namespaces)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	limits := shellPayload.Limits
+	_, err = tx.Exec(query, task.ID, shellPayload.Command, string(argsJSON), shellPayload.WorkingDir,
+		string(envJSON), shellPayload.Stdin, shellPayload.Timeout.Milliseconds(), shellPayload.MaxOutputSize,
+		limits.CPUTime.Milliseconds(), limits.MemoryBytes, int64(limits.OpenFiles), limits.User, limits.NewNamespaces)
+	if err != nil {
+		return fmt.Errorf("failed to insert shell payload: %w", err)
+	}
+	return nil
+}
+
+func (r *SQLiteRepo) insertDelayPayload(tx *sql.Tx, task *domain.Task) error {
+	delayPayload, ok := task.Payload.(*domain.DelayPayload)
+	if !ok {
+		return fmt.Errorf("invalid payload type for delay task")
+	}
+	query := `
+        INSERT INTO delay_payload (task_id, duration_ms, until, time_of_day, time_zone)
+        VALUES (?, ?, ?, ?, ?)`
+	_, err := tx.Exec(query, task.ID, delayPayload.Duration.Milliseconds(), delayPayload.Until,
+		delayPayload.TimeOfDay, delayPayload.TimeZone)
+	if err != nil {
+		return fmt.Errorf("failed to insert delay payload: %w", err)
+	}
+	return nil
+}
+
+func (r *SQLiteRepo) insertTransformPayload(tx *sql.Tx, task *domain.Task) error {
+	transformPayload, ok := task.Payload.(*domain.TransformPayload)
+	if !ok {
+		return fmt.Errorf("invalid payload type for transform task")
+	}
+	query := `
+        INSERT INTO transform_payload (task_id, query)
+        VALUES (?, ?)`
+	_, err := tx.Exec(query, task.ID, transformPayload.Query)
+	if err != nil {
+		return fmt.Errorf("failed to insert transform payload: %w", err)
+	}
+	return nil
+}
+
+func (r *SQLiteRepo) insertSubworkflowPayload(tx *sql.Tx, task *domain.Task) error {
+	subworkflowPayload, ok := task.Payload.(*domain.SubworkflowPayload)
+	if !ok {
+		return fmt.Errorf("invalid payload type for subworkflow task")
+	}
+	inputsJSON, err := json.Marshal(subworkflowPayload.Inputs)
+	if err != nil {
+		return fmt.Errorf("failed to marshal subworkflow inputs: %w", err)
+	}
+	query := `
+        INSERT INTO subworkflow_payload (task_id, workflow_id, inputs)
+        VALUES (?, ?, ?)`
+	_, err = tx.Exec(query, task.ID, subworkflowPayload.WorkflowID, string(inputsJSON))
+	if err != nil {
+		return fmt.Errorf("failed to insert subworkflow payload: %w", err)
+	}
+	return nil
+}
+
+func (r *SQLiteRepo) insertMapPayload(tx *sql.Tx, task *domain.Task, workflowID string, created map[string]bool) error {
+	mapPayload, ok := task.Payload.(*domain.MapPayload)
+	if !ok {
+		return fmt.Errorf("invalid payload type for map task")
+	}
+	if err := r.createTask(tx, mapPayload.Task, workflowID, created); err != nil {
+		return err
+	}
+	query := `
+        INSERT INTO map_payload (task_id, items, task_id_to_run, max_parallelism, failure_policy,
+            tolerated_failure_percent)
+        VALUES (?, ?, ?, ?, ?, ?)`
+	_, err := tx.Exec(query, task.ID, mapPayload.Items, mapPayload.Task.ID, mapPayload.MaxParallelism,
+		mapPayload.FailurePolicy, mapPayload.ToleratedFailurePercent)
+	if err != nil {
+		return fmt.Errorf("failed to insert map payload: %w", err)
+	}
+	return nil
+}
+
+func (r *SQLiteRepo) insertLoopPayload(tx *sql.Tx, task *domain.Task, workflowID string, created map[string]bool) error {
+	loopPayload, ok := task.Payload.(*domain.LoopPayload)
+	if !ok {
+		return fmt.Errorf("invalid payload type for loop task")
+	}
+	if err := r.createTask(tx, loopPayload.Task, workflowID, created); err != nil {
+		return err
+	}
+	query := `
+        INSERT INTO loop_payload (task_id, task_id_to_run, while_condition, max_iterations, interval_ms, deadline_ms)
+        VALUES (?, ?, ?, ?, ?, ?)`
+	_, err := tx.Exec(query, task.ID, loopPayload.Task.ID, loopPayload.While, loopPayload.MaxIterations,
+		loopPayload.Interval.Milliseconds(), loopPayload.Deadline.Milliseconds())
+	if err != nil {
+		return fmt.Errorf("failed to insert loop payload: %w", err)
+	}
+	return nil
+}
+
+func (r *SQLiteRepo) insertSwitchPayload(tx *sql.Tx, task *domain.Task) error {
+	switchPayload, ok := task.Payload.(*domain.SwitchPayload)
+	if !ok {
+		return fmt.Errorf("invalid payload type for switch task")
+	}
+	casesJSON, err := json.Marshal(switchPayload.Cases)
+	if err != nil {
+		return fmt.Errorf("failed to marshal switch cases: %w", err)
+	}
+	query := `
+        INSERT INTO switch_payload (task_id, cases, default_next)
+        VALUES (?, ?, ?)`
+	_, err = tx.Exec(query, task.ID, string(casesJSON), switchPayload.Default)
+	if err != nil {
+		return fmt.Errorf("failed to insert switch payload: %w", err)
+	}
+	return nil
+}
+
 func (r *SQLiteRepo) insertHTTPAuth(tx *sql.Tx, taskID string, auth domain.HTTPAuthType) error {
 	authType := auth.Type()
 	authDataJSON, err := json.Marshal(auth)
@@ -334,18 +841,31 @@ func (r *SQLiteRepo) createTables() error {
 		id TEXT PRIMARY KEY,
 		name TEXT NOT NULL,
 		description TEXT,
-		status TEXT NOT NULL,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	);
+	CREATE TABLE IF NOT EXISTS workflow_input (
+        workflow_id TEXT NOT NULL,
+        name TEXT NOT NULL,
+        type TEXT NOT NULL,
+        required BOOLEAN NOT NULL DEFAULT FALSE,
+        default_value TEXT, -- JSON encoded default value
+        description TEXT,
+        position INTEGER NOT NULL,
+        PRIMARY KEY (workflow_id, name),
+        FOREIGN KEY (workflow_id) REFERENCES workflow(id) ON DELETE CASCADE
+    );
 	CREATE TABLE IF NOT EXISTS task (
         id TEXT PRIMARY KEY,
         name TEXT NOT NULL,
         type TEXT NOT NULL,
-        status TEXT NOT NULL,
         retries INTEGER DEFAULT 0,
-        retry_delay INTEGER DEFAULT 0,
+        retry_delay_ms INTEGER NOT NULL DEFAULT 0,
         condition TEXT,
+        join_mode TEXT NOT NULL DEFAULT 'ALL',
+        join_quorum INTEGER NOT NULL DEFAULT 0, -- only for QUORUM joins
+        join_cancel_remaining BOOLEAN NOT NULL DEFAULT 0,
+        failure_policy TEXT NOT NULL DEFAULT 'FAIL_WORKFLOW',
         workflow_id TEXT NOT NULL,
         created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
         updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
@@ -354,9 +874,16 @@ func (r *SQLiteRepo) createTables() error {
 	CREATE TABLE IF NOT EXISTS task_next (
         task_id TEXT NOT NULL,
         next_task_id TEXT NOT NULL,
+        on_failure BOOLEAN NOT NULL DEFAULT 0, -- runs only when the task failed
         PRIMARY KEY (task_id, next_task_id),
         FOREIGN KEY (task_id) REFERENCES task(id) ON DELETE CASCADE,
         FOREIGN KEY (next_task_id) REFERENCES task(id) ON DELETE CASCADE
+    );
+	CREATE TABLE IF NOT EXISTS task_compensation (
+        task_id TEXT PRIMARY KEY,
+        compensation_task_id TEXT NOT NULL, -- not part of the graph, runs when the workflow fails or is cancelled
+        FOREIGN KEY (task_id) REFERENCES task(id) ON DELETE CASCADE,
+        FOREIGN KEY (compensation_task_id) REFERENCES task(id) ON DELETE CASCADE
     );
 	CREATE TABLE IF NOT EXISTS log_payload (
         task_id TEXT PRIMARY KEY,
@@ -381,6 +908,147 @@ func (r *SQLiteRepo) createTables() error {
         auth_type TEXT NOT NULL, -- 'basic', 'bearer', 'apikey'
         auth_data TEXT NOT NULL, -- JSON object containing auth details
         FOREIGN KEY (task_id) REFERENCES task(id) ON DELETE CASCADE
+    );
+	CREATE TABLE IF NOT EXISTS shell_payload (
+        task_id TEXT PRIMARY KEY,
+        command TEXT NOT NULL,
+        args TEXT NOT NULL, -- JSON array
+        working_dir TEXT,
+        env TEXT NOT NULL, -- JSON object for environment variables
+        stdin TEXT,
+        timeout_ms INTEGER NOT NULL DEFAULT 0,
+        max_output_size INTEGER NOT NULL,
+        cpu_time_ms INTEGER NOT NULL DEFAULT 0, -- zero values mean no limit
+        memory_bytes INTEGER NOT NULL DEFAULT 0,
+        open_files INTEGER NOT NULL DEFAULT 0,
+        run_as_user TEXT,
+        new_namespaces BOOLEAN NOT NULL DEFAULT FALSE,
+        FOREIGN KEY (task_id) REFERENCES task(id) ON DELETE CASCADE
+    );
+	CREATE TABLE IF NOT EXISTS delay_payload (
+        task_id TEXT PRIMARY KEY,
+        duration_ms INTEGER NOT NULL DEFAULT 0, -- only one of duration, until and time of day is set
+        until TEXT,
+        time_of_day TEXT,
+        time_zone TEXT,
+        FOREIGN KEY (task_id) REFERENCES task(id) ON DELETE CASCADE
+    );
+	CREATE TABLE IF NOT EXISTS transform_payload (
+        task_id TEXT PRIMARY KEY,
+        query TEXT NOT NULL, -- jq query
+        FOREIGN KEY (task_id) REFERENCES task(id) ON DELETE CASCADE
+    );
+	CREATE TABLE IF NOT EXISTS subworkflow_payload (
+        task_id TEXT PRIMARY KEY,
+        workflow_id TEXT NOT NULL, -- not a foreign key, the child workflow may be removed later
+        inputs TEXT NOT NULL, -- JSON object of input name to expression
+        FOREIGN KEY (task_id) REFERENCES task(id) ON DELETE CASCADE
+    );
+	CREATE TABLE IF NOT EXISTS map_payload (
+        task_id TEXT PRIMARY KEY,
+        items TEXT NOT NULL, -- CEL expression evaluating to a list
+        task_id_to_run TEXT NOT NULL, -- task run once per item, not part of the graph
+        max_parallelism INTEGER NOT NULL,
+        failure_policy TEXT NOT NULL,
+        tolerated_failure_percent INTEGER NOT NULL DEFAULT 0,
+        FOREIGN KEY (task_id) REFERENCES task(id) ON DELETE CASCADE,
+        FOREIGN KEY (task_id_to_run) REFERENCES task(id) ON DELETE CASCADE
+    );
+	CREATE TABLE IF NOT EXISTS loop_payload (
+        task_id TEXT PRIMARY KEY,
+        task_id_to_run TEXT NOT NULL, -- task run once per iteration, not part of the graph
+        while_condition TEXT NOT NULL, -- CEL expression evaluated after every iteration
+        max_iterations INTEGER NOT NULL,
+        interval_ms INTEGER NOT NULL DEFAULT 0,
+        deadline_ms INTEGER NOT NULL DEFAULT 0, -- 0 for no deadline
+        FOREIGN KEY (task_id) REFERENCES task(id) ON DELETE CASCADE,
+        FOREIGN KEY (task_id_to_run) REFERENCES task(id) ON DELETE CASCADE
+    );
+	CREATE TABLE IF NOT EXISTS switch_payload (
+        task_id TEXT PRIMARY KEY,
+        cases TEXT NOT NULL, -- JSON encoded list of cases, in order
+        default_next TEXT NOT NULL DEFAULT '', -- name of the next task followed when no case matches
+        FOREIGN KEY (task_id) REFERENCES task(id) ON DELETE CASCADE
+    );
+	CREATE TABLE IF NOT EXISTS schedule (
+        id TEXT PRIMARY KEY,
+        workflow_id TEXT NOT NULL,
+        cron TEXT NOT NULL,
+        time_zone TEXT NOT NULL,
+        inputs TEXT, -- JSON object with the inputs of every run
+        missed_fire_policy TEXT NOT NULL,
+        paused BOOLEAN NOT NULL DEFAULT FALSE,
+        last_fire_at DATETIME,
+        created_at DATETIME NOT NULL,
+        FOREIGN KEY (workflow_id) REFERENCES workflow(id) ON DELETE CASCADE
+    );
+	CREATE TABLE IF NOT EXISTS webhook (
+        id TEXT PRIMARY KEY,
+        workflow_id TEXT NOT NULL,
+        token TEXT NOT NULL UNIQUE,
+        secret TEXT, -- HMAC key, calls are not signed when empty
+        mode TEXT NOT NULL,
+        created_at DATETIME NOT NULL,
+        FOREIGN KEY (workflow_id) REFERENCES workflow(id) ON DELETE CASCADE
+    );
+	CREATE TABLE IF NOT EXISTS completion_trigger (
+        id TEXT PRIMARY KEY,
+        workflow_id TEXT NOT NULL,
+        target_workflow_id TEXT NOT NULL,
+        on_statuses TEXT NOT NULL, -- JSON array of final statuses
+        inputs TEXT, -- JSON object of input name to expression
+        created_at DATETIME NOT NULL,
+        FOREIGN KEY (workflow_id) REFERENCES workflow(id) ON DELETE CASCADE,
+        FOREIGN KEY (target_workflow_id) REFERENCES workflow(id) ON DELETE CASCADE
+    );
+	CREATE TABLE IF NOT EXISTS file_watch (
+        id TEXT PRIMARY KEY,
+        workflow_id TEXT NOT NULL,
+        dir TEXT NOT NULL,
+        pattern TEXT NOT NULL, -- glob matched against file names
+        debounce_ms INTEGER NOT NULL,
+        archive_dir TEXT, -- files are left in place when empty
+        created_at DATETIME NOT NULL,
+        FOREIGN KEY (workflow_id) REFERENCES workflow(id) ON DELETE CASCADE
+    );
+	-- execution history is kept even after its workflow is removed
+	CREATE TABLE IF NOT EXISTS execution (
+        id TEXT PRIMARY KEY,
+        workflow_id TEXT NOT NULL,
+        status TEXT NOT NULL,
+        inputs TEXT, -- JSON object with the resolved inputs
+        error TEXT,
+        started_at DATETIME NOT NULL,
+        ended_at DATETIME,
+        triggered_by TEXT, -- execution whose completion started this one
+        trigger_chain TEXT, -- JSON array with the workflows of the triggering executions
+        parent_execution_id TEXT, -- execution whose subworkflow task started this one
+        parent_task_id TEXT,
+        depth INTEGER NOT NULL DEFAULT 0 -- subworkflow nesting level
+    );
+	CREATE INDEX IF NOT EXISTS execution_workflow_started_at ON execution (workflow_id, started_at);
+	CREATE INDEX IF NOT EXISTS execution_started_at ON execution (started_at);
+	CREATE TABLE IF NOT EXISTS execution_event (
+        execution_id TEXT NOT NULL,
+        seq INTEGER NOT NULL,
+        data TEXT NOT NULL, -- JSON encoded event
+        PRIMARY KEY (execution_id, seq),
+        FOREIGN KEY (execution_id) REFERENCES execution(id) ON DELETE CASCADE
+    );
+	CREATE TABLE IF NOT EXISTS execution_task (
+        execution_id TEXT NOT NULL,
+        task_id TEXT NOT NULL,
+        task_name TEXT NOT NULL,
+        status TEXT NOT NULL,
+        attempts INTEGER NOT NULL DEFAULT 0,
+        output TEXT, -- JSON encoded task output
+        error TEXT,
+        started_at DATETIME,
+        ended_at DATETIME,
+        wake_at DATETIME, -- when a running delay task is due
+        compensates TEXT NOT NULL DEFAULT '', -- task undone by a compensation, empty for tasks of the workflow
+        PRIMARY KEY (execution_id, task_id),
+        FOREIGN KEY (execution_id) REFERENCES execution(id) ON DELETE CASCADE
     );
 	`
 	_, err := r.db.Exec(createDbTables)
@@ -390,10 +1058,124 @@ func (r *SQLiteRepo) createTables() error {
 	return nil
 }
 
+// columnMigration adds a column that databases created by an earlier
+// version lack, CREATE TABLE IF NOT EXISTS leaves existing tables untouched
+type columnMigration struct {
+	table      string
+	column     string
+	definition string
+	// backfill fills the column from the old data right after it is added
+	backfill string
+}
+
+// columnMigrations must match the definitions in createTables
+var columnMigrations = []columnMigration{
+	// retry delays used to be stored as seconds in retry_delay
+	{table: "task", column: "retry_delay_ms", definition: "INTEGER NOT NULL DEFAULT 0",
+		backfill: "UPDATE task SET retry_delay_ms = CAST(retry_delay * 1000 AS INTEGER)"},
+	{table: "execution", column: "triggered_by", definition: "TEXT"},
+	{table: "execution", column: "trigger_chain", definition: "TEXT"},
+	{table: "shell_payload", column: "cpu_time_ms", definition: "INTEGER NOT NULL DEFAULT 0"},
+	{table: "shell_payload", column: "memory_bytes", definition: "INTEGER NOT NULL DEFAULT 0"},
+	{table: "shell_payload", column: "open_files", definition: "INTEGER NOT NULL DEFAULT 0"},
+	{table: "shell_payload", column: "run_as_user", definition: "TEXT"},
+	{table: "shell_payload", column: "new_namespaces", definition: "BOOLEAN NOT NULL DEFAULT FALSE"},
+	{table: "execution_task", column: "wake_at", definition: "DATETIME"},
+	{table: "execution", column: "parent_execution_id", definition: "TEXT"},
+	{table: "execution", column: "parent_task_id", definition: "TEXT"},
+	{table: "execution", column: "depth", definition: "INTEGER NOT NULL DEFAULT 0"},
+	{table: "task", column: "join_mode", definition: "TEXT NOT NULL DEFAULT 'ALL'"},
+	{table: "task", column: "join_quorum", definition: "INTEGER NOT NULL DEFAULT 0"},
+	{table: "task", column: "join_cancel_remaining", definition: "BOOLEAN NOT NULL DEFAULT 0"},
+	{table: "task", column: "failure_policy", definition: "TEXT NOT NULL DEFAULT 'FAIL_WORKFLOW'"},
+	{table: "task_next", column: "on_failure", definition: "BOOLEAN NOT NULL DEFAULT 0"},
+	{table: "execution_task", column: "compensates", definition: "TEXT NOT NULL DEFAULT ''"},
+}
+
+// droppedColumns are columns earlier versions created and no longer read,
+// they are dropped so inserts do not trip over their NOT NULL constraints
+var droppedColumns = []struct{ table, column string }{
+	// run state is kept per execution, not on the definition
+	{table: "workflow", column: "status"},
+	{table: "task", column: "status"},
+}
+
+// migrate adds the missing columns and drops the removed ones, it is a no-op
+// on up to date databases
+func (r *SQLiteRepo) migrate() error {
+	for _, m := range columnMigrations {
+		exists, err := r.hasColumn(m.table, m.column)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		if err := r.addColumn(m); err != nil {
+			return fmt.Errorf("failed to add column %s to table %s: %w", m.column, m.table, err)
+		}
+	}
+	for _, d := range droppedColumns {
+		exists, err := r.hasColumn(d.table, d.column)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			continue
+		}
+		if _, err := r.db.Exec(fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", d.table, d.column)); err != nil {
+			return fmt.Errorf("failed to drop column %s from table %s: %w", d.column, d.table, err)
+		}
+	}
+	return nil
+}
+
+// addColumn adds the column and backfills it in one transaction, so an
+// interrupted migration runs again as a whole
+func (r *SQLiteRepo) addColumn(m columnMigration) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	query := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", m.table, m.column, m.definition)
+	if _, err := tx.Exec(query); err != nil {
+		return err
+	}
+	if m.backfill != "" {
+		if _, err := tx.Exec(m.backfill); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *SQLiteRepo) hasColumn(table, column string) (bool, error) {
+	rows, err := r.db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, fmt.Errorf("failed to query columns of table %s: %w", table, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			cid, notNull, pk int
+			name, colType    string
+			defaultValue     sql.NullString
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return false, fmt.Errorf("failed to scan column of table %s: %w", table, err)
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
 func (r *SQLiteRepo) loadTaskRelationships(tasksMap map[string]*domain.Task, workflowID string) error {
 	// get all relationships for this workflow
 	query := `
-		SELECT tn.task_id, tn.next_task_id
+		SELECT tn.task_id, tn.next_task_id, tn.on_failure
 		FROM task_next tn
 		INNER JOIN task t ON tn.task_id = t.id
 		WHERE t.workflow_id = ?`
@@ -404,12 +1186,18 @@ func (r *SQLiteRepo) loadTaskRelationships(tasksMap map[string]*domain.Task, wor
 	defer rows.Close()
 	for rows.Next() {
 		var taskID, nextTaskID string
-		if err := rows.Scan(&taskID, &nextTaskID); err != nil {
+		var onFailure bool
+		if err := rows.Scan(&taskID, &nextTaskID, &onFailure); err != nil {
 			return fmt.Errorf("failed to scan task relationship: %w", err)
 		}
 		task, taskExists := tasksMap[taskID]
 		nextTask, nextExists := tasksMap[nextTaskID]
-		if taskExists && nextExists {
+		if !taskExists || !nextExists {
+			continue
+		}
+		if onFailure {
+			task.OnFailure = nextTask
+		} else {
 			task.Next = append(task.Next, nextTask)
 		}
 	}
@@ -445,9 +1233,19 @@ func (r *SQLiteRepo) findRootTasks(tasksMap map[string]*domain.Task) []*domain.T
 	// find tasks that are not referenced as 'next' by any other task
 	referencedTasks := make(map[string]bool)
 	for _, task := range tasksMap {
-		for _, nextTask := range task.Next {
+		for _, nextTask := range task.Successors() {
 			referencedTasks[nextTask.ID] = true
 		}
+		// tasks run by maps and loops and compensations are not part of the graph
+		switch p := task.Payload.(type) {
+		case *domain.MapPayload:
+			referencedTasks[p.Task.ID] = true
+		case *domain.LoopPayload:
+			referencedTasks[p.Task.ID] = true
+		}
+		if task.Compensation != nil {
+			referencedTasks[task.Compensation.ID] = true
+		}
 	}
 	var rootTasks []*domain.Task
 	for _, task := range tasksMap {
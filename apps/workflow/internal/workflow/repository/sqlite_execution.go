@@ -0,0 +1,347 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/domain"
+)
+
+func (r *SQLiteRepo) CreateExecution(e *domain.Execution) error {
+	inputsJSON, err := json.Marshal(e.Inputs)
+	if err != nil {
+		return fmt.Errorf("failed to marshal inputs: %w", err)
+	}
+	chainJSON, err := json.Marshal(e.TriggerChain)
+	if err != nil {
+		return fmt.Errorf("failed to marshal trigger chain: %w", err)
+	}
+	// start transaction
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+	query := `
+		INSERT INTO execution (id, workflow_id, status, inputs, error, started_at, ended_at,
+			triggered_by, trigger_chain, parent_execution_id, parent_task_id, depth)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err = tx.Exec(query, e.ID, e.WorkflowID, e.Status, string(inputsJSON), e.Error,
+		e.StartedAt.UTC(), nullTime(e.EndedAt), e.TriggeredBy, string(chainJSON),
+		e.ParentExecutionID, e.ParentTaskID, e.Depth)
+	if err != nil {
+		return fmt.Errorf("failed to insert execution: %w", err)
+	}
+	for _, t := range e.Tasks {
+		if err := r.upsertTaskExecution(tx, e.ID, t); err != nil {
+			return err
+		}
+	}
+	for _, t := range e.Compensations {
+		if err := r.upsertTaskExecution(tx, e.ID, t); err != nil {
+			return err
+		}
+	}
+	// commit transaction
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+func (r *SQLiteRepo) UpdateExecution(e *domain.Execution) error {
+	query := `
+		UPDATE execution
+		SET status = ?, error = ?, ended_at = ?
+		WHERE id = ?`
+	result, err := r.db.Exec(query, e.Status, e.Error, nullTime(e.EndedAt), e.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update execution: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("execution with id %s not found for update", e.ID)
+	}
+	return nil
+}
+
+func (r *SQLiteRepo) UpdateTaskExecution(executionID string, t *domain.TaskExecution) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+	if err := r.upsertTaskExecution(tx, executionID, t); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+func (r *SQLiteRepo) upsertTaskExecution(tx *sql.Tx, executionID string, t *domain.TaskExecution) error {
+	var outputJSON sql.NullString
+	if t.Output != nil {
+		b, err := json.Marshal(t.Output)
+		if err != nil {
+			return fmt.Errorf("failed to marshal output of task %s: %w", t.TaskID, err)
+		}
+		outputJSON = sql.NullString{String: string(b), Valid: true}
+	}
+	query := `
+		INSERT INTO execution_task (execution_id, task_id, task_name, status, attempts,
+			output, error, started_at, ended_at, wake_at, compensates)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (execution_id, task_id) DO UPDATE SET
+			status = excluded.status,
+			attempts = excluded.attempts,
+			output = excluded.output,
+			error = excluded.error,
+			started_at = excluded.started_at,
+			ended_at = excluded.ended_at,
+			wake_at = excluded.wake_at`
+	_, err := tx.Exec(query, executionID, t.TaskID, t.TaskName, t.Status, t.Attempts,
+		outputJSON, t.Error, nullTime(t.StartedAt), nullTime(t.EndedAt), nullTime(t.WakeAt), t.Compensates)
+	if err != nil {
+		return fmt.Errorf("failed to upsert task execution %s: %w", t.TaskID, err)
+	}
+	return nil
+}
+
+func (r *SQLiteRepo) GetExecution(id string) (*domain.Execution, error) {
+	query := `
+		SELECT id, workflow_id, status, inputs, error, started_at, ended_at, triggered_by, trigger_chain,
+			parent_execution_id, parent_task_id, depth
+		FROM execution
+		WHERE id = ?`
+	e, err := scanExecution(r.db.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("execution with id %s not found", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := r.loadTaskExecutions(map[string]*domain.Execution{e.ID: e}); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (r *SQLiteRepo) ListExecutions(f domain.ExecutionFilter) ([]*domain.Execution, string, error) {
+	offset, err := domain.ParsePageToken(f.PageToken)
+	if err != nil {
+		return nil, "", err
+	}
+	pageSize := f.PageSize
+	if pageSize <= 0 {
+		pageSize = domain.ExecutionDefaultPageSize
+	}
+
+	var conditions []string
+	var args []interface{}
+	if f.WorkflowID != "" {
+		conditions = append(conditions, "workflow_id = ?")
+		args = append(args, f.WorkflowID)
+	}
+	if f.Status != "" {
+		conditions = append(conditions, "status = ?")
+		args = append(args, f.Status)
+	}
+	if !f.StartedAfter.IsZero() {
+		conditions = append(conditions, "started_at >= ?")
+		args = append(args, f.StartedAfter.UTC())
+	}
+	if !f.StartedBefore.IsZero() {
+		conditions = append(conditions, "started_at < ?")
+		args = append(args, f.StartedBefore.UTC())
+	}
+	query := `
+		SELECT id, workflow_id, status, inputs, error, started_at, ended_at, triggered_by, trigger_chain,
+			parent_execution_id, parent_task_id, depth
+		FROM execution`
+	if len(conditions) > 0 {
+		query += "\n\t\tWHERE " + strings.Join(conditions, " AND ")
+	}
+	// fetch one extra row to know if there is a next page
+	query += `
+		ORDER BY started_at DESC, id
+		LIMIT ? OFFSET ?`
+	args = append(args, pageSize+1, offset)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to query executions: %w", err)
+	}
+	defer rows.Close()
+	executions := []*domain.Execution{}
+	byID := make(map[string]*domain.Execution)
+	for rows.Next() {
+		e, err := scanExecution(rows)
+		if err != nil {
+			return nil, "", err
+		}
+		executions = append(executions, e)
+		byID[e.ID] = e
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", fmt.Errorf("error iterating rows: %w", err)
+	}
+	more := len(executions) > pageSize
+	if more {
+		delete(byID, executions[pageSize].ID)
+		executions = executions[:pageSize]
+	}
+	if err := r.loadTaskExecutions(byID); err != nil {
+		return nil, "", err
+	}
+	return executions, domain.NextPageToken(offset, pageSize, len(executions), more), nil
+}
+
+func (r *SQLiteRepo) loadTaskExecutions(executions map[string]*domain.Execution) error {
+	if len(executions) == 0 {
+		return nil
+	}
+	ids := make([]interface{}, 0, len(executions))
+	for id := range executions {
+		ids = append(ids, id)
+	}
+	query := `
+		SELECT execution_id, task_id, task_name, status, attempts, output, error, started_at, ended_at, wake_at,
+			compensates
+		FROM execution_task
+		WHERE execution_id IN (?` + strings.Repeat(", ?", len(ids)-1) + `)`
+	rows, err := r.db.Query(query, ids...)
+	if err != nil {
+		return fmt.Errorf("failed to query task executions: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			executionID          string
+			t                    domain.TaskExecution
+			status               string
+			outputJSON, errorMsg sql.NullString
+			startedAt, endedAt   sql.NullTime
+			wakeAt               sql.NullTime
+		)
+		if err := rows.Scan(&executionID, &t.TaskID, &t.TaskName, &status, &t.Attempts,
+			&outputJSON, &errorMsg, &startedAt, &endedAt, &wakeAt, &t.Compensates); err != nil {
+			return fmt.Errorf("failed to scan task execution: %w", err)
+		}
+		t.Status = domain.TaskStatus(status)
+		t.Error = errorMsg.String
+		t.StartedAt = startedAt.Time
+		t.EndedAt = endedAt.Time
+		t.WakeAt = wakeAt.Time
+		if outputJSON.Valid {
+			if err := json.Unmarshal([]byte(outputJSON.String), &t.Output); err != nil {
+				return fmt.Errorf("failed to unmarshal output of task %s: %w", t.TaskID, err)
+			}
+		}
+		if t.Compensates != "" {
+			executions[executionID].Compensations[t.Compensates] = &t
+			continue
+		}
+		executions[executionID].Tasks[t.TaskID] = &t
+	}
+	return rows.Err()
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanExecution(row rowScanner) (*domain.Execution, error) {
+	var (
+		e                    domain.Execution
+		status               string
+		inputsJSON, errorMsg sql.NullString
+		endedAt              sql.NullTime
+		triggeredBy          sql.NullString
+		chainJSON            sql.NullString
+		parentExecutionID    sql.NullString
+		parentTaskID         sql.NullString
+	)
+	if err := row.Scan(&e.ID, &e.WorkflowID, &status, &inputsJSON, &errorMsg, &e.StartedAt, &endedAt,
+		&triggeredBy, &chainJSON, &parentExecutionID, &parentTaskID, &e.Depth); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to scan execution: %w", err)
+	}
+	e.Status = domain.WorklowStatus(status)
+	e.Error = errorMsg.String
+	e.EndedAt = endedAt.Time
+	e.TriggeredBy = triggeredBy.String
+	e.ParentExecutionID = parentExecutionID.String
+	e.ParentTaskID = parentTaskID.String
+	e.Tasks = make(map[string]*domain.TaskExecution)
+	e.Compensations = make(map[string]*domain.TaskExecution)
+	if chainJSON.Valid && chainJSON.String != "" {
+		if err := json.Unmarshal([]byte(chainJSON.String), &e.TriggerChain); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal trigger chain: %w", err)
+		}
+	}
+	if inputsJSON.Valid && inputsJSON.String != "" {
+		if err := json.Unmarshal([]byte(inputsJSON.String), &e.Inputs); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal inputs: %w", err)
+		}
+	}
+	return &e, nil
+}
+
+// nullTime stores zero times as NULL and everything else in UTC so the
+// stored values sort chronologically
+func nullTime(t time.Time) sql.NullTime {
+	if t.IsZero() {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: t.UTC(), Valid: true}
+}
+
+func (r *SQLiteRepo) AppendExecutionEvent(ev *domain.ExecutionEvent) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+	query := `
+		INSERT INTO execution_event (execution_id, seq, data)
+		VALUES (?, ?, ?)`
+	if _, err := r.db.Exec(query, ev.ExecutionID, ev.Seq, string(data)); err != nil {
+		return fmt.Errorf("failed to insert event: %w", err)
+	}
+	return nil
+}
+
+func (r *SQLiteRepo) ListExecutionEvents(executionID string, fromSeq int64) ([]*domain.ExecutionEvent, error) {
+	query := `
+		SELECT data
+		FROM execution_event
+		WHERE execution_id = ? AND seq >= ?
+		ORDER BY seq`
+	rows, err := r.db.Query(query, executionID, fromSeq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query events: %w", err)
+	}
+	defer rows.Close()
+	events := []*domain.ExecutionEvent{}
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("failed to scan event: %w", err)
+		}
+		var ev domain.ExecutionEvent
+		if err := json.Unmarshal([]byte(data), &ev); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal event: %w", err)
+		}
+		events = append(events, &ev)
+	}
+	return events, rows.Err()
+}
@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/domain"
+)
+
+func (r *SQLiteRepo) CreateFileWatch(fw *domain.FileWatch) error {
+	query := `
+		INSERT INTO file_watch (id, workflow_id, dir, pattern, debounce_ms, archive_dir, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`
+	_, err := r.db.Exec(query, fw.ID, fw.WorkflowID, fw.Dir, fw.Pattern, fw.Debounce.Milliseconds(),
+		fw.ArchiveDir, fw.CreatedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to insert file watch: %w", err)
+	}
+	return nil
+}
+
+func (r *SQLiteRepo) ListFileWatches(workflowID string) ([]*domain.FileWatch, error) {
+	query := `
+		SELECT id, workflow_id, dir, pattern, debounce_ms, archive_dir, created_at
+		FROM file_watch
+		WHERE ? = '' OR workflow_id = ?
+		ORDER BY created_at, id`
+	rows, err := r.db.Query(query, workflowID, workflowID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query file watches: %w", err)
+	}
+	defer rows.Close()
+	watches := []*domain.FileWatch{}
+	for rows.Next() {
+		var (
+			fw         domain.FileWatch
+			debounceMs int64
+			archiveDir sql.NullString
+		)
+		if err := rows.Scan(&fw.ID, &fw.WorkflowID, &fw.Dir, &fw.Pattern, &debounceMs, &archiveDir, &fw.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan file watch: %w", err)
+		}
+		fw.Debounce = time.Duration(debounceMs) * time.Millisecond
+		fw.ArchiveDir = archiveDir.String
+		watches = append(watches, &fw)
+	}
+	return watches, rows.Err()
+}
+
+func (r *SQLiteRepo) DeleteFileWatch(id string) error {
+	result, err := r.db.Exec(`DELETE FROM file_watch WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete file watch: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("file watch with id %s not found", id)
+	}
+	return nil
+}
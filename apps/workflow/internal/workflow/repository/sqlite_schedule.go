@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/domain"
+)
+
+func (r *SQLiteRepo) CreateSchedule(s *domain.Schedule) error {
+	inputsJSON, err := json.Marshal(s.Inputs)
+	if err != nil {
+		return fmt.Errorf("failed to marshal inputs: %w", err)
+	}
+	query := `
+		INSERT INTO schedule (id, workflow_id, cron, time_zone, inputs, missed_fire_policy,
+			paused, last_fire_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err = r.db.Exec(query, s.ID, s.WorkflowID, s.Cron, s.TimeZone, string(inputsJSON),
+		s.MissedFirePolicy, s.Paused, nullTime(s.LastFireAt), s.CreatedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to insert schedule: %w", err)
+	}
+	return nil
+}
+
+func (r *SQLiteRepo) GetSchedule(id string) (*domain.Schedule, error) {
+	query := `
+		SELECT id, workflow_id, cron, time_zone, inputs, missed_fire_policy, paused, last_fire_at, created_at
+		FROM schedule
+		WHERE id = ?`
+	s, err := scanSchedule(r.db.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("schedule with id %s not found", id)
+	}
+	return s, err
+}
+
+func (r *SQLiteRepo) ListSchedules(workflowID string) ([]*domain.Schedule, error) {
+	query := `
+		SELECT id, workflow_id, cron, time_zone, inputs, missed_fire_policy, paused, last_fire_at, created_at
+		FROM schedule
+		WHERE ? = '' OR workflow_id = ?
+		ORDER BY created_at, id`
+	rows, err := r.db.Query(query, workflowID, workflowID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query schedules: %w", err)
+	}
+	defer rows.Close()
+	schedules := []*domain.Schedule{}
+	for rows.Next() {
+		s, err := scanSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, s)
+	}
+	return schedules, rows.Err()
+}
+
+func (r *SQLiteRepo) SetSchedulePaused(id string, paused bool) error {
+	return r.updateSchedule(id, `UPDATE schedule SET paused = ? WHERE id = ?`, paused, id)
+}
+
+func (r *SQLiteRepo) RecordScheduleFire(id string, at time.Time) error {
+	return r.updateSchedule(id, `UPDATE schedule SET last_fire_at = ? WHERE id = ?`, nullTime(at), id)
+}
+
+func (r *SQLiteRepo) DeleteSchedule(id string) error {
+	return r.updateSchedule(id, `DELETE FROM schedule WHERE id = ?`, id)
+}
+
+// updateSchedule runs a statement that must affect the schedule with the given id
+func (r *SQLiteRepo) updateSchedule(id, query string, args ...interface{}) error {
+	result, err := r.db.Exec(query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to update schedule: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("schedule with id %s not found", id)
+	}
+	return nil
+}
+
+func scanSchedule(row rowScanner) (*domain.Schedule, error) {
+	var (
+		s          domain.Schedule
+		policy     string
+		inputsJSON sql.NullString
+		lastFireAt sql.NullTime
+	)
+	if err := row.Scan(&s.ID, &s.WorkflowID, &s.Cron, &s.TimeZone, &inputsJSON, &policy,
+		&s.Paused, &lastFireAt, &s.CreatedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to scan schedule: %w", err)
+	}
+	s.MissedFirePolicy = domain.MissedFirePolicy(policy)
+	s.LastFireAt = lastFireAt.Time
+	if inputsJSON.Valid && inputsJSON.String != "" {
+		if err := json.Unmarshal([]byte(inputsJSON.String), &s.Inputs); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal inputs: %w", err)
+		}
+	}
+	return &s, nil
+}
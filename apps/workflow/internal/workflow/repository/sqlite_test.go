@@ -0,0 +1,454 @@
+package repository
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/domain"
+)
+
+func newTestSQLiteRepository(t *testing.T, dir string) *SQLiteRepo {
+	t.Helper()
+	repo, err := NewSQLiteRepository(dir, "test.db")
+	if err != nil {
+		t.Fatalf("failed to open repository: %v", err)
+	}
+	t.Cleanup(func() { repo.Close() })
+	return repo
+}
+
+func TestSQLiteRetryDelayRoundTrip(t *testing.T) {
+	repo := newTestSQLiteRepository(t, t.TempDir())
+
+	task, err := domain.NewTask("log", domain.TaskTypeLog, 2, 1500*time.Millisecond, "", domain.Join{}, "", &domain.LogPayload{Message: "hi"}, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+	w, err := domain.NewWorkflow("test", "", nil, []*domain.Task{task})
+	if err != nil {
+		t.Fatalf("failed to create workflow: %v", err)
+	}
+	if err := repo.Create(w); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	got, err := repo.Get(w.ID)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if d := got.Tasks[0].RetryDelay; d != 1500*time.Millisecond {
+		t.Errorf("got retry delay %v, want %v", d, 1500*time.Millisecond)
+	}
+}
+
+// openBaselineDatabase creates a database with the schema and a row of the
+// first released version, before any migration existed
+func openBaselineDatabase(t *testing.T, dir string) {
+	t.Helper()
+	db, err := sql.Open("sqlite3", dir+"/test.db")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	_, err = db.Exec(`
+	CREATE TABLE workflow (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		description TEXT,
+		status TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE task (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		type TEXT NOT NULL,
+		status TEXT NOT NULL,
+		retries INTEGER DEFAULT 0,
+		retry_delay INTEGER DEFAULT 0,
+		condition TEXT,
+		workflow_id TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE log_payload (
+		task_id TEXT PRIMARY KEY,
+		message TEXT NOT NULL
+	);
+	INSERT INTO workflow (id, name, description, status) VALUES ('w1', 'test', '', 'IDLE');
+	INSERT INTO task (id, name, type, status, retries, retry_delay, workflow_id)
+	VALUES ('t1', 'log', 'LOG', 'PENDING', 1, 2, 'w1');
+	INSERT INTO log_payload (task_id, message) VALUES ('t1', 'hi');`)
+	if err != nil {
+		t.Fatalf("failed to create baseline schema: %v", err)
+	}
+}
+
+func TestSQLiteMigratesRetryDelay(t *testing.T) {
+	dir := t.TempDir()
+	openBaselineDatabase(t, dir)
+
+	repo := newTestSQLiteRepository(t, dir)
+	got, err := repo.Get("w1")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if d := got.Tasks[0].RetryDelay; d != 2*time.Second {
+		t.Errorf("got retry delay %v, want %v", d, 2*time.Second)
+	}
+}
+
+func TestSQLiteDropsStatusColumns(t *testing.T) {
+	dir := t.TempDir()
+	openBaselineDatabase(t, dir)
+
+	repo := newTestSQLiteRepository(t, dir)
+	for _, table := range []string{"workflow", "task"} {
+		ok, err := repo.hasColumn(table, "status")
+		if err != nil {
+			t.Fatalf("has column: %v", err)
+		}
+		if ok {
+			t.Errorf("column %s.status was not dropped", table)
+		}
+	}
+	// the NOT NULL status columns would reject new workflows
+	task, err := domain.NewTask("log", domain.TaskTypeLog, 0, 0, "", domain.Join{}, "", &domain.LogPayload{Message: "hi"}, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+	w, err := domain.NewWorkflow("test", "", nil, []*domain.Task{task})
+	if err != nil {
+		t.Fatalf("failed to create workflow: %v", err)
+	}
+	if err := repo.Create(w); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+}
+
+func TestSQLiteMigrationsAddMissingColumns(t *testing.T) {
+	dir := t.TempDir()
+	repo := newTestSQLiteRepository(t, dir)
+	// backfills read columns of older schemas and get their own tests
+	var migrations []columnMigration
+	for _, m := range columnMigrations {
+		if m.backfill == "" {
+			migrations = append(migrations, m)
+		}
+	}
+	for _, m := range migrations {
+		if _, err := repo.db.Exec("ALTER TABLE " + m.table + " DROP COLUMN " + m.column); err != nil {
+			t.Fatalf("failed to drop %s.%s: %v", m.table, m.column, err)
+		}
+	}
+	repo.Close()
+
+	repo = newTestSQLiteRepository(t, dir)
+	for _, m := range migrations {
+		ok, err := repo.hasColumn(m.table, m.column)
+		if err != nil {
+			t.Fatalf("has column: %v", err)
+		}
+		if !ok {
+			t.Errorf("column %s.%s was not added back", m.table, m.column)
+		}
+	}
+}
+
+func TestSQLiteInputsRoundTrip(t *testing.T) {
+	repo := newTestSQLiteRepository(t, t.TempDir())
+
+	var inputs []*domain.Input
+	for _, in := range []struct {
+		name         string
+		inputType    domain.InputType
+		defaultValue interface{}
+	}{
+		{"count", domain.InputTypeNumber, 3.0},
+		{"ratio", domain.InputTypeNumber, 0.5},
+		{"tags", domain.InputTypeList, []interface{}{"a"}},
+		{"name", domain.InputTypeString, nil},
+	} {
+		input, err := domain.NewInput(in.name, in.inputType, in.defaultValue == nil, in.defaultValue, "")
+		if err != nil {
+			t.Fatalf("failed to create input: %v", err)
+		}
+		inputs = append(inputs, input)
+	}
+	w, err := domain.NewWorkflow("test", "", inputs, nil)
+	if err != nil {
+		t.Fatalf("failed to create workflow: %v", err)
+	}
+	if err := repo.Create(w); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	got, err := repo.Get(w.ID)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if !reflect.DeepEqual(got.Inputs, inputs) {
+		for i := range inputs {
+			t.Errorf("input %d: got %+v, want %+v", i, got.Inputs[i], inputs[i])
+		}
+	}
+}
+
+func TestSQLiteShellPayloadRoundTrip(t *testing.T) {
+	repo := newTestSQLiteRepository(t, t.TempDir())
+
+	p, err := domain.NewShellPayload("/bin/echo", []string{"a b", "{{ inputs.x }}"}, "/tmp",
+		map[string]string{"FOO": "bar"}, "in", 3*time.Second, 1024,
+		domain.ShellLimits{CPUTime: 2 * time.Second, MemoryBytes: 64 << 20, OpenFiles: 32, User: "nobody", NewNamespaces: true})
+	if err != nil {
+		t.Fatalf("failed to create shell payload: %v", err)
+	}
+	task, err := domain.NewTask("shell", domain.TaskTypeShell, 0, 0, "", domain.Join{}, "", p, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+	w, err := domain.NewWorkflow("test", "", nil, []*domain.Task{task})
+	if err != nil {
+		t.Fatalf("failed to create workflow: %v", err)
+	}
+	if err := repo.Create(w); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	got, err := repo.Get(w.ID)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if !reflect.DeepEqual(got.Tasks[0].Payload, p) {
+		t.Errorf("got payload %+v, want %+v", got.Tasks[0].Payload, p)
+	}
+}
+
+func TestSQLiteMapPayloadRoundTrip(t *testing.T) {
+	repo := newTestSQLiteRepository(t, t.TempDir())
+
+	item, err := domain.NewTask("item", domain.TaskTypeLog, 1, time.Second, "item > 0", domain.Join{}, "", &domain.LogPayload{Message: "{{ item }}"}, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+	p, err := domain.NewMapPayload("inputs.items", item, 4, domain.MapTolerate, 30)
+	if err != nil {
+		t.Fatalf("failed to create map payload: %v", err)
+	}
+	task, err := domain.NewTask("map", domain.TaskTypeMap, 0, 0, "", domain.Join{}, "", p, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+	w, err := domain.NewWorkflow("test", "", nil, []*domain.Task{task})
+	if err != nil {
+		t.Fatalf("failed to create workflow: %v", err)
+	}
+	if err := repo.Create(w); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	got, err := repo.Get(w.ID)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	// the task of the map is stored but not returned as a root task
+	if len(got.Tasks) != 1 {
+		t.Fatalf("got %d root tasks, want 1", len(got.Tasks))
+	}
+	if !reflect.DeepEqual(got.Tasks[0].Payload, p) {
+		t.Errorf("got payload %+v, want %+v", got.Tasks[0].Payload, p)
+	}
+}
+
+func TestSQLiteLoopPayloadRoundTrip(t *testing.T) {
+	repo := newTestSQLiteRepository(t, t.TempDir())
+
+	body, err := domain.NewTask("body", domain.TaskTypeLog, 2, time.Second, "", domain.Join{}, "", &domain.LogPayload{Message: "{{ iteration }}"}, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+	p, err := domain.NewLoopPayload(body, "iteration < 5", 10, 2*time.Second, time.Minute)
+	if err != nil {
+		t.Fatalf("failed to create loop payload: %v", err)
+	}
+	task, err := domain.NewTask("loop", domain.TaskTypeLoop, 0, 0, "", domain.Join{}, "", p, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+	w, err := domain.NewWorkflow("test", "", nil, []*domain.Task{task})
+	if err != nil {
+		t.Fatalf("failed to create workflow: %v", err)
+	}
+	if err := repo.Create(w); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	got, err := repo.Get(w.ID)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if len(got.Tasks) != 1 || !reflect.DeepEqual(got.Tasks[0].Payload, p) {
+		t.Errorf("got tasks %+v, want the loop with payload %+v", got.Tasks, p)
+	}
+}
+
+func TestSQLiteSwitchPayloadRoundTrip(t *testing.T) {
+	repo := newTestSQLiteRepository(t, t.TempDir())
+
+	red, err := domain.NewTask("red", domain.TaskTypeLog, 0, 0, "", domain.Join{}, "", &domain.LogPayload{Message: "red"}, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+	other, err := domain.NewTask("other", domain.TaskTypeLog, 0, 0, "", domain.Join{}, "", &domain.LogPayload{Message: "other"}, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+	p, err := domain.NewSwitchPayload([]domain.SwitchCase{{When: `inputs.color == "red"`, Next: "red"}}, "other")
+	if err != nil {
+		t.Fatalf("failed to create switch payload: %v", err)
+	}
+	task, err := domain.NewTask("switch", domain.TaskTypeSwitch, 0, 0, "", domain.Join{}, "", p, []*domain.Task{red, other}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+	w, err := domain.NewWorkflow("test", "", nil, []*domain.Task{task})
+	if err != nil {
+		t.Fatalf("failed to create workflow: %v", err)
+	}
+	if err := repo.Create(w); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	got, err := repo.Get(w.ID)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if len(got.Tasks) != 1 || !reflect.DeepEqual(got.Tasks[0].Payload, p) {
+		t.Fatalf("got tasks %+v, want the switch with payload %+v", got.Tasks, p)
+	}
+	if len(got.Tasks[0].Next) != 2 {
+		t.Errorf("got %d next tasks, want the 2 branches", len(got.Tasks[0].Next))
+	}
+}
+
+func TestSQLiteJoinRoundTrip(t *testing.T) {
+	repo := newTestSQLiteRepository(t, t.TempDir())
+
+	j, err := domain.NewJoin(domain.JoinQuorum, 2, true)
+	if err != nil {
+		t.Fatalf("failed to create join: %v", err)
+	}
+	join, err := domain.NewTask("join", domain.TaskTypeLog, 0, 0, "", j, "", &domain.LogPayload{Message: "join"}, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+	var roots []*domain.Task
+	for _, name := range []string{"a", "b", "c"} {
+		task, err := domain.NewTask(name, domain.TaskTypeLog, 0, 0, "", domain.Join{}, "", &domain.LogPayload{Message: name}, []*domain.Task{join}, nil, nil)
+		if err != nil {
+			t.Fatalf("failed to create task: %v", err)
+		}
+		roots = append(roots, task)
+	}
+	w, err := domain.NewWorkflow("test", "", nil, roots)
+	if err != nil {
+		t.Fatalf("failed to create workflow: %v", err)
+	}
+	if err := repo.Create(w); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	got, err := repo.Get(w.ID)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if len(got.Tasks) != 3 {
+		t.Fatalf("got %d root tasks, want 3", len(got.Tasks))
+	}
+	// the join is loaded once and shared by its predecessors
+	shared := got.Tasks[0].Next[0]
+	for _, task := range got.Tasks[1:] {
+		if len(task.Next) != 1 || task.Next[0] != shared {
+			t.Errorf("task %s does not lead to the shared join", task.Name)
+		}
+	}
+	if shared.Join != j {
+		t.Errorf("got join %+v, want %+v", shared.Join, j)
+	}
+}
+
+func TestSQLiteFailurePolicyRoundTrip(t *testing.T) {
+	repo := newTestSQLiteRepository(t, t.TempDir())
+
+	handler, err := domain.NewTask("handler", domain.TaskTypeLog, 0, 0, "", domain.Join{}, "", &domain.LogPayload{Message: "handler"}, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+	next, err := domain.NewTask("next", domain.TaskTypeLog, 0, 0, "", domain.Join{}, "", &domain.LogPayload{Message: "next"}, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+	task, err := domain.NewTask("task", domain.TaskTypeLog, 0, 0, "", domain.Join{}, domain.TaskContinue,
+		&domain.LogPayload{Message: "task"}, []*domain.Task{next}, handler, nil)
+	if err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+	w, err := domain.NewWorkflow("test", "", nil, []*domain.Task{task})
+	if err != nil {
+		t.Fatalf("failed to create workflow: %v", err)
+	}
+	if err := repo.Create(w); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	got, err := repo.Get(w.ID)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	gt := got.Tasks[0]
+	if gt.FailurePolicy != domain.TaskContinue {
+		t.Errorf("got failure policy %s, want %s", gt.FailurePolicy, domain.TaskContinue)
+	}
+	// the on failure task is stored as a next task but loaded apart
+	if len(gt.Next) != 1 || gt.Next[0].ID != next.ID {
+		t.Errorf("got next tasks %v, want only %s", gt.Next, next.Name)
+	}
+	if gt.OnFailure == nil || gt.OnFailure.ID != handler.ID {
+		t.Errorf("got on failure task %v, want %s", gt.OnFailure, handler.Name)
+	}
+}
+
+func TestSQLiteCompensationRoundTrip(t *testing.T) {
+	repo := newTestSQLiteRepository(t, t.TempDir())
+
+	undo, err := domain.NewTask("undo", domain.TaskTypeLog, 0, 0, "", domain.Join{}, "", &domain.LogPayload{Message: "undo"}, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+	task, err := domain.NewTask("task", domain.TaskTypeLog, 0, 0, "", domain.Join{}, "",
+		&domain.LogPayload{Message: "task"}, nil, nil, undo)
+	if err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+	w, err := domain.NewWorkflow("test", "", nil, []*domain.Task{task})
+	if err != nil {
+		t.Fatalf("failed to create workflow: %v", err)
+	}
+	if err := repo.Create(w); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	got, err := repo.Get(w.ID)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	gt := got.Tasks[0]
+	if len(gt.Next) != 0 {
+		t.Errorf("got next tasks %v, want none", gt.Next)
+	}
+	if gt.Compensation == nil || gt.Compensation.ID != undo.ID || gt.Compensation.Name != undo.Name {
+		t.Errorf("got compensation %v, want %s", gt.Compensation, undo.Name)
+	}
+}
@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/domain"
+)
+
+func (r *SQLiteRepo) CreateTrigger(t *domain.CompletionTrigger) error {
+	onJSON, err := json.Marshal(t.On)
+	if err != nil {
+		return fmt.Errorf("failed to marshal statuses: %w", err)
+	}
+	inputsJSON, err := json.Marshal(t.Inputs)
+	if err != nil {
+		return fmt.Errorf("failed to marshal inputs: %w", err)
+	}
+	query := `
+		INSERT INTO completion_trigger (id, workflow_id, target_workflow_id, on_statuses, inputs, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)`
+	_, err = r.db.Exec(query, t.ID, t.WorkflowID, t.TargetWorkflowID, string(onJSON), string(inputsJSON),
+		t.CreatedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to insert trigger: %w", err)
+	}
+	return nil
+}
+
+func (r *SQLiteRepo) ListTriggers(workflowID string) ([]*domain.CompletionTrigger, error) {
+	query := `
+		SELECT id, workflow_id, target_workflow_id, on_statuses, inputs, created_at
+		FROM completion_trigger
+		WHERE ? = '' OR workflow_id = ?
+		ORDER BY created_at, id`
+	rows, err := r.db.Query(query, workflowID, workflowID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query triggers: %w", err)
+	}
+	defer rows.Close()
+	triggers := []*domain.CompletionTrigger{}
+	for rows.Next() {
+		var (
+			t          domain.CompletionTrigger
+			onJSON     string
+			inputsJSON sql.NullString
+		)
+		if err := rows.Scan(&t.ID, &t.WorkflowID, &t.TargetWorkflowID, &onJSON, &inputsJSON, &t.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan trigger: %w", err)
+		}
+		if err := json.Unmarshal([]byte(onJSON), &t.On); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal statuses: %w", err)
+		}
+		if inputsJSON.Valid && inputsJSON.String != "" {
+			if err := json.Unmarshal([]byte(inputsJSON.String), &t.Inputs); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal inputs: %w", err)
+			}
+		}
+		triggers = append(triggers, &t)
+	}
+	return triggers, rows.Err()
+}
+
+func (r *SQLiteRepo) DeleteTrigger(id string) error {
+	result, err := r.db.Exec(`DELETE FROM completion_trigger WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete trigger: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("trigger with id %s not found", id)
+	}
+	return nil
+}
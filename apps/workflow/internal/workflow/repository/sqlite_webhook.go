@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/domain"
+)
+
+func (r *SQLiteRepo) CreateWebhook(w *domain.Webhook) error {
+	query := `
+		INSERT INTO webhook (id, workflow_id, token, secret, mode, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)`
+	_, err := r.db.Exec(query, w.ID, w.WorkflowID, w.Token, w.Secret, w.Mode, w.CreatedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to insert webhook: %w", err)
+	}
+	return nil
+}
+
+func (r *SQLiteRepo) ListWebhooks(workflowID string) ([]*domain.Webhook, error) {
+	query := `
+		SELECT id, workflow_id, token, secret, mode, created_at
+		FROM webhook
+		WHERE workflow_id = ?
+		ORDER BY created_at, id`
+	rows, err := r.db.Query(query, workflowID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query webhooks: %w", err)
+	}
+	defer rows.Close()
+	webhooks := []*domain.Webhook{}
+	for rows.Next() {
+		var (
+			w      domain.Webhook
+			mode   string
+			secret sql.NullString
+		)
+		if err := rows.Scan(&w.ID, &w.WorkflowID, &w.Token, &secret, &mode, &w.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook: %w", err)
+		}
+		w.Secret = secret.String
+		w.Mode = domain.WebhookMode(mode)
+		webhooks = append(webhooks, &w)
+	}
+	return webhooks, rows.Err()
+}
+
+func (r *SQLiteRepo) DeleteWebhook(id string) error {
+	result, err := r.db.Exec(`DELETE FROM webhook WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("webhook with id %s not found", id)
+	}
+	return nil
+}
@@ -10,7 +10,6 @@ var (
 		ID:         "task-d",
 		Name:       "Shared Task D",
 		Type:       domain.TaskTypeLog,
-		Status:     domain.TaskStatusPending,
 		Retries:    0,
 		RetryDelay: 0,
 		Payload: &domain.LogPayload{
@@ -21,7 +20,6 @@ var (
 				ID:         "task-e",
 				Name:       "Task E",
 				Type:       domain.TaskTypeLog,
-				Status:     domain.TaskStatusPending,
 				Retries:    0,
 				RetryDelay: 0,
 				Payload: &domain.LogPayload{
@@ -36,13 +34,11 @@ var (
 			ID:          "fan-in-test",
 			Name:        "Fan-In Test",
 			Description: "3 root tasks → 1 shared task",
-			Status:      domain.WorkflowStatusIDLE,
 			Tasks: []*domain.Task{
 				{
 					ID:         "task-a",
 					Name:       "Root Task A",
 					Type:       domain.TaskTypeLog,
-					Status:     domain.TaskStatusPending,
 					Retries:    0,
 					RetryDelay: 0,
 					Payload: &domain.LogPayload{
@@ -54,7 +50,6 @@ var (
 					ID:         "task-b",
 					Name:       "Root Task B",
 					Type:       domain.TaskTypeLog,
-					Status:     domain.TaskStatusPending,
 					Retries:    0,
 					RetryDelay: 0,
 					Payload: &domain.LogPayload{
@@ -66,7 +61,6 @@ var (
 					ID:         "task-c",
 					Name:       "Root Task C",
 					Type:       domain.TaskTypeLog,
-					Status:     domain.TaskStatusPending,
 					Retries:    0,
 					RetryDelay: 0,
 					Payload: &domain.LogPayload{
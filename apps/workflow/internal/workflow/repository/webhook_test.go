@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/domain"
+)
+
+func TestWebhooks(t *testing.T) {
+	for name, r := range workflowRepositories(t) {
+		hr := r.(domain.WebhookRepository)
+		t.Run(name, func(t *testing.T) {
+			w := newLogWorkflow(t, "test", "a")
+			if err := r.Create(w); err != nil {
+				t.Fatalf("create: %v", err)
+			}
+			wh, err := domain.NewWebhook(w.ID, domain.WebhookModeSync, "0123456789abcdef")
+			if err != nil {
+				t.Fatalf("new webhook: %v", err)
+			}
+			if err := hr.CreateWebhook(wh); err != nil {
+				t.Fatalf("create webhook: %v", err)
+			}
+
+			webhooks, err := hr.ListWebhooks(w.ID)
+			if err != nil || len(webhooks) != 1 {
+				t.Fatalf("got %d webhooks, %v, want 1", len(webhooks), err)
+			}
+			got := webhooks[0]
+			if got.ID != wh.ID || got.Token != wh.Token || got.Secret != wh.Secret || got.Mode != wh.Mode {
+				t.Errorf("got webhook %+v, want %+v", got, wh)
+			}
+
+			if err := hr.DeleteWebhook(wh.ID); err != nil {
+				t.Fatalf("delete webhook: %v", err)
+			}
+			if webhooks, err := hr.ListWebhooks(w.ID); err != nil || len(webhooks) != 0 {
+				t.Errorf("got %d webhooks after deleting, %v, want none", len(webhooks), err)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/domain"
+	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/repository/storage"
+)
+
+// workflowRepositories returns every WorkflowRepository implementation,
+// without the workflows the memory repository is seeded with
+func workflowRepositories(t *testing.T) map[string]domain.WorkflowRepository {
+	memory := NewMemoryRepository()
+	for id := range storage.DefaultWorkflows {
+		if err := memory.Delete(id); err != nil {
+			t.Fatalf("delete: %v", err)
+		}
+	}
+	return map[string]domain.WorkflowRepository{
+		"memory": memory,
+		"sqlite": newTestSQLiteRepository(t, t.TempDir()),
+	}
+}
+
+// newLogWorkflow returns a workflow with a chain of log tasks, one per message
+func newLogWorkflow(t *testing.T, name string, messages ...string) *domain.Workflow {
+	t.Helper()
+	var next []*domain.Task
+	for i := len(messages) - 1; i >= 0; i-- {
+		task, err := domain.NewTask(messages[i], domain.TaskTypeLog, 0, 0, "", domain.Join{}, "", &domain.LogPayload{Message: messages[i]}, next, nil, nil)
+		if err != nil {
+			t.Fatalf("failed to create task: %v", err)
+		}
+		next = []*domain.Task{task}
+	}
+	w, err := domain.NewWorkflow(name, "", nil, next)
+	if err != nil {
+		t.Fatalf("failed to create workflow: %v", err)
+	}
+	return w
+}
+
+// messages returns the messages of a chain of log tasks
+func messages(w *domain.Workflow) string {
+	var out []string
+	for tasks := w.Tasks; len(tasks) > 0; tasks = tasks[0].Next {
+		out = append(out, tasks[0].Payload.(*domain.LogPayload).Message)
+	}
+	return fmt.Sprint(out)
+}
+
+func TestWorkflowCRUD(t *testing.T) {
+	for name, r := range workflowRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			w := newLogWorkflow(t, "test", "a", "b")
+			if err := r.Create(w); err != nil {
+				t.Fatalf("create: %v", err)
+			}
+
+			// the update keeps the first task and replaces the rest of the graph
+			updated := newLogWorkflow(t, "renamed", "c")
+			updated.ID = w.ID
+			w.Tasks[0].Next = updated.Tasks
+			updated.Tasks = w.Tasks
+			updated.Description = "new"
+			if err := r.Update(updated); err != nil {
+				t.Fatalf("update: %v", err)
+			}
+			got, err := r.Get(w.ID)
+			if err != nil {
+				t.Fatalf("get: %v", err)
+			}
+			if got.Name != "renamed" || got.Description != "new" || messages(got) != "[a c]" {
+				t.Errorf("got workflow %s %q with tasks %s, want renamed \"new\" with [a c]", got.Name, got.Description, messages(got))
+			}
+
+			if err := r.Delete(w.ID); err != nil {
+				t.Fatalf("delete: %v", err)
+			}
+			if _, err := r.Get(w.ID); err == nil {
+				t.Errorf("expected a deleted workflow to be gone")
+			}
+			if err := r.Delete(w.ID); err == nil {
+				t.Errorf("expected deleting a missing workflow to fail")
+			}
+			if err := r.Update(updated); err == nil {
+				t.Errorf("expected updating a missing workflow to fail")
+			}
+		})
+	}
+}
+
+func TestListWorkflows(t *testing.T) {
+	for name, r := range workflowRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			for _, n := range []string{"Deploy", "backup", "Nightly backup", "cleanup"} {
+				if err := r.Create(newLogWorkflow(t, n, "a")); err != nil {
+					t.Fatalf("create: %v", err)
+				}
+			}
+
+			// sorted by name, the last page has no next token
+			var pages []string
+			token := ""
+			for {
+				page, next, err := r.List(domain.WorkflowFilter{PageSize: 3, PageToken: token})
+				if err != nil {
+					t.Fatalf("list: %v", err)
+				}
+				var names []string
+				for _, w := range page {
+					names = append(names, w.Name)
+				}
+				pages = append(pages, fmt.Sprint(names))
+				if next == "" {
+					break
+				}
+				token = next
+			}
+			if got, want := fmt.Sprint(pages), "[[Deploy Nightly backup backup] [cleanup]]"; got != want {
+				t.Errorf("got pages %s, want %s", got, want)
+			}
+
+			// the name filter is a case insensitive substring
+			page, _, err := r.List(domain.WorkflowFilter{Name: "BACK", PageSize: 10})
+			if err != nil {
+				t.Fatalf("list: %v", err)
+			}
+			if len(page) != 2 || page[0].Name != "Nightly backup" || page[1].Name != "backup" {
+				t.Errorf("got %d workflows matching BACK, want Nightly backup and backup", len(page))
+			}
+			if messages(page[0]) != "[a]" {
+				t.Errorf("got tasks %s, want [a]", messages(page[0]))
+			}
+		})
+	}
+}
@@ -0,0 +1,367 @@
+package workflow
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/domain"
+)
+
+// run holds everything that belongs to a single execution of a workflow,
+// concurrent runs of the same workflow share nothing but the definition
+type run struct {
+	w        *domain.Workflow
+	er       domain.ExecutionRepository // history of the run, updated on every change
+	eventCh  chan<- *domain.ExecutionEvent
+	deps     map[string]*taskDeps // fan-in counters by task id
+	data     *dataContext
+	total    int
+	executed atomic.Int32 // finished tasks, completed or skipped
+	failed   atomic.Int32 // failed tasks whose failure was handled
+	visited  sync.Map     // tasks already started, used to detect cycles
+	timeout  *runTimeout
+
+	mu        sync.Mutex // guards execution, cancels and joinCancelled
+	execution *domain.Execution
+	cancels   map[string]context.CancelCauseFunc // running tasks by id
+	// joinCancelled holds the tasks cancelled by a join, including the ones
+	// that had not started yet
+	joinCancelled map[string]bool
+}
+
+func newRun(w *domain.Workflow, e *domain.Execution, er domain.ExecutionRepository, deps map[string]*taskDeps, eventCh chan<- *domain.ExecutionEvent) *run {
+	return &run{
+		w:         w,
+		er:        er,
+		eventCh:   eventCh,
+		deps:      deps,
+		data:      newDataContext(e.Inputs),
+		total:     len(deps),
+		execution: e,
+
+		cancels:       make(map[string]context.CancelCauseFunc),
+		joinCancelled: make(map[string]bool),
+	}
+}
+
+// trackTask returns the context a starting task runs with, a join can
+// cancel it through cancelTask. done must be called once the task finished
+func (r *run) trackTask(ctx context.Context, t *domain.Task) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	r.mu.Lock()
+	if r.joinCancelled[t.ID] {
+		cancel(errJoinCancelled)
+	} else {
+		r.cancels[t.ID] = cancel
+	}
+	r.mu.Unlock()
+	return ctx, func() {
+		r.mu.Lock()
+		delete(r.cancels, t.ID)
+		r.mu.Unlock()
+		cancel(nil)
+	}
+}
+
+// failedWith returns the error of a task that failed for good, attempts
+// that are going to be retried do not count
+func (r *run) failedWith(t *domain.Task) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	te := r.execution.Tasks[t.ID]
+	if te.Status != domain.TaskStatusFailed || te.EndedAt.IsZero() {
+		return "", false
+	}
+	return te.Error, true
+}
+
+// cancelTask cancels a task a join no longer waits for, a task that has not
+// started yet is cancelled as soon as it does
+func (r *run) cancelTask(t *domain.Task) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.execution.Tasks[t.ID].EndedAt.IsZero() {
+		return
+	}
+	r.joinCancelled[t.ID] = true
+	if cancel, ok := r.cancels[t.ID]; ok {
+		cancel(errJoinCancelled)
+	}
+}
+
+// setStatus updates the execution status, finished executions get their end time
+func (r *run) setStatus(status domain.WorklowStatus, err error) {
+	r.mu.Lock()
+	r.execution.Status = status
+	switch status {
+	case domain.WorkflowStatusCompleted, domain.WorkflowStatusCompletedWithErrors,
+		domain.WorkflowStatusFailed, domain.WorkflowStatusCancelled:
+		r.execution.EndedAt = time.Now().UTC()
+	}
+	if err != nil {
+		r.execution.Error = err.Error()
+	}
+	snapshot := r.execution.Clone()
+	r.mu.Unlock()
+
+	if err := r.er.UpdateExecution(snapshot); err != nil {
+		log.Printf("failed to persist execution %s: %v", snapshot.ID, err)
+	}
+}
+
+// startAttempt marks the task as running and returns the attempt number
+func (r *run) startAttempt(t *domain.Task) int {
+	r.mu.Lock()
+	te := r.execution.Tasks[t.ID]
+	te.Status = domain.TaskStatusRunning
+	te.Attempts++
+	if te.StartedAt.IsZero() {
+		te.StartedAt = time.Now().UTC()
+	}
+	snapshot := *te
+	r.mu.Unlock()
+
+	r.persistTask(&snapshot)
+	return snapshot.Attempts
+}
+
+// startDelay marks a delay task as running and records when it is due, a
+// task resumed after a restart keeps the wake time it was given
+func (r *run) startDelay(t *domain.Task, p *domain.DelayPayload) (time.Time, error) {
+	r.mu.Lock()
+	te := r.execution.Tasks[t.ID]
+	if te.Status == domain.TaskStatusRunning && !te.WakeAt.IsZero() {
+		wakeAt := te.WakeAt
+		r.mu.Unlock()
+		return wakeAt, nil
+	}
+	now := time.Now().UTC()
+	te.Status = domain.TaskStatusRunning
+	te.Attempts++
+	if te.StartedAt.IsZero() {
+		te.StartedAt = now
+	}
+	wakeAt, err := p.WakeAt(now)
+	te.WakeAt = wakeAt
+	snapshot := *te
+	r.mu.Unlock()
+
+	r.persistTask(&snapshot)
+	return wakeAt, err
+}
+
+// finishTask records the final state of a task, final is false for failed
+// attempts that are going to be retried
+func (r *run) finishTask(t *domain.Task, status domain.TaskStatus, output interface{}, err error, final bool) {
+	r.mu.Lock()
+	te := r.execution.Tasks[t.ID]
+	te.Status = status
+	te.Output = output
+	te.Error = ""
+	if err != nil {
+		te.Error = err.Error()
+	}
+	if final {
+		te.EndedAt = time.Now().UTC()
+	}
+	snapshot := *te
+	r.mu.Unlock()
+
+	r.persistTask(&snapshot)
+}
+
+// cancelUnfinished marks every task that has not finished as cancelled,
+// including the ones that were interrupted while running
+func (r *run) cancelUnfinished() {
+	visited := make(map[string]bool)
+	var visit func(tasks []*domain.Task)
+	visit = func(tasks []*domain.Task) {
+		for _, t := range tasks {
+			if visited[t.ID] {
+				continue
+			}
+			visited[t.ID] = true
+
+			r.mu.Lock()
+			te := r.execution.Tasks[t.ID]
+			finished := !te.EndedAt.IsZero()
+			if !finished {
+				te.Status = domain.TaskStatusCancelled
+				te.EndedAt = time.Now().UTC()
+			}
+			snapshot := *te
+			r.mu.Unlock()
+
+			if !finished {
+				r.persistTask(&snapshot)
+				r.emit(t, int(t.Retries)+1)
+			}
+			visit(t.Successors())
+		}
+	}
+	visit(r.w.Tasks)
+}
+
+// completedTask is a task that completed along with its state
+type completedTask struct {
+	task *domain.Task
+	te   domain.TaskExecution
+}
+
+// toCompensate returns the completed tasks whose compensation has not
+// finished yet, the last completed task first
+func (r *run) toCompensate() []completedTask {
+	var tasks []completedTask
+	visited := make(map[string]bool)
+	var visit func(tasks []*domain.Task)
+	visit = func(ts []*domain.Task) {
+		for _, t := range ts {
+			if visited[t.ID] {
+				continue
+			}
+			visited[t.ID] = true
+
+			r.mu.Lock()
+			te := r.execution.Tasks[t.ID]
+			c, started := r.execution.Compensations[t.ID]
+			if t.Compensation != nil && te.Status == domain.TaskStatusCompleted && (!started || c.EndedAt.IsZero()) {
+				tasks = append(tasks, completedTask{task: t, te: *te})
+			}
+			r.mu.Unlock()
+			visit(t.Successors())
+		}
+	}
+	visit(r.w.Tasks)
+	sort.SliceStable(tasks, func(i, j int) bool {
+		return tasks[i].te.EndedAt.After(tasks[j].te.EndedAt)
+	})
+	return tasks
+}
+
+// startCompensation records that the compensation of a task is running, a
+// compensation interrupted by a restart runs again once the execution resumes
+func (r *run) startCompensation(t *domain.Task) {
+	r.mu.Lock()
+	if r.execution.Compensations == nil {
+		r.execution.Compensations = make(map[string]*domain.TaskExecution)
+	}
+	te := &domain.TaskExecution{
+		TaskID:      t.Compensation.ID,
+		TaskName:    t.Compensation.Name,
+		Status:      domain.TaskStatusRunning,
+		StartedAt:   time.Now().UTC(),
+		Compensates: t.ID,
+	}
+	r.execution.Compensations[t.ID] = te
+	snapshot := *te
+	r.mu.Unlock()
+
+	r.persistTask(&snapshot)
+}
+
+// finishCompensation records an attempt of the compensation of a task,
+// final is false for failed attempts that are going to be retried
+func (r *run) finishCompensation(t *domain.Task, status domain.TaskStatus, output interface{}, err error, attempt int, final bool) {
+	r.mu.Lock()
+	te := r.execution.Compensations[t.ID]
+	te.Status = status
+	te.Attempts = attempt
+	te.Output = output
+	te.Error = ""
+	if err != nil {
+		te.Error = err.Error()
+	}
+	if final {
+		te.EndedAt = time.Now().UTC()
+	}
+	snapshot := *te
+	r.mu.Unlock()
+
+	r.persistTask(&snapshot)
+}
+
+// persistTask saves the task state, a failure to record history is logged
+// but does not affect the run itself
+func (r *run) persistTask(te *domain.TaskExecution) {
+	if err := r.er.UpdateTaskExecution(r.execution.ID, te); err != nil {
+		log.Printf("failed to persist task %s of execution %s: %v", te.TaskID, r.execution.ID, err)
+	}
+}
+
+// emit streams an event describing the current state of the task,
+// a nil task produces a workflow level event
+func (r *run) emit(t *domain.Task, maxAttempts int) {
+	r.mu.Lock()
+	ev := &domain.ExecutionEvent{
+		ExecutionID:    r.execution.ID,
+		WorkflowID:     r.execution.WorkflowID,
+		WorkflowStatus: r.execution.Status,
+		TotalTasks:     r.total,
+		ExecutedTasks:  int(r.executed.Load()),
+		Time:           time.Now().UTC(),
+	}
+	if t != nil {
+		te := r.execution.Tasks[t.ID]
+		ev.TaskID = t.ID
+		ev.TaskStatus = te.Status
+		ev.Output = te.Output
+		ev.Error = te.Error
+		ev.Attempt = te.Attempts
+		ev.MaxAttempts = maxAttempts
+		join := t.Join
+		ev.Join = &join
+	} else {
+		ev.Error = r.execution.Error
+	}
+	r.mu.Unlock()
+	r.eventCh <- ev
+}
+
+// emitItem streams an event about a single item of a map task
+func (r *run) emitItem(t *domain.Task, index int, status domain.TaskStatus, output interface{}, err error, attempt, maxAttempts int) {
+	ev := r.partEvent(t, status, output, err, attempt, maxAttempts)
+	ev.ItemIndex = &index
+	r.eventCh <- ev
+}
+
+// emitIteration streams an event about a single iteration of a loop task
+func (r *run) emitIteration(t *domain.Task, iteration int, status domain.TaskStatus, output interface{}, err error, attempt, maxAttempts int) {
+	ev := r.partEvent(t, status, output, err, attempt, maxAttempts)
+	ev.Iteration = &iteration
+	r.eventCh <- ev
+}
+
+// emitCompensation streams an event about the compensation of a task
+func (r *run) emitCompensation(t *domain.Task, status domain.TaskStatus, output interface{}, err error, attempt, maxAttempts int) {
+	ev := r.partEvent(t.Compensation, status, output, err, attempt, maxAttempts)
+	ev.Compensates = t.ID
+	r.eventCh <- ev
+}
+
+// partEvent builds an event about a part of a task, an item of a map, an
+// iteration of a loop or a compensation, the task itself is left untouched
+func (r *run) partEvent(t *domain.Task, status domain.TaskStatus, output interface{}, err error, attempt, maxAttempts int) *domain.ExecutionEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ev := &domain.ExecutionEvent{
+		ExecutionID:    r.execution.ID,
+		WorkflowID:     r.execution.WorkflowID,
+		WorkflowStatus: r.execution.Status,
+		TotalTasks:     r.total,
+		ExecutedTasks:  int(r.executed.Load()),
+		TaskID:         t.ID,
+		TaskStatus:     status,
+		Output:         output,
+		Attempt:        attempt,
+		MaxAttempts:    maxAttempts,
+		Time:           time.Now().UTC(),
+	}
+	if err != nil {
+		ev.Error = err.Error()
+	}
+	return ev
+}
@@ -0,0 +1,137 @@
+package workflow
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+
+	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/domain"
+)
+
+// ExecutionStarter starts workflow executions in the background
+type ExecutionStarter interface {
+	Start(id string, inputs map[string]interface{}) (*domain.Execution, error)
+}
+
+// Scheduler fires executions of workflows on their cron schedules
+type Scheduler interface {
+	// Start loads the stored schedules, runs the fires missed while the
+	// server was down according to their policy and starts firing them,
+	// schedules that cannot be resumed are logged and skipped
+	Start(es ExecutionStarter) error
+	// Stop stops firing schedules, running executions are not affected
+	Stop()
+	// Add starts firing a schedule, replacing it if it was already added
+	Add(s *domain.Schedule) error
+	Remove(id string)
+}
+
+type scheduler struct {
+	sr   domain.ScheduleRepository
+	cron *cron.Cron
+
+	mu      sync.Mutex
+	es      ExecutionStarter
+	entries map[string]cron.EntryID // by schedule id
+}
+
+func NewScheduler(sr domain.ScheduleRepository) Scheduler {
+	return &scheduler{
+		sr:      sr,
+		cron:    cron.New(),
+		entries: make(map[string]cron.EntryID),
+	}
+}
+
+func (sc *scheduler) Start(es ExecutionStarter) error {
+	sc.mu.Lock()
+	sc.es = es
+	sc.mu.Unlock()
+
+	schedules, err := sc.sr.ListSchedules("")
+	if err != nil {
+		return fmt.Errorf("failed to load schedules: %w", err)
+	}
+	now := time.Now().UTC()
+	for _, s := range schedules {
+		if s.Paused {
+			continue
+		}
+		// one broken schedule must not keep the others from firing
+		if err := sc.resume(s, now); err != nil {
+			log.Printf("skipping schedule %s of workflow %s: %v", s.ID, s.WorkflowID, err)
+		}
+	}
+	sc.cron.Start()
+	return nil
+}
+
+// resume runs the fires of a schedule missed up to now and starts firing it
+func (sc *scheduler) resume(s *domain.Schedule, now time.Time) error {
+	missed, err := s.MissedFires(now)
+	if err != nil {
+		return err
+	}
+	for _, at := range missed {
+		log.Printf("running missed fire of schedule %s at %s", s.ID, at.Format(time.RFC3339))
+		sc.fire(s, at)
+	}
+	// every fire up to now has been handled, run or skipped
+	if err := sc.sr.RecordScheduleFire(s.ID, now); err != nil {
+		return err
+	}
+	return sc.Add(s)
+}
+
+func (sc *scheduler) Stop() {
+	<-sc.cron.Stop().Done()
+}
+
+func (sc *scheduler) Add(s *domain.Schedule) error {
+	spec, err := s.Spec()
+	if err != nil {
+		return err
+	}
+	s = s.Clone()
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if id, exists := sc.entries[s.ID]; exists {
+		sc.cron.Remove(id)
+	}
+	sc.entries[s.ID] = sc.cron.Schedule(spec, cron.FuncJob(func() {
+		sc.fire(s, time.Now().UTC())
+	}))
+	return nil
+}
+
+func (sc *scheduler) Remove(id string) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if entry, exists := sc.entries[id]; exists {
+		sc.cron.Remove(entry)
+		delete(sc.entries, id)
+	}
+}
+
+// fire starts an execution of the scheduled workflow, failures are logged
+// since there is no caller to report them to
+func (sc *scheduler) fire(s *domain.Schedule, at time.Time) {
+	sc.mu.Lock()
+	es := sc.es
+	sc.mu.Unlock()
+	if es == nil {
+		return
+	}
+	e, err := es.Start(s.WorkflowID, s.Inputs)
+	if err != nil {
+		log.Printf("failed to start workflow %s on schedule %s: %v", s.WorkflowID, s.ID, err)
+	} else {
+		log.Printf("started execution %s of workflow %s on schedule %s", e.ID, s.WorkflowID, s.ID)
+	}
+	if err := sc.sr.RecordScheduleFire(s.ID, at); err != nil {
+		log.Printf("failed to record fire of schedule %s: %v", s.ID, err)
+	}
+}
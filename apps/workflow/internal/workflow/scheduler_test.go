@@ -0,0 +1,120 @@
+package workflow
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/domain"
+	wr "github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/repository"
+)
+
+// recordingStarter records the workflows it is asked to start
+type recordingStarter struct {
+	mu      sync.Mutex
+	started []string
+	inputs  []map[string]interface{}
+}
+
+func (rs *recordingStarter) Start(id string, inputs map[string]interface{}) (*domain.Execution, error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.started = append(rs.started, id)
+	rs.inputs = append(rs.inputs, inputs)
+	return &domain.Execution{ID: id}, nil
+}
+
+// starts returns the inputs of the executions started so far
+func (rs *recordingStarter) starts() []map[string]interface{} {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return append([]map[string]interface{}(nil), rs.inputs...)
+}
+
+// newTestSchedule stores a schedule created three and a half hours ago
+// firing every hour
+func newTestSchedule(t *testing.T, repo *wr.MemoryRepo, w *domain.Workflow, policy domain.MissedFirePolicy) *domain.Schedule {
+	t.Helper()
+	s, err := domain.NewSchedule(w.ID, "0 * * * *", "UTC", nil, policy)
+	if err != nil {
+		t.Fatalf("new schedule: %v", err)
+	}
+	s.CreatedAt = time.Now().UTC().Truncate(time.Hour).Add(-3*time.Hour - 30*time.Minute)
+	if err := repo.CreateSchedule(s); err != nil {
+		t.Fatalf("create schedule: %v", err)
+	}
+	return s
+}
+
+func TestSchedulerStartRunsMissedFires(t *testing.T) {
+	repo := wr.NewMemoryRepository()
+	var workflows []*domain.Workflow
+	for _, name := range []string{"skip", "once", "catch up", "paused"} {
+		w := newTestWorkflow(t, newLogTask(t, name, 0, 0))
+		if err := repo.Create(w); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		workflows = append(workflows, w)
+	}
+	newTestSchedule(t, repo, workflows[0], domain.MissedFirePolicySkip)
+	newTestSchedule(t, repo, workflows[1], domain.MissedFirePolicyRunOnce)
+	catchUp := newTestSchedule(t, repo, workflows[2], domain.MissedFirePolicyCatchUp)
+	paused := newTestSchedule(t, repo, workflows[3], domain.MissedFirePolicyCatchUp)
+	if err := repo.SetSchedulePaused(paused.ID, true); err != nil {
+		t.Fatalf("pause: %v", err)
+	}
+
+	rs := &recordingStarter{}
+	sched := NewScheduler(repo)
+	if err := sched.Start(rs); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer sched.Stop()
+
+	counts := make(map[string]int)
+	for _, id := range rs.started {
+		counts[id]++
+	}
+	for i, want := range []int{0, 1, 4, 0} {
+		if got := counts[workflows[i].ID]; got != want {
+			t.Errorf("workflow %s: got %d missed fires run, want %d", workflows[i].Tasks[0].Name, got, want)
+		}
+	}
+	// the fires are recorded so a restart does not run them again
+	s, err := repo.GetSchedule(catchUp.ID)
+	if err != nil {
+		t.Fatalf("get schedule: %v", err)
+	}
+	if s.LastFireAt.Before(time.Now().Add(-time.Minute)) {
+		t.Errorf("got last fire at %s, want now", s.LastFireAt)
+	}
+}
+
+func TestSchedulerStartSkipsBrokenSchedules(t *testing.T) {
+	repo := wr.NewMemoryRepository()
+	w := newTestWorkflow(t, newLogTask(t, "a", 0, 0))
+	if err := repo.Create(w); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	// a stored schedule that no longer parses, such as one written by
+	// another version, does not keep the others from starting
+	broken := newTestSchedule(t, repo, w, domain.MissedFirePolicyCatchUp)
+	broken.Cron = "not a cron"
+	if err := repo.DeleteSchedule(broken.ID); err != nil {
+		t.Fatalf("delete schedule: %v", err)
+	}
+	if err := repo.CreateSchedule(broken); err != nil {
+		t.Fatalf("create schedule: %v", err)
+	}
+	newTestSchedule(t, repo, w, domain.MissedFirePolicyRunOnce)
+
+	rs := &recordingStarter{}
+	sched := NewScheduler(repo)
+	if err := sched.Start(rs); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer sched.Stop()
+	if len(rs.started) != 1 {
+		t.Errorf("got %d fires, want the missed fire of the valid schedule", len(rs.started))
+	}
+}
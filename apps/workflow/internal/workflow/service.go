@@ -2,6 +2,10 @@ package workflow
 
 import (
 	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
 
 	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/domain"
 )
@@ -9,18 +13,75 @@ import (
 type Service interface {
 	Create(w *domain.Workflow) (*domain.Workflow, error)
 	Get(id string) (*domain.Workflow, error)
-	Execute(ctx context.Context, id string, resultCh chan<- map[string]interface{}) error
+	List(f domain.WorkflowFilter) ([]*domain.Workflow, string, error)
+	Update(w *domain.Workflow) (*domain.Workflow, error)
+	Delete(id string) error
+	// Execute runs the workflow bound to ctx and streams its events until it finishes
+	Execute(ctx context.Context, id string, inputs map[string]interface{}, eventCh chan<- *domain.ExecutionEvent) error
+	// Start runs the workflow in the background and returns right away
+	Start(id string, inputs map[string]interface{}) (*domain.Execution, error)
+	// StartTriggered starts the workflow on behalf of a completion trigger of parent
+	StartTriggered(parent *domain.Execution, workflowID string, inputs map[string]interface{}) (*domain.Execution, error)
+	// RunChild runs the workflow as the child execution of a subworkflow task
+	// of parent bound to ctx, it returns the child once it finishes
+	RunChild(ctx context.Context, parent *domain.Execution, taskID, workflowID string, inputs map[string]interface{}) (*domain.Execution, error)
+	// Watch replays the events of an execution from fromSeq and follows the live ones
+	Watch(ctx context.Context, executionID string, fromSeq int64, eventCh chan<- *domain.ExecutionEvent) error
+	// Cancel stops a running execution and waits until its tasks have stopped
+	Cancel(ctx context.Context, executionID string, cause *domain.CancelError) (*domain.Execution, error)
+	GetExecution(id string) (*domain.Execution, error)
+	ListExecutions(f domain.ExecutionFilter) ([]*domain.Execution, string, error)
+	CreateSchedule(sc *domain.Schedule) (*domain.Schedule, error)
+	ListSchedules(workflowID string) ([]*domain.Schedule, error)
+	// PauseSchedule pauses or resumes a schedule, fires missed while paused are not run
+	PauseSchedule(id string, paused bool) (*domain.Schedule, error)
+	DeleteSchedule(id string) error
+	CreateWebhook(wh *domain.Webhook) (*domain.Webhook, error)
+	ListWebhooks(workflowID string) ([]*domain.Webhook, error)
+	DeleteWebhook(id string) error
+	CreateTrigger(t *domain.CompletionTrigger) (*domain.CompletionTrigger, error)
+	ListTriggers(workflowID string) ([]*domain.CompletionTrigger, error)
+	DeleteTrigger(id string) error
+	CreateFileWatch(fw *domain.FileWatch) (*domain.FileWatch, error)
+	ListFileWatches(workflowID string) ([]*domain.FileWatch, error)
+	DeleteFileWatch(id string) error
+	// Recover resumes the executions that were running when the server stopped
+	Recover() error
+	// TriggerWebhook starts the workflow of an inbound webhook call, sync
+	// webhooks return the execution once it finishes. ctx only bounds the
+	// wait, the run itself is not tied to it
+	TriggerWebhook(ctx context.Context, call *domain.WebhookCall) (*domain.Execution, error)
 }
 
 type service struct {
-	r  domain.WorkflowRepository
-	we WorkflowExecutor
+	r     domain.WorkflowRepository
+	er    domain.ExecutionRepository
+	sr    domain.ScheduleRepository
+	hr    domain.WebhookRepository
+	tr    domain.TriggerRepository
+	fr    domain.FileWatchRepository
+	we    WorkflowExecutor
+	sched Scheduler
+	fwr   FileWatcher
+
+	mu      sync.Mutex
+	streams map[string]*executionStream // running executions by id
 }
 
-func NewService(r domain.WorkflowRepository, we WorkflowExecutor) Service {
+func NewService(r domain.WorkflowRepository, er domain.ExecutionRepository, sr domain.ScheduleRepository,
+	hr domain.WebhookRepository, tr domain.TriggerRepository, fr domain.FileWatchRepository,
+	we WorkflowExecutor, sched Scheduler, fwr FileWatcher) Service {
 	return &service{
-		r:  r,
-		we: we,
+		r:       r,
+		er:      er,
+		sr:      sr,
+		hr:      hr,
+		tr:      tr,
+		fr:      fr,
+		we:      we,
+		sched:   sched,
+		fwr:     fwr,
+		streams: make(map[string]*executionStream),
 	}
 }
 
@@ -32,10 +93,462 @@ func (s *service) Get(id string) (*domain.Workflow, error) {
 	return s.r.Get(id)
 }
 
-func (s *service) Execute(ctx context.Context, id string, resultCh chan<- map[string]interface{}) error {
+func (s *service) List(f domain.WorkflowFilter) ([]*domain.Workflow, string, error) {
+	return s.r.List(f)
+}
+
+func (s *service) Update(w *domain.Workflow) (*domain.Workflow, error) {
+	return w, s.r.Update(w)
+}
+
+func (s *service) Delete(id string) error {
+	schedules, err := s.sr.ListSchedules(id)
+	if err != nil {
+		return err
+	}
+	watches, err := s.fr.ListFileWatches(id)
+	if err != nil {
+		return err
+	}
+	// schedules and file watches are deleted along with the workflow
+	if err := s.r.Delete(id); err != nil {
+		return err
+	}
+	for _, sc := range schedules {
+		s.sched.Remove(sc.ID)
+	}
+	for _, fw := range watches {
+		s.fwr.Remove(fw.ID)
+	}
+	return nil
+}
+
+func (s *service) Execute(ctx context.Context, id string, inputs map[string]interface{}, eventCh chan<- *domain.ExecutionEvent) error {
+	e, st, err := s.start(ctx, id, inputs, nil)
+	if err != nil {
+		return err
+	}
+	if err := s.Watch(ctx, e.ID, 0, eventCh); err != nil {
+		return err
+	}
+	return st.wait(ctx)
+}
+
+func (s *service) Start(id string, inputs map[string]interface{}) (*domain.Execution, error) {
+	// the run must outlive the request that started it
+	e, _, err := s.start(context.Background(), id, inputs, nil)
+	return e, err
+}
+
+func (s *service) StartTriggered(parent *domain.Execution, workflowID string, inputs map[string]interface{}) (*domain.Execution, error) {
+	e, _, err := s.start(context.Background(), workflowID, inputs, func(e *domain.Execution) error {
+		e.TriggeredBy = parent.ID
+		e.TriggerChain = parent.NextTriggerChain()
+		return nil
+	})
+	return e, err
+}
+
+func (s *service) RunChild(ctx context.Context, parent *domain.Execution, taskID, workflowID string, inputs map[string]interface{}) (*domain.Execution, error) {
+	e, st, err := s.start(ctx, workflowID, inputs, func(e *domain.Execution) error {
+		return e.SetParent(parent, taskID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	// the child stops by itself once ctx is done, wait until its final
+	// state is recorded
+	st.wait(context.Background())
+	return s.er.GetExecution(e.ID)
+}
+
+// start creates the execution and runs it in the background, it returns a
+// snapshot of the execution taken before it starts running. Link, if any,
+// records what started the execution before it is stored
+func (s *service) start(ctx context.Context, id string, inputs map[string]interface{},
+	link func(e *domain.Execution) error) (*domain.Execution, *executionStream, error) {
 	w, err := s.r.Get(id)
 	if err != nil {
+		return nil, nil, err
+	}
+	resolved, err := w.ResolveInputs(inputs)
+	if err != nil {
+		return nil, nil, err
+	}
+	e := domain.NewExecution(w, resolved)
+	if link != nil {
+		if err := link(e); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := s.er.CreateExecution(e); err != nil {
+		return nil, nil, err
+	}
+	snapshot := e.Clone()
+	st := s.launch(ctx, e, nil, func(ctx context.Context, eventCh chan<- *domain.ExecutionEvent) error {
+		return s.we.Execute(ctx, w, e, eventCh)
+	})
+	return snapshot, st, nil
+}
+
+// Recover resumes the executions that were running when the server stopped,
+// it must be called before anything else starts executions
+func (s *service) Recover() error {
+	var running []*domain.Execution
+	f := domain.ExecutionFilter{Status: domain.WorkflowStatusRunning, PageSize: domain.ExecutionMaxPageSize}
+	for {
+		page, next, err := s.er.ListExecutions(f)
+		if err != nil {
+			return fmt.Errorf("failed to list running executions: %w", err)
+		}
+		running = append(running, page...)
+		if next == "" {
+			break
+		}
+		f.PageToken = next
+	}
+	for _, e := range running {
+		if err := s.resume(e); err != nil {
+			log.Printf("failed to resume execution %s: %v", e.ID, err)
+		}
+	}
+	return nil
+}
+
+func (s *service) resume(e *domain.Execution) error {
+	if e.ParentExecutionID != "" {
+		// nothing waits for the child anymore, its parent fails on resume
+		// since its subworkflow task was interrupted
+		return s.failInterrupted(e, fmt.Errorf("parent execution %s was interrupted", e.ParentExecutionID))
+	}
+	w, err := s.r.Get(e.WorkflowID)
+	if err != nil {
+		// the workflow is gone, the execution can never finish
+		return s.failInterrupted(e, err)
+	}
+	history, err := s.er.ListExecutionEvents(e.ID, 0)
+	if err != nil {
+		return err
+	}
+	s.launch(context.Background(), e, history, func(ctx context.Context, eventCh chan<- *domain.ExecutionEvent) error {
+		return s.we.Resume(ctx, w, e, eventCh)
+	})
+	log.Printf("resumed execution %s of workflow %s", e.ID, e.WorkflowID)
+	return nil
+}
+
+// failInterrupted records that an execution interrupted by a restart cannot be resumed
+func (s *service) failInterrupted(e *domain.Execution, cause error) error {
+	e.Status = domain.WorkflowStatusFailed
+	e.EndedAt = time.Now().UTC()
+	e.Error = fmt.Sprintf("failed to resume execution: %v", cause)
+	return s.er.UpdateExecution(e)
+}
+
+// launch runs the execution in the background, publishing and persisting
+// its events, history holds the events it published before a restart
+func (s *service) launch(ctx context.Context, e *domain.Execution, history []*domain.ExecutionEvent,
+	runFn func(ctx context.Context, eventCh chan<- *domain.ExecutionEvent) error) *executionStream {
+	// the run stops with the cancel error as cause when cancelled on request
+	ctx, cancel := context.WithCancelCause(ctx)
+	st := newExecutionStream(cancel, history)
+	s.mu.Lock()
+	s.streams[e.ID] = st
+	s.mu.Unlock()
+
+	eventCh := make(chan *domain.ExecutionEvent)
+	pumped := make(chan struct{})
+	go func() {
+		defer close(pumped)
+		for ev := range eventCh {
+			st.publish(ev)
+			if err := s.er.AppendExecutionEvent(ev); err != nil {
+				log.Printf("failed to persist event %d of execution %s: %v", ev.Seq, ev.ExecutionID, err)
+			}
+		}
+	}()
+	go func() {
+		err := runFn(ctx, eventCh)
+		cancel(nil)
+		close(eventCh)
+		<-pumped
+		// every event is persisted by now, late watchers replay them from history
+		s.mu.Lock()
+		delete(s.streams, e.ID)
+		s.mu.Unlock()
+		st.finish(err)
+	}()
+	return st
+}
+
+func (s *service) Watch(ctx context.Context, executionID string, fromSeq int64, eventCh chan<- *domain.ExecutionEvent) error {
+	send := func(ev *domain.ExecutionEvent) error {
+		select {
+		case eventCh <- ev:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	s.mu.Lock()
+	st, running := s.streams[executionID]
+	s.mu.Unlock()
+	if running {
+		return st.watch(ctx, fromSeq, send)
+	}
+
+	// the execution is no longer running, replay it from history
+	if _, err := s.er.GetExecution(executionID); err != nil {
+		return err
+	}
+	events, err := s.er.ListExecutionEvents(executionID, fromSeq)
+	if err != nil {
+		return err
+	}
+	for _, ev := range events {
+		if err := send(ev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *service) Cancel(ctx context.Context, executionID string, cause *domain.CancelError) (*domain.Execution, error) {
+	s.mu.Lock()
+	st, running := s.streams[executionID]
+	s.mu.Unlock()
+	if !running {
+		e, err := s.er.GetExecution(executionID)
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("execution with id %s is not running, status %s", executionID, e.Status)
+	}
+
+	st.cancel(cause)
+	// the run finishes with the cancel error, only a done context matters here
+	if err := st.wait(ctx); err != nil && ctx.Err() != nil {
+		return nil, err
+	}
+	return s.er.GetExecution(executionID)
+}
+
+func (s *service) GetExecution(id string) (*domain.Execution, error) {
+	return s.er.GetExecution(id)
+}
+
+func (s *service) ListExecutions(f domain.ExecutionFilter) ([]*domain.Execution, string, error) {
+	return s.er.ListExecutions(f)
+}
+
+func (s *service) CreateSchedule(sc *domain.Schedule) (*domain.Schedule, error) {
+	w, err := s.r.Get(sc.WorkflowID)
+	if err != nil {
+		return nil, err
+	}
+	// fail now instead of on every fire
+	if _, err := w.ResolveInputs(sc.Inputs); err != nil {
+		return nil, err
+	}
+	if _, err := sc.Spec(); err != nil {
+		return nil, err
+	}
+	if err := s.sr.CreateSchedule(sc); err != nil {
+		return nil, err
+	}
+	if err := s.sched.Add(sc); err != nil {
+		// a schedule that cannot fire must not be left to be recovered
+		if derr := s.sr.DeleteSchedule(sc.ID); derr != nil {
+			return nil, fmt.Errorf("%w, failed to delete schedule: %v", err, derr)
+		}
+		return nil, err
+	}
+	return sc, nil
+}
+
+func (s *service) ListSchedules(workflowID string) ([]*domain.Schedule, error) {
+	return s.sr.ListSchedules(workflowID)
+}
+
+func (s *service) PauseSchedule(id string, paused bool) (*domain.Schedule, error) {
+	if err := s.sr.SetSchedulePaused(id, paused); err != nil {
+		return nil, err
+	}
+	if !paused {
+		// fires missed while paused are not caught up on restart
+		if err := s.sr.RecordScheduleFire(id, time.Now().UTC()); err != nil {
+			return nil, err
+		}
+	}
+	sc, err := s.sr.GetSchedule(id)
+	if err != nil {
+		return nil, err
+	}
+	if paused {
+		s.sched.Remove(id)
+		return sc, nil
+	}
+	if err := s.sched.Add(sc); err != nil {
+		return nil, err
+	}
+	return sc, nil
+}
+
+func (s *service) DeleteSchedule(id string) error {
+	if err := s.sr.DeleteSchedule(id); err != nil {
+		return err
+	}
+	s.sched.Remove(id)
+	return nil
+}
+
+func (s *service) CreateWebhook(wh *domain.Webhook) (*domain.Webhook, error) {
+	if _, err := s.r.Get(wh.WorkflowID); err != nil {
+		return nil, err
+	}
+	webhooks, err := s.hr.ListWebhooks(wh.WorkflowID)
+	if err != nil {
+		return nil, err
+	}
+	if len(webhooks) >= domain.WebhookMaxPerWorkflow {
+		return nil, fmt.Errorf("workflow cannot have more than %d webhooks", domain.WebhookMaxPerWorkflow)
+	}
+	if err := s.hr.CreateWebhook(wh); err != nil {
+		return nil, err
+	}
+	return wh, nil
+}
+
+func (s *service) ListWebhooks(workflowID string) ([]*domain.Webhook, error) {
+	return s.hr.ListWebhooks(workflowID)
+}
+
+func (s *service) DeleteWebhook(id string) error {
+	return s.hr.DeleteWebhook(id)
+}
+
+func (s *service) TriggerWebhook(ctx context.Context, call *domain.WebhookCall) (*domain.Execution, error) {
+	webhooks, err := s.hr.ListWebhooks(call.WorkflowID)
+	if err != nil {
+		return nil, err
+	}
+	var wh *domain.Webhook
+	for _, candidate := range webhooks {
+		if candidate.MatchToken(call.Token) {
+			wh = candidate
+			break
+		}
+	}
+	if wh == nil {
+		return nil, domain.ErrWebhookNotFound
+	}
+	if err := wh.VerifySignature(call.Body, call.Signature); err != nil {
+		return nil, err
+	}
+	w, err := s.r.Get(wh.WorkflowID)
+	if err != nil {
+		return nil, err
+	}
+	inputs := call.Inputs(w)
+	if _, err := w.ResolveInputs(inputs); err != nil {
+		return nil, fmt.Errorf("%w: %v", domain.ErrWebhookBadRequest, err)
+	}
+
+	// the run must outlive the request that started it, a client that goes
+	// away only stops waiting for it
+	e, st, err := s.start(context.Background(), w.ID, inputs, nil)
+	if err != nil || wh.Mode != domain.WebhookModeSync {
+		return e, err
+	}
+	// the run error is recorded in the execution, only a done context matters here
+	if err := st.wait(ctx); err != nil && ctx.Err() != nil {
+		return nil, err
+	}
+	return s.er.GetExecution(e.ID)
+}
+
+func (s *service) CreateTrigger(t *domain.CompletionTrigger) (*domain.CompletionTrigger, error) {
+	for _, id := range []string{t.WorkflowID, t.TargetWorkflowID} {
+		if _, err := s.r.Get(id); err != nil {
+			return nil, err
+		}
+	}
+	triggers, err := s.tr.ListTriggers("")
+	if err != nil {
+		return nil, err
+	}
+	// reject triggers that would let the target start the source again,
+	// executions also stop chaining at run time in case of concurrent changes
+	next := make(map[string][]string)
+	for _, existing := range triggers {
+		next[existing.WorkflowID] = append(next[existing.WorkflowID], existing.TargetWorkflowID)
+	}
+	visited := make(map[string]bool)
+	queue := []string{t.TargetWorkflowID}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if id == t.WorkflowID {
+			return nil, fmt.Errorf("trigger would create a loop: workflow %s already leads to workflow %s", t.TargetWorkflowID, t.WorkflowID)
+		}
+		if visited[id] {
+			continue
+		}
+		visited[id] = true
+		queue = append(queue, next[id]...)
+	}
+	if err := s.tr.CreateTrigger(t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (s *service) ListTriggers(workflowID string) ([]*domain.CompletionTrigger, error) {
+	return s.tr.ListTriggers(workflowID)
+}
+
+func (s *service) DeleteTrigger(id string) error {
+	return s.tr.DeleteTrigger(id)
+}
+
+func (s *service) CreateFileWatch(fw *domain.FileWatch) (*domain.FileWatch, error) {
+	w, err := s.r.Get(fw.WorkflowID)
+	if err != nil {
+		return nil, err
+	}
+	// fail now instead of on every file, e.g. on required inputs no file fills
+	if _, err := w.ResolveInputs(domain.FileEvent{Path: fw.Dir, ModTime: time.Now()}.Inputs(w)); err != nil {
+		return nil, err
+	}
+	watches, err := s.fr.ListFileWatches(fw.WorkflowID)
+	if err != nil {
+		return nil, err
+	}
+	if len(watches) >= domain.FileWatchMaxPerWorkflow {
+		return nil, fmt.Errorf("workflow cannot have more than %d file watches", domain.FileWatchMaxPerWorkflow)
+	}
+	if err := s.fr.CreateFileWatch(fw); err != nil {
+		return nil, err
+	}
+	if err := s.fwr.Add(fw); err != nil {
+		// a watch on a missing directory must not be left to be recovered
+		if derr := s.fr.DeleteFileWatch(fw.ID); derr != nil {
+			return nil, fmt.Errorf("%w, failed to delete file watch: %v", err, derr)
+		}
+		return nil, err
+	}
+	return fw, nil
+}
+
+func (s *service) ListFileWatches(workflowID string) ([]*domain.FileWatch, error) {
+	return s.fr.ListFileWatches(workflowID)
+}
+
+func (s *service) DeleteFileWatch(id string) error {
+	if err := s.fr.DeleteFileWatch(id); err != nil {
 		return err
 	}
-	return s.we.Execute(ctx, w, resultCh)
+	s.fwr.Remove(id)
+	return nil
 }
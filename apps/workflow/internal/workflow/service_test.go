@@ -0,0 +1,137 @@
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/domain"
+	wr "github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/repository"
+)
+
+// blockingTaskExecutor completes tasks once release is closed
+type blockingTaskExecutor struct {
+	release chan struct{}
+}
+
+func (be *blockingTaskExecutor) Execute(ctx context.Context, t *domain.Task) (interface{}, error) {
+	select {
+	case <-be.release:
+		return t.Name, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func newTestService(t *testing.T, te TaskExecutor, tasks ...*domain.Task) (Service, *domain.Workflow) {
+	t.Helper()
+	repo := wr.NewMemoryRepository()
+	w := newTestWorkflow(t, tasks...)
+	if err := repo.Create(w); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	return newServiceOn(repo, te), w
+}
+
+// newServiceOn wires a service on the repository the way the server does
+func newServiceOn(repo *wr.MemoryRepo, te TaskExecutor) Service {
+	we := NewWorkflowExecutor(repo, repo, repo, te)
+	s := NewService(repo, repo, repo, repo, repo, repo, we, NewScheduler(repo), NewFileWatcher(repo, repo))
+	we.SetTriggerStarter(s)
+	we.SetSubworkflowRunner(s)
+	return s
+}
+
+// watch returns the sequence numbers Watch streams
+func watch(ctx context.Context, s Service, executionID string, fromSeq int64) ([]int64, error) {
+	eventCh := make(chan *domain.ExecutionEvent)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- s.Watch(ctx, executionID, fromSeq, eventCh)
+		close(eventCh)
+	}()
+	var seqs []int64
+	for ev := range eventCh {
+		seqs = append(seqs, ev.Seq)
+	}
+	return seqs, <-errCh
+}
+
+func TestServiceWatchFollowsRunningExecutions(t *testing.T) {
+	te := &blockingTaskExecutor{release: make(chan struct{})}
+	s, w := newTestService(t, te, newLogTask(t, "b", 0, 0), newLogTask(t, "a", 0, 0))
+
+	e, err := s.Start(w.ID, nil)
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	time.AfterFunc(50*time.Millisecond, func() { close(te.release) })
+	seqs, err := watch(context.Background(), s, e.ID, 0)
+	if err != nil {
+		t.Fatalf("watch: %v", err)
+	}
+	// one event per task, then the workflow event
+	if got := fmt.Sprint(seqs); got != "[1 2 3]" {
+		t.Errorf("got events %s, want [1 2 3]", got)
+	}
+}
+
+func TestServiceWatchReplaysFinishedExecutions(t *testing.T) {
+	s, w := newTestService(t, &flakyTaskExecutor{}, newLogTask(t, "b", 0, 0), newLogTask(t, "a", 0, 0))
+
+	eventCh := make(chan *domain.ExecutionEvent, 10)
+	if err := s.Execute(context.Background(), w.ID, nil, eventCh); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	close(eventCh)
+	var executionID string
+	for ev := range eventCh {
+		executionID = ev.ExecutionID
+	}
+
+	seqs, err := watch(context.Background(), s, executionID, 2)
+	if err != nil {
+		t.Fatalf("watch: %v", err)
+	}
+	if got := fmt.Sprint(seqs); got != "[2 3]" {
+		t.Errorf("got events %s, want [2 3]", got)
+	}
+	if _, err := watch(context.Background(), s, "missing", 0); err == nil {
+		t.Errorf("expected watching an unknown execution to fail")
+	}
+}
+
+func TestServiceCancelStopsRunningExecutions(t *testing.T) {
+	after := newLogTask(t, "after", 0, 0)
+	s, w := newTestService(t, &blockingTaskExecutor{release: make(chan struct{})}, newLogTask(t, "a", 0, 0, after))
+
+	e, err := s.Start(w.ID, nil)
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	cause, err := domain.NewCancelError("no longer needed")
+	if err != nil {
+		t.Fatalf("cancel error: %v", err)
+	}
+	e, err = s.Cancel(context.Background(), e.ID, cause)
+	if err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+	if e.Status != domain.WorkflowStatusCancelled || e.Error != cause.Error() {
+		t.Errorf("got status %s and error %q, want %s and %q", e.Status, e.Error, domain.WorkflowStatusCancelled, cause.Error())
+	}
+	for _, te := range e.Tasks {
+		if te.Status != domain.TaskStatusCancelled || te.EndedAt.IsZero() {
+			t.Errorf("task %s: got status %s, want a finished %s", te.TaskName, te.Status, domain.TaskStatusCancelled)
+		}
+	}
+
+	// finished executions cannot be cancelled again
+	if _, err := s.Cancel(context.Background(), e.ID, cause); err == nil {
+		t.Errorf("expected cancelling a finished execution to fail")
+	}
+	if _, err := s.Cancel(context.Background(), "missing", cause); err == nil {
+		t.Errorf("expected cancelling an unknown execution to fail")
+	}
+}
@@ -0,0 +1,137 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/domain"
+)
+
+// shellWaitDelay bounds how long a killed command may keep its output
+// pipes open, e.g. through children that outlive it
+const shellWaitDelay = 2 * time.Second
+
+// shellErrorMaxLength caps how much of stderr is quoted in task errors
+const shellErrorMaxLength = 200
+
+type ShellTaskExecutor interface {
+	Execute(ctx context.Context, p *domain.ShellPayload) (*domain.ShellResult, error)
+}
+
+type shellTaskExecutor struct{}
+
+func NewShellTaskExecutor() ShellTaskExecutor {
+	return &shellTaskExecutor{}
+}
+
+func (se *shellTaskExecutor) Execute(ctx context.Context, p *domain.ShellPayload) (*domain.ShellResult, error) {
+	// a zero timeout means the command is only bound by the workflow context
+	if p.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.Timeout)
+		defer cancel()
+	}
+
+	stdout := &limitedBuffer{max: p.MaxOutputSize}
+	stderr := &limitedBuffer{max: p.MaxOutputSize}
+	cmd := exec.CommandContext(ctx, p.Command, p.Args...)
+	cmd.Dir = p.WorkingDir
+	cmd.Env = shellEnv(p.Env)
+	cmd.Stdin = strings.NewReader(p.Stdin)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.WaitDelay = shellWaitDelay
+	if err := configureShellCommand(cmd, p.Limits); err != nil {
+		return nil, err
+	}
+
+	if err := startShellCommand(cmd, p.Limits); err != nil {
+		return nil, fmt.Errorf("failed to start command: %w", err)
+	}
+	err := cmd.Wait()
+	out := &domain.ShellResult{
+		ExitCode:  cmd.ProcessState.ExitCode(),
+		Stdout:    stdout.String(),
+		Stderr:    stderr.String(),
+		Truncated: stdout.truncated || stderr.truncated,
+		Killed:    cmd.ProcessState != nil && !cmd.ProcessState.Exited(),
+	}
+	if ctx.Err() != nil {
+		if p.Timeout > 0 && errors.Is(context.Cause(ctx), context.DeadlineExceeded) {
+			out.LimitExceeded = domain.ShellLimitTimeout
+			return out, fmt.Errorf("command timed out after %v", p.Timeout)
+		}
+		return out, context.Cause(ctx)
+	}
+	if cmd.ProcessState != nil {
+		out.LimitExceeded = shellLimitExceeded(cmd.ProcessState, p.Limits, out.Stderr)
+	}
+	if out.LimitExceeded != "" {
+		return out, fmt.Errorf("command exceeded its %s limit%s", out.LimitExceeded, stderrSuffix(out.Stderr))
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if out.Killed {
+			return out, fmt.Errorf("command ended by %v%s", exitErr, stderrSuffix(out.Stderr))
+		}
+		return out, fmt.Errorf("command exited with code %d%s", out.ExitCode, stderrSuffix(out.Stderr))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to run command: %w", err)
+	}
+	return out, nil
+}
+
+// shellEnv builds the environment of a command, only PATH is taken from the
+// server so commands can be found without leaking its configuration
+func shellEnv(env map[string]string) []string {
+	out := make([]string, 0, len(env)+1)
+	if _, ok := env["PATH"]; !ok {
+		out = append(out, "PATH="+os.Getenv("PATH"))
+	}
+	for k, v := range env {
+		out = append(out, k+"="+v)
+	}
+	return out
+}
+
+// stderrSuffix quotes the end of stderr, where errors are usually printed
+func stderrSuffix(stderr string) string {
+	stderr = strings.TrimSpace(stderr)
+	if stderr == "" {
+		return ""
+	}
+	if len(stderr) > shellErrorMaxLength {
+		stderr = "..." + stderr[len(stderr)-shellErrorMaxLength:]
+	}
+	return ": " + stderr
+}
+
+// limitedBuffer keeps the first max bytes written to it and drops the rest,
+// writes never fail so the command is not killed by a broken pipe
+type limitedBuffer struct {
+	buf       strings.Builder
+	max       int64
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - int64(b.buf.Len()); room < int64(len(p)) {
+		b.truncated = true
+		if room > 0 {
+			b.buf.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	b.buf.Write(p)
+	return len(p), nil
+}
+
+func (b *limitedBuffer) String() string {
+	return b.buf.String()
+}
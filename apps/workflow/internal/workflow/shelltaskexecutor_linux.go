@@ -0,0 +1,196 @@
+//go:build linux
+
+package workflow
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/domain"
+)
+
+// configureShellCommand runs the command in its own process group, so that
+// killing it on timeout or cancellation also kills its children, under the
+// user and namespaces of the limits
+func configureShellCommand(cmd *exec.Cmd, l domain.ShellLimits) error {
+	attr := &syscall.SysProcAttr{
+		Setpgid:   true,
+		Pdeathsig: syscall.SIGKILL, // commands do not outlive the engine
+	}
+	privileged := os.Geteuid() == 0
+	if l.User != "" {
+		if !privileged {
+			return fmt.Errorf("running commands as user %s needs the engine to run as root", l.User)
+		}
+		cred, err := lookupCredential(l.User)
+		if err != nil {
+			return err
+		}
+		attr.Credential = cred
+	}
+	if l.NewNamespaces {
+		attr.Cloneflags = syscall.CLONE_NEWPID | syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS | syscall.CLONE_NEWNS
+		if !privileged {
+			// unprivileged engines need a user namespace to create the others
+			attr.Cloneflags |= syscall.CLONE_NEWUSER
+			attr.UidMappings = []syscall.SysProcIDMap{{ContainerID: os.Geteuid(), HostID: os.Geteuid(), Size: 1}}
+			attr.GidMappings = []syscall.SysProcIDMap{{ContainerID: os.Getegid(), HostID: os.Getegid(), Size: 1}}
+		}
+	}
+	cmd.SysProcAttr = attr
+	cmd.Cancel = func() error {
+		// a negative pid addresses the whole process group
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	return nil
+}
+
+// lookupCredential resolves a user name or uid to the ids the command runs with
+func lookupCredential(name string) (*syscall.Credential, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		if u, err = user.LookupId(name); err != nil {
+			return nil, fmt.Errorf("unknown user %s", name)
+		}
+	}
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid uid of user %s: %w", name, err)
+	}
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid gid of user %s: %w", name, err)
+	}
+	if uid == 0 {
+		return nil, fmt.Errorf("user %s must be unprivileged", name)
+	}
+	return &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid), Groups: []uint32{}}, nil
+}
+
+// startShellCommand starts the command with its resource limits already in
+// place. os/exec cannot set limits between fork and exec, so the child is
+// traced to stop it right after exec, before any of the command runs, while
+// the limits are set
+func startShellCommand(cmd *exec.Cmd, l domain.ShellLimits) error {
+	if l.CPUTime == 0 && l.MemoryBytes == 0 && l.OpenFiles == 0 {
+		return cmd.Start()
+	}
+	// only the thread that started a traced child can detach from it
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	cmd.SysProcAttr.Ptrace = true
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	pid := cmd.Process.Pid
+	var ws syscall.WaitStatus
+	_, err := syscall.Wait4(pid, &ws, 0, nil)
+	if err == nil && !ws.Stopped() {
+		err = fmt.Errorf("command did not stop after exec: %v", ws)
+	}
+	if err == nil {
+		err = applyShellLimits(pid, l)
+		if derr := syscall.PtraceDetach(pid); err == nil && derr != nil {
+			err = fmt.Errorf("failed to resume command: %w", derr)
+		}
+	}
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return err
+	}
+	return nil
+}
+
+func applyShellLimits(pid int, l domain.ShellLimits) error {
+	if l.CPUTime > 0 {
+		// SIGXCPU at the soft limit and SIGKILL one second later
+		secs := uint64((l.CPUTime + time.Second - 1) / time.Second)
+		if err := setRlimit(pid, unix.RLIMIT_CPU, secs, secs+1); err != nil {
+			return fmt.Errorf("failed to limit CPU time: %w", err)
+		}
+	}
+	if l.MemoryBytes > 0 {
+		if err := setRlimit(pid, unix.RLIMIT_AS, uint64(l.MemoryBytes), uint64(l.MemoryBytes)); err != nil {
+			return fmt.Errorf("failed to limit memory: %w", err)
+		}
+	}
+	if l.OpenFiles > 0 {
+		if err := setRlimit(pid, unix.RLIMIT_NOFILE, l.OpenFiles, l.OpenFiles); err != nil {
+			return fmt.Errorf("failed to limit open files: %w", err)
+		}
+	}
+	return nil
+}
+
+// setRlimit lowers a limit of a process, hard limits are never raised
+// since that needs privileges
+func setRlimit(pid, resource int, cur, max uint64) error {
+	var old unix.Rlimit
+	if err := unix.Prlimit(pid, resource, nil, &old); err != nil {
+		return err
+	}
+	if max > old.Max {
+		max = old.Max
+	}
+	if cur > max {
+		cur = max
+	}
+	return unix.Prlimit(pid, resource, &unix.Rlimit{Cur: cur, Max: max}, nil)
+}
+
+// shellLimitExceeded returns the limit a failed command ran into. A command
+// over its CPU time is killed, commands run through a shell report the signal
+// in their exit code. Memory and open files are only seen through how the
+// command fails once its allocations or opens do
+func shellLimitExceeded(state *os.ProcessState, l domain.ShellLimits, stderr string) string {
+	ws, ok := state.Sys().(syscall.WaitStatus)
+	if !ok || state.Success() {
+		return ""
+	}
+	if l.CPUTime > 0 {
+		switch {
+		case ws.Signaled() && ws.Signal() == syscall.SIGXCPU,
+			ws.Exited() && ws.ExitStatus() == 128+int(syscall.SIGXCPU):
+			return domain.ShellLimitCPUTime
+		case ws.Signaled() && ws.Signal() == syscall.SIGKILL && state.UserTime()+state.SystemTime() >= l.CPUTime:
+			return domain.ShellLimitCPUTime
+		}
+	}
+	// a failed stack or heap growth often crashes the command without a word
+	crashed := ws.Signaled() && ws.Signal() == syscall.SIGSEGV ||
+		ws.Exited() && ws.ExitStatus() == 128+int(syscall.SIGSEGV)
+	if l.MemoryBytes > 0 && (crashed || containsAny(strings.ToLower(stderr), shellMemoryErrors)) {
+		return domain.ShellLimitMemory
+	}
+	if l.OpenFiles > 0 && strings.Contains(strings.ToLower(stderr), "too many open files") {
+		return domain.ShellLimitOpenFiles
+	}
+	return ""
+}
+
+// shellMemoryErrors are how common commands and runtimes report failed
+// allocations, in lower case
+var shellMemoryErrors = []string{
+	"cannot allocate", // ENOMEM and bash
+	"out of memory",
+	"memory exhausted",
+}
+
+func containsAny(s string, substrs []string) bool {
+	for _, sub := range substrs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+//go:build linux
+
+package workflow
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/domain"
+)
+
+// newLimitedShellPayload runs script with /bin/sh under limits
+func newLimitedShellPayload(t *testing.T, script string, limits domain.ShellLimits) *domain.ShellPayload {
+	t.Helper()
+	p, err := domain.NewShellPayload("/bin/sh", []string{"-c", script}, "", nil, "", 10*time.Second, 0, limits)
+	if err != nil {
+		t.Fatalf("failed to create shell payload: %v", err)
+	}
+	return p
+}
+
+func TestShellTaskExecutorAppliesLimitsBeforeTheCommandRuns(t *testing.T) {
+	p := newLimitedShellPayload(t, "ulimit -t; ulimit -n; ulimit -v",
+		domain.ShellLimits{CPUTime: 1500 * time.Millisecond, MemoryBytes: 64 << 20, OpenFiles: 32})
+	out, err := NewShellTaskExecutor().Execute(context.Background(), p)
+	if err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	// CPU time is rounded up to whole seconds, ulimit -v is in KiB
+	if out.Stdout != "2\n32\n65536\n" {
+		t.Errorf("got limits %q, want 2s of CPU, 32 files and 65536 KiB", out.Stdout)
+	}
+}
+
+func TestShellTaskExecutorReportsExceededLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		limits domain.ShellLimits
+		want   string
+	}{
+		{"CPU time", "while :; do :; done", domain.ShellLimits{CPUTime: time.Second}, domain.ShellLimitCPUTime},
+		{"memory", "head -c 100000000 /dev/zero | sort", domain.ShellLimits{MemoryBytes: 64 << 20}, domain.ShellLimitMemory},
+		{"open files", "exec 3</dev/null 4</dev/null 5</dev/null 6</dev/null 7</dev/null; cat </dev/null",
+			domain.ShellLimits{OpenFiles: 8}, domain.ShellLimitOpenFiles},
+		// a failure unrelated to the limits is not blamed on them
+		{"plain failure", "echo 'cannot allocate' >&2; exit 1", domain.ShellLimits{OpenFiles: 8}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := NewShellTaskExecutor().Execute(context.Background(), newLimitedShellPayload(t, tt.script, tt.limits))
+			if err == nil {
+				t.Fatalf("expected the command to fail")
+			}
+			if out == nil || out.LimitExceeded != tt.want {
+				t.Errorf("got result %+v and error %v, want limit %q", out, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+//go:build !linux
+
+package workflow
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/domain"
+)
+
+func configureShellCommand(_ *exec.Cmd, l domain.ShellLimits) error {
+	if l != (domain.ShellLimits{}) {
+		return fmt.Errorf("shell limits are only supported on Linux")
+	}
+	return nil
+}
+
+func startShellCommand(cmd *exec.Cmd, _ domain.ShellLimits) error {
+	return cmd.Start()
+}
+
+func shellLimitExceeded(_ *os.ProcessState, _ domain.ShellLimits, _ string) string {
+	return ""
+}
@@ -0,0 +1,129 @@
+package workflow
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/domain"
+)
+
+// newShellPayload runs script with /bin/sh
+func newShellPayload(t *testing.T, script string, env map[string]string, stdin string, timeout time.Duration, maxOutputSize int64) *domain.ShellPayload {
+	t.Helper()
+	p, err := domain.NewShellPayload("/bin/sh", []string{"-c", script}, "", env, stdin, timeout, maxOutputSize, domain.ShellLimits{})
+	if err != nil {
+		t.Fatalf("failed to create shell payload: %v", err)
+	}
+	return p
+}
+
+func TestShellTaskExecutorExitCodes(t *testing.T) {
+	out, err := NewShellTaskExecutor().Execute(context.Background(), newShellPayload(t, "echo hi", nil, "", 0, 0))
+	if err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if out.ExitCode != 0 || out.Stdout != "hi\n" || out.Truncated {
+		t.Errorf("got %+v, want exit code 0 and hi", out)
+	}
+
+	// a non zero exit code fails the task and quotes stderr
+	out, err = NewShellTaskExecutor().Execute(context.Background(), newShellPayload(t, "echo partial; echo oops >&2; exit 3", nil, "", 0, 0))
+	if err == nil || err.Error() != "command exited with code 3: oops" {
+		t.Fatalf("got error %v, want the exit code and stderr", err)
+	}
+	if out == nil || out.ExitCode != 3 || out.Stdout != "partial\n" {
+		t.Errorf("got %+v, want the output kept along with exit code 3", out)
+	}
+
+	long := strings.Repeat("x", shellErrorMaxLength) + "end"
+	_, err = NewShellTaskExecutor().Execute(context.Background(), newShellPayload(t, "echo "+long+" >&2; exit 1", nil, "", 0, 0))
+	if err == nil || !strings.HasSuffix(err.Error(), "...x"+long[len(long)-shellErrorMaxLength+1:]) {
+		t.Errorf("got error %v, want the end of stderr", err)
+	}
+
+	p := newShellPayload(t, "", nil, "", 0, 0)
+	p.Command = "/does/not/exist"
+	if _, err := NewShellTaskExecutor().Execute(context.Background(), p); err == nil || !strings.Contains(err.Error(), "failed to start command") {
+		t.Errorf("got error %v, want a missing command to fail", err)
+	}
+}
+
+func TestShellTaskExecutorTruncatesOutput(t *testing.T) {
+	out, err := NewShellTaskExecutor().Execute(context.Background(), newShellPayload(t, "printf 0123456789abcdef; printf ab >&2", nil, "", 0, 10))
+	if err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if out.Stdout != "0123456789" || out.Stderr != "ab" || !out.Truncated {
+		t.Errorf("got %+v, want stdout cut at 10 bytes", out)
+	}
+
+	// output past the limit is drained, the command is not killed by a full pipe
+	out, err = NewShellTaskExecutor().Execute(context.Background(), newShellPayload(t, "head -c 1000000 /dev/zero; echo done >&2", nil, "", 0, 10))
+	if err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if len(out.Stdout) != 10 || out.Stderr != "done\n" {
+		t.Errorf("got %d bytes of stdout and stderr %q", len(out.Stdout), out.Stderr)
+	}
+}
+
+func TestShellTaskExecutorEnvAndStdin(t *testing.T) {
+	t.Setenv("SERVER_SECRET", "secret")
+	out, err := NewShellTaskExecutor().Execute(context.Background(),
+		newShellPayload(t, `cat; echo "$FOO-$SERVER_SECRET"`, map[string]string{"FOO": "bar"}, "in\n", 0, 0))
+	if err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	// the server environment besides PATH is not passed on
+	if out.Stdout != "in\nbar-\n" {
+		t.Errorf("got stdout %q", out.Stdout)
+	}
+}
+
+func TestShellTaskExecutorTimeout(t *testing.T) {
+	start := time.Now()
+	_, err := NewShellTaskExecutor().Execute(context.Background(), newShellPayload(t, "exec sleep 5", nil, "", 100*time.Millisecond, 0))
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("got error %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("the command was not killed, execute took %v", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if _, err := NewShellTaskExecutor().Execute(ctx, newShellPayload(t, "exec sleep 5", nil, "", 0, 0)); err != context.Canceled {
+		t.Errorf("got error %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestNewShellPayload(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		env     map[string]string
+		timeout time.Duration
+		maxOut  int64
+		limits  domain.ShellLimits
+	}{
+		{"empty command", "", nil, 0, 0, domain.ShellLimits{}},
+		{"placeholder in command", "{{ inputs.cmd }}", nil, 0, 0, domain.ShellLimits{}},
+		{"invalid env name", "ls", map[string]string{"A=B": "x"}, 0, 0, domain.ShellLimits{}},
+		{"invalid env placeholder", "ls", map[string]string{"A": "{{ 1 + }}"}, 0, 0, domain.ShellLimits{}},
+		{"timeout over the maximum", "ls", nil, domain.ShellMaxTimeout + time.Second, 0, domain.ShellLimits{}},
+		{"output size over the maximum", "ls", nil, 0, domain.ShellMaxOutputSize + 1, domain.ShellLimits{}},
+		{"negative CPU time", "ls", nil, 0, 0, domain.ShellLimits{CPUTime: -time.Second}},
+		{"memory under the minimum", "ls", nil, 0, 0, domain.ShellLimits{MemoryBytes: domain.ShellMinMemory - 1}},
+		{"open files under the minimum", "ls", nil, 0, 0, domain.ShellLimits{OpenFiles: domain.ShellMinOpenFiles - 1}},
+		{"root by name", "ls", nil, 0, 0, domain.ShellLimits{User: "root"}},
+		{"root by uid", "ls", nil, 0, 0, domain.ShellLimits{User: "0"}},
+		{"root by padded uid", "ls", nil, 0, 0, domain.ShellLimits{User: "00"}},
+	}
+	for _, tt := range tests {
+		if _, err := domain.NewShellPayload(tt.command, nil, "", tt.env, "", tt.timeout, tt.maxOut, tt.limits); err == nil {
+			t.Errorf("%s: expected the payload to be rejected", tt.name)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package workflow
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/domain"
+	wr "github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/repository"
+)
+
+func newSubworkflowTask(t *testing.T, name, workflowID string, inputs map[string]string, next ...*domain.Task) *domain.Task {
+	t.Helper()
+	p, err := domain.NewSubworkflowPayload(workflowID, inputs)
+	if err != nil {
+		t.Fatalf("failed to create subworkflow payload: %v", err)
+	}
+	task, err := domain.NewTask(name, domain.TaskTypeSubworkflow, 0, 0, "", domain.Join{}, "", p, next, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create task %s: %v", name, err)
+	}
+	return task
+}
+
+// createWorkflows stores the workflows in a new repository
+func createWorkflows(t *testing.T, workflows ...*domain.Workflow) *wr.MemoryRepo {
+	t.Helper()
+	repo := wr.NewMemoryRepository()
+	for _, w := range workflows {
+		if err := repo.Create(w); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+	}
+	return repo
+}
+
+// executionsOf returns the executions of a workflow, most recent first
+func executionsOf(t *testing.T, s Service, workflowID string) []*domain.Execution {
+	t.Helper()
+	executions, _, err := s.ListExecutions(domain.ExecutionFilter{WorkflowID: workflowID, PageSize: domain.ExecutionMaxPageSize})
+	if err != nil {
+		t.Fatalf("list executions: %v", err)
+	}
+	return executions
+}
+
+func TestSubworkflowReturnsChildOutputs(t *testing.T) {
+	child := newTestWorkflow(t, newLogTask(t, "hello", 0, 0))
+	sub := newSubworkflowTask(t, "sub", child.ID, nil)
+	parent := newTestWorkflow(t, sub)
+	s := newServiceOn(createWorkflows(t, child, parent), &flakyTaskExecutor{})
+
+	if err := s.Execute(context.Background(), parent.ID, nil, make(chan *domain.ExecutionEvent, 10)); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	e := executionsOf(t, s, parent.ID)[0]
+	out, ok := e.Tasks[sub.ID].Output.(*domain.SubworkflowResult)
+	if !ok || out.Status != domain.WorkflowStatusCompleted || out.Outputs["hello"] != "hello" {
+		t.Fatalf("got output %#v, want the completed child outputs", e.Tasks[sub.ID].Output)
+	}
+	children := executionsOf(t, s, child.ID)
+	if len(children) != 1 || children[0].ID != out.ExecutionID {
+		t.Fatalf("got %d child executions, want the one in the output", len(children))
+	}
+	if c := children[0]; c.ParentExecutionID != e.ID || c.ParentTaskID != sub.ID || c.Depth != 1 {
+		t.Errorf("got parent %s, task %s and depth %d, want %s, %s and 1", c.ParentExecutionID, c.ParentTaskID, c.Depth, e.ID, sub.ID)
+	}
+}
+
+func TestSubworkflowDepthIsLimited(t *testing.T) {
+	// a workflow that runs itself only stops at the depth limit
+	self := newSubworkflowTask(t, "self", "pending", nil)
+	w := newTestWorkflow(t, self)
+	self.Payload.(*domain.SubworkflowPayload).WorkflowID = w.ID
+	s := newServiceOn(createWorkflows(t, w), &flakyTaskExecutor{})
+
+	err := s.Execute(context.Background(), w.ID, nil, make(chan *domain.ExecutionEvent, 10))
+	if err == nil || !strings.Contains(err.Error(), "nested more than") {
+		t.Fatalf("got error %v, want the depth limit to stop the recursion", err)
+	}
+	executions := executionsOf(t, s, w.ID)
+	if len(executions) != domain.SubworkflowMaxDepth+1 {
+		t.Errorf("got %d executions, want one per level up to %d", len(executions), domain.SubworkflowMaxDepth)
+	}
+	for _, e := range executions {
+		if e.Status != domain.WorkflowStatusFailed {
+			t.Errorf("execution at depth %d: got status %s, want %s", e.Depth, e.Status, domain.WorkflowStatusFailed)
+		}
+	}
+}
+
+func TestCancelPropagatesToChildExecutions(t *testing.T) {
+	child := newTestWorkflow(t, newLogTask(t, "block", 0, 0))
+	parent := newTestWorkflow(t, newSubworkflowTask(t, "sub", child.ID, nil))
+	s := newServiceOn(createWorkflows(t, child, parent), &blockingTaskExecutor{release: make(chan struct{})})
+
+	e, err := s.Start(parent.ID, nil)
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(executionsOf(t, s, child.ID)) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("the child execution never started")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cause, err := domain.NewCancelError("stop")
+	if err != nil {
+		t.Fatalf("cancel error: %v", err)
+	}
+	if e, err = s.Cancel(context.Background(), e.ID, cause); err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+	if e.Status != domain.WorkflowStatusCancelled {
+		t.Errorf("got parent status %s, want %s", e.Status, domain.WorkflowStatusCancelled)
+	}
+	// the parent only finishes once its child has stopped
+	if c := executionsOf(t, s, child.ID)[0]; c.Status != domain.WorkflowStatusCancelled {
+		t.Errorf("got child status %s, want %s", c.Status, domain.WorkflowStatusCancelled)
+	}
+}
@@ -0,0 +1,96 @@
+package workflow
+
+import (
+	"context"
+	"testing"
+
+	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/domain"
+)
+
+// newSwitchTask switches on the color input between its next tasks
+func newSwitchTask(t *testing.T, defaultNext string, next ...*domain.Task) *domain.Task {
+	t.Helper()
+	p, err := domain.NewSwitchPayload([]domain.SwitchCase{
+		{When: `inputs.color == "red"`, Next: "red"},
+		{When: `inputs.color in ["red", "green"]`, Next: "green"},
+	}, defaultNext)
+	if err != nil {
+		t.Fatalf("failed to create switch payload: %v", err)
+	}
+	task, err := domain.NewTask("switch", domain.TaskTypeSwitch, 0, 0, "", domain.Join{}, "", p, next, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+	return task
+}
+
+func TestSwitchFollowsOneBranch(t *testing.T) {
+	tests := []struct {
+		color    string
+		want     string
+		wantCase int
+	}{
+		// cases are evaluated in order, the first match wins
+		{"red", "red", 0},
+		{"green", "green", 1},
+		{"blue", "other", -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.color, func(t *testing.T) {
+			branches := map[string]*domain.Task{
+				"red":   newLogTask(t, "red", 0, 0),
+				"green": newLogTask(t, "green", 0, 0),
+				"other": newLogTask(t, "other", 0, 0),
+			}
+			sw := newSwitchTask(t, "other", branches["red"], branches["green"], branches["other"])
+			e, _, err := newTestExecutor(&flakyTaskExecutor{}).run(context.Background(), newTestWorkflow(t, sw), map[string]interface{}{"color": tt.color})
+			if err != nil {
+				t.Fatalf("execute: %v", err)
+			}
+			out, ok := e.Tasks[sw.ID].Output.(*domain.SwitchResult)
+			if !ok || out.Case != tt.wantCase || out.Branch != tt.want {
+				t.Fatalf("got output %#v, want case %d and branch %s", e.Tasks[sw.ID].Output, tt.wantCase, tt.want)
+			}
+			for name, task := range branches {
+				want := domain.TaskStatusSkipped
+				if name == tt.want {
+					want = domain.TaskStatusCompleted
+				}
+				assertTaskStatus(t, e, task, want)
+			}
+		})
+	}
+}
+
+func TestSwitchWithoutDefaultSkipsEveryBranch(t *testing.T) {
+	after := newLogTask(t, "after", 0, 0)
+	red := newLogTask(t, "red", 0, 0, after)
+	green := newLogTask(t, "green", 0, 0)
+	sw := newSwitchTask(t, "", red, green)
+	e, _, err := newTestExecutor(&flakyTaskExecutor{}).run(context.Background(), newTestWorkflow(t, sw), map[string]interface{}{"color": "blue"})
+	if err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	assertTaskStatus(t, e, sw, domain.TaskStatusCompleted)
+	// skipping a branch skips the tasks after it
+	for _, task := range []*domain.Task{red, green, after} {
+		assertTaskStatus(t, e, task, domain.TaskStatusSkipped)
+	}
+}
+
+func TestSwitchBranch(t *testing.T) {
+	tests := []struct {
+		output interface{}
+		want   string
+	}{
+		{&domain.SwitchResult{Case: 0, Branch: "red"}, "red"},
+		// outputs of executions loaded from the repository are decoded JSON
+		{map[string]interface{}{"case": 1.0, "branch": "green"}, "green"},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		if got := switchBranch(tt.output); got != tt.want {
+			t.Errorf("switchBranch(%#v) = %q, want %q", tt.output, got, tt.want)
+		}
+	}
+}
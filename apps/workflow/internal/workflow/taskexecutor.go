@@ -14,43 +14,62 @@ type TaskExecutor interface {
 }
 
 type taskExecutor struct {
-	// httpExecutor HTTPTaskExecutor TODO: Add HTTPTaskExecutor
+	httpExecutor      HTTPTaskExecutor
+	shellExecutor     ShellTaskExecutor
+	transformExecutor TransformTaskExecutor
 	// logExecutor  LogTaskExecutor TODO: Add LogTaskExecutor
 }
 
 func NewTaskExecutor() TaskExecutor {
 	return &taskExecutor{
-		// httpExecutor: NewHTTPTaskExecutor(), TODO: Add HTTPTaskExecutor
+		httpExecutor:      NewHTTPTaskExecutor(),
+		shellExecutor:     NewShellTaskExecutor(),
+		transformExecutor: NewTransformTaskExecutor(),
 		// logExecutor:  NewLogTaskExecutor(),  TODO: Add LogTaskExecutor
 	}
 }
 
 func (te *taskExecutor) Execute(ctx context.Context, t *domain.Task) (interface{}, error) {
-	t.Status = domain.TaskStatusRunning
-
 	var err error
 	var output interface{}
 	switch t.Type {
 	case domain.TaskTypeHTTP:
-		return nil, fmt.Errorf("HTTP task executor not implemented yet")
+		httpPayload, ok := t.Payload.(*domain.HTTPPayload)
+		if !ok {
+			err = fmt.Errorf("invalid payload type for HTTP task")
+		} else {
+			output, err = te.httpExecutor.Execute(ctx, httpPayload)
+		}
+	case domain.TaskTypeShell:
+		shellPayload, ok := t.Payload.(*domain.ShellPayload)
+		if !ok {
+			err = fmt.Errorf("invalid payload type for SHELL task")
+		} else {
+			output, err = te.shellExecutor.Execute(ctx, shellPayload)
+		}
+	case domain.TaskTypeTransform:
+		transformPayload, ok := t.Payload.(*domain.TransformPayload)
+		if !ok {
+			err = fmt.Errorf("invalid payload type for TRANSFORM task")
+		} else {
+			output, err = te.transformExecutor.Execute(ctx, transformPayload)
+		}
 	case domain.TaskTypeLog:
 		logPayload, ok := t.Payload.(*domain.LogPayload)
 		if !ok {
 			err = fmt.Errorf("invalid payload type for LOG task")
 		} else {
 			randomSeconds := rand.Intn(3)
-			time.Sleep(time.Duration(randomSeconds) * time.Second)
-			output = logPayload.Message
+			if err = sleep(ctx, time.Duration(randomSeconds)*time.Second); err == nil {
+				output = logPayload.Message
+			}
 		}
 	default:
 		err = fmt.Errorf("unknown task type: %v", t.Type)
 	}
 
 	if err != nil {
-		t.Status = domain.TaskStatusFailed
 		return nil, err
-	} else {
-		t.Status = domain.TaskStatusCompleted
 	}
 	return output, nil
 }
@@ -0,0 +1,49 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/domain"
+	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/expression"
+)
+
+// transformTimeout bounds a single query, transforms only reshape data so
+// anything slower is a runaway query
+const transformTimeout = 5 * time.Second
+
+type TransformTaskExecutor interface {
+	Execute(ctx context.Context, p *domain.TransformPayload) (interface{}, error)
+}
+
+type transformTaskExecutor struct{}
+
+func NewTransformTaskExecutor() TransformTaskExecutor {
+	return &transformTaskExecutor{}
+}
+
+func (tf *transformTaskExecutor) Execute(ctx context.Context, p *domain.TransformPayload) (interface{}, error) {
+	query, err := expression.CompileJQ(p.Query)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, transformTimeout)
+	defer cancel()
+	results, err := query.Eval(ctx, p.Input)
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("query timed out after %v", transformTimeout)
+		}
+		return nil, err
+	}
+	switch len(results) {
+	case 0:
+		return nil, nil
+	case 1:
+		return results[0], nil
+	default:
+		return results, nil
+	}
+}
@@ -0,0 +1,51 @@
+package workflow
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/domain"
+	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/expression"
+)
+
+func TestTransformTaskExecutor(t *testing.T) {
+	vars := map[string]interface{}{
+		expression.VarInputs: map[string]interface{}{"min": 2.0},
+		expression.VarUpstream: map[string]interface{}{
+			"fetch": map[string]interface{}{"output": []interface{}{1.0, 2.0, 3.0}},
+		},
+	}
+	tests := []struct {
+		query string
+		want  interface{}
+	}{
+		// a single result is the output as is
+		{".inputs.min as $min | [.upstream.fetch.output[] | select(. >= $min)] | length", 2},
+		{".upstream.fetch.output | add", 6.0},
+		// no results give null and several give an array
+		{".upstream.fetch.output[] | select(. > 5)", nil},
+		{".upstream.fetch.output[] | . * 10", []interface{}{10.0, 20.0, 30.0}},
+	}
+	for _, tt := range tests {
+		p, err := domain.NewTransformPayload(tt.query)
+		if err != nil {
+			t.Fatalf("failed to create transform payload %q: %v", tt.query, err)
+		}
+		rendered, err := renderPayload(context.Background(), p, vars)
+		if err != nil {
+			t.Fatalf("render %q: %v", tt.query, err)
+		}
+		got, err := NewTransformTaskExecutor().Execute(context.Background(), rendered.(*domain.TransformPayload))
+		if err != nil {
+			t.Fatalf("execute %q: %v", tt.query, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got %#v, want %#v", tt.query, got, tt.want)
+		}
+	}
+
+	if _, err := domain.NewTransformPayload(".a | foo"); err == nil {
+		t.Errorf("expected an invalid query to be rejected")
+	}
+}
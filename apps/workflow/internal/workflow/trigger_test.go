@@ -0,0 +1,156 @@
+package workflow
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/domain"
+)
+
+// recordingTriggerStarter records the executions completion triggers start
+type recordingTriggerStarter struct {
+	mu      sync.Mutex
+	started []*domain.Execution
+	inputs  []map[string]interface{}
+}
+
+func (rs *recordingTriggerStarter) StartTriggered(parent *domain.Execution, workflowID string, inputs map[string]interface{}) (*domain.Execution, error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	e := &domain.Execution{ID: workflowID, WorkflowID: workflowID, TriggeredBy: parent.ID, TriggerChain: parent.NextTriggerChain()}
+	rs.started = append(rs.started, e)
+	rs.inputs = append(rs.inputs, inputs)
+	return e, nil
+}
+
+func TestExecuteFiresCompletionTriggers(t *testing.T) {
+	te := newTestExecutor(&flakyTaskExecutor{})
+	rs := &recordingTriggerStarter{}
+	te.SetTriggerStarter(rs)
+
+	source := newTestWorkflow(t, newLogTask(t, "a", 0, 0))
+	outputs, err := domain.NewInput(domain.TriggerInputOutputs, domain.InputTypeObject, false, nil, "")
+	if err != nil {
+		t.Fatalf("new input: %v", err)
+	}
+	target := newTestWorkflow(t, newLogTask(t, "b", 0, 0))
+	target.Inputs = []*domain.Input{outputs}
+	onFailure := newTestWorkflow(t, newLogTask(t, "c", 0, 0))
+	for _, w := range []*domain.Workflow{source, target, onFailure} {
+		if err := te.repo.Create(w); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+	}
+	for _, tr := range []struct {
+		target string
+		on     domain.WorklowStatus
+		inputs map[string]string
+	}{
+		{target.ID, domain.WorkflowStatusCompleted, map[string]string{"message": "tasks.a.output + '!'"}},
+		{onFailure.ID, domain.WorkflowStatusFailed, nil},
+	} {
+		trigger, err := domain.NewCompletionTrigger(source.ID, tr.target, []domain.WorklowStatus{tr.on}, tr.inputs)
+		if err != nil {
+			t.Fatalf("new trigger: %v", err)
+		}
+		if err := te.repo.CreateTrigger(trigger); err != nil {
+			t.Fatalf("create trigger: %v", err)
+		}
+	}
+
+	e, _, err := te.run(context.Background(), source, nil)
+	if err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if len(rs.started) != 1 {
+		t.Fatalf("got %d triggered executions, want 1", len(rs.started))
+	}
+	if got := rs.started[0]; got.WorkflowID != target.ID || got.TriggeredBy != e.ID {
+		t.Errorf("got execution of %s triggered by %s, want %s triggered by %s", got.WorkflowID, got.TriggeredBy, target.ID, e.ID)
+	}
+	inputs := rs.inputs[0]
+	if inputs["message"] != "a!" {
+		t.Errorf("got message %v, want a!", inputs["message"])
+	}
+	// the target declares the outputs input, it gets the outputs by task name
+	if got, ok := inputs[domain.TriggerInputOutputs].(map[string]interface{}); !ok || got["a"] != "a" {
+		t.Errorf("got outputs %v, want map[a:a]", inputs[domain.TriggerInputOutputs])
+	}
+}
+
+func TestExecuteStopsTriggerLoops(t *testing.T) {
+	te := newTestExecutor(&flakyTaskExecutor{})
+	rs := &recordingTriggerStarter{}
+	te.SetTriggerStarter(rs)
+	a := newTestWorkflow(t, newLogTask(t, "a", 0, 0))
+	b := newTestWorkflow(t, newLogTask(t, "b", 0, 0))
+	for _, w := range []*domain.Workflow{a, b} {
+		if err := te.repo.Create(w); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+	}
+	// stored directly, the service rejects it when it would close a loop
+	trigger, err := domain.NewCompletionTrigger(a.ID, b.ID, nil, nil)
+	if err != nil {
+		t.Fatalf("new trigger: %v", err)
+	}
+	if err := te.repo.CreateTrigger(trigger); err != nil {
+		t.Fatalf("create trigger: %v", err)
+	}
+
+	// a run of a that b started does not start b again
+	e := domain.NewExecution(a, nil)
+	e.TriggeredBy, e.TriggerChain = "eb", []string{b.ID}
+	if err := te.repo.CreateExecution(e); err != nil {
+		t.Fatalf("create execution: %v", err)
+	}
+	eventCh := make(chan *domain.ExecutionEvent, 10)
+	if err := te.Execute(context.Background(), a, e, eventCh); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if len(rs.started) != 0 {
+		t.Errorf("got %d triggered executions, want the loop to stop", len(rs.started))
+	}
+}
+
+func TestServiceRejectsTriggerLoops(t *testing.T) {
+	s, a := newTestService(t, &flakyTaskExecutor{}, newLogTask(t, "a", 0, 0))
+	b, err := s.Create(newTestWorkflow(t, newLogTask(t, "b", 0, 0)))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	for _, pair := range [][2]string{{a.ID, b.ID}, {b.ID, a.ID}} {
+		trigger, err := domain.NewCompletionTrigger(pair[0], pair[1], nil, nil)
+		if err != nil {
+			t.Fatalf("new trigger: %v", err)
+		}
+		_, err = s.CreateTrigger(trigger)
+		if first := pair[0] == a.ID; first != (err == nil) {
+			t.Errorf("trigger %s to %s: got %v", pair[0], pair[1], err)
+		}
+	}
+
+	// the run of a starts b, which finishes without starting a again
+	if err := s.Execute(context.Background(), a.ID, nil, make(chan *domain.ExecutionEvent, 10)); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		executions, _, err := s.ListExecutions(domain.ExecutionFilter{WorkflowID: b.ID, Status: domain.WorkflowStatusCompleted})
+		if err != nil {
+			t.Fatalf("list executions: %v", err)
+		}
+		if len(executions) == 1 {
+			if executions[0].TriggeredBy == "" {
+				t.Errorf("got an execution of b not triggered by a")
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got no completed execution of b")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,117 @@
+package workflow
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/luis12loureiro/neurun/apps/workflow/internal/workflow/domain"
+)
+
+// newTestWebhook adds a webhook to the workflow
+func newTestWebhook(t *testing.T, s Service, w *domain.Workflow, mode domain.WebhookMode, secret string) *domain.Webhook {
+	t.Helper()
+	wh, err := domain.NewWebhook(w.ID, mode, secret)
+	if err != nil {
+		t.Fatalf("new webhook: %v", err)
+	}
+	if _, err := s.CreateWebhook(wh); err != nil {
+		t.Fatalf("create webhook: %v", err)
+	}
+	return wh
+}
+
+func TestTriggerWebhookChecksTokenAndSignature(t *testing.T) {
+	const secret = "0123456789abcdef"
+	s, w := newTestService(t, &flakyTaskExecutor{}, newLogTask(t, "a", 0, 0))
+	wh := newTestWebhook(t, s, w, domain.WebhookModeSync, secret)
+	body := []byte(`{}`)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	tests := []struct {
+		name string
+		call domain.WebhookCall
+		want error
+	}{
+		{"unknown workflow", domain.WebhookCall{WorkflowID: "missing", Token: wh.Token, Signature: signature}, domain.ErrWebhookNotFound},
+		{"wrong token", domain.WebhookCall{WorkflowID: w.ID, Token: "wrong", Signature: signature}, domain.ErrWebhookNotFound},
+		{"unsigned", domain.WebhookCall{WorkflowID: w.ID, Token: wh.Token}, domain.ErrWebhookSignature},
+		{"signed", domain.WebhookCall{WorkflowID: w.ID, Token: wh.Token, Signature: signature}, nil},
+	}
+	for _, tt := range tests {
+		tt.call.Body = body
+		if _, err := s.TriggerWebhook(context.Background(), &tt.call); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestTriggerWebhookModes(t *testing.T) {
+	te := &blockingTaskExecutor{release: make(chan struct{})}
+	s, w := newTestService(t, te, newLogTask(t, "a", 0, 0))
+
+	// async calls return as soon as the run starts
+	async := newTestWebhook(t, s, w, domain.WebhookModeAsync, "")
+	e, err := s.TriggerWebhook(context.Background(), &domain.WebhookCall{WorkflowID: w.ID, Token: async.Token})
+	if err != nil {
+		t.Fatalf("trigger async: %v", err)
+	}
+	if !e.EndedAt.IsZero() {
+		t.Errorf("got a finished execution from an async webhook")
+	}
+
+	// sync calls wait for the run, a caller that goes away does not stop it
+	sync := newTestWebhook(t, s, w, domain.WebhookModeSync, "")
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := s.TriggerWebhook(ctx, &domain.WebhookCall{WorkflowID: w.ID, Token: sync.Token}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+	close(te.release)
+	e, err = s.TriggerWebhook(context.Background(), &domain.WebhookCall{WorkflowID: w.ID, Token: sync.Token})
+	if err != nil {
+		t.Fatalf("trigger sync: %v", err)
+	}
+	if e.Status != domain.WorkflowStatusCompleted || e.EndedAt.IsZero() {
+		t.Errorf("got status %s, want a finished %s", e.Status, domain.WorkflowStatusCompleted)
+	}
+
+	// all three runs complete
+	deadline := time.Now().Add(time.Second)
+	for {
+		executions, _, err := s.ListExecutions(domain.ExecutionFilter{Status: domain.WorkflowStatusCompleted})
+		if err != nil {
+			t.Fatalf("list executions: %v", err)
+		}
+		if len(executions) == 3 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d completed executions, want 3", len(executions))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestTriggerWebhookRejectsInvalidInputs(t *testing.T) {
+	s, w := newTestService(t, &flakyTaskExecutor{}, newLogTask(t, "a", 0, 0))
+	in, err := domain.NewInput(domain.WebhookInputBody, domain.InputTypeObject, true, nil, "")
+	if err != nil {
+		t.Fatalf("new input: %v", err)
+	}
+	w.Inputs = []*domain.Input{in}
+	if _, err := s.Update(w); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	wh := newTestWebhook(t, s, w, domain.WebhookModeAsync, "")
+	call := &domain.WebhookCall{WorkflowID: w.ID, Token: wh.Token, Body: []byte("not json")}
+	if _, err := s.TriggerWebhook(context.Background(), call); !errors.Is(err, domain.ErrWebhookBadRequest) {
+		t.Errorf("got %v, want %v", err, domain.ErrWebhookBadRequest)
+	}
+}
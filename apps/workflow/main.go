@@ -6,6 +6,7 @@ import (
 	"log"
 	"net"
 	"net/http"
+	"strings"
 
 	"github.com/improbable-eng/grpc-web/go/grpcweb"
 	pb "github.com/luis12loureiro/neurun/apps/workflow/gen"
@@ -21,27 +22,47 @@ var (
 
 func main() {
 	flag.Parse()
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run serves until the server fails, errors are returned rather than
+// logged fatally so the deferred cleanups still run
+func run() error {
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", *port))
 	if err != nil {
-		log.Fatalf("failed to listen: %v", err)
+		return fmt.Errorf("failed to listen: %w", err)
 	}
 
 	s := grpc.NewServer()
 	// repo, err := wr.NewSQLiteRepository("./internal/workflow/repository/storage", "data.sqlite")
 	// if err != nil {
-	// 	log.Fatalf("failed to create repository: %v", err)
+	// 	return fmt.Errorf("failed to create repository: %w", err)
 	// }
-	// defer func() {
-	// 	if sqliteRepo, ok := repo.(*wr.SQLiteRepo); ok {
-	// 		sqliteRepo.Close()
-	// 	}
-	// }()
+	// defer repo.Close()
 	repo := wr.NewMemoryRepository()
 	te := ws.NewTaskExecutor()
-	we := ws.NewWorkflowExecutor(repo, te)
-	svc := ws.NewService(repo, we)
+	we := ws.NewWorkflowExecutor(repo, repo, repo, te)
+	sched := ws.NewScheduler(repo)
+	fwr := ws.NewFileWatcher(repo, repo)
+	svc := ws.NewService(repo, repo, repo, repo, repo, repo, we, sched, fwr)
+	we.SetTriggerStarter(svc)
+	we.SetSubworkflowRunner(svc)
+	if err := svc.Recover(); err != nil {
+		return fmt.Errorf("failed to recover executions: %w", err)
+	}
+	if err := sched.Start(svc); err != nil {
+		return fmt.Errorf("failed to start scheduler: %w", err)
+	}
+	defer sched.Stop()
+	if err := fwr.Start(svc); err != nil {
+		return fmt.Errorf("failed to start file watcher: %w", err)
+	}
+	defer fwr.Stop()
 	handler := wh.NewServer(svc)
 	pb.RegisterWorkflowServiceServer(s, handler)
+	webhookHandler := wh.NewWebhookHandler(svc)
 
 	// Wrap gRPC server with gRPC-Web
 	grpcWebServer := grpcweb.WrapServer(s,
@@ -71,6 +92,12 @@ func main() {
 				return
 			}
 
+			// Inbound webhook calls
+			if strings.HasPrefix(req.URL.Path, "/hooks/") {
+				webhookHandler.ServeHTTP(resp, req)
+				return
+			}
+
 			// If not recognized
 			http.NotFound(resp, req)
 		}),
@@ -78,6 +105,7 @@ func main() {
 
 	log.Printf("gRPC-Web server listening at %v", lis.Addr())
 	if err := httpServer.Serve(lis); err != nil {
-		log.Fatalf("failed to serve: %v", err)
+		return fmt.Errorf("failed to serve: %w", err)
 	}
+	return nil
 }